@@ -0,0 +1,239 @@
+// agent/bitrix24/address.go
+package bitrix24
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"saas-sync-platform/internal/shared"
+)
+
+// CRM entity type IDs used by requisites and addresses
+const (
+	entityTypeContact   = 3
+	entityTypeRequisite = 8
+)
+
+// Bitrix24 address type IDs (crm.address.getTypes) of the Sage address
+// types
+const (
+	AddressTypeLegal    = 6
+	AddressTypeDelivery = 11
+)
+
+// addressTypeIDs maps Sage address types to Bitrix24 address type IDs
+var addressTypeIDs = map[string]int{
+	shared.AddressFiscal:   AddressTypeLegal,
+	shared.AddressDelivery: AddressTypeDelivery,
+}
+
+// AddressPayload returns the requisites and addresses written to Bitrix24
+// for the addresses of a customer, keyed by requisite XML_ID and address
+// type ID. A requisite holds at most one address of each type, so the
+// first requisite takes the fiscal and the first delivery address and every
+// further delivery address gets a requisite of its own.
+func (c *Client) AddressPayload(customer *shared.Customer, addresses []shared.Address) map[string]interface{} {
+	requisites := make(map[string]interface{})
+	slots := make(map[int]int)
+
+	for _, address := range addresses {
+		typeID, ok := addressTypeIDs[address.Type]
+		if !ok {
+			continue
+		}
+		slot := slots[typeID]
+		slots[typeID]++
+
+		xmlID := requisiteXMLID(customer.Code, slot)
+		requisite, ok := requisites[xmlID].(map[string]interface{})
+		if !ok {
+			name := customer.Name
+			if slot > 0 && address.Name != "" {
+				name += " - " + address.Name
+			}
+			requisite = map[string]interface{}{"NAME": name, "ADDRESSES": map[string]interface{}{}}
+			requisites[xmlID] = requisite
+		}
+		requisite["ADDRESSES"].(map[string]interface{})[strconv.Itoa(typeID)] = addressFields(address)
+	}
+
+	return requisites
+}
+
+// addressFields converts a Sage address to crm.address fields
+func addressFields(address shared.Address) map[string]interface{} {
+	return map[string]interface{}{
+		"ADDRESS_1":   address.Line1,
+		"ADDRESS_2":   address.Line2,
+		"CITY":        address.City,
+		"POSTAL_CODE": address.PostalCode,
+		"PROVINCE":    address.Region,
+		"COUNTRY":     address.Country,
+	}
+}
+
+// SyncAddresses writes the addresses of a customer as requisite addresses
+// of its contact. Requisites the sync created are found again by XML_ID;
+// requisites and addresses no longer in Sage are deleted, while those
+// added by hand in Bitrix24 are left alone.
+func (c *Client) SyncAddresses(contactID string, customer *shared.Customer, addresses []shared.Address) error {
+	desired := c.AddressPayload(customer, addresses)
+
+	existing, err := c.ListAll("crm.requisite.list", ListParams{
+		Filter: map[string]interface{}{"ENTITY_TYPE_ID": entityTypeContact, "ENTITY_ID": contactID},
+		Select: []string{"ID", "XML_ID"},
+	})
+	if err != nil {
+		return err
+	}
+
+	prefix := requisiteXMLID(customer.Code, 0)
+	requisites := make(map[string]string)
+	for _, record := range existing {
+		xmlID := formatFieldValue(record["XML_ID"])
+		if xmlID == prefix || strings.HasPrefix(xmlID, prefix+":") {
+			requisites[xmlID] = RecordID(record)
+		}
+	}
+
+	xmlIDs := make([]string, 0, len(desired))
+	for xmlID := range desired {
+		xmlIDs = append(xmlIDs, xmlID)
+	}
+	sort.Strings(xmlIDs)
+
+	for _, xmlID := range xmlIDs {
+		requisite := desired[xmlID].(map[string]interface{})
+		requisiteID, ok := requisites[xmlID]
+		if !ok {
+			requisiteID, err = c.saveRecord("requisite", "", map[string]interface{}{
+				"ENTITY_TYPE_ID": entityTypeContact,
+				"ENTITY_ID":      contactID,
+				"PRESET_ID":      c.config.RequisitePresetID(),
+				"NAME":           requisite["NAME"],
+				"XML_ID":         xmlID,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := c.syncRequisiteAddresses(requisiteID, requisite["ADDRESSES"].(map[string]interface{})); err != nil {
+			return fmt.Errorf("requisite %s: %w", requisiteID, err)
+		}
+	}
+
+	for xmlID, requisiteID := range requisites {
+		if _, keep := desired[xmlID]; keep {
+			continue
+		}
+		if err := c.deleteRecord("requisite", requisiteID); err != nil {
+			return err
+		}
+	}
+
+	c.logger.Info("Synced Bitrix24 addresses", "customer_code", customer.Code,
+		"contact_id", contactID, "addresses", len(addresses), "requisites", len(desired))
+	return nil
+}
+
+// syncRequisiteAddresses adds, updates and deletes the addresses of one
+// requisite so those of the Sage address types match desired
+func (c *Client) syncRequisiteAddresses(requisiteID string, desired map[string]interface{}) error {
+	current, err := c.ListAll("crm.address.list", ListParams{
+		Filter: map[string]interface{}{"ENTITY_TYPE_ID": entityTypeRequisite, "ENTITY_ID": requisiteID},
+		Order:  map[string]string{"TYPE_ID": "ASC"},
+	})
+	if err != nil {
+		return err
+	}
+
+	existing := make(map[string]map[string]interface{})
+	for _, record := range current {
+		existing[formatFieldValue(record["TYPE_ID"])] = record
+	}
+
+	for typeID, raw := range desired {
+		fields := raw.(map[string]interface{})
+		method := "crm.address.add"
+		if record, ok := existing[typeID]; ok {
+			if sameAddress(record, fields) {
+				continue
+			}
+			method = "crm.address.update"
+		}
+		if err := c.addressCall(method, requisiteID, typeID, fields); err != nil {
+			return err
+		}
+	}
+
+	for _, typeID := range addressTypeIDs {
+		key := strconv.Itoa(typeID)
+		if _, ok := existing[key]; !ok {
+			continue
+		}
+		if _, keep := desired[key]; keep {
+			continue
+		}
+		if err := c.addressCall("crm.address.delete", requisiteID, key, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addressCall runs a crm.address method. Addresses have no ID of their
+// own; they are identified by type and requisite.
+func (c *Client) addressCall(method, requisiteID, typeID string, fields map[string]interface{}) error {
+	data := map[string]interface{}{
+		"TYPE_ID":        typeID,
+		"ENTITY_TYPE_ID": entityTypeRequisite,
+		"ENTITY_ID":      requisiteID,
+	}
+	for key, value := range fields {
+		data[key] = value
+	}
+
+	var response APIResponse
+	if err := c.makeRequest(method, map[string]interface{}{"fields": data}, &response); err != nil {
+		return fmt.Errorf("%s failed for requisite %s: %w", method, requisiteID, err)
+	}
+	if response.Error != nil {
+		return response.Error
+	}
+	return nil
+}
+
+// deleteRecord deletes a CRM record
+func (c *Client) deleteRecord(entity, id string) error {
+	var response APIResponse
+	if err := c.makeRequest("crm."+entity+".delete", map[string]interface{}{"id": id}, &response); err != nil {
+		return fmt.Errorf("failed to delete %s %s: %w", entity, id, err)
+	}
+	if response.Error != nil {
+		return response.Error
+	}
+	return nil
+}
+
+// sameAddress reports whether a listed address already holds fields
+func sameAddress(current, fields map[string]interface{}) bool {
+	for key, value := range fields {
+		if strings.TrimSpace(formatFieldValue(current[key])) != strings.TrimSpace(formatFieldValue(value)) {
+			return false
+		}
+	}
+	return true
+}
+
+// requisiteXMLID identifies the requisites created for a customer: the
+// first is "sage:<code>", further ones "sage:<code>:<n>"
+func requisiteXMLID(customerCode string, slot int) string {
+	if slot == 0 {
+		return "sage:" + customerCode
+	}
+	return fmt.Sprintf("sage:%s:%d", customerCode, slot)
+}
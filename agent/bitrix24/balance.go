@@ -0,0 +1,58 @@
+// agent/bitrix24/balance.go
+package bitrix24
+
+import (
+	"saas-sync-platform/internal/shared"
+)
+
+// SyncsBalances reports whether balance fields are configured
+func (c *Client) SyncsBalances() bool {
+	return c.config.Balances.Enabled()
+}
+
+// BalancePayload returns the custom fields written for the balance of a
+// customer, keyed by the configured field names. Amounts are rounded to
+// cents; the risk status is written through RiskValues when mapped.
+func (c *Client) BalancePayload(balance *shared.CustomerBalance) map[string]interface{} {
+	names := c.config.Balances
+	if !names.Enabled() {
+		return nil
+	}
+
+	fields := make(map[string]interface{})
+	for name, value := range map[string]float64{
+		names.Balance:     balance.Balance,
+		names.Overdue:     balance.Overdue,
+		names.CreditLimit: balance.CreditLimit,
+	} {
+		if name != "" {
+			fields[name] = roundCents(value)
+		}
+	}
+
+	if names.Risk != "" {
+		risk := balance.Risk()
+		if value, ok := names.RiskValues[risk]; ok {
+			fields[names.Risk] = value
+		} else {
+			fields[names.Risk] = risk
+		}
+	}
+
+	return fields
+}
+
+// UpdateCustomerFields writes custom fields, such as those of the balance
+// or tariff of a customer, to its contact and, when companyID is not
+// empty, to its company
+func (c *Client) UpdateCustomerFields(contactID, companyID string, fields map[string]interface{}) error {
+	if _, err := c.saveRecord("contact", contactID, fields); err != nil {
+		return err
+	}
+	if companyID != "" {
+		if _, err := c.saveRecord("company", companyID, fields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+// agent/bitrix24/bitrix24test/address.go
+package bitrix24test
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// requisiteEntityType is the ENTITY_TYPE_ID of addresses owned by
+// requisites.
+const requisiteEntityType = "8"
+
+// Addresses returns copies of the addresses of a requisite ordered by
+// TYPE_ID.
+func (s *Server) Addresses(requisiteID string) []map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var addresses []map[string]interface{}
+	for _, address := range s.addresses {
+		if address["ENTITY_TYPE_ID"] == requisiteEntityType && address["ENTITY_ID"] == requisiteID {
+			addresses = append(addresses, copyRecord(address))
+		}
+	}
+	sortAddresses(addresses)
+	return addresses
+}
+
+// address implements crm.address.add, .update, .delete and .list.
+// Addresses have no ID; like the real API they are identified by TYPE_ID,
+// ENTITY_TYPE_ID and ENTITY_ID, and a requisite holds at most one address
+// of each type. The caller must hold s.mu.
+func (s *Server) address(op string, params map[string]interface{}) (interface{}, error) {
+	if op == "list" {
+		filter, _ := params["filter"].(map[string]interface{})
+		items := []map[string]interface{}{}
+		for _, address := range s.addresses {
+			if matchesFilter(address, filter) {
+				items = append(items, copyRecord(address))
+			}
+		}
+		sortAddresses(items)
+		return listPage{Items: items, Total: len(items)}, nil
+	}
+
+	fields, _ := params["fields"].(map[string]interface{})
+	key := addressKey(fields)
+	if key == "" {
+		return nil, &Error{Status: http.StatusBadRequest, Code: "", Description: "The parameters TYPE_ID, ENTITY_TYPE_ID and ENTITY_ID are required."}
+	}
+	existing, exists := s.addresses[key]
+
+	switch op {
+	case "add":
+		if exists {
+			return nil, &Error{Status: http.StatusBadRequest, Code: "", Description: "Address already exists."}
+		}
+		if toString(fields["ENTITY_TYPE_ID"]) == requisiteEntityType {
+			if _, err := s.store("requisite").find(fields["ENTITY_ID"]); err != nil {
+				return nil, err
+			}
+		}
+		address := make(map[string]interface{}, len(fields))
+		for name, value := range fields {
+			address[strings.ToUpper(name)] = toString(value)
+		}
+		s.addresses[key] = address
+	case "update":
+		if !exists {
+			return nil, ErrNotFound
+		}
+		for name, value := range fields {
+			existing[strings.ToUpper(name)] = toString(value)
+		}
+	case "delete":
+		if !exists {
+			return nil, ErrNotFound
+		}
+		delete(s.addresses, key)
+	default:
+		return nil, ErrMethodMissing
+	}
+	return true, nil
+}
+
+// deleteRequisiteAddresses removes the addresses of a deleted requisite, as
+// the real portal does. The caller must hold s.mu.
+func (s *Server) deleteRequisiteAddresses(requisiteID string) {
+	for key, address := range s.addresses {
+		if address["ENTITY_TYPE_ID"] == requisiteEntityType && address["ENTITY_ID"] == requisiteID {
+			delete(s.addresses, key)
+		}
+	}
+}
+
+func addressKey(fields map[string]interface{}) string {
+	parts := []string{
+		toString(fields["TYPE_ID"]),
+		toString(fields["ENTITY_TYPE_ID"]),
+		toString(fields["ENTITY_ID"]),
+	}
+	for _, part := range parts {
+		if part == "" {
+			return ""
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+func sortAddresses(addresses []map[string]interface{}) {
+	sort.Slice(addresses, func(i, j int) bool {
+		a, _ := strconv.Atoi(toString(addresses[i]["ENTITY_ID"]))
+		b, _ := strconv.Atoi(toString(addresses[j]["ENTITY_ID"]))
+		if a != b {
+			return a < b
+		}
+		a, _ = strconv.Atoi(toString(addresses[i]["TYPE_ID"]))
+		b, _ = strconv.Atoi(toString(addresses[j]["TYPE_ID"]))
+		return a < b
+	})
+}
@@ -0,0 +1,64 @@
+// agent/bitrix24/bitrix24test/binding.go
+package bitrix24test
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// CompanyContacts returns the IDs of the contacts bound to a company with
+// crm.company.contact.add, in ID order.
+func (s *Server) CompanyContacts(companyID string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]string, 0, len(s.bindings[companyID]))
+	for id := range s.bindings[companyID] {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, _ := strconv.Atoi(ids[i])
+		b, _ := strconv.Atoi(ids[j])
+		return a < b
+	})
+	return ids
+}
+
+// companyContact implements crm.company.contact.add, .delete and
+// .items.get. The caller must hold s.mu.
+func (s *Server) companyContact(op string, params map[string]interface{}) (interface{}, error) {
+	company, err := s.store("company").find(params["id"])
+	if err != nil {
+		return nil, err
+	}
+	companyID := toString(company["ID"])
+
+	if op == "items.get" {
+		items := []interface{}{}
+		for id := range s.bindings[companyID] {
+			n, _ := strconv.Atoi(id)
+			items = append(items, map[string]interface{}{"CONTACT_ID": n, "SORT": 10, "IS_PRIMARY": "N"})
+		}
+		return items, nil
+	}
+
+	fields, _ := params["fields"].(map[string]interface{})
+	contactID := toString(fields["CONTACT_ID"])
+	if _, err := s.store("contact").find(contactID); err != nil {
+		return nil, &Error{Status: http.StatusBadRequest, Code: "", Description: "The parameter 'fields' must contain a valid CONTACT_ID."}
+	}
+
+	switch op {
+	case "add":
+		if s.bindings[companyID] == nil {
+			s.bindings[companyID] = make(map[string]bool)
+		}
+		s.bindings[companyID][contactID] = true
+	case "delete":
+		delete(s.bindings[companyID], contactID)
+	default:
+		return nil, ErrMethodMissing
+	}
+	return true, nil
+}
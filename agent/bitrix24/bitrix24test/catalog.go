@@ -0,0 +1,218 @@
+// agent/bitrix24/bitrix24test/catalog.go
+package bitrix24test
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// stockDocument is a catalog document and the rows added to it.
+type stockDocument struct {
+	docType   string
+	conducted bool
+	deleted   bool
+	elements  []map[string]interface{}
+}
+
+// SeedStoreAmount sets the quantity of a product in a store.
+func (s *Server) SeedStoreAmount(productID string, storeID int, amount float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.storeAmounts[storeKey(productID, storeID)] = amount
+}
+
+// StoreAmount returns the quantity of a product in a store.
+func (s *Server) StoreAmount(productID string, storeID int) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.storeAmounts[storeKey(productID, storeID)]
+}
+
+// DraftDocuments returns the number of catalog documents that were neither
+// conducted nor deleted.
+func (s *Server) DraftDocuments() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	drafts := 0
+	for _, document := range s.documents {
+		if !document.conducted && !document.deleted {
+			drafts++
+		}
+	}
+	return drafts
+}
+
+// Price returns the price of a product for a price type set with
+// catalog.price.add or catalog.price.update.
+func (s *Server) Price(productID string, priceType int) (float64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, price := range s.prices {
+		if toString(price["productId"]) == productID && toString(price["catalogGroupId"]) == strconv.Itoa(priceType) {
+			amount, _ := strconv.ParseFloat(toString(price["price"]), 64)
+			return amount, true
+		}
+	}
+	return 0, false
+}
+
+// catalog implements catalog.storeproduct.list, catalog.price.list, .add and
+// .update, and the catalog.document.add, .element.add, .conduct and .delete
+// methods needed to move store quantities. Conducting a "S" document adds
+// its amounts to storeTo and a "D" document removes them from storeFrom;
+// only documents that were not conducted can be deleted. The caller must
+// hold s.mu.
+func (s *Server) catalog(op string, params map[string]interface{}) (interface{}, error) {
+	fields, _ := params["fields"].(map[string]interface{})
+
+	switch op {
+	case "storeproduct.list":
+		return s.listStoreProducts(params), nil
+
+	case "price.list":
+		filter, _ := params["filter"].(map[string]interface{})
+		wanted := toString(filter["productId"])
+		items := []map[string]interface{}{}
+		for _, price := range s.prices {
+			if wanted == "" || toString(price["productId"]) == wanted {
+				items = append(items, copyRecord(price))
+			}
+		}
+		return listPage{Key: "prices", Items: items, Total: len(items)}, nil
+
+	case "price.add":
+		for _, price := range s.prices {
+			if toString(price["productId"]) == toString(fields["productId"]) &&
+				toString(price["catalogGroupId"]) == toString(fields["catalogGroupId"]) {
+				return nil, &Error{Status: http.StatusBadRequest, Code: "ERROR_PRICE_EXISTS", Description: "Price already exists"}
+			}
+		}
+		price := copyRecord(fields)
+		price["id"] = len(s.prices) + 1
+		s.prices = append(s.prices, price)
+		return map[string]interface{}{"price": copyRecord(price)}, nil
+
+	case "price.update":
+		id, err := strconv.Atoi(toString(params["id"]))
+		if err != nil || id < 1 || id > len(s.prices) {
+			return nil, ErrNotFound
+		}
+		for key, value := range fields {
+			s.prices[id-1][key] = value
+		}
+		return map[string]interface{}{"price": copyRecord(s.prices[id-1])}, nil
+
+	case "document.add":
+		docType := toString(fields["docType"])
+		if docType != "S" && docType != "D" {
+			return nil, &Error{Status: http.StatusBadRequest, Code: "ERROR_DOCUMENT_TYPE", Description: "Unsupported document type"}
+		}
+		s.documents = append(s.documents, &stockDocument{docType: docType})
+		id := len(s.documents)
+		return map[string]interface{}{"document": map[string]interface{}{"id": id, "docType": docType}}, nil
+
+	case "document.element.add":
+		document, err := s.document(fields["docId"])
+		if err != nil {
+			return nil, err
+		}
+		element := make(map[string]interface{}, len(fields))
+		for key, value := range fields {
+			element[key] = value
+		}
+		document.elements = append(document.elements, element)
+		return map[string]interface{}{"documentElement": map[string]interface{}{"id": len(document.elements)}}, nil
+
+	case "document.conduct":
+		document, err := s.document(params["id"])
+		if err != nil {
+			return nil, err
+		}
+		if document.conducted {
+			return nil, &Error{Status: http.StatusBadRequest, Code: "ERROR_DOCUMENT_STATUS", Description: "Document already conducted"}
+		}
+		for _, element := range document.elements {
+			amount, _ := strconv.ParseFloat(toString(element["amount"]), 64)
+			productID := toString(element["elementId"])
+			if document.docType == "S" {
+				store, _ := strconv.Atoi(toString(element["storeTo"]))
+				s.storeAmounts[storeKey(productID, store)] += amount
+			} else {
+				store, _ := strconv.Atoi(toString(element["storeFrom"]))
+				s.storeAmounts[storeKey(productID, store)] -= amount
+			}
+		}
+		for key, amount := range s.storeAmounts {
+			s.storeAmounts[key] = math.Round(amount*10000) / 10000
+		}
+		document.conducted = true
+		return true, nil
+
+	case "document.delete":
+		document, err := s.document(params["id"])
+		if err != nil {
+			return nil, err
+		}
+		if document.conducted {
+			return nil, &Error{Status: http.StatusBadRequest, Code: "ERROR_DOCUMENT_STATUS", Description: "Conducted documents cannot be deleted"}
+		}
+		document.deleted = true
+		return true, nil
+	}
+
+	return nil, ErrMethodMissing
+}
+
+// listStoreProducts returns the store quantities of the products in the
+// productId filter, or of every product, wrapped as "storeProducts".
+func (s *Server) listStoreProducts(params map[string]interface{}) listPage {
+	filter, _ := params["filter"].(map[string]interface{})
+	wanted := make(map[string]bool)
+	for _, id := range toStringList(filter["productId"]) {
+		wanted[id] = true
+	}
+
+	keys := make([]string, 0, len(s.storeAmounts))
+	for key := range s.storeAmounts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	items := []map[string]interface{}{}
+	for _, key := range keys {
+		productID, store, _ := strings.Cut(key, "/")
+		if len(wanted) > 0 && !wanted[productID] {
+			continue
+		}
+		productNumber, _ := strconv.Atoi(productID)
+		storeNumber, _ := strconv.Atoi(store)
+		items = append(items, map[string]interface{}{
+			"id":        len(items) + 1,
+			"productId": productNumber,
+			"storeId":   storeNumber,
+			"amount":    s.storeAmounts[key],
+		})
+	}
+
+	return listPage{Key: "storeProducts", Items: items, Total: len(items)}
+}
+
+// document returns the catalog document with the given ID.
+func (s *Server) document(rawID interface{}) (*stockDocument, error) {
+	id, err := strconv.Atoi(toString(rawID))
+	if err != nil || id < 1 || id > len(s.documents) || s.documents[id-1].deleted {
+		return nil, ErrNotFound
+	}
+	return s.documents[id-1], nil
+}
+
+func storeKey(productID string, storeID int) string {
+	return productID + "/" + strconv.Itoa(storeID)
+}
@@ -0,0 +1,113 @@
+// agent/bitrix24/bitrix24test/duplicate.go
+package bitrix24test
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxDuplicateValues is the largest number of values crm.duplicate.findbycomm
+// accepts in one call.
+const maxDuplicateValues = 20
+
+// minPhoneDigits is the shortest national number compared by suffix.
+const minPhoneDigits = 7
+
+// findByComm implements crm.duplicate.findbycomm. Like the real portal it
+// compares emails case-insensitively and phone numbers by their digits, so
+// "+34 931 234 567" matches "931234567", and returns an empty list rather
+// than an empty object when nothing matches.
+func (s *Server) findByComm(params map[string]interface{}) (interface{}, error) {
+	commType := strings.ToUpper(toString(params["type"]))
+	if commType != "PHONE" && commType != "EMAIL" {
+		return nil, &Error{Status: http.StatusBadRequest, Code: "", Description: "Communication type is not supported."}
+	}
+
+	values := toStringList(params["values"])
+	if len(values) == 0 || len(values) > maxDuplicateValues {
+		return nil, &Error{Status: http.StatusBadRequest, Code: "", Description: "Values must contain from 1 to 20 items."}
+	}
+
+	wanted := make(map[string]bool, len(values))
+	for _, value := range values {
+		if key := commKey(commType, value); key != "" {
+			wanted[key] = true
+		}
+	}
+
+	entityTypes := []string{"LEAD", "CONTACT", "COMPANY"}
+	if entityType := strings.ToUpper(toString(params["entity_type"])); entityType != "" {
+		entityTypes = []string{entityType}
+	}
+
+	result := make(map[string]interface{})
+	for _, entityType := range entityTypes {
+		store, ok := s.entities[strings.ToLower(entityType)]
+		if !ok {
+			continue
+		}
+
+		var ids []int
+		for _, id := range store.sortedIDs() {
+			if recordHasComm(store.records[id], commType, wanted) {
+				n, _ := strconv.Atoi(id)
+				ids = append(ids, n)
+			}
+		}
+		if len(ids) > 0 {
+			result[entityType] = ids
+		}
+	}
+
+	if len(result) == 0 {
+		return []interface{}{}, nil
+	}
+	return result, nil
+}
+
+// recordHasComm reports whether any item of the record's multi-field
+// matches one of the wanted keys.
+func recordHasComm(record map[string]interface{}, commType string, wanted map[string]bool) bool {
+	items, _ := record[commType].([]interface{})
+	for _, raw := range items {
+		item, _ := raw.(map[string]interface{})
+		have := commKey(commType, toString(item["VALUE"]))
+		if wanted[have] {
+			return true
+		}
+		if commType != "PHONE" {
+			continue
+		}
+		for key := range wanted {
+			if samePhone(have, key) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// samePhone reports whether two digit strings are the same number with and
+// without country calling code.
+func samePhone(a, b string) bool {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	return len(a) >= minPhoneDigits && strings.HasSuffix(b, a)
+}
+
+// commKey is the form in which communication values are compared.
+func commKey(commType, value string) string {
+	if commType == "EMAIL" {
+		return strings.ToLower(strings.TrimSpace(value))
+	}
+
+	var digits strings.Builder
+	for _, r := range value {
+		if r >= '0' && r <= '9' {
+			digits.WriteRune(r)
+		}
+	}
+	return digits.String()
+}
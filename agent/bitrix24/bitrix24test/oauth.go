@@ -0,0 +1,135 @@
+// agent/bitrix24/bitrix24test/oauth.go
+package bitrix24test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// AuthCode is the authorization code accepted by the fake OAuth server.
+const AuthCode = "test-auth-code"
+
+// oauthState tracks the OAuth application registered on the fake portal.
+type oauthState struct {
+	clientID     string
+	clientSecret string
+	accessToken  string
+	refreshToken string
+	expiresIn    int
+	generation   int
+	expired      bool
+}
+
+// EnableOAuth requires REST calls to carry a valid "auth" token and serves
+// /oauth/token/ for the given application credentials. Webhook calls are
+// rejected from then on.
+func (s *Server) EnableOAuth(clientID, clientSecret string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.oauth = &oauthState{
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		expiresIn:    3600,
+	}
+	s.oauth.issue()
+}
+
+// AccessToken returns the currently valid access token.
+func (s *Server) AccessToken() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.oauth.accessToken
+}
+
+// RefreshToken returns the currently valid refresh token.
+func (s *Server) RefreshToken() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.oauth.refreshToken
+}
+
+// ExpireAccessToken makes the API reject the current access token with
+// expired_token until the client refreshes it.
+func (s *Server) ExpireAccessToken() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.oauth.expired = true
+}
+
+// issue rotates the token pair, as Bitrix24 does on every refresh.
+func (o *oauthState) issue() {
+	o.generation++
+	o.accessToken = fmt.Sprintf("access-%d", o.generation)
+	o.refreshToken = fmt.Sprintf("refresh-%d", o.generation)
+	o.expired = false
+}
+
+// checkAuth validates the "auth" parameter when OAuth is enabled. The caller
+// must hold s.mu.
+func (s *Server) checkAuth(params map[string]interface{}) error {
+	if s.oauth == nil {
+		return nil
+	}
+
+	token := toString(params["auth"])
+	if token != s.oauth.accessToken {
+		return ErrInvalidToken
+	}
+	if s.oauth.expired {
+		return ErrExpiredToken
+	}
+	return nil
+}
+
+func (s *Server) serveToken(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.oauth == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Get("client_id") != s.oauth.clientID || query.Get("client_secret") != s.oauth.clientSecret {
+		writeError(w, &Error{Status: http.StatusUnauthorized, Code: "invalid_client", Description: "Invalid client credentials"})
+		return
+	}
+
+	switch query.Get("grant_type") {
+	case "authorization_code":
+		if query.Get("code") != AuthCode {
+			writeError(w, &Error{Status: http.StatusBadRequest, Code: "invalid_grant", Description: "Invalid authorization code"})
+			return
+		}
+	case "refresh_token":
+		if query.Get("refresh_token") != s.oauth.refreshToken {
+			writeError(w, &Error{Status: http.StatusBadRequest, Code: "invalid_grant", Description: "Invalid refresh token"})
+			return
+		}
+	default:
+		writeError(w, &Error{Status: http.StatusBadRequest, Code: "unsupported_grant_type", Description: "Unsupported grant type"})
+		return
+	}
+
+	s.oauth.issue()
+	domain := strings.TrimPrefix(s.URL, "http://")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token":    s.oauth.accessToken,
+		"refresh_token":   s.oauth.refreshToken,
+		"expires_in":      s.oauth.expiresIn,
+		"client_endpoint": s.URL + "/rest/",
+		"server_endpoint": s.URL + "/oauth/rest/",
+		"domain":          domain,
+		"member_id":       "fake-member",
+		"status":          "L",
+	})
+}
@@ -0,0 +1,64 @@
+// agent/bitrix24/bitrix24test/productrows.go
+package bitrix24test
+
+import (
+	"math"
+	"strconv"
+)
+
+// ProductRows returns the product rows of a deal set with
+// crm.deal.productrows.set.
+func (s *Server) ProductRows(dealID string) []map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.store("deal").records[dealID]
+	if !ok {
+		return nil
+	}
+	items, _ := copyValue(record["PRODUCT_ROWS"]).([]interface{})
+	rows := make([]map[string]interface{}, len(items))
+	for i, item := range items {
+		rows[i] = item.(map[string]interface{})
+	}
+	return rows
+}
+
+// dealProductRows implements crm.deal.productrows.set and .get. Setting
+// rows replaces all of them and, as on a real portal, recalculates the
+// OPPORTUNITY of the deal. The caller must hold s.mu.
+func (s *Server) dealProductRows(op string, params map[string]interface{}) (interface{}, error) {
+	deal, err := s.store("deal").find(params["id"])
+	if err != nil {
+		return nil, err
+	}
+
+	switch op {
+	case "get":
+		items, _ := copyValue(deal["PRODUCT_ROWS"]).([]interface{})
+		if items == nil {
+			items = []interface{}{}
+		}
+		return items, nil
+	case "set":
+		raw, _ := params["rows"].([]interface{})
+		rows := make([]interface{}, 0, len(raw))
+		total := 0.0
+		for i, item := range raw {
+			fields, _ := item.(map[string]interface{})
+			row := map[string]interface{}{"ID": strconv.Itoa(i + 1), "OWNER_ID": deal["ID"], "OWNER_TYPE": "D"}
+			for key, value := range fields {
+				row[key] = toString(value)
+			}
+			price, _ := strconv.ParseFloat(toString(fields["PRICE"]), 64)
+			quantity, _ := strconv.ParseFloat(toString(fields["QUANTITY"]), 64)
+			total += price * quantity
+			rows = append(rows, row)
+		}
+		deal["PRODUCT_ROWS"] = rows
+		deal["OPPORTUNITY"] = strconv.FormatFloat(math.Round(total*100)/100, 'f', -1, 64)
+		return true, nil
+	}
+
+	return nil, ErrMethodMissing
+}
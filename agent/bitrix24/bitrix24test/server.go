@@ -0,0 +1,533 @@
+// agent/bitrix24/bitrix24test/server.go
+
+// Package bitrix24test provides an in-process fake of the Bitrix24 REST API
+// so bitrix24.Client can be exercised without a live portal.
+package bitrix24test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultPageSize is the number of records returned per list page, as in
+// the real API.
+const DefaultPageSize = 50
+
+// maxBatchCommands is the largest number of commands accepted by batch.
+const maxBatchCommands = 50
+
+// Call records a REST method invocation received by the server.
+type Call struct {
+	Method string
+	Params map[string]interface{}
+}
+
+// Error is a Bitrix24 error response.
+type Error struct {
+	Status      int
+	Code        string
+	Description string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Description)
+}
+
+// Common API errors.
+var (
+	ErrNotFound      = &Error{Status: http.StatusBadRequest, Code: "", Description: "Not found"}
+	ErrQueryLimit    = &Error{Status: http.StatusServiceUnavailable, Code: "QUERY_LIMIT_EXCEEDED", Description: "Too many requests"}
+	ErrExpiredToken  = &Error{Status: http.StatusUnauthorized, Code: "expired_token", Description: "The access token provided has expired."}
+	ErrInvalidToken  = &Error{Status: http.StatusUnauthorized, Code: "invalid_token", Description: "The access token provided is invalid."}
+	ErrMethodMissing = &Error{Status: http.StatusNotFound, Code: "ERROR_METHOD_NOT_FOUND", Description: "Method not found!"}
+)
+
+// Handler implements a custom REST method. It returns the "result" value of
+// the response or an error; errors that are not *Error become HTTP 400.
+type Handler func(params map[string]interface{}) (interface{}, error)
+
+// Server is a stateful fake Bitrix24 portal.
+type Server struct {
+	*httptest.Server
+
+	// PageSize is the number of records returned per list page.
+	PageSize int
+
+	mu        sync.Mutex
+	entities  map[string]*entityStore
+	handlers  map[string]Handler
+	calls     []Call
+	failures  map[string][]*Error
+	limited   int
+	bindings  map[string]map[string]bool        // company ID -> bound contact IDs
+	addresses map[string]map[string]interface{} // by "TYPE_ID/ENTITY_TYPE_ID/ENTITY_ID"
+
+	storeAmounts map[string]float64       // by "productId/storeId"
+	documents    []*stockDocument         // catalog documents, ID is index+1
+	prices       []map[string]interface{} // catalog prices, ID is index+1
+
+	oauth *oauthState
+}
+
+// NewServer starts a fake portal supporting crm.contact.*, crm.company.*,
+// crm.deal.*, crm.deal.productrows.*, crm.product.*, crm.requisite.*,
+// crm.address.*, crm.company.contact.*, crm.duplicate.findbycomm, the
+// catalog methods that read and move store quantities, catalog.price.* and
+// batch.
+func NewServer() *Server {
+	s := &Server{
+		PageSize:  DefaultPageSize,
+		entities:  make(map[string]*entityStore),
+		handlers:  make(map[string]Handler),
+		failures:  make(map[string][]*Error),
+		bindings:  make(map[string]map[string]bool),
+		addresses: make(map[string]map[string]interface{}),
+
+		storeAmounts: make(map[string]float64),
+	}
+	for _, entity := range []string{"contact", "company", "deal", "product", "requisite"} {
+		s.entities[entity] = newEntityStore()
+	}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// WebhookURL returns an incoming webhook URL for the fake portal.
+func (s *Server) WebhookURL() string {
+	return s.URL + "/rest/1/fakewebhooktoken/"
+}
+
+// Handle registers a custom REST method, overriding any built-in one.
+func (s *Server) Handle(method string, handler Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.handlers[method] = handler
+}
+
+// AddEntity enables the crm.<entity>.* methods for another entity type.
+func (s *Server) AddEntity(entity string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.entities[entity]; !ok {
+		s.entities[entity] = newEntityStore()
+	}
+}
+
+// FailNext makes the next call to method fail with err. Several failures
+// may be queued for the same method.
+func (s *Server) FailNext(method string, err *Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures[method] = append(s.failures[method], err)
+}
+
+// LimitNext makes the next n requests fail with QUERY_LIMIT_EXCEEDED.
+func (s *Server) LimitNext(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.limited = n
+}
+
+// Seed stores a record directly and returns its ID.
+func (s *Server) Seed(entity string, fields map[string]interface{}) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.store(entity).add(fields)
+}
+
+// Record returns a copy of a stored record, or nil if it does not exist.
+func (s *Server) Record(entity, id string) map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.store(entity).records[id]
+	if !ok {
+		return nil
+	}
+	return copyRecord(record)
+}
+
+// Records returns copies of all stored records of entity ordered by ID.
+func (s *Server) Records(entity string) []map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	store := s.store(entity)
+	records := make([]map[string]interface{}, 0, len(store.records))
+	for _, id := range store.sortedIDs() {
+		records = append(records, copyRecord(store.records[id]))
+	}
+	return records
+}
+
+// Calls returns the recorded invocations of method, or of every method if
+// method is empty. Commands executed inside a batch are recorded too.
+func (s *Server) Calls(method string) []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var calls []Call
+	for _, call := range s.calls {
+		if method == "" || call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// CallCount returns the number of recorded invocations of method.
+func (s *Server) CallCount(method string) int {
+	return len(s.Calls(method))
+}
+
+// ResetCalls clears the recorded invocations.
+func (s *Server) ResetCalls() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls = nil
+}
+
+func (s *Server) store(entity string) *entityStore {
+	store, ok := s.entities[entity]
+	if !ok {
+		store = newEntityStore()
+		s.entities[entity] = store
+	}
+	return store
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/oauth/token") {
+		s.serveToken(w, r)
+		return
+	}
+
+	if !strings.HasPrefix(r.URL.Path, "/rest/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	method := strings.TrimSuffix(path[strings.LastIndex(path, "/")+1:], ".json")
+
+	params, err := readParams(r)
+	if err != nil {
+		writeError(w, &Error{Status: http.StatusBadRequest, Code: "INVALID_REQUEST", Description: err.Error()})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkAuth(params); err != nil {
+		writeError(w, err)
+		return
+	}
+	delete(params, "auth")
+
+	if s.limited > 0 {
+		s.limited--
+		writeError(w, ErrQueryLimit)
+		return
+	}
+
+	start := time.Now()
+	var result interface{}
+	if method == "batch" {
+		result, err = s.batch(params)
+	} else {
+		result, err = s.dispatch(method, params)
+	}
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"result": result,
+		"time":   responseTime(start),
+	}
+	if page, ok := result.(listPage); ok {
+		response["result"] = page.result()
+		response["total"] = page.Total
+		if page.Next > 0 {
+			response["next"] = page.Next
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// dispatch runs a single REST method. The caller must hold s.mu.
+func (s *Server) dispatch(method string, params map[string]interface{}) (interface{}, error) {
+	s.calls = append(s.calls, Call{Method: method, Params: params})
+
+	if queued := s.failures[method]; len(queued) > 0 {
+		s.failures[method] = queued[1:]
+		return nil, queued[0]
+	}
+
+	if handler, ok := s.handlers[method]; ok {
+		return handler(params)
+	}
+
+	if method == "crm.duplicate.findbycomm" {
+		return s.findByComm(params)
+	}
+	if op, ok := strings.CutPrefix(method, "crm.company.contact."); ok {
+		return s.companyContact(op, params)
+	}
+	if op, ok := strings.CutPrefix(method, "crm.deal.productrows."); ok {
+		return s.dealProductRows(op, params)
+	}
+	if op, ok := strings.CutPrefix(method, "crm.address."); ok {
+		return s.address(op, params)
+	}
+	if op, ok := strings.CutPrefix(method, "catalog."); ok {
+		return s.catalog(op, params)
+	}
+	if method == "crm.requisite.delete" {
+		s.deleteRequisiteAddresses(toString(params["id"]))
+	}
+
+	parts := strings.Split(method, ".")
+	if len(parts) == 3 && parts[0] == "crm" {
+		if store, ok := s.entities[parts[1]]; ok {
+			return store.call(parts[2], params, s.PageSize)
+		}
+	}
+
+	return nil, ErrMethodMissing
+}
+
+// batch executes up to 50 commands written as "method?query" strings.
+func (s *Server) batch(params map[string]interface{}) (interface{}, error) {
+	commands, _ := params["cmd"].(map[string]interface{})
+	if len(commands) > maxBatchCommands {
+		return nil, &Error{Status: http.StatusBadRequest, Code: "ERROR_BATCH_LENGTH_EXCEEDED", Description: "Max batch length exceeded"}
+	}
+	halt := toString(params["halt"]) == "1" || params["halt"] == true
+
+	results := make(map[string]interface{})
+	errors := make(map[string]interface{})
+	totals := make(map[string]interface{})
+	nexts := make(map[string]interface{})
+
+	keys := make([]string, 0, len(commands))
+	for key := range commands {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		command := toString(commands[key])
+		method, rawQuery, _ := strings.Cut(command, "?")
+
+		query, err := url.ParseQuery(rawQuery)
+		if err != nil {
+			return nil, &Error{Status: http.StatusBadRequest, Code: "INVALID_REQUEST", Description: err.Error()}
+		}
+
+		result, err := s.dispatch(method, ParseQuery(query))
+		if err != nil {
+			apiErr := toAPIError(err)
+			errors[key] = map[string]interface{}{
+				"error":             apiErr.Code,
+				"error_description": apiErr.Description,
+			}
+			if halt {
+				break
+			}
+			continue
+		}
+
+		if page, ok := result.(listPage); ok {
+			result = page.result()
+			totals[key] = page.Total
+			if page.Next > 0 {
+				nexts[key] = page.Next
+			}
+		}
+		results[key] = result
+	}
+
+	return map[string]interface{}{
+		"result":       results,
+		"result_error": errors,
+		"result_total": totals,
+		"result_next":  nexts,
+		"result_time":  map[string]interface{}{},
+	}, nil
+}
+
+// readParams decodes a JSON or form-encoded request body, merged with the
+// URL query.
+func readParams(r *http.Request) (map[string]interface{}, error) {
+	params := ParseQuery(r.URL.Query())
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) == 0 {
+		return params, nil
+	}
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var data map[string]interface{}
+		if err := json.Unmarshal(body, &data); err != nil {
+			return nil, err
+		}
+		for key, value := range data {
+			params[key] = value
+		}
+		return params, nil
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range ParseQuery(form) {
+		params[key] = value
+	}
+	return params, nil
+}
+
+// ParseQuery decodes PHP-style query parameters such as
+// "fields[PHONE][0][VALUE]=1" into nested maps and slices.
+func ParseQuery(values url.Values) map[string]interface{} {
+	root := make(map[string]interface{})
+
+	for key, list := range values {
+		path := splitQueryKey(key)
+		for _, value := range list {
+			setPath(root, path, value)
+		}
+	}
+
+	return normalizeLists(root).(map[string]interface{})
+}
+
+func splitQueryKey(key string) []string {
+	name, rest, found := strings.Cut(key, "[")
+	path := []string{name}
+	if !found {
+		return path
+	}
+
+	for _, part := range strings.Split(strings.TrimSuffix(rest, "]"), "][") {
+		path = append(path, part)
+	}
+	return path
+}
+
+func setPath(node map[string]interface{}, path []string, value string) {
+	key := path[0]
+	if key == "" {
+		key = strconv.Itoa(len(node))
+	}
+
+	if len(path) == 1 {
+		node[key] = value
+		return
+	}
+
+	child, ok := node[key].(map[string]interface{})
+	if !ok {
+		child = make(map[string]interface{})
+		node[key] = child
+	}
+	setPath(child, path[1:], value)
+}
+
+// normalizeLists turns maps keyed 0..n-1 into slices.
+func normalizeLists(node interface{}) interface{} {
+	m, ok := node.(map[string]interface{})
+	if !ok {
+		return node
+	}
+
+	for key, value := range m {
+		m[key] = normalizeLists(value)
+	}
+
+	list := make([]interface{}, len(m))
+	for key, value := range m {
+		index, err := strconv.Atoi(key)
+		if err != nil || index < 0 || index >= len(m) {
+			return m
+		}
+		list[index] = value
+	}
+	if len(list) == 0 {
+		return m
+	}
+	return list
+}
+
+func toAPIError(err error) *Error {
+	if apiErr, ok := err.(*Error); ok {
+		return apiErr
+	}
+	return &Error{Status: http.StatusBadRequest, Code: "ERROR_CORE", Description: err.Error()}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	apiErr := toAPIError(err)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(apiErr.Status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":             apiErr.Code,
+		"error_description": apiErr.Description,
+	})
+}
+
+func responseTime(start time.Time) map[string]interface{} {
+	finish := time.Now()
+	return map[string]interface{}{
+		"start":       float64(start.UnixNano()) / 1e9,
+		"finish":      float64(finish.UnixNano()) / 1e9,
+		"duration":    finish.Sub(start).Seconds(),
+		"processing":  finish.Sub(start).Seconds(),
+		"date_start":  start.Format(time.RFC3339),
+		"date_finish": finish.Format(time.RFC3339),
+	}
+}
+
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		if v {
+			return "Y"
+		}
+		return "N"
+	default:
+		return fmt.Sprint(v)
+	}
+}
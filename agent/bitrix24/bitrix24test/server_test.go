@@ -0,0 +1,94 @@
+package bitrix24test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func post(t *testing.T, server *Server, method string, params map[string]interface{}) map[string]interface{} {
+	t.Helper()
+
+	body, _ := json.Marshal(params)
+	resp, err := http.Post(server.WebhookURL()+method, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST %s: %v", method, err)
+	}
+	defer resp.Body.Close()
+
+	var response map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatalf("decode %s: %v", method, err)
+	}
+	return response
+}
+
+func TestParseQuery(t *testing.T) {
+	values, _ := url.ParseQuery("id=4&fields[NAME]=Ana&fields[PHONE][0][VALUE]=600&fields[PHONE][0][VALUE_TYPE]=MOBILE")
+
+	want := map[string]interface{}{
+		"id": "4",
+		"fields": map[string]interface{}{
+			"NAME": "Ana",
+			"PHONE": []interface{}{
+				map[string]interface{}{"VALUE": "600", "VALUE_TYPE": "MOBILE"},
+			},
+		},
+	}
+
+	if got := ParseQuery(values); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseQuery = %#v", got)
+	}
+}
+
+func TestListPagination(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	server.PageSize = 2
+
+	for _, name := range []string{"A", "B", "C"} {
+		server.Seed("company", map[string]interface{}{"TITLE": name})
+	}
+
+	first := post(t, server, "crm.company.list", map[string]interface{}{})
+	if first["total"] != float64(3) || first["next"] != float64(2) {
+		t.Fatalf("first page = %v", first)
+	}
+
+	second := post(t, server, "crm.company.list", map[string]interface{}{"start": 2})
+	if _, ok := second["next"]; ok || len(second["result"].([]interface{})) != 1 {
+		t.Fatalf("second page = %v", second)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	id := server.Seed("contact", map[string]interface{}{"NAME": "Ana"})
+
+	response := post(t, server, "batch", map[string]interface{}{
+		"halt": 0,
+		"cmd": map[string]interface{}{
+			"get":     "crm.contact.get?id=" + id,
+			"missing": "crm.contact.get?id=999",
+			"add":     "crm.company.add?fields[TITLE]=Acme",
+		},
+	})
+
+	result := response["result"].(map[string]interface{})
+	results := result["result"].(map[string]interface{})
+	errors := result["result_error"].(map[string]interface{})
+
+	if results["get"].(map[string]interface{})["NAME"] != "Ana" {
+		t.Errorf("get result = %v", results["get"])
+	}
+	if _, ok := errors["missing"]; !ok {
+		t.Errorf("expected error for missing contact, got %v", errors)
+	}
+	if len(server.Records("company")) != 1 {
+		t.Error("batch add did not store the company")
+	}
+}
@@ -0,0 +1,451 @@
+// agent/bitrix24/bitrix24test/store.go
+package bitrix24test
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// multiFields are the communication fields stored as lists of
+// {ID, VALUE, VALUE_TYPE, TYPE_ID} items.
+var multiFields = map[string]bool{
+	"PHONE": true,
+	"EMAIL": true,
+	"WEB":   true,
+	"IM":    true,
+}
+
+// listPage is a page of list results before it is written as the
+// result/next/total response fields.
+type listPage struct {
+	// Key wraps the items in an object, as catalog.* list methods do.
+	Key   string
+	Items []map[string]interface{}
+	Next  int
+	Total int
+}
+
+// result returns the "result" value of the page.
+func (p listPage) result() interface{} {
+	if p.Key != "" {
+		return map[string]interface{}{p.Key: p.Items}
+	}
+	return p.Items
+}
+
+// entityStore keeps the records of one CRM entity type.
+type entityStore struct {
+	records    map[string]map[string]interface{}
+	nextID     int
+	nextItemID int
+}
+
+func newEntityStore() *entityStore {
+	return &entityStore{
+		records:    make(map[string]map[string]interface{}),
+		nextID:     1,
+		nextItemID: 1,
+	}
+}
+
+// call runs the crm.<entity>.<op> method.
+func (es *entityStore) call(op string, params map[string]interface{}, pageSize int) (interface{}, error) {
+	switch op {
+	case "add":
+		fields, _ := params["fields"].(map[string]interface{})
+		id, _ := strconv.Atoi(es.add(fields))
+		return id, nil
+
+	case "update":
+		record, err := es.find(params["id"])
+		if err != nil {
+			return nil, err
+		}
+		fields, _ := params["fields"].(map[string]interface{})
+		es.merge(record, fields)
+		record["DATE_MODIFY"] = time.Now().Format(time.RFC3339)
+		return true, nil
+
+	case "get":
+		record, err := es.find(params["id"])
+		if err != nil {
+			return nil, err
+		}
+		return copyRecord(record), nil
+
+	case "delete":
+		record, err := es.find(params["id"])
+		if err != nil {
+			return nil, err
+		}
+		delete(es.records, toString(record["ID"]))
+		return true, nil
+
+	case "list":
+		return es.list(params, pageSize), nil
+
+	case "fields":
+		return es.fields(), nil
+	}
+
+	return nil, ErrMethodMissing
+}
+
+// add stores a new record and returns its ID.
+func (es *entityStore) add(fields map[string]interface{}) string {
+	id := strconv.Itoa(es.nextID)
+	es.nextID++
+
+	now := time.Now().Format(time.RFC3339)
+	record := map[string]interface{}{
+		"ID":          id,
+		"DATE_CREATE": now,
+		"DATE_MODIFY": now,
+	}
+	es.merge(record, fields)
+	es.records[id] = record
+
+	return id
+}
+
+func (es *entityStore) find(rawID interface{}) (map[string]interface{}, error) {
+	id := toString(rawID)
+	if id == "" {
+		return nil, &Error{Status: http.StatusBadRequest, Code: "", Description: "ID is not defined or invalid."}
+	}
+
+	record, ok := es.records[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return record, nil
+}
+
+// merge applies fields to record. Multi-field items with an ID update or,
+// with an empty VALUE, delete the existing item; items without an ID are
+// appended, as the real API does.
+func (es *entityStore) merge(record, fields map[string]interface{}) {
+	for key, value := range fields {
+		key = strings.ToUpper(key)
+		if key == "ID" {
+			continue
+		}
+
+		if multiFields[key] {
+			record[key] = es.mergeMulti(record[key], value)
+			continue
+		}
+
+		switch v := value.(type) {
+		case map[string]interface{}, []interface{}:
+			record[key] = v
+		default:
+			record[key] = toString(v)
+		}
+	}
+}
+
+func (es *entityStore) mergeMulti(existing, update interface{}) []interface{} {
+	items, _ := existing.([]interface{})
+
+	updates, _ := update.([]interface{})
+	for _, raw := range updates {
+		item, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		id := toString(item["ID"])
+		value := toString(item["VALUE"])
+
+		if id == "" {
+			if value == "" {
+				continue
+			}
+			items = append(items, map[string]interface{}{
+				"ID":         strconv.Itoa(es.nextItemID),
+				"VALUE":      value,
+				"VALUE_TYPE": defaultString(toString(item["VALUE_TYPE"]), "WORK"),
+				"TYPE_ID":    toString(item["TYPE_ID"]),
+			})
+			es.nextItemID++
+			continue
+		}
+
+		for i, rawExisting := range items {
+			current := rawExisting.(map[string]interface{})
+			if current["ID"] != id {
+				continue
+			}
+			if value == "" {
+				items = append(items[:i], items[i+1:]...)
+			} else {
+				current["VALUE"] = value
+				if valueType := toString(item["VALUE_TYPE"]); valueType != "" {
+					current["VALUE_TYPE"] = valueType
+				}
+			}
+			break
+		}
+	}
+
+	return items
+}
+
+// list filters, orders and paginates records.
+func (es *entityStore) list(params map[string]interface{}, pageSize int) listPage {
+	filter, _ := params["filter"].(map[string]interface{})
+
+	var matched []map[string]interface{}
+	for _, id := range es.sortedIDs() {
+		record := es.records[id]
+		if matchesFilter(record, filter) {
+			matched = append(matched, record)
+		}
+	}
+
+	if order, ok := params["order"].(map[string]interface{}); ok {
+		sortRecords(matched, order)
+	}
+
+	start, _ := strconv.Atoi(toString(params["start"]))
+	if start < 0 || start > len(matched) {
+		start = len(matched)
+	}
+	end := start + pageSize
+	if end > len(matched) {
+		end = len(matched)
+	}
+
+	selectFields := toStringList(params["select"])
+	items := make([]map[string]interface{}, 0, end-start)
+	for _, record := range matched[start:end] {
+		items = append(items, selectRecord(record, selectFields))
+	}
+
+	page := listPage{Items: items, Total: len(matched)}
+	if end < len(matched) {
+		page.Next = end
+	}
+	return page
+}
+
+func (es *entityStore) fields() map[string]interface{} {
+	descriptors := map[string]interface{}{
+		"ID":          map[string]interface{}{"type": "integer", "isReadOnly": true},
+		"DATE_CREATE": map[string]interface{}{"type": "datetime", "isReadOnly": true},
+		"DATE_MODIFY": map[string]interface{}{"type": "datetime", "isReadOnly": true},
+	}
+	for name := range multiFields {
+		descriptors[name] = map[string]interface{}{"type": "crm_multifield", "isMultiple": true}
+	}
+	for _, record := range es.records {
+		for name := range record {
+			if _, ok := descriptors[name]; !ok {
+				descriptors[name] = map[string]interface{}{"type": "string"}
+			}
+		}
+	}
+	return descriptors
+}
+
+func (es *entityStore) sortedIDs() []string {
+	ids := make([]string, 0, len(es.records))
+	for id := range es.records {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, _ := strconv.Atoi(ids[i])
+		b, _ := strconv.Atoi(ids[j])
+		return a < b
+	})
+	return ids
+}
+
+// matchesFilter supports the "", "=", "!", "%", ">", ">=", "<" and "<="
+// key prefixes. Multi-fields match if any item's VALUE matches.
+func matchesFilter(record, filter map[string]interface{}) bool {
+	for rawKey, expected := range filter {
+		op, key := splitFilterKey(rawKey)
+
+		var actual []string
+		if multiFields[key] {
+			items, _ := record[key].([]interface{})
+			for _, raw := range items {
+				if item, ok := raw.(map[string]interface{}); ok {
+					actual = append(actual, toString(item["VALUE"]))
+				}
+			}
+		} else {
+			actual = []string{toString(record[key])}
+		}
+
+		matched := false
+		for _, want := range toStringList(expected) {
+			for _, have := range actual {
+				if compareFilter(op, have, want) {
+					matched = true
+				}
+			}
+		}
+
+		if op == "!" {
+			// Negation must hold against every expected value.
+			matched = true
+			for _, want := range toStringList(expected) {
+				for _, have := range actual {
+					if strings.EqualFold(have, want) {
+						matched = false
+					}
+				}
+			}
+		}
+
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func splitFilterKey(key string) (op, field string) {
+	for _, prefix := range []string{">=", "<=", "=", "!", "%", ">", "<"} {
+		if strings.HasPrefix(key, prefix) {
+			return prefix, strings.ToUpper(key[len(prefix):])
+		}
+	}
+	return "=", strings.ToUpper(key)
+}
+
+func compareFilter(op, have, want string) bool {
+	switch op {
+	case "=":
+		return strings.EqualFold(have, want)
+	case "%":
+		return strings.Contains(strings.ToLower(have), strings.ToLower(want))
+	case ">":
+		return compareValues(have, want) > 0
+	case ">=":
+		return compareValues(have, want) >= 0
+	case "<":
+		return compareValues(have, want) < 0
+	case "<=":
+		return compareValues(have, want) <= 0
+	}
+	return false
+}
+
+// compareValues compares numerically when both values are numbers.
+func compareValues(a, b string) int {
+	x, errA := strconv.ParseFloat(a, 64)
+	y, errB := strconv.ParseFloat(b, 64)
+	if errA == nil && errB == nil {
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(a, b)
+}
+
+func sortRecords(records []map[string]interface{}, order map[string]interface{}) {
+	for rawKey, rawDirection := range order {
+		key := strings.ToUpper(rawKey)
+		desc := strings.EqualFold(toString(rawDirection), "DESC")
+		sort.SliceStable(records, func(i, j int) bool {
+			cmp := compareValues(toString(records[i][key]), toString(records[j][key]))
+			if desc {
+				return cmp > 0
+			}
+			return cmp < 0
+		})
+		// Only a single sort key is supported.
+		return
+	}
+}
+
+// selectRecord applies a select list the way the API does: "*" (or no
+// select) returns every standard field, while multi-fields and UF_ fields
+// must be requested explicitly or through "UF_*".
+func selectRecord(record map[string]interface{}, selectFields []string) map[string]interface{} {
+	all := len(selectFields) == 0
+	userFields := false
+	wanted := map[string]bool{"ID": true}
+	for _, field := range selectFields {
+		switch field {
+		case "*":
+			all = true
+		case "UF_*":
+			userFields = true
+		default:
+			wanted[strings.ToUpper(field)] = true
+		}
+	}
+
+	selected := make(map[string]interface{})
+	for key, value := range record {
+		isUserField := strings.HasPrefix(key, "UF_")
+		switch {
+		case wanted[key]:
+		case isUserField && userFields:
+		case all && !isUserField && !multiFields[key]:
+		default:
+			continue
+		}
+		selected[key] = copyValue(value)
+	}
+	return selected
+}
+
+func toStringList(value interface{}) []string {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			list = append(list, toString(item))
+		}
+		return list
+	case []string:
+		return v
+	default:
+		return []string{toString(v)}
+	}
+}
+
+func copyRecord(record map[string]interface{}) map[string]interface{} {
+	return copyValue(record).(map[string]interface{})
+}
+
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			copied[key] = copyValue(item)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = copyValue(item)
+		}
+		return copied
+	default:
+		return v
+	}
+}
+
+func defaultString(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
@@ -4,61 +4,180 @@ package bitrix24
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"strings"
 	"time"
 
+	"saas-sync-platform/agent/metrics"
+	"saas-sync-platform/agent/normalize"
 	"saas-sync-platform/internal/shared"
 )
 
+// Defaults for retrying requests rejected with QUERY_LIMIT_EXCEEDED
+const (
+	defaultRateLimitDelay   = time.Second
+	defaultRateLimitRetries = 3
+)
+
+// ErrContactNotFound is returned when no Bitrix24 contact matches a search
+var ErrContactNotFound = errors.New("contact not found")
+
 // Client handles communication with Bitrix24 API
 type Client struct {
 	baseURL    string
 	httpClient *http.Client
 	config     *shared.Bitrix24Config
+	oauth      *oauthSession
+	logger     *slog.Logger
+	metrics    *metrics.Metrics
+
+	// rateLimitDelay is the first pause after QUERY_LIMIT_EXCEEDED, doubled
+	// on every further retry, up to rateLimitRetries retries
+	rateLimitDelay   time.Duration
+	rateLimitRetries int
 }
 
-// NewClient creates a new Bitrix24 API client
+// NewClient creates a new Bitrix24 API client authenticated by webhook
 func NewClient(config *shared.Bitrix24Config) *Client {
 	return &Client{
 		baseURL:    strings.TrimSuffix(config.APITenant, "/"),
 		httpClient: &http.Client{Timeout: 30 * time.Second},
 		config:     config,
+		logger:     slog.Default(),
+
+		rateLimitDelay:   defaultRateLimitDelay,
+		rateLimitRetries: defaultRateLimitRetries,
 	}
 }
 
+// NewOAuthClient creates a Bitrix24 API client authenticated as an OAuth
+// application. It returns ErrNotInstalled if store holds no token for the
+// configured portal.
+func NewOAuthClient(config *shared.Bitrix24Config, store TokenStore) (*Client, error) {
+	if !config.UsesOAuth() {
+		return nil, fmt.Errorf("Bitrix24 OAuth is not configured")
+	}
+
+	token, err := store.LoadToken(config.OAuth.Portal)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		baseURL:    strings.TrimSuffix(token.ClientEndpoint, "/"),
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		config:     config,
+		oauth: &oauthSession{
+			app:    NewOAuthApp(config.OAuth),
+			store:  store,
+			portal: config.OAuth.Portal,
+			token:  token,
+		},
+		logger: slog.Default(),
+
+		rateLimitDelay:   defaultRateLimitDelay,
+		rateLimitRetries: defaultRateLimitRetries,
+	}, nil
+}
+
+// WithLogger returns a copy of the client that logs through logger, e.g.
+// one carrying the correlation ID of a sync cycle
+func (c *Client) WithLogger(logger *slog.Logger) *Client {
+	clone := *c
+	clone.logger = logger
+	return &clone
+}
+
+// WithMetrics returns a copy of the client that records request latency
+// and errors in m
+func (c *Client) WithMetrics(m *metrics.Metrics) *Client {
+	clone := *c
+	clone.metrics = m
+	return &clone
+}
+
+// WithRateLimitBackoff returns a copy of the client that retries requests
+// rejected with QUERY_LIMIT_EXCEEDED up to retries times, waiting delay
+// before the first retry and twice as long before each further one
+func (c *Client) WithRateLimitBackoff(delay time.Duration, retries int) *Client {
+	clone := *c
+	clone.rateLimitDelay = delay
+	clone.rateLimitRetries = retries
+	return &clone
+}
+
 // Contact represents a Bitrix24 contact
 type Contact struct {
-	ID       string            `json:"ID,omitempty"`
-	Name     string            `json:"NAME"`
-	LastName string            `json:"LAST_NAME,omitempty"`
-	Phone    []PhoneField      `json:"PHONE,omitempty"`
-	Email    []EmailField      `json:"EMAIL,omitempty"`
-	Comments string            `json:"COMMENTS,omitempty"`
-	Fields   map[string]string `json:"-"` // Additional custom fields
+	ID       string                 `json:"ID,omitempty"`
+	Name     string                 `json:"NAME"`
+	LastName string                 `json:"LAST_NAME,omitempty"`
+	Phone    []PhoneField           `json:"PHONE,omitempty"`
+	Email    []EmailField           `json:"EMAIL,omitempty"`
+	Web      []MultiField           `json:"WEB,omitempty"`
+	IM       []MultiField           `json:"IM,omitempty"`
+	Comments string                 `json:"COMMENTS,omitempty"`
+	Fields   map[string]interface{} `json:"-"` // Other standard and custom (UF_*) fields
 }
 
-// PhoneField represents a phone number in Bitrix24
-type PhoneField struct {
+// MultiField is one item of a Bitrix24 multi-field (PHONE, EMAIL, WEB,
+// IM). Items read from Bitrix24 carry an ID; sending it back updates the
+// item instead of adding a new one.
+type MultiField struct {
+	ID        string `json:"ID,omitempty"`
 	Value     string `json:"VALUE"`
 	ValueType string `json:"VALUE_TYPE"`
 	TypeID    string `json:"TYPE_ID"`
 }
 
+// PhoneField represents a phone number in Bitrix24
+type PhoneField MultiField
+
 // EmailField represents an email in Bitrix24
-type EmailField struct {
-	Value     string `json:"VALUE"`
-	ValueType string `json:"VALUE_TYPE"`
-	TypeID    string `json:"TYPE_ID"`
+type EmailField MultiField
+
+// phoneValueTypes maps normalised phone kinds to PHONE VALUE_TYPEs
+var phoneValueTypes = map[string]string{
+	normalize.KindLandline: "WORK",
+	normalize.KindMobile:   "MOBILE",
+	normalize.KindFax:      "FAX",
+}
+
+// phoneFields converts normalised phones to PHONE items
+func phoneFields(phones []normalize.Phone) []PhoneField {
+	var fields []PhoneField
+	for _, phone := range phones {
+		fields = append(fields, PhoneField{
+			Value:     phone.Number,
+			ValueType: phoneValueTypes[phone.Kind],
+			TypeID:    "PHONE",
+		})
+	}
+	return fields
+}
+
+// emailFields converts normalised emails to EMAIL items
+func emailFields(emails []string) []EmailField {
+	var fields []EmailField
+	for _, email := range emails {
+		fields = append(fields, EmailField{
+			Value:     email,
+			ValueType: "WORK",
+			TypeID:    "EMAIL",
+		})
+	}
+	return fields
 }
 
 // APIResponse represents a standard Bitrix24 API response
 type APIResponse struct {
 	Result interface{} `json:"result"`
 	Error  *APIError   `json:"error,omitempty"`
+	Next   int         `json:"next,omitempty"`  // offset of the next page of a list
+	Total  int         `json:"total,omitempty"` // number of records a list matches
 	Time   struct {
 		Start      float64 `json:"start"`
 		Finish     float64 `json:"finish"`
@@ -98,45 +217,31 @@ func (c *Client) CreateContact(customer *shared.Customer) (*Contact, error) {
 	}
 
 	// Create a Contact struct to return
+	info := normalize.Customer(customer)
 	contact := &Contact{
 		Name:     customer.Name,
 		Comments: fmt.Sprintf("Synced from Sage 200c - Customer Code: %s", customer.Code),
-	}
-
-	// Set phone if available
-	if customer.Phone != "" {
-		contact.Phone = []PhoneField{
-			{
-				Value:     customer.Phone,
-				ValueType: "WORK",
-				TypeID:    "PHONE",
-			},
-		}
-	}
-
-	// Set email if available
-	if customer.Email != "" {
-		contact.Email = []EmailField{
-			{
-				Value:     customer.Email,
-				ValueType: "WORK",
-				TypeID:    "EMAIL",
-			},
-		}
+		Phone:    phoneFields(info.Phones),
+		Email:    emailFields(info.Emails),
 	}
 
 	// The result should contain the new contact ID
 	if contactID, ok := response.Result.(float64); ok {
 		contact.ID = fmt.Sprintf("%.0f", contactID)
-		log.Printf("Created Bitrix24 contact: %s (ID: %s)", customer.Name, contact.ID)
+		c.logger.Info("Created Bitrix24 contact",
+			"customer_code", customer.Code, "name", customer.Name, "contact_id", contact.ID)
 	}
 
 	return contact, nil
 }
 
-// UpdateContact updates an existing contact in Bitrix24
+// UpdateContact updates an existing contact in Bitrix24, replacing its
+// phones and emails with the customer's
 func (c *Client) UpdateContact(contactID string, customer *shared.Customer) error {
-	contact := c.customerToContact(customer)
+	contact, err := c.withItemIDs("contact", contactID, clearingMultiFields(c.customerToContact(customer)))
+	if err != nil {
+		return fmt.Errorf("failed to update contact: %w", err)
+	}
 
 	data := map[string]interface{}{
 		"id":     contactID,
@@ -144,7 +249,7 @@ func (c *Client) UpdateContact(contactID string, customer *shared.Customer) erro
 	}
 
 	var response APIResponse
-	err := c.makeRequest("crm.contact.update", data, &response)
+	err = c.makeRequest("crm.contact.update", data, &response)
 	if err != nil {
 		return fmt.Errorf("failed to update contact: %w", err)
 	}
@@ -153,66 +258,67 @@ func (c *Client) UpdateContact(contactID string, customer *shared.Customer) erro
 		return response.Error
 	}
 
-	log.Printf("Updated Bitrix24 contact: %s (ID: %s)", customer.Name, contactID)
+	c.logger.Info("Updated Bitrix24 contact",
+		"customer_code", customer.Code, "name", customer.Name, "contact_id", contactID)
 	return nil
 }
 
-// FindContactByName searches for a contact by name
+// FindContactByName returns the oldest contact with the given name,
+// decoded with all its fields
 func (c *Client) FindContactByName(name string) (*Contact, error) {
-	data := map[string]interface{}{
-		"filter": map[string]string{
-			"NAME": name,
-		},
-		"select": []string{"ID", "NAME", "LAST_NAME", "PHONE", "EMAIL"},
-	}
-
-	var response APIResponse
-	err := c.makeRequest("crm.contact.list", data, &response)
+	contacts, err := c.FindContactsByName(name)
 	if err != nil {
-		return nil, fmt.Errorf("failed to search contact: %w", err)
+		return nil, err
 	}
 
-	if response.Error != nil {
-		return nil, response.Error
+	if len(contacts) == 0 {
+		return nil, ErrContactNotFound
 	}
-
-	// Parse the results
-	if resultArray, ok := response.Result.([]interface{}); ok && len(resultArray) > 0 {
-		if contactData, ok := resultArray[0].(map[string]interface{}); ok {
-			contact := &Contact{}
-
-			// Handle ID as either string or number
-			if id, ok := contactData["ID"].(string); ok {
-				contact.ID = id
-			} else if id, ok := contactData["ID"].(float64); ok {
-				contact.ID = fmt.Sprintf("%.0f", id)
-			}
-
-			if name, ok := contactData["NAME"].(string); ok {
-				contact.Name = name
-			}
-			if lastName, ok := contactData["LAST_NAME"].(string); ok {
-				contact.LastName = lastName
-			}
-			return contact, nil
-		}
+	if len(contacts) > 1 {
+		c.logger.Warn("Several Bitrix24 contacts share a name, using the oldest",
+			"name", name, "count", len(contacts), "contact_id", contacts[0].ID)
 	}
 
-	return nil, fmt.Errorf("contact not found")
+	return contacts[0], nil
 }
 
 // SyncCustomer syncs a Sage customer to Bitrix24 (create or update)
 func (c *Client) SyncCustomer(customer *shared.Customer) error {
-	// Try to find existing contact
-	existingContact, err := c.FindContactByName(customer.Name)
-	if err == nil && existingContact != nil {
+	_, _, err := c.UpsertCustomer(customer, "")
+	return err
+}
+
+// UpsertCustomer updates the contact with the given ID, or finds the
+// contact by name when contactID is empty. A customer without a contact
+// whose phone or email matches existing contacts is handled by the
+// duplicate policy; otherwise a new contact is created. It returns the ID
+// of the contact that was written and the action taken (ActionCreate,
+// ActionUpdate, ActionLink, ActionMerge or ActionReview).
+func (c *Client) UpsertCustomer(customer *shared.Customer, contactID string) (string, string, error) {
+	if contactID == "" {
+		// Try to find existing contact
+		existingContact, err := c.FindContactByName(customer.Name)
+		if err == nil && existingContact != nil {
+			contactID = existingContact.ID
+		}
+	}
+
+	if contactID != "" {
 		// Contact exists, update it
-		return c.UpdateContact(existingContact.ID, customer)
+		return contactID, ActionUpdate, c.UpdateContact(contactID, customer)
+	}
+
+	duplicateID, action, err := c.adoptDuplicate(customer)
+	if err != nil || duplicateID != "" {
+		return duplicateID, action, err
 	}
 
 	// Contact doesn't exist, create new one
-	_, err = c.CreateContact(customer)
-	return err
+	contact, err := c.CreateContact(customer)
+	if err != nil {
+		return "", ActionCreate, err
+	}
+	return contact.ID, ActionCreate, nil
 }
 
 // SyncCustomers syncs multiple customers to Bitrix24
@@ -220,11 +326,12 @@ func (c *Client) SyncCustomers(customers []shared.Customer) error {
 	successCount := 0
 	errorCount := 0
 
-	log.Printf("Starting sync of %d customers to Bitrix24", len(customers))
+	c.logger.Info("Starting sync of customers to Bitrix24", "count", len(customers))
 
 	for _, customer := range customers {
 		if err := c.SyncCustomer(&customer); err != nil {
-			log.Printf("Failed to sync customer %s: %v", customer.Name, err)
+			c.logger.Error("Failed to sync customer",
+				"customer_code", customer.Code, "name", customer.Name, "error", err)
 			errorCount++
 		} else {
 			successCount++
@@ -234,7 +341,7 @@ func (c *Client) SyncCustomers(customers []shared.Customer) error {
 		time.Sleep(100 * time.Millisecond)
 	}
 
-	log.Printf("Bitrix24 sync completed: %d successful, %d errors", successCount, errorCount)
+	c.logger.Info("Bitrix24 sync completed", "successful", successCount, "errors", errorCount)
 
 	if errorCount > 0 {
 		return fmt.Errorf("sync completed with %d errors", errorCount)
@@ -257,7 +364,7 @@ func (c *Client) TestConnection() error {
 		return fmt.Errorf("Bitrix24 API error: %v", response.Error)
 	}
 
-	log.Println("Bitrix24 connection test successful")
+	c.logger.Info("Bitrix24 connection test successful")
 	return nil
 }
 
@@ -268,26 +375,13 @@ func (c *Client) customerToContact(customer *shared.Customer) map[string]interfa
 		"COMMENTS": fmt.Sprintf("Synced from Sage 200c - Customer Code: %s", customer.Code),
 	}
 
-	// Add phone if available
-	if customer.Phone != "" {
-		contact["PHONE"] = []PhoneField{
-			{
-				Value:     customer.Phone,
-				ValueType: "WORK",
-				TypeID:    "PHONE",
-			},
-		}
+	// Phones and emails are sent normalised; unusable parts are dropped
+	info := normalize.Customer(customer)
+	if phones := phoneFields(info.Phones); len(phones) > 0 {
+		contact["PHONE"] = phones
 	}
-
-	// Add email if available
-	if customer.Email != "" {
-		contact["EMAIL"] = []EmailField{
-			{
-				Value:     customer.Email,
-				ValueType: "WORK",
-				TypeID:    "EMAIL",
-			},
-		}
+	if emails := emailFields(info.Emails); len(emails) > 0 {
+		contact["EMAIL"] = emails
 	}
 
 	// Add address fields if available
@@ -307,10 +401,72 @@ func (c *Client) customerToContact(customer *shared.Customer) map[string]interfa
 	return contact
 }
 
-// makeRequest makes a request to the Bitrix24 API
+// makeRequest makes a request to the Bitrix24 API, renewing the OAuth
+// token and retrying once if the API reports it expired
 func (c *Client) makeRequest(method string, data map[string]interface{}, result interface{}) error {
+	err := c.limitedRequest(method, data, result)
+	if c.oauth == nil || !isTokenError(err) {
+		return err
+	}
+
+	if err := c.oauth.refresh(); err != nil {
+		return err
+	}
+
+	return c.limitedRequest(method, data, result)
+}
+
+// limitedRequest performs a call, backing off and retrying while Bitrix24
+// rejects it with QUERY_LIMIT_EXCEEDED
+func (c *Client) limitedRequest(method string, data map[string]interface{}, result interface{}) error {
+	wait := c.rateLimitDelay
+	for retry := 0; ; retry++ {
+		err := c.doRequest(method, data, result)
+		if retry >= c.rateLimitRetries || !isRateLimitError(err) {
+			return err
+		}
+
+		c.logger.Warn("Bitrix24 rate limit exceeded, backing off",
+			"method", method, "wait", wait, "retry", retry+1)
+		c.metrics.RateLimitWait(wait)
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+// isRateLimitError reports whether err means Bitrix24 throttled the request
+func isRateLimitError(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode == "QUERY_LIMIT_EXCEEDED"
+}
+
+// doRequest performs a single HTTP call to the Bitrix24 API
+func (c *Client) doRequest(method string, data map[string]interface{}, result interface{}) (err error) {
+	started := time.Now()
+	defer func() {
+		c.metrics.ObserveRequest(method, time.Since(started), errorCode(err))
+	}()
+
+	baseURL := c.baseURL
+
+	// OAuth applications pass the access token as the "auth" parameter
+	if c.oauth != nil {
+		token, err := c.oauth.accessToken()
+		if err != nil {
+			return err
+		}
+
+		baseURL = strings.TrimSuffix(token.ClientEndpoint, "/")
+		authData := make(map[string]interface{}, len(data)+1)
+		for key, value := range data {
+			authData[key] = value
+		}
+		authData["auth"] = token.AccessToken
+		data = authData
+	}
+
 	// Prepare the request URL
-	requestURL := fmt.Sprintf("%s/%s", c.baseURL, method)
+	requestURL := fmt.Sprintf("%s/%s", baseURL, method)
 
 	// Prepare the request body
 	jsonData, err := json.Marshal(data)
@@ -339,8 +495,12 @@ func (c *Client) makeRequest(method string, data map[string]interface{}, result
 		return fmt.Errorf("failed to read response: %w", err)
 	}
 
-	// Check HTTP status
+	// Check HTTP status, keeping the API error when the body carries one
 	if resp.StatusCode != http.StatusOK {
+		var apiErr APIError
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.ErrorCode != "" {
+			return fmt.Errorf("HTTP error %d: %w", resp.StatusCode, &apiErr)
+		}
 		return fmt.Errorf("HTTP error %d: %s", resp.StatusCode, string(body))
 	}
 
@@ -351,3 +511,17 @@ func (c *Client) makeRequest(method string, data map[string]interface{}, result
 
 	return nil
 }
+
+// errorCode returns the Bitrix24 error code of err for metrics, or a
+// generic code for transport failures
+func errorCode(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode != "" {
+		return apiErr.ErrorCode
+	}
+	return "REQUEST_FAILED"
+}
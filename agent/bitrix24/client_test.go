@@ -0,0 +1,293 @@
+package bitrix24
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"saas-sync-platform/agent/bitrix24/bitrix24test"
+	"saas-sync-platform/agent/metrics"
+	"saas-sync-platform/internal/shared"
+)
+
+func newTestClient(t *testing.T) (*Client, *bitrix24test.Server) {
+	t.Helper()
+
+	server := bitrix24test.NewServer()
+	t.Cleanup(server.Close)
+
+	client := NewClient(&shared.Bitrix24Config{APITenant: server.WebhookURL()})
+	return client, server
+}
+
+func testCustomer() *shared.Customer {
+	return &shared.Customer{
+		ID:    "C001",
+		Code:  "C001",
+		Name:  "Ferreteria Puig",
+		Email: "info@puig.example",
+		Phone: "931234567",
+		City:  "Girona",
+	}
+}
+
+func TestCreateContact(t *testing.T) {
+	client, server := newTestClient(t)
+
+	contact, err := client.CreateContact(testCustomer())
+	if err != nil {
+		t.Fatalf("CreateContact: %v", err)
+	}
+	if contact.ID == "" {
+		t.Fatal("expected contact ID to be set")
+	}
+
+	record := server.Record("contact", contact.ID)
+	if record == nil {
+		t.Fatalf("contact %s not stored", contact.ID)
+	}
+	if record["NAME"] != "Ferreteria Puig" {
+		t.Errorf("NAME = %v", record["NAME"])
+	}
+	if record["ADDRESS_CITY"] != "Girona" {
+		t.Errorf("ADDRESS_CITY = %v", record["ADDRESS_CITY"])
+	}
+	if !strings.Contains(record["COMMENTS"].(string), "C001") {
+		t.Errorf("COMMENTS = %v, want customer code", record["COMMENTS"])
+	}
+
+	phones := record["PHONE"].([]interface{})
+	if len(phones) != 1 || phones[0].(map[string]interface{})["VALUE"] != "+34931234567" {
+		t.Errorf("PHONE = %v", phones)
+	}
+}
+
+func TestUpdateContact(t *testing.T) {
+	client, server := newTestClient(t)
+	id := server.Seed("contact", map[string]interface{}{"NAME": "Old name"})
+
+	customer := testCustomer()
+	if err := client.UpdateContact(id, customer); err != nil {
+		t.Fatalf("UpdateContact: %v", err)
+	}
+
+	if name := server.Record("contact", id)["NAME"]; name != customer.Name {
+		t.Errorf("NAME = %v, want %s", name, customer.Name)
+	}
+}
+
+func TestFindContactByName(t *testing.T) {
+	client, server := newTestClient(t)
+	server.Seed("contact", map[string]interface{}{"NAME": "Other"})
+	id := server.Seed("contact", map[string]interface{}{"NAME": "Ferreteria Puig", "LAST_NAME": "SL"})
+
+	contact, err := client.FindContactByName("Ferreteria Puig")
+	if err != nil {
+		t.Fatalf("FindContactByName: %v", err)
+	}
+	if contact.ID != id || contact.LastName != "SL" {
+		t.Errorf("got %+v, want ID %s", contact, id)
+	}
+
+	if _, err := client.FindContactByName("Missing"); err == nil {
+		t.Error("expected error for missing contact")
+	}
+}
+
+func TestSyncCustomerCreatesThenUpdates(t *testing.T) {
+	client, server := newTestClient(t)
+	customer := testCustomer()
+
+	if err := client.SyncCustomer(customer); err != nil {
+		t.Fatalf("first SyncCustomer: %v", err)
+	}
+	customer.City = "Figueres"
+	if err := client.SyncCustomer(customer); err != nil {
+		t.Fatalf("second SyncCustomer: %v", err)
+	}
+
+	if got := server.CallCount("crm.contact.add"); got != 1 {
+		t.Errorf("crm.contact.add calls = %d, want 1", got)
+	}
+	if got := server.CallCount("crm.contact.update"); got != 1 {
+		t.Errorf("crm.contact.update calls = %d, want 1", got)
+	}
+
+	records := server.Records("contact")
+	if len(records) != 1 || records[0]["ADDRESS_CITY"] != "Figueres" {
+		t.Fatalf("records = %v", records)
+	}
+	record := records[0]
+	if phones, _ := record["PHONE"].([]interface{}); len(phones) != 1 {
+		t.Errorf("PHONE after update = %v, want the phone updated in place", record["PHONE"])
+	}
+	if emails, _ := record["EMAIL"].([]interface{}); len(emails) != 1 {
+		t.Errorf("EMAIL after update = %v, want the email updated in place", record["EMAIL"])
+	}
+}
+
+func TestUpsertCompanyReplacesPhonesAndEmails(t *testing.T) {
+	client, server := newTestClient(t)
+	companyID := server.Seed("company", map[string]interface{}{
+		"TITLE": "Ferreteria Puig",
+		"PHONE": []interface{}{
+			map[string]interface{}{"VALUE": "+34 931 23 45 67", "VALUE_TYPE": "WORK"},
+			map[string]interface{}{"VALUE": "972 00 00 00", "VALUE_TYPE": "WORK"},
+		},
+		"EMAIL": []interface{}{map[string]interface{}{"VALUE": "old@puig.example", "VALUE_TYPE": "WORK"}},
+	})
+
+	if _, _, err := client.UpsertCompany(testCustomer(), companyID); err != nil {
+		t.Fatalf("UpsertCompany: %v", err)
+	}
+
+	record := server.Records("company")[0]
+	phones, _ := record["PHONE"].([]interface{})
+	if len(phones) != 1 || phones[0].(map[string]interface{})["VALUE"] != "+34931234567" {
+		t.Errorf("PHONE = %v, want only the Sage phone", record["PHONE"])
+	}
+	emails, _ := record["EMAIL"].([]interface{})
+	if len(emails) != 1 || emails[0].(map[string]interface{})["VALUE"] != "info@puig.example" {
+		t.Errorf("EMAIL = %v, want the old email replaced", record["EMAIL"])
+	}
+}
+
+func TestUpdatesDeleteClearedPhonesAndEmails(t *testing.T) {
+	client, server := newTestClient(t)
+	customer := testCustomer()
+	if err := client.SyncCustomer(customer); err != nil {
+		t.Fatalf("first SyncCustomer: %v", err)
+	}
+	companyID, _, err := client.UpsertCompany(customer, "")
+	if err != nil {
+		t.Fatalf("first UpsertCompany: %v", err)
+	}
+
+	customer.Phone = ""
+	customer.Email = ""
+	if err := client.SyncCustomer(customer); err != nil {
+		t.Fatalf("second SyncCustomer: %v", err)
+	}
+	if _, _, err := client.UpsertCompany(customer, companyID); err != nil {
+		t.Fatalf("second UpsertCompany: %v", err)
+	}
+
+	for _, record := range []map[string]interface{}{server.Records("contact")[0], server.Record("company", companyID)} {
+		if phones, _ := record["PHONE"].([]interface{}); len(phones) != 0 {
+			t.Errorf("PHONE = %v, want the cleared phone deleted", record["PHONE"])
+		}
+		if emails, _ := record["EMAIL"].([]interface{}); len(emails) != 0 {
+			t.Errorf("EMAIL = %v, want the cleared email deleted", record["EMAIL"])
+		}
+	}
+}
+
+func TestSalesOrderFromDealPrices(t *testing.T) {
+	client, server := newTestClient(t)
+	productID := server.Seed("product", map[string]interface{}{"NAME": "Tornillo M6", "XML_ID": "TORN-M6"})
+
+	tests := []struct {
+		name string
+		row  map[string]interface{}
+	}{
+		{"tax included", map[string]interface{}{"PRICE": "10.89", "TAX_INCLUDED": "Y"}},
+		{"tax excluded", map[string]interface{}{"PRICE": "9", "TAX_INCLUDED": "N"}},
+		{"exclusive and netto prices", map[string]interface{}{
+			"PRICE": "10.89", "TAX_INCLUDED": "N", "PRICE_EXCLUSIVE": "9", "PRICE_NETTO": "10"}},
+	}
+
+	for _, tt := range tests {
+		row := map[string]interface{}{"PRODUCT_ID": productID, "QUANTITY": "10", "TAX_RATE": "21", "DISCOUNT_RATE": "10"}
+		for key, value := range tt.row {
+			row[key] = value
+		}
+		dealID := server.Seed("deal", map[string]interface{}{"CURRENCY_ID": "EUR", "PRODUCT_ROWS": []interface{}{row}})
+
+		order, err := client.SalesOrderFromDeal(map[string]interface{}{"ID": dealID, "CURRENCY_ID": "EUR"}, "430000001")
+		if err != nil {
+			t.Fatalf("%s: SalesOrderFromDeal: %v", tt.name, err)
+		}
+		line := order.Lines[0]
+		if line.ProductCode != "TORN-M6" || line.UnitPrice != 10 || line.Discount != 10 || line.TaxRate != 21 {
+			t.Errorf("%s: line = %+v, want unit price 10 before a 10%% discount", tt.name, line)
+		}
+		if order.NetAmount != 90 || order.TaxAmount != 18.9 || order.TotalAmount != 108.9 {
+			t.Errorf("%s: amounts = %.2f + %.2f = %.2f, want 90 + 18.90 = 108.90",
+				tt.name, order.NetAmount, order.TaxAmount, order.TotalAmount)
+		}
+	}
+}
+
+func TestSyncCustomersReportsErrors(t *testing.T) {
+	client, server := newTestClient(t)
+	server.FailNext("crm.contact.add", &bitrix24test.Error{Status: 400, Code: "ERROR_CORE", Description: "boom"})
+
+	customers := []shared.Customer{*testCustomer(), {Code: "C002", Name: "Bar Roca"}}
+	err := client.SyncCustomers(customers)
+	if err == nil || !strings.Contains(err.Error(), "1 errors") {
+		t.Fatalf("SyncCustomers error = %v, want 1 error", err)
+	}
+
+	if got := len(server.Records("contact")); got != 1 {
+		t.Errorf("stored contacts = %d, want 1", got)
+	}
+}
+
+func TestAPIErrorsAreTyped(t *testing.T) {
+	client, server := newTestClient(t)
+	client = client.WithRateLimitBackoff(0, 0)
+	server.LimitNext(1)
+
+	_, err := client.CreateContact(testCustomer())
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("error %v is not an *APIError", err)
+	}
+	if apiErr.ErrorCode != "QUERY_LIMIT_EXCEEDED" {
+		t.Errorf("ErrorCode = %s", apiErr.ErrorCode)
+	}
+}
+
+func TestRateLimitedRequestsBackOff(t *testing.T) {
+	client, server := newTestClient(t)
+	m := metrics.New()
+	client = client.WithRateLimitBackoff(time.Millisecond, 3).WithMetrics(m)
+
+	server.LimitNext(2)
+	if _, err := client.CreateContact(testCustomer()); err != nil {
+		t.Fatalf("CreateContact after two rate-limited attempts: %v", err)
+	}
+	if got := len(server.Records("contact")); got != 1 {
+		t.Errorf("stored contacts = %d, want 1", got)
+	}
+
+	// Retries stop once the budget is spent.
+	server.LimitNext(4)
+	_, err := client.CreateContact(testCustomer())
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.ErrorCode != "QUERY_LIMIT_EXCEEDED" {
+		t.Fatalf("error = %v, want QUERY_LIMIT_EXCEEDED after 3 retries", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	m.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	if want := "sagesync_bitrix24_rate_limit_waits_total 5"; !strings.Contains(recorder.Body.String(), want) {
+		t.Errorf("metrics missing %q", want)
+	}
+}
+
+func TestTestConnection(t *testing.T) {
+	client, server := newTestClient(t)
+
+	if err := client.TestConnection(); err != nil {
+		t.Fatalf("TestConnection: %v", err)
+	}
+
+	server.FailNext("crm.contact.fields", bitrix24test.ErrInvalidToken)
+	if err := client.TestConnection(); err == nil {
+		t.Error("expected TestConnection to fail")
+	}
+}
@@ -0,0 +1,50 @@
+// agent/bitrix24/collection.go
+package bitrix24
+
+import (
+	"saas-sync-platform/internal/shared"
+)
+
+// SyncsCollections reports whether collection fields are configured
+func (c *Client) SyncsCollections() bool {
+	return c.config.Collections.Enabled()
+}
+
+// CollectionPayload returns the custom fields written to a deal for the
+// collection state of its invoices, keyed by the configured field names.
+// The due date is cleared once everything is collected.
+func (c *Client) CollectionPayload(summary *shared.CollectionSummary) map[string]interface{} {
+	names := c.config.Collections
+	if !names.Enabled() {
+		return nil
+	}
+
+	fields := make(map[string]interface{})
+	if names.Status != "" {
+		if value, ok := names.StatusValues[summary.Status]; ok {
+			fields[names.Status] = value
+		} else {
+			fields[names.Status] = summary.Status
+		}
+	}
+	if names.Paid != "" {
+		fields[names.Paid] = roundCents(summary.Amount - summary.Outstanding)
+	}
+	if names.Outstanding != "" {
+		fields[names.Outstanding] = roundCents(summary.Outstanding)
+	}
+	if names.DueDate != "" {
+		fields[names.DueDate] = ""
+		if !summary.NextDueDate.IsZero() {
+			fields[names.DueDate] = summary.NextDueDate.Format("2006-01-02")
+		}
+	}
+
+	return fields
+}
+
+// UpdateDealCollection writes collection fields to a deal
+func (c *Client) UpdateDealCollection(dealID string, fields map[string]interface{}) error {
+	_, err := c.saveRecord("deal", dealID, fields)
+	return err
+}
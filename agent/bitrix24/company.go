@@ -0,0 +1,183 @@
+// agent/bitrix24/company.go
+package bitrix24
+
+import (
+	"errors"
+	"fmt"
+
+	"saas-sync-platform/agent/normalize"
+	"saas-sync-platform/internal/shared"
+)
+
+// ErrCompanyNotFound is returned when no Bitrix24 company matches a search
+var ErrCompanyNotFound = errors.New("company not found")
+
+// CompanyPayload returns the fields sent to Bitrix24 for the company that
+// groups the contact persons of a customer. It carries the same data as
+// the customer's contact, with the name as TITLE.
+func (c *Client) CompanyPayload(customer *shared.Customer) map[string]interface{} {
+	fields := c.customerToContact(customer)
+	fields["TITLE"] = fields["NAME"]
+	delete(fields, "NAME")
+	return fields
+}
+
+// ContactPersonPayload returns the fields sent to Bitrix24 for a contact
+// person. Its comment does not name the customer code the way customer
+// contacts do, so reconciliation never takes it for one.
+func (c *Client) ContactPersonPayload(person *shared.ContactPerson, country string) map[string]interface{} {
+	fields := map[string]interface{}{
+		"NAME":      person.FirstName,
+		"LAST_NAME": person.LastName,
+		"COMMENTS":  fmt.Sprintf("Synced from Sage 200c - Contact person %s of customer %s", person.ID, person.CustomerCode),
+	}
+	if person.Position != "" {
+		fields["POST"] = person.Position
+	}
+
+	info := normalize.Person(person, country)
+	if phones := phoneFields(info.Phones); len(phones) > 0 {
+		fields["PHONE"] = phones
+	}
+	if emails := emailFields(info.Emails); len(emails) > 0 {
+		fields["EMAIL"] = emails
+	}
+
+	return fields
+}
+
+// UpsertCompany updates the company with the given ID, or finds the
+// company by title when companyID is empty, creating it if none exists. It
+// returns the company ID and ActionCreate or ActionUpdate.
+func (c *Client) UpsertCompany(customer *shared.Customer, companyID string) (string, string, error) {
+	if companyID == "" {
+		existing, err := c.FindCompanyByTitle(customer.Name)
+		if err != nil && !errors.Is(err, ErrCompanyNotFound) {
+			return "", ActionCreate, err
+		}
+		companyID = existing
+	}
+
+	action := ActionUpdate
+	if companyID == "" {
+		action = ActionCreate
+	}
+
+	id, err := c.saveWholeRecord("company", companyID, c.CompanyPayload(customer))
+	if err != nil {
+		return "", action, err
+	}
+
+	c.logger.Info("Synced Bitrix24 company", "customer_code", customer.Code,
+		"company_id", id, "action", action)
+	return id, action, nil
+}
+
+// FindCompanyByTitle returns the ID of the oldest company with the given
+// title
+func (c *Client) FindCompanyByTitle(title string) (string, error) {
+	params := ListParams{
+		Filter: map[string]interface{}{"TITLE": title},
+		Select: []string{"ID"},
+	}
+
+	page, err := c.ListPage("crm.company.list", params, 0)
+	if err != nil {
+		return "", fmt.Errorf("failed to search company: %w", err)
+	}
+	if len(page.Records) == 0 {
+		return "", ErrCompanyNotFound
+	}
+	return RecordID(page.Records[0]), nil
+}
+
+// UpsertContactPerson updates the contact with the given ID or creates a
+// new one for a contact person. Unlike customers, contact persons are not
+// matched by name or checked for duplicates: colleagues often share the
+// switchboard number and email of their company. It returns the contact ID
+// and ActionCreate or ActionUpdate.
+func (c *Client) UpsertContactPerson(person *shared.ContactPerson, country, contactID string) (string, string, error) {
+	action := ActionUpdate
+	if contactID == "" {
+		action = ActionCreate
+	}
+
+	id, err := c.saveWholeRecord("contact", contactID, c.ContactPersonPayload(person, country))
+	if err != nil {
+		return "", action, err
+	}
+
+	c.logger.Info("Synced Bitrix24 contact person", "customer_code", person.CustomerCode,
+		"person_id", person.ID, "contact_id", id, "action", action)
+	return id, action, nil
+}
+
+// BindContact links a contact to a company with crm.company.contact.add
+func (c *Client) BindContact(companyID, contactID string) error {
+	return c.companyContactCall("crm.company.contact.add", companyID, contactID)
+}
+
+// UnbindContact removes the link between a contact and a company. The
+// contact itself is kept.
+func (c *Client) UnbindContact(companyID, contactID string) error {
+	return c.companyContactCall("crm.company.contact.delete", companyID, contactID)
+}
+
+func (c *Client) companyContactCall(method, companyID, contactID string) error {
+	data := map[string]interface{}{
+		"id":     companyID,
+		"fields": map[string]interface{}{"CONTACT_ID": contactID},
+	}
+
+	var response APIResponse
+	if err := c.makeRequest(method, data, &response); err != nil {
+		return fmt.Errorf("%s failed for company %s and contact %s: %w", method, companyID, contactID, err)
+	}
+	if response.Error != nil {
+		return response.Error
+	}
+	return nil
+}
+
+// saveWholeRecord saves a CRM record written in full from Sage data, so an
+// update also deletes the stored PHONE and EMAIL items of multi-fields
+// missing from fields
+func (c *Client) saveWholeRecord(entity, id string, fields map[string]interface{}) (string, error) {
+	if id != "" {
+		fields = clearingMultiFields(fields)
+	}
+	return c.saveRecord(entity, id, fields)
+}
+
+// saveRecord adds a CRM record when id is empty and updates it otherwise,
+// returning its ID. Updates replace the record's PHONE and EMAIL items
+// with those in fields.
+func (c *Client) saveRecord(entity, id string, fields map[string]interface{}) (string, error) {
+	method := "crm." + entity + ".add"
+	if id != "" {
+		method = "crm." + entity + ".update"
+
+		var err error
+		if fields, err = c.withItemIDs(entity, id, fields); err != nil {
+			return "", fmt.Errorf("failed to save %s: %w", entity, err)
+		}
+	}
+
+	data := map[string]interface{}{"fields": fields}
+	if id != "" {
+		data["id"] = id
+	}
+
+	var response APIResponse
+	if err := c.makeRequest(method, data, &response); err != nil {
+		return "", fmt.Errorf("failed to save %s: %w", entity, err)
+	}
+	if response.Error != nil {
+		return "", response.Error
+	}
+
+	if id == "" {
+		id = formatFieldValue(response.Result)
+	}
+	return id, nil
+}
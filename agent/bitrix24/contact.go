@@ -0,0 +1,167 @@
+// agent/bitrix24/contact.go
+package bitrix24
+
+import "fmt"
+
+// readOnlyFields are maintained by Bitrix24 and never sent back
+var readOnlyFields = map[string]bool{
+	"ID":                 true,
+	"DATE_CREATE":        true,
+	"DATE_MODIFY":        true,
+	"CREATED_BY_ID":      true,
+	"MODIFY_BY_ID":       true,
+	"LAST_ACTIVITY_TIME": true,
+	"LAST_ACTIVITY_BY":   true,
+}
+
+// DecodeContact converts a record returned by crm.contact.get or
+// crm.contact.list into a Contact. Fields without a typed counterpart,
+// including custom UF_ fields, are kept as returned in Fields.
+func DecodeContact(record map[string]interface{}) *Contact {
+	contact := &Contact{
+		ID:     RecordID(record),
+		Fields: make(map[string]interface{}),
+	}
+
+	for key, value := range record {
+		switch key {
+		case "ID":
+		case "NAME":
+			contact.Name = formatFieldValue(value)
+		case "LAST_NAME":
+			contact.LastName = formatFieldValue(value)
+		case "COMMENTS":
+			contact.Comments = formatFieldValue(value)
+		case "PHONE":
+			for _, item := range decodeMultiField(value) {
+				contact.Phone = append(contact.Phone, PhoneField(item))
+			}
+		case "EMAIL":
+			for _, item := range decodeMultiField(value) {
+				contact.Email = append(contact.Email, EmailField(item))
+			}
+		case "WEB":
+			contact.Web = decodeMultiField(value)
+		case "IM":
+			contact.IM = decodeMultiField(value)
+		default:
+			contact.Fields[key] = value
+		}
+	}
+
+	return contact
+}
+
+// decodeMultiField converts a PHONE/EMAIL/WEB/IM list into typed items
+func decodeMultiField(value interface{}) []MultiField {
+	items, _ := value.([]interface{})
+
+	var fields []MultiField
+	for _, raw := range items {
+		item, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		fields = append(fields, MultiField{
+			ID:        RecordID(item),
+			Value:     formatFieldValue(item["VALUE"]),
+			ValueType: formatFieldValue(item["VALUE_TYPE"]),
+			TypeID:    formatFieldValue(item["TYPE_ID"]),
+		})
+	}
+	return fields
+}
+
+// Payload returns the fields to send to crm.contact.add or
+// crm.contact.update, including Fields so custom values survive a
+// read-modify-write cycle. Multi-field items keep their IDs, so they are
+// updated in place rather than appended.
+func (ct *Contact) Payload() map[string]interface{} {
+	payload := make(map[string]interface{}, len(ct.Fields)+7)
+	for key, value := range ct.Fields {
+		if !readOnlyFields[key] {
+			payload[key] = value
+		}
+	}
+
+	payload["NAME"] = ct.Name
+	if ct.LastName != "" {
+		payload["LAST_NAME"] = ct.LastName
+	}
+	if ct.Comments != "" {
+		payload["COMMENTS"] = ct.Comments
+	}
+	if len(ct.Phone) > 0 {
+		payload["PHONE"] = ct.Phone
+	}
+	if len(ct.Email) > 0 {
+		payload["EMAIL"] = ct.Email
+	}
+	if len(ct.Web) > 0 {
+		payload["WEB"] = ct.Web
+	}
+	if len(ct.IM) > 0 {
+		payload["IM"] = ct.IM
+	}
+
+	return payload
+}
+
+// GetContact reads a contact with all its fields
+func (c *Client) GetContact(contactID string) (*Contact, error) {
+	fields, err := c.GetContactFields(contactID)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeContact(fields), nil
+}
+
+// FindContactsByName returns every contact with the given name, oldest
+// first
+func (c *Client) FindContactsByName(name string) ([]*Contact, error) {
+	params := ListParams{
+		Filter: map[string]interface{}{"NAME": name},
+		Select: contactSelect,
+	}
+
+	var contacts []*Contact
+	err := c.ListEach("crm.contact.list", params, func(record map[string]interface{}) error {
+		contacts = append(contacts, DecodeContact(record))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search contact: %w", err)
+	}
+
+	return contacts, nil
+}
+
+// SaveContact creates the contact when it has no ID and updates it
+// otherwise, returning its ID
+func (c *Client) SaveContact(contact *Contact) (string, error) {
+	if contact.ID == "" {
+		var response APIResponse
+		err := c.makeRequest("crm.contact.add", map[string]interface{}{"fields": contact.Payload()}, &response)
+		if err != nil {
+			return "", fmt.Errorf("failed to create contact: %w", err)
+		}
+		if response.Error != nil {
+			return "", response.Error
+		}
+		return formatFieldValue(response.Result), nil
+	}
+
+	data := map[string]interface{}{
+		"id":     contact.ID,
+		"fields": contact.Payload(),
+	}
+
+	var response APIResponse
+	if err := c.makeRequest("crm.contact.update", data, &response); err != nil {
+		return "", fmt.Errorf("failed to update contact: %w", err)
+	}
+	if response.Error != nil {
+		return "", response.Error
+	}
+	return contact.ID, nil
+}
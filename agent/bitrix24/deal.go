@@ -0,0 +1,428 @@
+// agent/bitrix24/deal.go
+package bitrix24
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"saas-sync-platform/internal/shared"
+)
+
+// DealOriginator is the ORIGINATOR_ID of deals created from Sage documents;
+// their ORIGIN_ID is the Sage document ID
+const DealOriginator = "sage200c"
+
+// defaultCurrency is the currency of documents that do not name one
+const defaultCurrency = "EUR"
+
+// ErrDealNotFound is returned when no Bitrix24 deal matches a search
+var ErrDealNotFound = errors.New("deal not found")
+
+// documentNames are the names of Sage document types in deal titles
+var documentNames = map[string]string{
+	shared.DocumentOrder: "Sales order",
+	shared.DocumentQuote: "Quote",
+}
+
+// DealPayload returns the fields sent to Bitrix24 for the deal of a Sage
+// sales order or quote. The pipeline and stage come from the deal settings;
+// contactID and companyID may be empty.
+func (c *Client) DealPayload(order *shared.SalesOrder, contactID, companyID string) map[string]interface{} {
+	name := documentNames[order.Type]
+	if name == "" {
+		name = "Document"
+	}
+
+	currency := order.Currency
+	if currency == "" {
+		currency = defaultCurrency
+	}
+
+	fields := map[string]interface{}{
+		"TITLE":         fmt.Sprintf("%s %s", name, order.Number),
+		"CATEGORY_ID":   c.config.DealCategory(),
+		"STAGE_ID":      c.config.DealStage(order.Type, order.Status),
+		"OPPORTUNITY":   order.TotalAmount,
+		"CURRENCY_ID":   currency,
+		"BEGINDATE":     order.Date.Format("2006-01-02"),
+		"ORIGINATOR_ID": DealOriginator,
+		"ORIGIN_ID":     order.ID,
+		"COMMENTS":      fmt.Sprintf("Synced from Sage 200c - %s %s of customer %s", name, order.Number, order.CustomerCode),
+	}
+	if contactID != "" {
+		fields["CONTACT_ID"] = contactID
+	}
+	if companyID != "" {
+		fields["COMPANY_ID"] = companyID
+	}
+
+	return fields
+}
+
+// UpsertDeal updates the deal with the given ID, or finds the deal of the
+// document by ORIGIN_ID when dealID is empty, creating it if none exists,
+// and then replaces its product rows with the document lines. Deals keep
+// their pipeline once created, and a won deal stays won unless the Sage
+// document is cancelled. It returns the deal ID and ActionCreate or
+// ActionUpdate.
+func (c *Client) UpsertDeal(order *shared.SalesOrder, dealID, contactID, companyID string) (string, string, error) {
+	if dealID == "" {
+		existing, err := c.FindDealByOrigin(order.ID)
+		if err != nil && !errors.Is(err, ErrDealNotFound) {
+			return "", ActionCreate, err
+		}
+		dealID = existing
+	}
+
+	action := ActionUpdate
+	fields := c.DealPayload(order, contactID, companyID)
+	if dealID == "" {
+		action = ActionCreate
+	} else {
+		delete(fields, "CATEGORY_ID")
+		keep, err := c.keepsWonStage(dealID, order, fields)
+		if err != nil {
+			return dealID, action, err
+		}
+		if keep {
+			delete(fields, "STAGE_ID")
+		}
+	}
+
+	id, err := c.saveRecord("deal", dealID, fields)
+	if err != nil {
+		return "", action, err
+	}
+
+	products, err := c.FindProductIDs(orderProductCodes(order))
+	if err != nil {
+		return id, action, err
+	}
+	if err := c.SetDealProductRows(id, dealRows(order, products)); err != nil {
+		return id, action, err
+	}
+
+	c.logger.Info("Synced Bitrix24 deal", "order_id", order.ID, "number", order.Number,
+		"type", order.Type, "deal_id", id, "stage", fields["STAGE_ID"], "action", action)
+	return id, action, nil
+}
+
+// FindDealByOrigin returns the ID of the deal created for a Sage document
+func (c *Client) FindDealByOrigin(orderID string) (string, error) {
+	params := ListParams{
+		Filter: map[string]interface{}{"ORIGINATOR_ID": DealOriginator, "ORIGIN_ID": orderID},
+		Select: []string{"ID"},
+	}
+
+	page, err := c.ListPage("crm.deal.list", params, 0)
+	if err != nil {
+		return "", fmt.Errorf("failed to search deal: %w", err)
+	}
+	if len(page.Records) == 0 {
+		return "", ErrDealNotFound
+	}
+	return RecordID(page.Records[0]), nil
+}
+
+// FindProductIDs returns the IDs of the catalog products whose XML_ID is
+// one of the given Sage product codes, keyed by code. Codes without a
+// product are left out.
+func (c *Client) FindProductIDs(codes []string) (map[string]string, error) {
+	products := make(map[string]string)
+	if len(codes) == 0 {
+		return products, nil
+	}
+
+	err := c.ListEach("crm.product.list", ListParams{
+		Filter: map[string]interface{}{"XML_ID": codes},
+		Select: []string{"ID", "XML_ID"},
+	}, func(record map[string]interface{}) error {
+		products[formatFieldValue(record["XML_ID"])] = RecordID(record)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+// SetDealProductRows replaces the product rows of a deal
+func (c *Client) SetDealProductRows(dealID string, rows []map[string]interface{}) error {
+	data := map[string]interface{}{
+		"id":   dealID,
+		"rows": rows,
+	}
+
+	var response APIResponse
+	if err := c.makeRequest("crm.deal.productrows.set", data, &response); err != nil {
+		return fmt.Errorf("failed to set product rows of deal %s: %w", dealID, err)
+	}
+	if response.Error != nil {
+		return response.Error
+	}
+	return nil
+}
+
+// keepsWonStage reports whether an update must leave the stage of a won
+// deal alone: deals won in Bitrix24 become live Sage orders, which would
+// otherwise move them back to an open stage
+func (c *Client) keepsWonStage(dealID string, order *shared.SalesOrder, fields map[string]interface{}) (bool, error) {
+	won := c.config.DealWonStage()
+	if fields["STAGE_ID"] == won || order.Status == shared.DocumentCancelled {
+		return false, nil
+	}
+
+	deal, err := c.GetDeal(dealID)
+	if err != nil {
+		return false, err
+	}
+	return formatFieldValue(deal["STAGE_ID"]) == won, nil
+}
+
+// GetDeal reads a deal
+func (c *Client) GetDeal(dealID string) (map[string]interface{}, error) {
+	var response APIResponse
+	if err := c.makeRequest("crm.deal.get", map[string]interface{}{"id": dealID}, &response); err != nil {
+		return nil, fmt.Errorf("failed to get deal %s: %w", dealID, err)
+	}
+	if response.Error != nil {
+		return nil, response.Error
+	}
+
+	deal, ok := response.Result.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected crm.deal.get result for deal %s", dealID)
+	}
+	return deal, nil
+}
+
+// ListWonDeals returns the deals in the won stage modified since the given
+// time that did not come from Sage. DATE_MODIFY only has second precision,
+// so deals modified in the same second as since are included.
+func (c *Client) ListWonDeals(since time.Time) ([]map[string]interface{}, error) {
+	deals, err := c.ListAll("crm.deal.list", ListParams{
+		Filter: map[string]interface{}{
+			"STAGE_ID":      c.config.DealWonStage(),
+			">=DATE_MODIFY": since.Format(time.RFC3339),
+		},
+		Select: []string{"ID", "TITLE", "CONTACT_ID", "COMPANY_ID", "CURRENCY_ID", "ORIGINATOR_ID", "ORIGIN_ID"},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	won := deals[:0]
+	for _, deal := range deals {
+		if formatFieldValue(deal["ORIGINATOR_ID"]) != DealOriginator {
+			won = append(won, deal)
+		}
+	}
+	return won, nil
+}
+
+// SalesOrderFromDeal builds the Sage sales order of a won deal for the
+// given customer from its product rows. Rows are mapped to Sage products
+// through the XML_ID of their catalog product; rows without one become
+// free-text lines. The order reference "B24-<deal ID>" identifies it in
+// Sage.
+func (c *Client) SalesOrderFromDeal(deal map[string]interface{}, customerCode string) (*shared.SalesOrder, error) {
+	dealID := RecordID(deal)
+	rows, err := c.GetDealProductRows(dealID)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("deal %s has no product rows", dealID)
+	}
+
+	var productIDs []string
+	for _, row := range rows {
+		if id := formatFieldValue(row["PRODUCT_ID"]); id != "" && id != "0" {
+			productIDs = append(productIDs, id)
+		}
+	}
+	codes, err := c.FindProductCodes(productIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	order := &shared.SalesOrder{
+		Type:         shared.DocumentOrder,
+		Status:       shared.DocumentLive,
+		CustomerCode: customerCode,
+		Date:         time.Now(),
+		Currency:     formatFieldValue(deal["CURRENCY_ID"]),
+		Reference:    "B24-" + dealID,
+	}
+	for _, row := range rows {
+		quantity := rowNumber(row, "QUANTITY")
+		discount := rowNumber(row, "DISCOUNT_RATE")
+		taxRate := rowNumber(row, "TAX_RATE")
+
+		net, unitPrice := rowNetPrices(row, discount, taxRate)
+
+		order.Lines = append(order.Lines, shared.SalesOrderLine{
+			ProductCode: codes[formatFieldValue(row["PRODUCT_ID"])],
+			Description: formatFieldValue(row["PRODUCT_NAME"]),
+			Quantity:    quantity,
+			UnitPrice:   roundCents(unitPrice),
+			Discount:    discount,
+			TaxRate:     taxRate,
+		})
+		order.NetAmount += net * quantity
+		order.TaxAmount += net * quantity * taxRate / 100
+	}
+	order.NetAmount = roundCents(order.NetAmount)
+	order.TaxAmount = roundCents(order.TaxAmount)
+	order.TotalAmount = roundCents(order.NetAmount + order.TaxAmount)
+
+	return order, nil
+}
+
+// rowNetPrices returns the unit price of a product row without tax, after
+// and before its discount. PRICE_EXCLUSIVE and PRICE_NETTO carry them when
+// the portal returns them; otherwise they are derived from PRICE, the final
+// unit price after discount, which includes tax only when TAX_INCLUDED is
+// "Y".
+func rowNetPrices(row map[string]interface{}, discount, taxRate float64) (net, unitPrice float64) {
+	if formatFieldValue(row["PRICE_EXCLUSIVE"]) != "" {
+		net = rowNumber(row, "PRICE_EXCLUSIVE")
+	} else {
+		net = rowNumber(row, "PRICE")
+		if formatFieldValue(row["TAX_INCLUDED"]) == "Y" {
+			net /= 1 + taxRate/100
+		}
+	}
+
+	unitPrice = net
+	if formatFieldValue(row["PRICE_NETTO"]) != "" {
+		unitPrice = rowNumber(row, "PRICE_NETTO")
+	} else if discount < 100 {
+		unitPrice = net / (1 - discount/100)
+	}
+	return net, unitPrice
+}
+
+// GetDealProductRows reads the product rows of a deal
+func (c *Client) GetDealProductRows(dealID string) ([]map[string]interface{}, error) {
+	var response APIResponse
+	if err := c.makeRequest("crm.deal.productrows.get", map[string]interface{}{"id": dealID}, &response); err != nil {
+		return nil, fmt.Errorf("failed to get product rows of deal %s: %w", dealID, err)
+	}
+	if response.Error != nil {
+		return nil, response.Error
+	}
+
+	items, _ := response.Result.([]interface{})
+	rows := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		if row, ok := item.(map[string]interface{}); ok {
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+// FindProductCodes returns the Sage product codes, stored as XML_ID, of
+// the catalog products with the given IDs, keyed by product ID
+func (c *Client) FindProductCodes(ids []string) (map[string]string, error) {
+	codes := make(map[string]string)
+	if len(ids) == 0 {
+		return codes, nil
+	}
+
+	err := c.ListEach("crm.product.list", ListParams{
+		Filter: map[string]interface{}{"ID": ids},
+		Select: []string{"ID", "XML_ID"},
+	}, func(record map[string]interface{}) error {
+		if code := formatFieldValue(record["XML_ID"]); code != "" {
+			codes[RecordID(record)] = code
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// LinkDealToOrder marks a deal as the deal of a Sage sales order, so later
+// changes to the order update it, and writes the order number to the
+// configured deal field
+func (c *Client) LinkDealToOrder(dealID string, order *shared.SalesOrder) error {
+	fields := map[string]interface{}{
+		"ORIGINATOR_ID": DealOriginator,
+		"ORIGIN_ID":     order.ID,
+	}
+	if c.config.Deals != nil && c.config.Deals.OrderNumberField != "" {
+		fields[c.config.Deals.OrderNumberField] = order.Number
+	}
+
+	if _, err := c.saveRecord("deal", dealID, fields); err != nil {
+		return err
+	}
+
+	c.logger.Info("Linked Bitrix24 deal to Sage sales order", "deal_id", dealID,
+		"order_id", order.ID, "number", order.Number)
+	return nil
+}
+
+// dealRows converts document lines to deal product rows. PRICE is the
+// final unit price after discount and including tax, as Bitrix24 expects;
+// lines whose product is not in the catalog are sent by name only.
+func dealRows(order *shared.SalesOrder, products map[string]string) []map[string]interface{} {
+	rows := make([]map[string]interface{}, 0, len(order.Lines))
+	for _, line := range order.Lines {
+		name := line.Description
+		if name == "" {
+			name = line.ProductCode
+		}
+
+		price := line.UnitPrice * (1 - line.Discount/100) * (1 + line.TaxRate/100)
+		row := map[string]interface{}{
+			"PRODUCT_NAME":     name,
+			"PRICE":            roundCents(price),
+			"QUANTITY":         line.Quantity,
+			"DISCOUNT_TYPE_ID": 2, // percentage
+			"DISCOUNT_RATE":    line.Discount,
+			"TAX_RATE":         line.TaxRate,
+			"TAX_INCLUDED":     "Y",
+		}
+		if id, ok := products[line.ProductCode]; ok {
+			row["PRODUCT_ID"] = id
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// rowNumber reads a numeric product row field
+func rowNumber(row map[string]interface{}, field string) float64 {
+	value, _ := strconv.ParseFloat(formatFieldValue(row[field]), 64)
+	return value
+}
+
+func roundCents(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+// round4 rounds a stock quantity or unit price to the 4 decimals Sage keeps
+func round4(value float64) float64 {
+	return math.Round(value*10000) / 10000
+}
+
+// orderProductCodes returns the distinct product codes of a document
+func orderProductCodes(order *shared.SalesOrder) []string {
+	seen := make(map[string]bool)
+	var codes []string
+	for _, line := range order.Lines {
+		if line.ProductCode != "" && !seen[line.ProductCode] {
+			seen[line.ProductCode] = true
+			codes = append(codes, line.ProductCode)
+		}
+	}
+	return codes
+}
@@ -0,0 +1,289 @@
+// agent/bitrix24/duplicate.go
+package bitrix24
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"saas-sync-platform/agent/normalize"
+	"saas-sync-platform/internal/shared"
+)
+
+// Actions taken when a new customer matches existing contacts by phone or
+// email, following the configured duplicate policy
+const (
+	ActionLink   = "link"
+	ActionMerge  = "merge"
+	ActionReview = "review"
+)
+
+// maxDuplicateValues is the largest number of values crm.duplicate.findbycomm
+// accepts in one call
+const maxDuplicateValues = 20
+
+// DuplicateError is returned under the review policy when a customer
+// without a contact matches existing contacts. Nothing is written; once a
+// person has decided, adding the customer code to the right contact's
+// comments lets reconciliation link it.
+type DuplicateError struct {
+	Code       string
+	ContactIDs []string
+}
+
+func (e *DuplicateError) Error() string {
+	return fmt.Sprintf("customer %s matches Bitrix24 contacts %s by phone or email, flagged for review",
+		e.Code, strings.Join(e.ContactIDs, ", "))
+}
+
+// FindDuplicateContacts returns the IDs of contacts sharing one of the
+// customer's normalised phone numbers or emails, oldest first
+func (c *Client) FindDuplicateContacts(customer *shared.Customer) ([]string, error) {
+	info := normalize.Customer(customer)
+	comms := map[string][]string{"EMAIL": info.Emails}
+	for _, phone := range info.Phones {
+		comms["PHONE"] = append(comms["PHONE"], phone.Number)
+	}
+
+	seen := make(map[string]bool)
+	var ids []string
+	for _, commType := range []string{"PHONE", "EMAIL"} {
+		values := comms[commType]
+		if len(values) == 0 {
+			continue
+		}
+
+		found, err := c.findByComm(commType, values)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range found {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		a, _ := strconv.Atoi(ids[i])
+		b, _ := strconv.Atoi(ids[j])
+		return a < b
+	})
+	return ids, nil
+}
+
+// findByComm calls crm.duplicate.findbycomm for contacts
+func (c *Client) findByComm(commType string, values []string) ([]string, error) {
+	if len(values) > maxDuplicateValues {
+		values = values[:maxDuplicateValues]
+	}
+
+	data := map[string]interface{}{
+		"entity_type": "CONTACT",
+		"type":        commType,
+		"values":      values,
+	}
+
+	var response APIResponse
+	if err := c.makeRequest("crm.duplicate.findbycomm", data, &response); err != nil {
+		return nil, fmt.Errorf("failed to search duplicates by %s: %w", strings.ToLower(commType), err)
+	}
+	if response.Error != nil {
+		return nil, response.Error
+	}
+
+	// No match is reported as an empty list instead of an empty object
+	result, _ := response.Result.(map[string]interface{})
+	items, _ := result["CONTACT"].([]interface{})
+
+	ids := make([]string, 0, len(items))
+	for _, item := range items {
+		if id := formatFieldValue(item); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// adoptDuplicate applies the duplicate policy to a customer without a
+// contact. It returns an empty ID when no contact matches or the policy is
+// to create anyway.
+func (c *Client) adoptDuplicate(customer *shared.Customer) (string, string, error) {
+	policy := c.config.DuplicateMode()
+	if policy == shared.DuplicateCreate {
+		return "", "", nil
+	}
+
+	ids, err := c.FindDuplicateContacts(customer)
+	if err != nil || len(ids) == 0 {
+		return "", "", err
+	}
+	contactID := ids[0]
+
+	switch policy {
+	case shared.DuplicateReview:
+		return "", ActionReview, &DuplicateError{Code: customer.Code, ContactIDs: ids}
+
+	case shared.DuplicateMerge:
+		if err := c.mergeCustomer(contactID, customer); err != nil {
+			return "", ActionMerge, err
+		}
+		c.logger.Info("Merged customer into existing Bitrix24 contact",
+			"customer_code", customer.Code, "contact_id", contactID, "matches", len(ids))
+		return contactID, ActionMerge, nil
+	}
+
+	if err := c.UpdateContact(contactID, customer); err != nil {
+		return "", ActionLink, err
+	}
+	c.logger.Info("Linked customer to existing Bitrix24 contact",
+		"customer_code", customer.Code, "contact_id", contactID, "matches", len(ids))
+	return contactID, ActionLink, nil
+}
+
+// planNewCustomer is the read-only counterpart of adoptDuplicate for a
+// customer without a contact
+func (c *Client) planNewCustomer(customer *shared.Customer, desired map[string]interface{}) (*ContactPlan, error) {
+	plan := &ContactPlan{
+		Action:  ActionCreate,
+		Changes: diffFields(nil, desired),
+	}
+
+	policy := c.config.DuplicateMode()
+	if policy == shared.DuplicateCreate {
+		return plan, nil
+	}
+
+	ids, err := c.FindDuplicateContacts(customer)
+	if err != nil || len(ids) == 0 {
+		return plan, err
+	}
+	plan.ContactID = ids[0]
+
+	if policy == shared.DuplicateReview {
+		plan.Action = ActionReview
+		plan.Changes = nil
+		return plan, nil
+	}
+
+	current, err := c.GetContactFields(plan.ContactID)
+	if err != nil {
+		return nil, err
+	}
+
+	if policy == shared.DuplicateMerge {
+		plan.Action = ActionMerge
+		plan.Changes = diffFields(current, mergeFields(current, desired, customer.Country))
+	} else {
+		plan.Action = ActionLink
+		plan.Changes = diffFields(current, desired)
+	}
+	return plan, nil
+}
+
+// mergeCustomer fills the empty fields of an existing contact from
+// customer and adds the phones and emails it lacks, keeping every value
+// already in Bitrix24. The sync comment is appended so the contact can be
+// traced back to the customer.
+func (c *Client) mergeCustomer(contactID string, customer *shared.Customer) error {
+	current, err := c.GetContactFields(contactID)
+	if err != nil {
+		return err
+	}
+
+	fields := mergeFields(current, c.customerToContact(customer), customer.Country)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	data := map[string]interface{}{
+		"id":     contactID,
+		"fields": fields,
+	}
+
+	var response APIResponse
+	if err := c.makeRequest("crm.contact.update", data, &response); err != nil {
+		return fmt.Errorf("failed to merge contact: %w", err)
+	}
+	if response.Error != nil {
+		return response.Error
+	}
+	return nil
+}
+
+// mergeFields returns the part of desired that adds to current without
+// overwriting it. Existing phone numbers are read in country.
+func mergeFields(current, desired map[string]interface{}, country string) map[string]interface{} {
+	fields := make(map[string]interface{})
+	phoneKey := func(phone string) string { return normalize.PhoneKey(phone, country) }
+
+	for name, value := range desired {
+		switch name {
+		case "PHONE":
+			if added := missingItems(current[name], value, phoneKey); len(added) > 0 {
+				fields[name] = added
+			}
+		case "EMAIL":
+			if added := missingItems(current[name], value, emailKey); len(added) > 0 {
+				fields[name] = added
+			}
+		case "COMMENTS":
+			existing := formatFieldValue(current[name])
+			if existing == "" {
+				fields[name] = value
+			} else if CustomerCodeFromComments(existing) == "" {
+				fields[name] = existing + "\n" + formatFieldValue(value)
+			}
+		default:
+			if formatFieldValue(current[name]) == "" {
+				fields[name] = value
+			}
+		}
+	}
+
+	return fields
+}
+
+// missingItems returns the desired multi-field items whose normalised
+// value is not among the current ones. Items are sent without ID, so
+// Bitrix24 appends them.
+func missingItems(current, desired interface{}, normalize func(string) string) []MultiField {
+	have := make(map[string]bool)
+	for _, item := range decodeMultiField(current) {
+		have[normalize(item.Value)] = true
+	}
+
+	var added []MultiField
+	for _, item := range multiFieldItems(desired) {
+		if !have[normalize(item.Value)] {
+			added = append(added, item)
+		}
+	}
+	return added
+}
+
+// multiFieldItems converts the typed multi-field values built by
+// customerToContact into MultiField items
+func multiFieldItems(value interface{}) []MultiField {
+	var items []MultiField
+	switch v := value.(type) {
+	case []PhoneField:
+		for _, phone := range v {
+			items = append(items, MultiField(phone))
+		}
+	case []EmailField:
+		for _, email := range v {
+			items = append(items, MultiField(email))
+		}
+	case []MultiField:
+		items = v
+	}
+	return items
+}
+
+// emailKey is the form in which emails are compared
+func emailKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,132 @@
+package bitrix24
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"saas-sync-platform/internal/shared"
+)
+
+func TestFindDuplicateContacts(t *testing.T) {
+	client, server := newTestClient(t)
+	byPhone := server.Seed("contact", map[string]interface{}{
+		"NAME":  "Puig",
+		"PHONE": []interface{}{map[string]interface{}{"VALUE": "93 123 45 67", "VALUE_TYPE": "WORK"}},
+	})
+	byEmail := server.Seed("contact", map[string]interface{}{
+		"NAME":  "Puig (shop)",
+		"EMAIL": []interface{}{map[string]interface{}{"VALUE": "INFO@Puig.example", "VALUE_TYPE": "WORK"}},
+	})
+	server.Seed("contact", map[string]interface{}{"NAME": "Unrelated"})
+
+	ids, err := client.FindDuplicateContacts(testCustomer())
+	if err != nil {
+		t.Fatalf("FindDuplicateContacts: %v", err)
+	}
+	if len(ids) != 2 || ids[0] != byPhone || ids[1] != byEmail {
+		t.Errorf("ids = %v, want [%s %s]", ids, byPhone, byEmail)
+	}
+
+	ids, err = client.FindDuplicateContacts(&shared.Customer{Code: "C002", Phone: "600000000"})
+	if err != nil || len(ids) != 0 {
+		t.Errorf("ids = %v, err = %v, want none", ids, err)
+	}
+}
+
+func TestUpsertCustomerDuplicatePolicies(t *testing.T) {
+	tests := []struct {
+		policy     string
+		wantAction string
+		wantNew    bool
+	}{
+		{policy: "", wantAction: ActionLink},
+		{policy: shared.DuplicateMerge, wantAction: ActionMerge},
+		{policy: shared.DuplicateCreate, wantAction: ActionCreate, wantNew: true},
+		{policy: shared.DuplicateReview, wantAction: ActionReview},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.wantAction, func(t *testing.T) {
+			client, server := newTestClient(t)
+			client.config.DuplicatePolicy = tt.policy
+			existing := server.Seed("contact", map[string]interface{}{
+				"NAME":         "Puig Ferreteria",
+				"ADDRESS_CITY": "Figueres",
+				"PHONE":        []interface{}{map[string]interface{}{"VALUE": "931 234 567", "VALUE_TYPE": "WORK"}},
+			})
+
+			contactID, action, err := client.UpsertCustomer(testCustomer(), "")
+			if action != tt.wantAction {
+				t.Errorf("action = %q, want %q", action, tt.wantAction)
+			}
+
+			contacts := server.Records("contact")
+			switch {
+			case tt.wantNew:
+				if err != nil || contactID == existing || len(contacts) != 2 {
+					t.Errorf("contactID = %q, err = %v, contacts = %d; want a new contact", contactID, err, len(contacts))
+				}
+				return
+			case tt.policy == shared.DuplicateReview:
+				var duplicate *DuplicateError
+				if !errors.As(err, &duplicate) || len(duplicate.ContactIDs) != 1 || duplicate.ContactIDs[0] != existing {
+					t.Errorf("err = %v, want DuplicateError for contact %s", err, existing)
+				}
+				if contactID != "" || server.CallCount("crm.contact.update") != 0 || len(contacts) != 1 {
+					t.Error("review policy must not write to Bitrix24")
+				}
+				return
+			}
+
+			if err != nil || contactID != existing || len(contacts) != 1 {
+				t.Fatalf("contactID = %q, err = %v, contacts = %d; want %s", contactID, err, len(contacts), existing)
+			}
+
+			record := server.Record("contact", existing)
+			if !strings.Contains(record["COMMENTS"].(string), "C001") {
+				t.Errorf("COMMENTS = %v, want customer code", record["COMMENTS"])
+			}
+
+			wantName, wantCity := "Ferreteria Puig", "Girona"
+			if tt.policy == shared.DuplicateMerge {
+				// Merging keeps what Bitrix24 already had
+				wantName, wantCity = "Puig Ferreteria", "Figueres"
+				if emails, _ := record["EMAIL"].([]interface{}); len(emails) != 1 {
+					t.Errorf("EMAIL = %v, want the customer email added", record["EMAIL"])
+				}
+			}
+			if record["NAME"] != wantName || record["ADDRESS_CITY"] != wantCity {
+				t.Errorf("NAME = %v, ADDRESS_CITY = %v, want %s, %s", record["NAME"], record["ADDRESS_CITY"], wantName, wantCity)
+			}
+		})
+	}
+}
+
+func TestMergeFieldsKeepsExistingValues(t *testing.T) {
+	current := map[string]interface{}{
+		"NAME":     "Existing",
+		"COMMENTS": "VIP",
+		"PHONE":    []interface{}{map[string]interface{}{"ID": "4", "VALUE": "931-234-567"}},
+	}
+	desired := map[string]interface{}{
+		"NAME":         "Ferreteria Puig",
+		"COMMENTS":     "Synced from Sage 200c - Customer Code: C001",
+		"ADDRESS_CITY": "Girona",
+		"PHONE":        []PhoneField{{Value: "931234567", ValueType: "WORK", TypeID: "PHONE"}},
+	}
+
+	fields := mergeFields(current, desired, "ES")
+	if _, ok := fields["NAME"]; ok {
+		t.Error("NAME overwritten")
+	}
+	if _, ok := fields["PHONE"]; ok {
+		t.Error("phone added although it only differs in formatting")
+	}
+	if fields["ADDRESS_CITY"] != "Girona" {
+		t.Errorf("ADDRESS_CITY = %v, want Girona", fields["ADDRESS_CITY"])
+	}
+	if fields["COMMENTS"] != "VIP\nSynced from Sage 200c - Customer Code: C001" {
+		t.Errorf("COMMENTS = %q", fields["COMMENTS"])
+	}
+}
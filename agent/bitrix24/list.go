@@ -0,0 +1,174 @@
+// agent/bitrix24/list.go
+package bitrix24
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrStopList can be returned by a ListEach callback to stop reading pages
+// without failing
+var ErrStopList = errors.New("stop listing")
+
+// contactSelect requests every standard, custom and multi-field of a
+// contact; "*" alone leaves out UF_ fields and PHONE/EMAIL/WEB/IM
+var contactSelect = []string{"*", "UF_*", "PHONE", "EMAIL", "WEB", "IM"}
+
+// reconcileContactFields are the contact fields read when enumerating
+// contacts, covering everything customerToContact writes
+var reconcileContactFields = []string{
+	"ID", "NAME", "LAST_NAME", "COMMENTS", "PHONE", "EMAIL",
+	"ADDRESS", "ADDRESS_CITY", "ADDRESS_POSTAL_CODE", "ADDRESS_COUNTRY",
+}
+
+// ListParams are the arguments of a crm.*.list or catalog.*.list call
+type ListParams struct {
+	Filter map[string]interface{}
+	Select []string
+	// Order defaults to ascending ID, which keeps offsets stable while
+	// records are added
+	Order map[string]string
+}
+
+// ListPage is one page of a list result
+type ListPage struct {
+	Records []map[string]interface{}
+	// Next is the "start" offset of the following page, 0 on the last page
+	Next int
+	// Total is the number of records matching the filter
+	Total int
+}
+
+// ListPage reads the page of method starting at offset start
+func (c *Client) ListPage(method string, params ListParams, start int) (*ListPage, error) {
+	order := params.Order
+	if order == nil {
+		order = map[string]string{"ID": "ASC"}
+	}
+
+	data := map[string]interface{}{
+		"order": order,
+		"start": start,
+	}
+	if params.Filter != nil {
+		data["filter"] = params.Filter
+	}
+	if len(params.Select) > 0 {
+		data["select"] = params.Select
+	}
+
+	var response APIResponse
+	if err := c.makeRequest(method, data, &response); err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", method, err)
+	}
+	if response.Error != nil {
+		return nil, response.Error
+	}
+
+	items, ok := listItems(response.Result)
+	if !ok {
+		return nil, fmt.Errorf("unexpected %s result", method)
+	}
+
+	page := &ListPage{
+		Records: make([]map[string]interface{}, 0, len(items)),
+		Next:    response.Next,
+		Total:   response.Total,
+	}
+	for _, item := range items {
+		if record, ok := item.(map[string]interface{}); ok {
+			page.Records = append(page.Records, record)
+		}
+	}
+
+	return page, nil
+}
+
+// listItems returns the records of a list result. crm.* methods return
+// them as an array; catalog.* methods wrap the array in an object with a
+// single key such as "storeProducts".
+func listItems(result interface{}) ([]interface{}, bool) {
+	switch value := result.(type) {
+	case []interface{}:
+		return value, true
+	case map[string]interface{}:
+		if len(value) == 1 {
+			for _, wrapped := range value {
+				items, ok := wrapped.([]interface{})
+				return items, ok
+			}
+		}
+	}
+	return nil, false
+}
+
+// ListEach calls fn for every record of method, following "next" from page
+// to page. It stops at the first error from fn; ErrStopList stops quietly.
+func (c *Client) ListEach(method string, params ListParams, fn func(record map[string]interface{}) error) error {
+	start := 0
+	for {
+		page, err := c.ListPage(method, params, start)
+		if err != nil {
+			return err
+		}
+
+		for _, record := range page.Records {
+			if err := fn(record); err != nil {
+				if errors.Is(err, ErrStopList) {
+					return nil
+				}
+				return err
+			}
+		}
+
+		// A next offset that does not advance would loop forever
+		if page.Next <= start {
+			return nil
+		}
+		start = page.Next
+	}
+}
+
+// ListAll returns every record of method across all pages
+func (c *Client) ListAll(method string, params ListParams) ([]map[string]interface{}, error) {
+	var records []map[string]interface{}
+	err := c.ListEach(method, params, func(record map[string]interface{}) error {
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c.logger.Debug("Listed Bitrix24 records", "method", method, "count", len(records))
+	return records, nil
+}
+
+// ListContacts returns every contact in the portal with the fields the sync
+// writes
+func (c *Client) ListContacts() ([]map[string]interface{}, error) {
+	return c.ListAll("crm.contact.list", ListParams{Select: reconcileContactFields})
+}
+
+// ListCompanies returns every company in the portal with the given fields
+func (c *Client) ListCompanies(fields ...string) ([]map[string]interface{}, error) {
+	return c.ListAll("crm.company.list", ListParams{Select: fields})
+}
+
+// RecordID returns the ID of a listed record, which Bitrix24 may encode as
+// a string or a number
+func RecordID(record map[string]interface{}) string {
+	switch id := record["ID"].(type) {
+	case string:
+		return id
+	case float64:
+		return fmt.Sprintf("%.0f", id)
+	}
+	return ""
+}
+
+// FieldString returns a field of a listed record as a string, "" when it
+// is missing
+func FieldString(record map[string]interface{}, field string) string {
+	return formatFieldValue(record[field])
+}
@@ -0,0 +1,141 @@
+package bitrix24
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestListAllFollowsPages(t *testing.T) {
+	client, server := newTestClient(t)
+	server.PageSize = 2
+	for i := 1; i <= 5; i++ {
+		server.Seed("contact", map[string]interface{}{"NAME": fmt.Sprintf("Contact %d", i)})
+	}
+
+	page, err := client.ListPage("crm.contact.list", ListParams{}, 0)
+	if err != nil {
+		t.Fatalf("ListPage: %v", err)
+	}
+	if len(page.Records) != 2 || page.Next != 2 || page.Total != 5 {
+		t.Errorf("first page = %d records, next %d, total %d", len(page.Records), page.Next, page.Total)
+	}
+
+	records, err := client.ListAll("crm.contact.list", ListParams{Select: []string{"ID", "NAME"}})
+	if err != nil {
+		t.Fatalf("ListAll: %v", err)
+	}
+	if len(records) != 5 || records[4]["NAME"] != "Contact 5" {
+		t.Errorf("records = %v", records)
+	}
+	if got := server.CallCount("crm.contact.list"); got != 4 {
+		t.Errorf("crm.contact.list calls = %d, want 4", got)
+	}
+}
+
+func TestListEachStops(t *testing.T) {
+	client, server := newTestClient(t)
+	server.PageSize = 2
+	for i := 1; i <= 5; i++ {
+		server.Seed("contact", map[string]interface{}{"NAME": fmt.Sprintf("Contact %d", i)})
+	}
+
+	seen := 0
+	err := client.ListEach("crm.contact.list", ListParams{}, func(record map[string]interface{}) error {
+		seen++
+		if seen == 3 {
+			return ErrStopList
+		}
+		return nil
+	})
+	if err != nil || seen != 3 {
+		t.Errorf("ListEach = %v after %d records, want nil after 3", err, seen)
+	}
+
+	failure := errors.New("boom")
+	err = client.ListEach("crm.contact.list", ListParams{}, func(map[string]interface{}) error { return failure })
+	if !errors.Is(err, failure) {
+		t.Errorf("ListEach error = %v, want %v", err, failure)
+	}
+}
+
+func TestFindContactByNameDecodesAllFields(t *testing.T) {
+	client, server := newTestClient(t)
+	server.PageSize = 1
+	oldest := server.Seed("contact", map[string]interface{}{"NAME": "Ferreteria Puig"})
+	full := server.Seed("contact", map[string]interface{}{
+		"NAME":          "Ferreteria Puig",
+		"LAST_NAME":     "SL",
+		"ADDRESS_CITY":  "Girona",
+		"UF_CRM_SECTOR": "Retail",
+		"PHONE":         []interface{}{map[string]interface{}{"VALUE": "931234567", "VALUE_TYPE": "WORK"}},
+		"EMAIL":         []interface{}{map[string]interface{}{"VALUE": "info@puig.example", "VALUE_TYPE": "WORK"}},
+		"WEB":           []interface{}{map[string]interface{}{"VALUE": "puig.example", "VALUE_TYPE": "WORK"}},
+		"IM":            []interface{}{map[string]interface{}{"VALUE": "puig", "VALUE_TYPE": "SKYPE"}},
+	})
+
+	contacts, err := client.FindContactsByName("Ferreteria Puig")
+	if err != nil {
+		t.Fatalf("FindContactsByName: %v", err)
+	}
+	if len(contacts) != 2 {
+		t.Fatalf("contacts = %d, want both pages", len(contacts))
+	}
+
+	contact, err := client.FindContactByName("Ferreteria Puig")
+	if err != nil {
+		t.Fatalf("FindContactByName: %v", err)
+	}
+	if contact.ID != oldest {
+		t.Fatalf("got contact %s, want the oldest %s", contact.ID, oldest)
+	}
+
+	contact, err = client.GetContact(full)
+	if err != nil {
+		t.Fatalf("GetContact: %v", err)
+	}
+	if len(contact.Phone) != 1 || contact.Phone[0].Value != "931234567" || contact.Phone[0].ID == "" {
+		t.Errorf("Phone = %+v", contact.Phone)
+	}
+	if len(contact.Email) != 1 || len(contact.Web) != 1 || len(contact.IM) != 1 || contact.IM[0].ValueType != "SKYPE" {
+		t.Errorf("Email = %+v, Web = %+v, IM = %+v", contact.Email, contact.Web, contact.IM)
+	}
+	if contact.Fields["UF_CRM_SECTOR"] != "Retail" || contact.Fields["ADDRESS_CITY"] != "Girona" {
+		t.Errorf("Fields = %v", contact.Fields)
+	}
+}
+
+func TestSaveContactRoundTripsFields(t *testing.T) {
+	client, server := newTestClient(t)
+	id := server.Seed("contact", map[string]interface{}{
+		"NAME":          "Bar Roca",
+		"UF_CRM_SECTOR": "Hostelería",
+		"PHONE":         []interface{}{map[string]interface{}{"VALUE": "600112233", "VALUE_TYPE": "MOBILE"}},
+	})
+
+	contact, err := client.GetContact(id)
+	if err != nil {
+		t.Fatalf("GetContact: %v", err)
+	}
+	contact.Phone[0].Value = "600999999"
+	contact.Fields["UF_CRM_SECTOR"] = "Restauración"
+
+	if _, err := client.SaveContact(contact); err != nil {
+		t.Fatalf("SaveContact: %v", err)
+	}
+
+	record := server.Record("contact", id)
+	phones := record["PHONE"].([]interface{})
+	if len(phones) != 1 || phones[0].(map[string]interface{})["VALUE"] != "600999999" {
+		t.Errorf("PHONE = %v, want the existing item updated", phones)
+	}
+	if record["UF_CRM_SECTOR"] != "Restauración" {
+		t.Errorf("UF_CRM_SECTOR = %v", record["UF_CRM_SECTOR"])
+	}
+
+	contact.ID = ""
+	newID, err := client.SaveContact(contact)
+	if err != nil || newID == "" || newID == id {
+		t.Errorf("SaveContact without ID = %q, %v; want a new contact", newID, err)
+	}
+}
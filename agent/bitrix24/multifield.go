@@ -0,0 +1,111 @@
+// agent/bitrix24/multifield.go
+package bitrix24
+
+import "saas-sync-platform/agent/normalize"
+
+// syncedMultiFields are the multi-fields written from Sage data
+var syncedMultiFields = []string{"PHONE", "EMAIL"}
+
+// withItemIDs returns the fields for updating CRM record id so that its
+// PHONE and EMAIL items are replaced rather than appended to. Items whose
+// value is already stored keep the stored item's ID, other items reuse the
+// IDs of stored items that are no longer wanted, and the stored items left
+// over are deleted with an empty VALUE. Multi-fields missing from fields
+// are not touched; see clearingMultiFields.
+func (c *Client) withItemIDs(entity, id string, fields map[string]interface{}) (map[string]interface{}, error) {
+	var names []string
+	for _, name := range syncedMultiFields {
+		if _, ok := fields[name]; ok {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return fields, nil
+	}
+
+	current, err := c.getRecordFields(entity, id)
+	if err != nil {
+		return nil, err
+	}
+
+	country := formatFieldValue(fields["ADDRESS_COUNTRY"])
+	if country == "" {
+		country = formatFieldValue(current["ADDRESS_COUNTRY"])
+	}
+	phoneKey := func(phone string) string { return normalize.PhoneKey(phone, country) }
+
+	updated := make(map[string]interface{}, len(fields))
+	for name, value := range fields {
+		updated[name] = value
+	}
+	for _, name := range names {
+		itemKey := emailKey
+		if name == "PHONE" {
+			itemKey = phoneKey
+		}
+		items := replaceItems(decodeMultiField(current[name]), multiFieldItems(fields[name]), itemKey)
+		if len(items) == 0 {
+			delete(updated, name)
+			continue
+		}
+		updated[name] = items
+	}
+
+	return updated, nil
+}
+
+// clearingMultiFields returns fields with an empty PHONE and EMAIL added
+// where they are missing, for updates of a record written in full from
+// Sage data: withItemIDs then deletes the stored items of the multi-fields
+// the Sage record no longer has
+func clearingMultiFields(fields map[string]interface{}) map[string]interface{} {
+	cleared := make(map[string]interface{}, len(fields)+len(syncedMultiFields))
+	for name, value := range fields {
+		cleared[name] = value
+	}
+	for _, name := range syncedMultiFields {
+		if _, ok := cleared[name]; !ok {
+			cleared[name] = []MultiField{}
+		}
+	}
+	return cleared
+}
+
+// replaceItems gives the wanted items the IDs of the stored ones, matching
+// values by key first, and appends deletions for the stored items left over
+func replaceItems(stored, wanted []MultiField, key func(string) string) []MultiField {
+	used := make([]bool, len(stored))
+	items := make([]MultiField, len(wanted))
+	copy(items, wanted)
+
+	for i := range items {
+		for j, item := range stored {
+			if !used[j] && item.ID != "" && key(item.Value) == key(items[i].Value) {
+				items[i].ID = item.ID
+				used[j] = true
+				break
+			}
+		}
+	}
+
+	for i := range items {
+		if items[i].ID != "" {
+			continue
+		}
+		for j, item := range stored {
+			if !used[j] && item.ID != "" {
+				items[i].ID = item.ID
+				used[j] = true
+				break
+			}
+		}
+	}
+
+	for j, item := range stored {
+		if !used[j] && item.ID != "" {
+			items = append(items, MultiField{ID: item.ID, TypeID: item.TypeID})
+		}
+	}
+
+	return items
+}
@@ -0,0 +1,344 @@
+// agent/bitrix24/oauth.go
+package bitrix24
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"saas-sync-platform/internal/shared"
+)
+
+// ErrNotInstalled is returned when no OAuth token is stored for a portal,
+// meaning the application has not been installed there yet.
+var ErrNotInstalled = errors.New("Bitrix24 application not installed on portal")
+
+// tokenRefreshMargin is how long before expiry an access token is renewed.
+const tokenRefreshMargin = time.Minute
+
+// TokenFileName is the name of the token store file in the agent data
+// directory.
+const TokenFileName = "bitrix24_tokens.json"
+
+// OAuthToken holds the OAuth credentials issued for one portal
+type OAuthToken struct {
+	AccessToken    string    `json:"access_token"`
+	RefreshToken   string    `json:"refresh_token"`
+	ExpiresAt      time.Time `json:"expires_at"`
+	ClientEndpoint string    `json:"client_endpoint"`
+	Domain         string    `json:"domain"`
+	MemberID       string    `json:"member_id,omitempty"`
+}
+
+// Expired reports whether the access token is expired or about to expire
+func (t *OAuthToken) Expired() bool {
+	return time.Now().Add(tokenRefreshMargin).After(t.ExpiresAt)
+}
+
+// TokenStore persists OAuth tokens per portal between agent restarts
+type TokenStore interface {
+	LoadToken(portal string) (*OAuthToken, error)
+	SaveToken(portal string, token *OAuthToken) error
+}
+
+// FileTokenStore keeps tokens in a JSON file with the access and refresh
+// tokens encrypted through the shared secret codec
+type FileTokenStore struct {
+	path    string
+	secrets *shared.SecretCodec
+	mu      sync.Mutex
+}
+
+// NewFileTokenStore creates a token store backed by path
+func NewFileTokenStore(path string, secrets *shared.SecretCodec) *FileTokenStore {
+	return &FileTokenStore{
+		path:    path,
+		secrets: secrets,
+	}
+}
+
+// LoadToken returns the stored token for portal or ErrNotInstalled
+func (s *FileTokenStore) LoadToken(portal string) (*OAuthToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokens, err := s.readAll()
+	if err != nil {
+		return nil, err
+	}
+
+	token, ok := tokens[portal]
+	if !ok {
+		return nil, ErrNotInstalled
+	}
+
+	if token.AccessToken, err = s.secrets.Decrypt(token.AccessToken); err != nil {
+		return nil, err
+	}
+	if token.RefreshToken, err = s.secrets.Decrypt(token.RefreshToken); err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// SaveToken stores token for portal, replacing any previous one
+func (s *FileTokenStore) SaveToken(portal string, token *OAuthToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokens, err := s.readAll()
+	if err != nil {
+		return err
+	}
+
+	stored := *token
+	if stored.AccessToken, err = s.secrets.Encrypt(token.AccessToken); err != nil {
+		return err
+	}
+	if stored.RefreshToken, err = s.secrets.Encrypt(token.RefreshToken); err != nil {
+		return err
+	}
+	tokens[portal] = &stored
+
+	data, err := json.MarshalIndent(tokens, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(s.path, data, 0600)
+}
+
+func (s *FileTokenStore) readAll() (map[string]*OAuthToken, error) {
+	tokens := make(map[string]*OAuthToken)
+
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return tokens, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token store: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("failed to parse token store: %w", err)
+	}
+
+	return tokens, nil
+}
+
+// OAuthApp implements the Bitrix24 OAuth 2.0 authorization-code flow for a
+// local or marketplace application
+type OAuthApp struct {
+	config     *shared.Bitrix24OAuthConfig
+	httpClient *http.Client
+}
+
+// NewOAuthApp creates an OAuth application from its configuration
+func NewOAuthApp(config *shared.Bitrix24OAuthConfig) *OAuthApp {
+	return &OAuthApp{
+		config:     config,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// AuthorizeURL returns the portal URL where an administrator grants access
+func (app *OAuthApp) AuthorizeURL(state string) string {
+	query := url.Values{}
+	query.Set("client_id", app.config.ClientID)
+	query.Set("response_type", "code")
+	if state != "" {
+		query.Set("state", state)
+	}
+	if app.config.RedirectURI != "" {
+		query.Set("redirect_uri", app.config.RedirectURI)
+	}
+
+	return fmt.Sprintf("https://%s/oauth/authorize/?%s", app.config.Portal, query.Encode())
+}
+
+// ExchangeCode trades an authorization code for an access token
+func (app *OAuthApp) ExchangeCode(code string) (*OAuthToken, error) {
+	return app.requestToken(url.Values{
+		"grant_type": {"authorization_code"},
+		"code":       {code},
+	})
+}
+
+// Refresh obtains a new access token using a refresh token
+func (app *OAuthApp) Refresh(refreshToken string) (*OAuthToken, error) {
+	return app.requestToken(url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+	})
+}
+
+// tokenResponse is the payload returned by the Bitrix24 OAuth server
+type tokenResponse struct {
+	AccessToken    string `json:"access_token"`
+	RefreshToken   string `json:"refresh_token"`
+	ExpiresIn      int64  `json:"expires_in"`
+	ClientEndpoint string `json:"client_endpoint"`
+	Domain         string `json:"domain"`
+	MemberID       string `json:"member_id"`
+	APIError
+}
+
+func (app *OAuthApp) requestToken(params url.Values) (*OAuthToken, error) {
+	params.Set("client_id", app.config.ClientID)
+	params.Set("client_secret", app.config.ClientSecret)
+
+	requestURL := app.config.GetOAuthServer() + "/oauth/token/?" + params.Encode()
+
+	resp, err := app.httpClient.Get(requestURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token response: %w", err)
+	}
+
+	var payload tokenResponse
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("failed to parse token response (HTTP %d): %w", resp.StatusCode, err)
+	}
+
+	if payload.ErrorCode != "" {
+		return nil, &payload.APIError
+	}
+	if resp.StatusCode != http.StatusOK || payload.AccessToken == "" {
+		return nil, fmt.Errorf("token request failed with HTTP %d", resp.StatusCode)
+	}
+
+	token := &OAuthToken{
+		AccessToken:    payload.AccessToken,
+		RefreshToken:   payload.RefreshToken,
+		ExpiresAt:      time.Now().Add(time.Duration(payload.ExpiresIn) * time.Second),
+		ClientEndpoint: payload.ClientEndpoint,
+		Domain:         payload.Domain,
+		MemberID:       payload.MemberID,
+	}
+	if token.ClientEndpoint == "" {
+		token.ClientEndpoint = fmt.Sprintf("https://%s/rest/", app.config.Portal)
+	}
+
+	return token, nil
+}
+
+// InstallHandler returns an HTTP handler that completes the install flow by
+// exchanging the code of the OAuth redirect for a token, stored under the
+// configured portal. The redirect must carry state, which must not be
+// empty; install events posting AUTH_ID directly are rejected, as nothing
+// proves they come from the portal. installed, when not nil, is called
+// once the token is stored.
+func (app *OAuthApp) InstallHandler(store TokenStore, state string, installed func()) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+
+		code := r.Form.Get("code")
+		if code == "" {
+			http.Error(w, "missing authorization code", http.StatusBadRequest)
+			return
+		}
+		got := r.Form.Get("state")
+		if state == "" || subtle.ConstantTimeCompare([]byte(got), []byte(state)) != 1 {
+			http.Error(w, "state mismatch", http.StatusForbidden)
+			return
+		}
+
+		token, err := app.ExchangeCode(code)
+		if err != nil {
+			slog.Error("Bitrix24 OAuth install failed", "portal", app.config.Portal, "error", err)
+			http.Error(w, "authorization failed", http.StatusBadGateway)
+			return
+		}
+
+		if err := store.SaveToken(app.config.Portal, token); err != nil {
+			slog.Error("Failed to store Bitrix24 OAuth token", "portal", app.config.Portal, "error", err)
+			http.Error(w, "failed to store token", http.StatusInternalServerError)
+			return
+		}
+
+		slog.Info("Bitrix24 application installed", "portal", app.config.Portal)
+		fmt.Fprintln(w, "Sage Sync is now connected to Bitrix24. You can close this window.")
+
+		if installed != nil {
+			installed()
+		}
+	})
+}
+
+// oauthSession supplies valid access tokens to the client, refreshing and
+// persisting them as needed
+type oauthSession struct {
+	app    *OAuthApp
+	store  TokenStore
+	portal string
+	token  *OAuthToken
+	mu     sync.Mutex
+}
+
+// accessToken returns a valid token, refreshing it when close to expiry
+func (s *oauthSession) accessToken() (*OAuthToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token.Expired() {
+		if err := s.refreshLocked(); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.token, nil
+}
+
+// refresh forces a token refresh, e.g. after the API rejected the token
+func (s *oauthSession) refresh() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.refreshLocked()
+}
+
+func (s *oauthSession) refreshLocked() error {
+	token, err := s.app.Refresh(s.token.RefreshToken)
+	if err != nil {
+		return fmt.Errorf("failed to refresh Bitrix24 token: %w", err)
+	}
+
+	if err := s.store.SaveToken(s.portal, token); err != nil {
+		return fmt.Errorf("failed to store refreshed Bitrix24 token: %w", err)
+	}
+
+	s.token = token
+	slog.Debug("Refreshed Bitrix24 OAuth token", "portal", s.portal)
+	return nil
+}
+
+// isTokenError reports whether err means the access token must be renewed
+func isTokenError(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return apiErr.ErrorCode == "expired_token" || apiErr.ErrorCode == "invalid_token"
+}
@@ -0,0 +1,137 @@
+package bitrix24
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"saas-sync-platform/agent/bitrix24/bitrix24test"
+	"saas-sync-platform/internal/shared"
+)
+
+func newOAuthTestSetup(t *testing.T) (*shared.Bitrix24Config, *FileTokenStore, *bitrix24test.Server) {
+	t.Helper()
+
+	server := bitrix24test.NewServer()
+	t.Cleanup(server.Close)
+	server.EnableOAuth("app.123", "secret")
+
+	dir := t.TempDir()
+	store := NewFileTokenStore(filepath.Join(dir, "tokens.json"), shared.NewSecretCodec(dir))
+
+	config := &shared.Bitrix24Config{
+		OAuth: &shared.Bitrix24OAuthConfig{
+			Portal:       "portal.example",
+			ClientID:     "app.123",
+			ClientSecret: "secret",
+			OAuthServer:  server.URL,
+		},
+	}
+
+	return config, store, server
+}
+
+func TestNewOAuthClientRequiresInstall(t *testing.T) {
+	config, store, _ := newOAuthTestSetup(t)
+
+	if _, err := NewOAuthClient(config, store); !errors.Is(err, ErrNotInstalled) {
+		t.Fatalf("error = %v, want ErrNotInstalled", err)
+	}
+}
+
+func TestInstallHandlerRequiresState(t *testing.T) {
+	config, store, _ := newOAuthTestSetup(t)
+	handler := NewOAuthApp(config.OAuth).InstallHandler(store, "", nil)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/callback?code="+bitrix24test.AuthCode+"&state=", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want 403 without an expected state", rec.Code)
+	}
+}
+
+func TestInstallHandlerStoresToken(t *testing.T) {
+	config, store, server := newOAuthTestSetup(t)
+	app := NewOAuthApp(config.OAuth)
+
+	installed := 0
+	handler := app.InstallHandler(store, "xyz", func() { installed++ })
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/callback?code="+bitrix24test.AuthCode+"&state=bad", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("state mismatch status = %d, want 403", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/callback?code="+bitrix24test.AuthCode, nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("missing state status = %d, want 403", rec.Code)
+	}
+
+	// Tokens posted by an install event are not trusted.
+	form := strings.NewReader("AUTH_ID=planted&REFRESH_ID=planted&DOMAIN=portal.example&state=xyz")
+	req := httptest.NewRequest(http.MethodPost, "/callback", form)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("install event status = %d, want 400", rec.Code)
+	}
+	if _, err := store.LoadToken("portal.example"); !errors.Is(err, ErrNotInstalled) {
+		t.Fatalf("token stored before the code exchange: %v", err)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/callback?code="+bitrix24test.AuthCode+"&state=xyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+	if installed != 1 {
+		t.Errorf("installed called %d times, want 1", installed)
+	}
+
+	token, err := store.LoadToken("portal.example")
+	if err != nil {
+		t.Fatalf("LoadToken: %v", err)
+	}
+	if token.AccessToken != server.AccessToken() {
+		t.Errorf("AccessToken = %s, want %s", token.AccessToken, server.AccessToken())
+	}
+}
+
+func TestOAuthClientRefreshesExpiredToken(t *testing.T) {
+	config, store, server := newOAuthTestSetup(t)
+
+	token, err := NewOAuthApp(config.OAuth).ExchangeCode(bitrix24test.AuthCode)
+	if err != nil {
+		t.Fatalf("ExchangeCode: %v", err)
+	}
+	if err := store.SaveToken("portal.example", token); err != nil {
+		t.Fatalf("SaveToken: %v", err)
+	}
+
+	client, err := NewOAuthClient(config, store)
+	if err != nil {
+		t.Fatalf("NewOAuthClient: %v", err)
+	}
+
+	server.ExpireAccessToken()
+	if _, err := client.CreateContact(testCustomer()); err != nil {
+		t.Fatalf("CreateContact after expiry: %v", err)
+	}
+
+	stored, err := store.LoadToken("portal.example")
+	if err != nil {
+		t.Fatalf("LoadToken: %v", err)
+	}
+	if stored.RefreshToken != server.RefreshToken() {
+		t.Errorf("stored refresh token %s not rotated to %s", stored.RefreshToken, server.RefreshToken())
+	}
+	if got := len(server.Records("contact")); got != 1 {
+		t.Errorf("stored contacts = %d, want 1", got)
+	}
+}
@@ -0,0 +1,68 @@
+// agent/bitrix24/payload.go
+package bitrix24
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"saas-sync-platform/internal/shared"
+)
+
+// ContactPayload returns the fields that would be sent to Bitrix24 for a
+// customer
+func (c *Client) ContactPayload(customer *shared.Customer) map[string]interface{} {
+	return c.customerToContact(customer)
+}
+
+// customerCodePattern finds the Sage code written into contact comments
+var customerCodePattern = regexp.MustCompile(`Customer Code:\s*(\S+)`)
+
+// CustomerCodeFromComments returns the Sage customer code recorded in the
+// COMMENTS of a contact created by the sync, or "" if there is none
+func CustomerCodeFromComments(comments string) string {
+	match := customerCodePattern.FindStringSubmatch(comments)
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
+
+// PayloadHash returns a hash of a normalised payload. Map keys are sorted
+// and surrounding whitespace is ignored, so equivalent payloads hash equal.
+func PayloadHash(payload map[string]interface{}) string {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return ""
+	}
+
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return ""
+	}
+
+	normalised, _ := json.Marshal(normalisePayload(generic))
+	sum := sha256.Sum256(normalised)
+	return hex.EncodeToString(sum[:])
+}
+
+func normalisePayload(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = normalisePayload(item)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalisePayload(item)
+		}
+		return v
+	default:
+		return v
+	}
+}
@@ -0,0 +1,208 @@
+// agent/bitrix24/plan.go
+package bitrix24
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"saas-sync-platform/agent/normalize"
+	"saas-sync-platform/internal/shared"
+)
+
+// Actions SyncCustomer can take for a customer
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionSkip   = "skip"
+)
+
+// FieldChange describes a single field that would change in Bitrix24
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// ContactPlan describes what SyncCustomer would do for a customer without
+// doing it
+type ContactPlan struct {
+	Action    string        `json:"action"`
+	ContactID string        `json:"contact_id,omitempty"`
+	Changes   []FieldChange `json:"changes,omitempty"`
+}
+
+// PlanCustomer computes the create/update/skip decision and the changed
+// fields for a customer, planned against contactID when the customer is
+// already linked to a contact, like UpsertCustomer. It only performs read
+// requests.
+func (c *Client) PlanCustomer(customer *shared.Customer, contactID string) (*ContactPlan, error) {
+	desired := c.customerToContact(customer)
+
+	if contactID == "" {
+		existing, err := c.FindContactByName(customer.Name)
+		if errors.Is(err, ErrContactNotFound) {
+			return c.planNewCustomer(customer, desired)
+		}
+		if err != nil {
+			return nil, err
+		}
+		contactID = existing.ID
+	}
+
+	current, err := c.GetContactFields(contactID)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &ContactPlan{
+		Action:    ActionUpdate,
+		ContactID: contactID,
+		Changes:   diffFields(current, desired),
+	}
+	if len(plan.Changes) == 0 {
+		plan.Action = ActionSkip
+	}
+
+	return plan, nil
+}
+
+// ContactChanges lists the fields of an existing contact that differ from
+// what would be pushed for customer
+func (c *Client) ContactChanges(customer *shared.Customer, current map[string]interface{}) []FieldChange {
+	return diffFields(current, c.customerToContact(customer))
+}
+
+// GetContactFields returns the raw fields of a contact as stored in Bitrix24
+func (c *Client) GetContactFields(contactID string) (map[string]interface{}, error) {
+	return c.getRecordFields("contact", contactID)
+}
+
+// getRecordFields returns the raw fields of a CRM record with crm.<entity>.get
+func (c *Client) getRecordFields(entity, id string) (map[string]interface{}, error) {
+	data := map[string]interface{}{
+		"id": id,
+	}
+
+	var response APIResponse
+	err := c.makeRequest("crm."+entity+".get", data, &response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s: %w", entity, err)
+	}
+
+	if response.Error != nil {
+		return nil, response.Error
+	}
+
+	fields, ok := response.Result.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected crm.%s.get result", entity)
+	}
+
+	return fields, nil
+}
+
+// diffFields lists the desired fields whose value differs from current,
+// in field name order
+func diffFields(current, desired map[string]interface{}) []FieldChange {
+	names := make([]string, 0, len(desired))
+	for name := range desired {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Phones already in Bitrix24 may be written in national format
+	country := formatFieldValue(desired["ADDRESS_COUNTRY"])
+	valueKey := strings.ToLower
+	phoneKey := func(phone string) string { return normalize.PhoneKey(phone, country) }
+
+	var changes []FieldChange
+	for _, name := range names {
+		oldValue := formatFieldValue(current[name])
+		newValue := formatFieldValue(desired[name])
+
+		if isMultiField(desired[name]) {
+			key := valueKey
+			if name == "PHONE" {
+				key = phoneKey
+			}
+			if containsAllValues(oldValue, newValue, key) {
+				continue
+			}
+		} else if oldValue == newValue {
+			continue
+		}
+
+		changes = append(changes, FieldChange{Field: name, Old: oldValue, New: newValue})
+	}
+
+	return changes
+}
+
+// formatFieldValue renders a field value for comparison and reporting.
+// Multi-fields are rendered as a comma-separated list of their values.
+func formatFieldValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case []PhoneField:
+		values := make([]string, len(v))
+		for i, phone := range v {
+			values[i] = phone.Value
+		}
+		return strings.Join(values, ", ")
+	case []EmailField:
+		values := make([]string, len(v))
+		for i, email := range v {
+			values[i] = email.Value
+		}
+		return strings.Join(values, ", ")
+	case []MultiField:
+		values := make([]string, len(v))
+		for i, item := range v {
+			values[i] = item.Value
+		}
+		return strings.Join(values, ", ")
+	case []interface{}:
+		var values []string
+		for _, item := range v {
+			if field, ok := item.(map[string]interface{}); ok {
+				values = append(values, formatFieldValue(field["VALUE"]))
+			}
+		}
+		return strings.Join(values, ", ")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func isMultiField(value interface{}) bool {
+	switch value.(type) {
+	case []PhoneField, []EmailField, []MultiField:
+		return true
+	}
+	return false
+}
+
+// containsAllValues reports whether every value of the desired list is
+// already present in the current list, comparing values through key
+func containsAllValues(current, desired string, key func(string) string) bool {
+	present := make(map[string]bool)
+	for _, value := range strings.Split(current, ", ") {
+		present[key(value)] = true
+	}
+	for _, value := range strings.Split(desired, ", ") {
+		if !present[key(value)] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,126 @@
+// agent/bitrix24/pricing.go
+package bitrix24
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"saas-sync-platform/internal/shared"
+)
+
+// SyncsPrices reports whether Sage price bands are mapped to price types
+func (c *Client) SyncsPrices() bool {
+	return c.config.Pricing != nil && len(c.config.Pricing.PriceTypes) > 0
+}
+
+// SyncsCustomerPricing reports whether a tariff or discount field is
+// configured
+func (c *Client) SyncsCustomerPricing() bool {
+	pricing := c.config.Pricing
+	return pricing != nil && (pricing.TariffField != "" || pricing.DiscountField != "")
+}
+
+// PricePayload returns the price of a product for each price type, by
+// price type ID, with the four decimals Sage keeps for unit prices. Prices
+// of price bands that are not mapped are left out.
+func (c *Client) PricePayload(prices []shared.ProductPrice) map[int]float64 {
+	types := make(map[int]float64)
+	for _, price := range prices {
+		if priceType, ok := c.config.PriceTypeID(price.PriceBand); ok {
+			types[priceType] = round4(price.Price)
+		}
+	}
+	return types
+}
+
+// SetProductPrices writes the prices of a product for the given price
+// types, adding those it has no price for yet. Prices of other price types
+// are left alone.
+func (c *Client) SetProductPrices(productID string, prices map[int]float64) error {
+	currency := c.config.PriceCurrency()
+
+	existing := make(map[int]map[string]interface{})
+	err := c.ListEach("catalog.price.list", ListParams{
+		Filter: map[string]interface{}{"productId": productID},
+		Select: []string{"id", "catalogGroupId", "price", "currency"},
+		Order:  map[string]string{"id": "ASC"},
+	}, func(record map[string]interface{}) error {
+		priceType, _ := strconv.Atoi(formatFieldValue(record["catalogGroupId"]))
+		existing[priceType] = record
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	priceTypes := make([]int, 0, len(prices))
+	for priceType := range prices {
+		priceTypes = append(priceTypes, priceType)
+	}
+	sort.Ints(priceTypes)
+
+	for _, priceType := range priceTypes {
+		price := prices[priceType]
+		record, ok := existing[priceType]
+		if !ok {
+			_, err := c.callCatalog("catalog.price.add", map[string]interface{}{
+				"fields": map[string]interface{}{
+					"productId":      productID,
+					"catalogGroupId": priceType,
+					"price":          price,
+					"currency":       currency,
+				},
+			})
+			if err != nil {
+				return fmt.Errorf("failed to add price type %d of product %s: %w", priceType, productID, err)
+			}
+			continue
+		}
+
+		current, _ := strconv.ParseFloat(formatFieldValue(record["price"]), 64)
+		if round4(current) == price && formatFieldValue(record["currency"]) == currency {
+			continue
+		}
+		_, err := c.callCatalog("catalog.price.update", map[string]interface{}{
+			"id":     formatFieldValue(record["id"]),
+			"fields": map[string]interface{}{"price": price, "currency": currency},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update price type %d of product %s: %w", priceType, productID, err)
+		}
+	}
+
+	c.logger.Info("Synced Bitrix24 product prices", "product_id", productID, "price_types", len(prices))
+	return nil
+}
+
+// CustomerPricingPayload returns the custom fields written for the tariff
+// and discounts of a customer, keyed by the configured field names. The
+// discount rules are written as text such as "TORNILLERIA 12%; * 5%",
+// where "*" stands for every product.
+func (c *Client) CustomerPricingPayload(pricing *shared.CustomerPricing) map[string]interface{} {
+	settings := c.config.Pricing
+	if settings == nil {
+		return nil
+	}
+
+	fields := make(map[string]interface{})
+	if settings.TariffField != "" {
+		fields[settings.TariffField] = pricing.PriceBand
+	}
+	if settings.DiscountField != "" {
+		rules := make([]string, len(pricing.Discounts))
+		for i, rule := range pricing.Discounts {
+			group := rule.ProductGroup
+			if group == "" {
+				group = "*"
+			}
+			rules[i] = fmt.Sprintf("%s %s%%", group, strconv.FormatFloat(roundCents(rule.Percent), 'f', -1, 64))
+		}
+		fields[settings.DiscountField] = strings.Join(rules, "; ")
+	}
+
+	return fields
+}
@@ -0,0 +1,162 @@
+// agent/bitrix24/stock.go
+package bitrix24
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"saas-sync-platform/internal/shared"
+)
+
+// Catalog document types used to move store quantities
+const (
+	stockDocumentArrival  = "S" // stock adjustment, adds to storeTo
+	stockDocumentWriteOff = "D" // write-off, removes from storeFrom
+)
+
+// StockChange is an adjustment of the quantity of a product in a store
+type StockChange struct {
+	ProductID string
+	StoreID   int
+	Delta     float64
+}
+
+// SyncsStock reports whether Sage warehouses are mapped to stores
+func (c *Client) SyncsStock() bool {
+	return c.config.Stock != nil && len(c.config.Stock.Warehouses) > 0
+}
+
+// StockPayload returns the quantity each store must hold for the stock
+// levels of a product, by store ID. Warehouses that are not mapped are
+// left out; warehouses sharing a store add up.
+func (c *Client) StockPayload(levels []shared.StockLevel) map[int]float64 {
+	stores := make(map[int]float64)
+	for _, level := range levels {
+		if store, ok := c.config.StoreID(level.Warehouse); ok {
+			stores[store] = round4(stores[store] + level.Quantity)
+		}
+	}
+	return stores
+}
+
+// StoreQuantities returns the quantities of products in stores, by product
+// ID and store ID. Stores that never held a product are left out.
+func (c *Client) StoreQuantities(productIDs []string) (map[string]map[int]float64, error) {
+	quantities := make(map[string]map[int]float64)
+	if len(productIDs) == 0 {
+		return quantities, nil
+	}
+
+	err := c.ListEach("catalog.storeproduct.list", ListParams{
+		Filter: map[string]interface{}{"productId": productIDs},
+		Select: []string{"id", "productId", "storeId", "amount"},
+		Order:  map[string]string{"id": "ASC"},
+	}, func(record map[string]interface{}) error {
+		productID := formatFieldValue(record["productId"])
+		store, _ := strconv.Atoi(formatFieldValue(record["storeId"]))
+		amount, _ := strconv.ParseFloat(formatFieldValue(record["amount"]), 64)
+		if quantities[productID] == nil {
+			quantities[productID] = make(map[int]float64)
+		}
+		quantities[productID][store] = amount
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return quantities, nil
+}
+
+// AdjustStock applies store quantity changes. Store quantities cannot be
+// written directly, so increases go into a stock adjustment document and
+// decreases into a write-off, each conducted once all its rows are added.
+// Changes below the precision of a quantity are ignored.
+func (c *Client) AdjustStock(changes []StockChange) error {
+	var arrivals, writeOffs []StockChange
+	for _, change := range changes {
+		switch delta := round4(change.Delta); {
+		case delta > 0:
+			arrivals = append(arrivals, change)
+		case delta < 0:
+			writeOffs = append(writeOffs, change)
+		}
+	}
+
+	if err := c.conductStockDocument(stockDocumentArrival, arrivals); err != nil {
+		return err
+	}
+	return c.conductStockDocument(stockDocumentWriteOff, writeOffs)
+}
+
+// conductStockDocument creates a catalog document of the given type with a
+// row per change and conducts it
+func (c *Client) conductStockDocument(docType string, changes []StockChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	result, err := c.callCatalog("catalog.document.add", map[string]interface{}{
+		"fields": map[string]interface{}{
+			"docType":  docType,
+			"currency": c.config.StockCurrency(),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create stock document: %w", err)
+	}
+	created, _ := result.(map[string]interface{})
+	document, _ := created["document"].(map[string]interface{})
+	documentID := formatFieldValue(document["id"])
+	if documentID == "" {
+		return fmt.Errorf("catalog.document.add returned no document ID")
+	}
+
+	// A document that cannot be conducted is deleted rather than left as a
+	// draft for someone to find and conduct later
+	for _, change := range changes {
+		element := map[string]interface{}{
+			"docId":     documentID,
+			"elementId": change.ProductID,
+			"amount":    round4(math.Abs(change.Delta)),
+		}
+		if docType == stockDocumentArrival {
+			element["storeTo"] = change.StoreID
+		} else {
+			element["storeFrom"] = change.StoreID
+		}
+
+		if _, err := c.callCatalog("catalog.document.element.add", map[string]interface{}{"fields": element}); err != nil {
+			c.deleteStockDocument(documentID)
+			return fmt.Errorf("failed to add product %s to stock document %s: %w", change.ProductID, documentID, err)
+		}
+	}
+
+	if _, err := c.callCatalog("catalog.document.conduct", map[string]interface{}{"id": documentID}); err != nil {
+		c.deleteStockDocument(documentID)
+		return fmt.Errorf("failed to conduct stock document %s: %w", documentID, err)
+	}
+
+	c.logger.Info("Adjusted Bitrix24 store quantities", "document_id", documentID,
+		"doc_type", docType, "rows", len(changes))
+	return nil
+}
+
+// deleteStockDocument deletes a stock document that was not conducted
+func (c *Client) deleteStockDocument(documentID string) {
+	if _, err := c.callCatalog("catalog.document.delete", map[string]interface{}{"id": documentID}); err != nil {
+		c.logger.Error("Failed to delete unconducted stock document", "document_id", documentID, "error", err)
+	}
+}
+
+// callCatalog calls a catalog.* method and returns its result
+func (c *Client) callCatalog(method string, data map[string]interface{}) (interface{}, error) {
+	var response APIResponse
+	if err := c.makeRequest(method, data, &response); err != nil {
+		return nil, err
+	}
+	if response.Error != nil {
+		return nil, response.Error
+	}
+	return response.Result, nil
+}
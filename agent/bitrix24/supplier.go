@@ -0,0 +1,104 @@
+// agent/bitrix24/supplier.go
+package bitrix24
+
+import (
+	"errors"
+	"fmt"
+
+	"saas-sync-platform/agent/normalize"
+	"saas-sync-platform/internal/shared"
+)
+
+// SupplierOriginator is the ORIGINATOR_ID of the companies created for
+// Sage suppliers; their ORIGIN_ID is the supplier code
+const SupplierOriginator = "sage200c-supplier"
+
+// SupplierPayload returns the fields of the company of a Sage supplier.
+// Its comment names the supplier code rather than a customer code, so
+// reconciliation never takes it for a customer.
+func (c *Client) SupplierPayload(supplier *shared.Supplier) map[string]interface{} {
+	fields := map[string]interface{}{
+		"TITLE":         supplier.Name,
+		"COMPANY_TYPE":  c.config.SupplierCompanyType(),
+		"ORIGINATOR_ID": SupplierOriginator,
+		"ORIGIN_ID":     supplier.Code,
+		"COMMENTS":      fmt.Sprintf("Synced from Sage 200c - Supplier Code: %s", supplier.Code),
+	}
+	if supplier.TaxNumber != "" {
+		fields["COMMENTS"] = fmt.Sprintf("%s - Tax number: %s", fields["COMMENTS"], supplier.TaxNumber)
+	}
+
+	info := normalize.Supplier(supplier)
+	if phones := phoneFields(info.Phones); len(phones) > 0 {
+		fields["PHONE"] = phones
+	}
+	if emails := emailFields(info.Emails); len(emails) > 0 {
+		fields["EMAIL"] = emails
+	}
+
+	if supplier.Address != "" {
+		fields["ADDRESS"] = supplier.Address
+	}
+	if supplier.City != "" {
+		fields["ADDRESS_CITY"] = supplier.City
+	}
+	if supplier.PostalCode != "" {
+		fields["ADDRESS_POSTAL_CODE"] = supplier.PostalCode
+	}
+	if supplier.Country != "" {
+		fields["ADDRESS_COUNTRY"] = supplier.Country
+	}
+
+	return fields
+}
+
+// SyncsSuppliers reports whether suppliers are pushed as companies
+func (c *Client) SyncsSuppliers() bool {
+	return c.config.SyncSuppliers
+}
+
+// UpsertSupplier updates the company with the given ID, or finds the
+// company created for the supplier by origin when companyID is empty,
+// creating it if none exists. It returns the company ID and ActionCreate
+// or ActionUpdate.
+func (c *Client) UpsertSupplier(supplier *shared.Supplier, companyID string) (string, string, error) {
+	if companyID == "" {
+		existing, err := c.FindSupplierCompany(supplier.Code)
+		if err != nil && !errors.Is(err, ErrCompanyNotFound) {
+			return "", ActionCreate, err
+		}
+		companyID = existing
+	}
+
+	action := ActionUpdate
+	if companyID == "" {
+		action = ActionCreate
+	}
+
+	id, err := c.saveWholeRecord("company", companyID, c.SupplierPayload(supplier))
+	if err != nil {
+		return "", action, err
+	}
+
+	c.logger.Info("Synced Bitrix24 supplier company", "supplier_code", supplier.Code,
+		"company_id", id, "action", action)
+	return id, action, nil
+}
+
+// FindSupplierCompany returns the ID of the company created for a Sage
+// supplier
+func (c *Client) FindSupplierCompany(supplierCode string) (string, error) {
+	params := ListParams{
+		Filter: map[string]interface{}{"ORIGINATOR_ID": SupplierOriginator, "ORIGIN_ID": supplierCode},
+		Select: []string{"ID"},
+	}
+
+	page, err := c.ListPage("crm.company.list", params, 0)
+	if err != nil {
+		return "", fmt.Errorf("failed to search supplier company: %w", err)
+	}
+	if len(page.Records) == 0 {
+		return "", ErrCompanyNotFound
+	}
+	return RecordID(page.Records[0]), nil
+}
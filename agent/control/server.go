@@ -0,0 +1,212 @@
+// agent/control/server.go
+package control
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"saas-sync-platform/internal/shared"
+)
+
+// Errors an Agent returns to signal client mistakes rather than failures
+var (
+	ErrUnknownEntity = errors.New("unknown entity")
+	ErrNotRunning    = errors.New("sync is not running")
+)
+
+// Log tail limits for GET /api/logs
+const (
+	defaultLogLines = 100
+	maxLogLines     = 1000
+)
+
+// Status describes the agent's current state
+type Status struct {
+	ClientCode     string    `json:"client_code"`
+	Running        bool      `json:"running"`
+	Paused         bool      `json:"paused"`
+	DryRun         bool      `json:"dry_run"`
+	Status         string    `json:"status"`
+	LastSync       time.Time `json:"last_sync,omitempty"`
+	PendingRetries int       `json:"pending_retries"`
+}
+
+// Agent is the part of the tray agent the control API operates
+type Agent interface {
+	Status() Status
+	Results() []shared.SyncResult
+	SyncNow(entity string) (*shared.SyncResult, error)
+	Pause() error
+	Resume() error
+}
+
+// Server exposes an Agent over a token-protected HTTP API meant to be
+// bound to a loopback address
+type Server struct {
+	agent   Agent
+	token   string
+	logPath string
+}
+
+// NewServer creates a control API for agent. Requests must carry token as
+// a bearer token; logPath is the file served by /api/logs.
+func NewServer(agent Agent, token, logPath string) *Server {
+	return &Server{
+		agent:   agent,
+		token:   token,
+		logPath: logPath,
+	}
+}
+
+// Handler returns the API routes wrapped in token authentication
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/status", s.handleStatus)
+	mux.HandleFunc("GET /api/results", s.handleResults)
+	mux.HandleFunc("POST /api/sync/{entity}", s.handleSync)
+	mux.HandleFunc("POST /api/pause", s.handlePause)
+	mux.HandleFunc("POST /api/resume", s.handleResume)
+	mux.HandleFunc("GET /api/logs", s.handleLogs)
+
+	return s.authenticate(mux)
+}
+
+// Serve listens on addr, which must be a loopback address, until the
+// returned server is closed
+func (s *Server) Serve(addr string) (*http.Server, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid control API address %q: %w", addr, err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return nil, fmt.Errorf("control API must listen on a loopback address, got %q", addr)
+	}
+	if s.token == "" {
+		return nil, fmt.Errorf("control API token is required")
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for control API on %s: %w", addr, err)
+	}
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Control API stopped", "addr", addr, "error", err)
+		}
+	}()
+
+	slog.Info("Serving control API", "addr", addr)
+	return server, nil
+}
+
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="sagesync"`)
+			writeError(w, http.StatusUnauthorized, errors.New("invalid or missing token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.agent.Status())
+}
+
+func (s *Server) handleResults(w http.ResponseWriter, r *http.Request) {
+	results := s.agent.Results()
+	if results == nil {
+		results = []shared.SyncResult{}
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+func (s *Server) handleSync(w http.ResponseWriter, r *http.Request) {
+	entity := r.PathValue("entity")
+	slog.Info("Sync requested through control API", "entity", entity)
+
+	result, err := s.agent.SyncNow(entity)
+	switch {
+	case errors.Is(err, ErrUnknownEntity):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, ErrNotRunning):
+		writeError(w, http.StatusConflict, err)
+	case result != nil:
+		// A cycle that ran but reported errors still returns its result
+		writeJSON(w, http.StatusOK, result)
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err)
+	default:
+		writeJSON(w, http.StatusOK, struct{}{})
+	}
+}
+
+func (s *Server) handlePause(w http.ResponseWriter, r *http.Request) {
+	s.changeState(w, s.agent.Pause)
+}
+
+func (s *Server) handleResume(w http.ResponseWriter, r *http.Request) {
+	s.changeState(w, s.agent.Resume)
+}
+
+func (s *Server) changeState(w http.ResponseWriter, change func() error) {
+	if err := change(); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrNotRunning) {
+			status = http.StatusConflict
+		}
+		writeError(w, status, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.agent.Status())
+}
+
+func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
+	lines := defaultLogLines
+	if value := r.URL.Query().Get("lines"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid lines %q", value))
+			return
+		}
+		lines = min(n, maxLogLines)
+	}
+
+	tail, err := TailFile(s.logPath, lines)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"path":  s.logPath,
+		"lines": tail,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,142 @@
+package control
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"saas-sync-platform/internal/shared"
+)
+
+const testToken = "test-token"
+
+type fakeAgent struct {
+	paused  bool
+	running bool
+	synced  []string
+}
+
+func (f *fakeAgent) Status() Status {
+	return Status{ClientCode: "TEST", Running: f.running, Paused: f.paused}
+}
+
+func (f *fakeAgent) Results() []shared.SyncResult {
+	return []shared.SyncResult{{TaskID: "customers-1", Success: true}}
+}
+
+func (f *fakeAgent) SyncNow(entity string) (*shared.SyncResult, error) {
+	if entity != "customer" {
+		return nil, ErrUnknownEntity
+	}
+	if !f.running {
+		return nil, ErrNotRunning
+	}
+	f.synced = append(f.synced, entity)
+	return &shared.SyncResult{TaskID: "customers-2", Success: true, RecordsCount: 3}, nil
+}
+
+func (f *fakeAgent) Pause() error {
+	f.paused = true
+	return nil
+}
+
+func (f *fakeAgent) Resume() error {
+	f.paused = false
+	return nil
+}
+
+func do(t *testing.T, handler http.Handler, method, path, token string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestServerRequiresToken(t *testing.T) {
+	handler := NewServer(&fakeAgent{}, testToken, "").Handler()
+
+	for _, token := range []string{"", "wrong"} {
+		if got := do(t, handler, "GET", "/api/status", token).Code; got != http.StatusUnauthorized {
+			t.Errorf("token %q: status = %d, want 401", token, got)
+		}
+	}
+	if got := do(t, handler, "GET", "/api/status", testToken).Code; got != http.StatusOK {
+		t.Errorf("valid token: status = %d, want 200", got)
+	}
+}
+
+func TestServerSyncAndPause(t *testing.T) {
+	agent := &fakeAgent{running: true}
+	handler := NewServer(agent, testToken, "").Handler()
+
+	resp := do(t, handler, "POST", "/api/sync/customer", testToken)
+	var result shared.SyncResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil || result.RecordsCount != 3 {
+		t.Fatalf("sync response = %d %+v, %v", resp.Code, result, err)
+	}
+	if got := do(t, handler, "POST", "/api/sync/invoice", testToken).Code; got != http.StatusNotFound {
+		t.Errorf("unknown entity status = %d, want 404", got)
+	}
+	if got := do(t, handler, "GET", "/api/sync/customer", testToken).Code; got != http.StatusMethodNotAllowed {
+		t.Errorf("GET sync status = %d, want 405", got)
+	}
+
+	resp = do(t, handler, "POST", "/api/pause", testToken)
+	var status Status
+	json.NewDecoder(resp.Body).Decode(&status)
+	if !agent.paused || !status.Paused {
+		t.Errorf("pause: agent paused = %v, status = %+v", agent.paused, status)
+	}
+
+	do(t, handler, "POST", "/api/resume", testToken)
+	if agent.paused {
+		t.Error("resume did not clear paused")
+	}
+
+	agent.running = false
+	if got := do(t, handler, "POST", "/api/sync/customer", testToken).Code; got != http.StatusConflict {
+		t.Errorf("sync while stopped status = %d, want 409", got)
+	}
+}
+
+func TestServerLogs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.log")
+	var content strings.Builder
+	for _, line := range []string{"one", "two", "three", "four"} {
+		content.WriteString(line + "\n")
+	}
+	os.WriteFile(path, []byte(content.String()), 0644)
+
+	handler := NewServer(&fakeAgent{}, testToken, path).Handler()
+
+	resp := do(t, handler, "GET", "/api/logs?lines=2", testToken)
+	var body struct {
+		Lines []string `json:"lines"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	if strings.Join(body.Lines, ",") != "three,four" {
+		t.Errorf("lines = %v, want [three four]", body.Lines)
+	}
+
+	if got := do(t, handler, "GET", "/api/logs?lines=x", testToken).Code; got != http.StatusBadRequest {
+		t.Errorf("invalid lines status = %d, want 400", got)
+	}
+}
+
+func TestServeRejectsNonLoopback(t *testing.T) {
+	if _, err := NewServer(&fakeAgent{}, testToken, "").Serve("0.0.0.0:0"); err == nil {
+		t.Error("expected error for non-loopback address")
+	}
+	if _, err := NewServer(&fakeAgent{}, "", "").Serve("127.0.0.1:0"); err == nil {
+		t.Error("expected error without token")
+	}
+}
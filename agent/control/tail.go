@@ -0,0 +1,59 @@
+// agent/control/tail.go
+package control
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// tailChunk bounds how much of the end of a file TailFile reads
+const tailChunk = 1 << 20
+
+// TailFile returns up to n of the last lines of the file at path. Only the
+// final megabyte is read, so very long lines may reduce the count. A
+// missing file yields no lines.
+func TailFile(path string, n int) ([]string, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	offset := max(info.Size()-tailChunk, 0)
+	data, err := io.ReadAll(io.NewSectionReader(file, offset, info.Size()-offset))
+	if err != nil {
+		return nil, err
+	}
+
+	// Drop a partial first line when reading from the middle of the file
+	if offset > 0 {
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			data = data[i+1:]
+		}
+	}
+
+	data = bytes.TrimRight(data, "\n")
+	if len(data) == 0 {
+		return []string{}, nil
+	}
+
+	all := bytes.Split(data, []byte("\n"))
+	if len(all) > n {
+		all = all[len(all)-n:]
+	}
+
+	lines := make([]string, len(all))
+	for i, line := range all {
+		lines[i] = string(bytes.TrimRight(line, "\r"))
+	}
+	return lines, nil
+}
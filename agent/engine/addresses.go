@@ -0,0 +1,101 @@
+// agent/engine/addresses.go
+package engine
+
+import (
+	"time"
+
+	"saas-sync-platform/agent/bitrix24"
+	"saas-sync-platform/agent/metrics"
+	"saas-sync-platform/agent/sage"
+	"saas-sync-platform/agent/state"
+	"saas-sync-platform/internal/shared"
+)
+
+// entityAddress links a customer code to the contact its addresses were
+// last written to and is the dead-letter entity type of customers whose
+// addresses failed to sync
+const entityAddress = "address"
+
+// syncAddresses syncs the fiscal and delivery addresses of the customers of
+// this cycle and of customers whose addresses changed since the given
+// time, and of those due for retry. Customers without a contact yet,
+// because they failed or were flagged, are left for the cycle that creates
+// it.
+func (e *Engine) syncAddresses(customers []shared.Customer, since time.Time, result *shared.SyncResult) {
+	source, ok := e.source.(sage.AddressSource)
+	if !ok {
+		return
+	}
+
+	defer e.stepSucceeded(entityAddress, result.FailedCount, result)
+
+	changed, err := source.GetRecentAddresses(since)
+	if err != nil {
+		e.Metrics.Error(metrics.SourceSage, "READ_FAILED")
+		e.logger.Error("Failed to read Sage customer addresses", "error", err)
+		result.FailedCount++
+		return
+	}
+	e.Metrics.RecordsRead(entityAddress, e.Company, len(changed))
+
+	codes := make([]string, len(changed))
+	for i, address := range changed {
+		codes[i] = address.CustomerCode
+	}
+	for _, letter := range e.DeadLetters.Due(entityAddress, time.Now()) {
+		result.RetriedCount++
+		codes = append(codes, letter.Code)
+	}
+	customers = e.withCustomers(customers, codes, result)
+
+	for i := range customers {
+		customer := &customers[i]
+		contact, ok := e.Identities.Get(entityCustomer, customer.Code)
+		if !ok {
+			continue
+		}
+		if err := e.pushAddresses(source, customer, contact.RemoteID); err != nil {
+			e.logger.Error("Failed to sync customer addresses",
+				"customer_code", customer.Code, "name", customer.Name, "error", err)
+			result.FailedCount++
+			e.recordEntityFailure(entityAddress, customer.Code, customer.Name, err)
+		} else if err := e.DeadLetters.Resolve(entityAddress, customer.Code); err != nil {
+			e.logger.Error("Failed to update dead-letter queue", "customer_code", customer.Code, "error", err)
+		}
+	}
+}
+
+// pushAddresses writes the addresses of a customer to its contact unless
+// they are unchanged since the last push to the same contact
+func (e *Engine) pushAddresses(source sage.AddressSource, customer *shared.Customer, contactID string) error {
+	addresses, err := source.GetCustomerAddresses(customer.Code)
+	if err != nil {
+		return err
+	}
+
+	hash := bitrix24.PayloadHash(map[string]interface{}{
+		"CONTACT_ID": contactID,
+		"REQUISITES": e.bitrix24.AddressPayload(customer, addresses),
+	})
+
+	identity, known := e.Identities.Get(entityAddress, customer.Code)
+	if known && identity.Hash == hash {
+		e.Metrics.RecordPushed(entityAddress, bitrix24.ActionSkip)
+		return nil
+	}
+	if !known && len(addresses) == 0 {
+		return nil
+	}
+
+	client := e.bitrix24.WithLogger(e.logger).WithMetrics(e.Metrics)
+	if err := client.SyncAddresses(contactID, customer, addresses); err != nil {
+		return err
+	}
+	e.Metrics.RecordPushed(entityAddress, bitrix24.ActionUpdate)
+
+	return e.Identities.Put(entityAddress, customer.Code, state.Identity{
+		RemoteID: contactID,
+		Hash:     hash,
+		SyncedAt: time.Now(),
+	})
+}
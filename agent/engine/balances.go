@@ -0,0 +1,41 @@
+// agent/engine/balances.go
+package engine
+
+import (
+	"saas-sync-platform/agent/metrics"
+	"saas-sync-platform/agent/sage"
+	"saas-sync-platform/internal/shared"
+)
+
+// entityBalance links a customer code to the contact its balance fields
+// were last written to
+const entityBalance = "balance"
+
+// syncBalances computes the balance of every customer and writes those
+// that changed to the customers' contacts and companies
+func (e *Engine) syncBalances(result *shared.SyncResult) {
+	source, ok := e.source.(sage.BalanceSource)
+	if !ok || !e.bitrix24.SyncsBalances() {
+		return
+	}
+
+	defer e.stepSucceeded(entityBalance, result.FailedCount, result)
+
+	balances, err := source.GetCustomerBalances()
+	if err != nil {
+		e.Metrics.Error(metrics.SourceSage, "READ_FAILED")
+		e.logger.Error("Failed to read Sage customer balances", "error", err)
+		result.FailedCount++
+		return
+	}
+	e.Metrics.RecordsRead(entityBalance, e.Company, len(balances))
+
+	customers := make([]customerFields, len(balances))
+	for i := range balances {
+		customers[i] = customerFields{
+			code:   balances[i].CustomerCode,
+			fields: e.bitrix24.BalancePayload(&balances[i]),
+		}
+	}
+	e.syncCustomerFields(entityBalance, customers, result)
+}
@@ -0,0 +1,97 @@
+// agent/engine/catalog.go
+package engine
+
+import (
+	"time"
+
+	"saas-sync-platform/agent/bitrix24"
+	"saas-sync-platform/agent/state"
+	"saas-sync-platform/internal/shared"
+)
+
+// productPush describes how the Sage data of a product, such as its stock
+// or prices, is written to its Bitrix24 catalog product. The data itself
+// is kept by the caller, keyed by product code.
+type productPush struct {
+	// entity is the identity and dead-letter entity type of the pushes
+	entity string
+	// reload reads the data of a product due for retry that did not change
+	// in this cycle
+	reload func(code string) error
+	// payload returns the data written to a product; it is hashed to skip
+	// products unchanged since the last push
+	payload func(client *bitrix24.Client, code, productID string) map[string]interface{}
+	// write writes the data of a product
+	write func(client *bitrix24.Client, code, productID string) error
+}
+
+// syncProducts pushes the products with the given codes, and those due for
+// retry, to the Bitrix24 catalog. A product that fails goes to the
+// dead-letter queue under the push's entity type.
+func (e *Engine) syncProducts(push productPush, codes []string, result *shared.SyncResult) {
+	inCycle := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		inCycle[code] = true
+	}
+	for _, letter := range e.DeadLetters.Due(push.entity, time.Now()) {
+		result.RetriedCount++
+		if inCycle[letter.Code] {
+			continue
+		}
+		if err := push.reload(letter.Code); err != nil {
+			e.logger.Error("Failed to reload product for retry", "entity", push.entity,
+				"product_code", letter.Code, "error", err)
+			result.FailedCount++
+			if _, err := e.DeadLetters.RecordFailure(push.entity, letter.Code, letter.Name, err); err != nil {
+				e.logger.Error("Failed to update dead-letter queue", "product_code", letter.Code, "error", err)
+			}
+			continue
+		}
+		codes = append(codes, letter.Code)
+	}
+
+	client := e.bitrix24.WithLogger(e.logger).WithMetrics(e.Metrics)
+	for _, code := range codes {
+		if err := e.pushProduct(client, push, code); err != nil {
+			e.logger.Error("Failed to sync product", "entity", push.entity, "product_code", code, "error", err)
+			result.FailedCount++
+			if _, err := e.DeadLetters.RecordFailure(push.entity, code, code, err); err != nil {
+				e.logger.Error("Failed to update dead-letter queue", "product_code", code, "error", err)
+			}
+		} else if err := e.DeadLetters.Resolve(push.entity, code); err != nil {
+			e.logger.Error("Failed to update dead-letter queue", "product_code", code, "error", err)
+		}
+	}
+}
+
+// pushProduct writes the data of a product unless it is unchanged since the
+// last push. Products that are not in the Bitrix24 catalog are skipped.
+func (e *Engine) pushProduct(client *bitrix24.Client, push productPush, code string) error {
+	products, err := client.FindProductIDs([]string{code})
+	if err != nil {
+		return err
+	}
+	productID, ok := products[code]
+	if !ok {
+		e.logger.Debug("Product is not in the Bitrix24 catalog, skipping", "entity", push.entity, "product_code", code)
+		return nil
+	}
+
+	hash := bitrix24.PayloadHash(push.payload(client, code, productID))
+	identity, known := e.Identities.Get(push.entity, code)
+	if known && identity.Hash == hash {
+		e.Metrics.RecordPushed(push.entity, bitrix24.ActionSkip)
+		return nil
+	}
+
+	if err := push.write(client, code, productID); err != nil {
+		return err
+	}
+	e.Metrics.RecordPushed(push.entity, bitrix24.ActionUpdate)
+
+	return e.Identities.Put(push.entity, code, state.Identity{
+		RemoteID: productID,
+		Hash:     hash,
+		SyncedAt: time.Now(),
+	})
+}
@@ -0,0 +1,113 @@
+// agent/engine/collections.go
+package engine
+
+import (
+	"time"
+
+	"saas-sync-platform/agent/bitrix24"
+	"saas-sync-platform/agent/metrics"
+	"saas-sync-platform/agent/sage"
+	"saas-sync-platform/agent/state"
+	"saas-sync-platform/internal/shared"
+)
+
+// entityCollection links a sales order ID to the deal its collection state
+// was last written to and is the dead-letter entity type of those writes
+const entityCollection = "collection"
+
+// syncCollections writes the collection state of the sales orders whose
+// receivables changed since the given time, and of those due for retry, to
+// their deals. It runs after the sales orders of the cycle are pushed, so
+// an order invoiced and collected in the same period already has its deal;
+// receivables of invoices not raised from an order have no deal to update.
+func (e *Engine) syncCollections(since time.Time, result *shared.SyncResult) {
+	source, ok := e.source.(sage.ReceivableSource)
+	if !ok || !e.bitrix24.SyncsCollections() {
+		return
+	}
+
+	defer e.stepSucceeded(entityCollection, result.FailedCount, result)
+
+	changed, err := source.GetRecentReceivables(since)
+	if err != nil {
+		e.Metrics.Error(metrics.SourceSage, "READ_FAILED")
+		e.logger.Error("Failed to read Sage receivables", "error", err)
+		result.FailedCount++
+		return
+	}
+	e.Metrics.RecordsRead(entityCollection, e.Company, len(changed))
+
+	var orderIDs []string
+	invoices := make(map[string]string)
+	for _, receivable := range changed {
+		if receivable.OrderID == "" {
+			continue
+		}
+		if _, seen := invoices[receivable.OrderID]; !seen {
+			orderIDs = append(orderIDs, receivable.OrderID)
+			invoices[receivable.OrderID] = receivable.InvoiceNumber
+		}
+	}
+	for _, letter := range e.DeadLetters.Due(entityCollection, time.Now()) {
+		result.RetriedCount++
+		if _, seen := invoices[letter.Code]; !seen {
+			orderIDs = append(orderIDs, letter.Code)
+			invoices[letter.Code] = letter.Name
+		}
+	}
+
+	client := e.bitrix24.WithLogger(e.logger).WithMetrics(e.Metrics)
+	for _, orderID := range orderIDs {
+		if err := e.pushCollection(client, source, orderID); err != nil {
+			e.logger.Error("Failed to sync collection state", "order_id", orderID,
+				"invoice", invoices[orderID], "error", err)
+			result.FailedCount++
+			if _, err := e.DeadLetters.RecordFailure(entityCollection, orderID, invoices[orderID], err); err != nil {
+				e.logger.Error("Failed to update dead-letter queue", "order_id", orderID, "error", err)
+			}
+		} else if err := e.DeadLetters.Resolve(entityCollection, orderID); err != nil {
+			e.logger.Error("Failed to update dead-letter queue", "order_id", orderID, "error", err)
+		}
+	}
+}
+
+// pushCollection writes the collection state of a sales order to its deal
+// unless it is unchanged since the last write to the same deal. Orders
+// without a deal are skipped.
+func (e *Engine) pushCollection(client *bitrix24.Client, source sage.ReceivableSource, orderID string) error {
+	deal, ok := e.Identities.Get(entitySalesOrder, orderID)
+	if !ok {
+		e.logger.Debug("Sales order has no deal, skipping collection state", "order_id", orderID)
+		return nil
+	}
+
+	receivables, err := source.GetOrderReceivables(orderID)
+	if err != nil {
+		return err
+	}
+	summary := shared.SummarizeReceivables(receivables)
+	fields := client.CollectionPayload(&summary)
+	hash := bitrix24.PayloadHash(map[string]interface{}{
+		"DEAL_ID": deal.RemoteID,
+		"FIELDS":  fields,
+	})
+
+	identity, known := e.Identities.Get(entityCollection, orderID)
+	if known && identity.Hash == hash {
+		e.Metrics.RecordPushed(entityCollection, bitrix24.ActionSkip)
+		return nil
+	}
+
+	if err := client.UpdateDealCollection(deal.RemoteID, fields); err != nil {
+		return err
+	}
+	e.Metrics.RecordPushed(entityCollection, bitrix24.ActionUpdate)
+
+	e.logger.Info("Updated deal collection state", "order_id", orderID, "deal_id", deal.RemoteID,
+		"status", summary.Status, "outstanding", summary.Outstanding)
+	return e.Identities.Put(entityCollection, orderID, state.Identity{
+		RemoteID: deal.RemoteID,
+		Hash:     hash,
+		SyncedAt: time.Now(),
+	})
+}
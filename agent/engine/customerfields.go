@@ -0,0 +1,65 @@
+// agent/engine/customerfields.go
+package engine
+
+import (
+	"time"
+
+	"saas-sync-platform/agent/bitrix24"
+	"saas-sync-platform/agent/state"
+	"saas-sync-platform/internal/shared"
+)
+
+// customerFields are custom fields written to the contact and company of a
+// customer, such as its balance or tariff
+type customerFields struct {
+	code   string
+	fields map[string]interface{}
+}
+
+// syncCustomerFields writes the fields of every customer that changed to
+// the customers' contacts and companies, tracked under the given entity
+// type. The fields are read in full each cycle, so a failed push is simply
+// tried again on the next one instead of going to the dead-letter queue.
+// Customers without a contact yet are left for the cycle that creates it.
+func (e *Engine) syncCustomerFields(entity string, customers []customerFields, result *shared.SyncResult) {
+	client := e.bitrix24.WithLogger(e.logger).WithMetrics(e.Metrics)
+	for _, customer := range customers {
+		contact, ok := e.Identities.Get(entityCustomer, customer.code)
+		if !ok {
+			continue
+		}
+		if err := e.pushCustomerFields(client, entity, customer, contact.RemoteID); err != nil {
+			e.logger.Error("Failed to sync customer fields", "entity", entity,
+				"customer_code", customer.code, "error", err)
+			result.FailedCount++
+		}
+	}
+}
+
+// pushCustomerFields writes the fields of a customer unless they are
+// unchanged since the last push to the same contact
+func (e *Engine) pushCustomerFields(client *bitrix24.Client, entity string, customer customerFields, contactID string) error {
+	company, _ := e.Identities.Get(entityCompany, customer.code)
+	hash := bitrix24.PayloadHash(map[string]interface{}{
+		"CONTACT_ID": contactID,
+		"COMPANY_ID": company.RemoteID,
+		"FIELDS":     customer.fields,
+	})
+
+	identity, known := e.Identities.Get(entity, customer.code)
+	if known && identity.Hash == hash {
+		e.Metrics.RecordPushed(entity, bitrix24.ActionSkip)
+		return nil
+	}
+
+	if err := client.UpdateCustomerFields(contactID, company.RemoteID, customer.fields); err != nil {
+		return err
+	}
+	e.Metrics.RecordPushed(entity, bitrix24.ActionUpdate)
+
+	return e.Identities.Put(entity, customer.code, state.Identity{
+		RemoteID: contactID,
+		Hash:     hash,
+		SyncedAt: time.Now(),
+	})
+}
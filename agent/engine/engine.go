@@ -0,0 +1,337 @@
+// agent/engine/engine.go
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"saas-sync-platform/agent/bitrix24"
+	"saas-sync-platform/agent/metrics"
+	"saas-sync-platform/agent/normalize"
+	"saas-sync-platform/agent/sage"
+	"saas-sync-platform/agent/state"
+	"saas-sync-platform/agent/tickelia"
+	"saas-sync-platform/internal/logging"
+	"saas-sync-platform/internal/shared"
+)
+
+// initialLookback is how far back the first sync cycle looks for changes
+const initialLookback = 24 * time.Hour
+
+// entityCustomer is the identity map entity type for Sage customers
+const entityCustomer = "customer"
+
+// syncedEntities are the entity types a cycle syncs, in the order of its
+// steps
+var syncedEntities = []string{
+	entityCustomer, entityAddress, entityContactPerson, entityBalance, entityPricing, entityWonDeal,
+	entitySalesOrder, entityCollection, entityStock, entityPrice, entitySupplier,
+}
+
+// SyncedEntities returns the entity types a cycle syncs, in the order of
+// its steps. Every cycle runs every step, skipping those not configured.
+func SyncedEntities() []string {
+	return append([]string(nil), syncedEntities...)
+}
+
+// Engine runs sync cycles from a Sage customer source to the configured
+// integrations
+type Engine struct {
+	clientCode string
+	source     sage.CustomerSource
+	bitrix24   *bitrix24.Client
+	lastSync   *watermark
+	logger     *slog.Logger
+
+	// RequestDelay is the pause between Bitrix24 requests
+	RequestDelay time.Duration
+	// DryRun makes cycles write a preview report instead of syncing
+	DryRun bool
+	// ReportDir is where dry-run reports are written
+	ReportDir string
+	// Identities links Sage records to Bitrix24 entities and remembers the
+	// hash of the last pushed payload so unchanged records are skipped
+	Identities *state.IdentityMap
+	// DeadLetters keeps records that failed to sync for retry with backoff
+	DeadLetters *state.DeadLetterQueue
+	// Metrics records throughput and failures; nil disables metrics
+	Metrics *metrics.Metrics
+	// Company is the Sage company the records belong to, used to label
+	// metrics
+	Company string
+	// CreateSageOrders makes cycles create Sage sales orders for deals won
+	// in Bitrix24
+	CreateSageOrders bool
+	// Tickelia receives Sage suppliers as expense vendors; nil when
+	// Tickelia is not configured
+	Tickelia *tickelia.Client
+}
+
+// NewEngine creates a sync engine. bitrixClient may be nil when Bitrix24
+// is not configured.
+func NewEngine(clientCode string, source sage.CustomerSource, bitrixClient *bitrix24.Client) *Engine {
+	return &Engine{
+		clientCode:   clientCode,
+		source:       source,
+		bitrix24:     bitrixClient,
+		lastSync:     &watermark{},
+		logger:       slog.Default(),
+		RequestDelay: 100 * time.Millisecond,
+		Identities:   state.NewMemoryIdentityMap(),
+		DeadLetters:  state.NewMemoryDeadLetterQueue(),
+	}
+}
+
+// watermark is the start time of the last completed cycle, read by status
+// requests while a cycle runs
+type watermark struct {
+	mu sync.Mutex
+	at time.Time
+}
+
+// LastSync returns the start time of the last completed cycle
+func (e *Engine) LastSync() time.Time {
+	e.lastSync.mu.Lock()
+	defer e.lastSync.mu.Unlock()
+	return e.lastSync.at
+}
+
+// SetLastSync sets the watermark the next cycle reads changes from
+func (e *Engine) SetLastSync(lastSync time.Time) {
+	e.lastSync.mu.Lock()
+	defer e.lastSync.mu.Unlock()
+	e.lastSync.at = lastSync
+}
+
+// withLogger returns a copy of the engine that logs through logger. The
+// copy shares the watermark, state and clients of e.
+func (e *Engine) withLogger(logger *slog.Logger) *Engine {
+	cycle := *e
+	cycle.logger = logger
+	return &cycle
+}
+
+// SyncCustomers runs one customer sync cycle: it reads customers modified
+// since the previous cycle and pushes them, their addresses and their
+// contact persons to Bitrix24, refreshes the balance, tariff and discount
+// fields of every synced customer, and pushes the sales orders and quotes
+// modified in the same period as deals, together with the collection state
+// of their invoices, and the store quantities and prices of the products
+// whose stock or prices changed.
+// With CreateSageOrders, deals won in Bitrix24 first become Sage sales
+// orders. Suppliers modified in the period go to Bitrix24 and Tickelia
+// last.
+func (e *Engine) SyncCustomers() (*shared.SyncResult, error) {
+	syncID := logging.NewCorrelationID()
+
+	// Every line logged during this cycle carries its correlation ID, and
+	// those of each step the entity it syncs.
+	cycle := e.withLogger(slog.With("sync_id", syncID))
+	return cycle.syncCustomers(syncID)
+}
+
+// step returns a copy of the engine for a step of a cycle, whose lines are
+// logged with the entity the step syncs
+func (e *Engine) step(entity string) *Engine {
+	return e.withLogger(e.logger.With("entity", entity))
+}
+
+// stepSucceeded records the time of a step's success when it added no
+// failures to result, which held failed of them when the step started
+func (e *Engine) stepSucceeded(entity string, failed int, result *shared.SyncResult) {
+	if result.FailedCount == failed {
+		e.Metrics.SyncSucceeded(entity, e.Company, time.Now())
+	}
+}
+
+func (e *Engine) syncCustomers(syncID string) (*shared.SyncResult, error) {
+	started := time.Now()
+	result := &shared.SyncResult{
+		TaskID:   "customers-" + syncID,
+		ClientID: e.clientCode,
+	}
+
+	if err := e.source.TestConnection(); err != nil {
+		e.Metrics.Error(metrics.SourceSage, "CONNECTION_FAILED")
+		return e.fail(result, fmt.Errorf("Sage connection test failed: %w", err))
+	}
+
+	since := started.Add(-initialLookback)
+	if lastSync := e.LastSync(); !lastSync.IsZero() {
+		since = lastSync
+	}
+
+	customers, err := e.source.GetRecentCustomers(since)
+	if err != nil {
+		e.Metrics.Error(metrics.SourceSage, "READ_FAILED")
+		return e.fail(result, fmt.Errorf("failed to read Sage customers: %w", err))
+	}
+
+	result.RecordsCount = len(customers)
+	e.Metrics.RecordsRead(entityCustomer, e.Company, len(customers))
+	e.step(entityCustomer).logger.Info("Found customers to sync", "count", len(customers), "since", since)
+
+	// A dry run leaves the watermark alone so the real cycle sees the same
+	// changes that were previewed.
+	if e.DryRun {
+		report := e.previewCustomers(customers, since)
+		if e.ReportDir != "" {
+			if _, _, err := report.SaveFiles(e.ReportDir); err != nil {
+				return e.fail(result, fmt.Errorf("failed to write dry-run report: %w", err))
+			}
+		}
+
+		result.Success = true
+		result.CompletedAt = time.Now()
+		e.logger.Info("Dry run completed", "summary", report.Summary)
+		return result, nil
+	}
+
+	if e.bitrix24 != nil {
+		customers = e.step(entityCustomer).pushCustomers(customers, result)
+		e.step(entityAddress).syncAddresses(customers, since, result)
+		e.step(entityContactPerson).syncContactPersons(customers, since, result)
+		e.step(entityBalance).syncBalances(result)
+		e.step(entityPricing).syncCustomerPricing(result)
+		e.step(entityWonDeal).syncWonDeals(since, result)
+		e.step(entitySalesOrder).syncSalesOrders(since, result)
+		e.step(entityCollection).syncCollections(since, result)
+		e.step(entityStock).syncStock(since, result)
+		e.step(entityPrice).syncPrices(since, result)
+	}
+	e.step(entitySupplier).syncSuppliers(since, result)
+
+	e.SetLastSync(started)
+	result.CompletedAt = time.Now()
+
+	if result.FailedCount > 0 {
+		result.ErrorMessage = fmt.Sprintf("sync completed with %d errors", result.FailedCount)
+		return result, fmt.Errorf("Bitrix24 %s", result.ErrorMessage)
+	}
+
+	result.Success = true
+	e.logger.Info("Sync completed successfully", "processed", len(customers),
+		"skipped", result.SkippedCount, "duration", time.Since(started))
+	return result, nil
+}
+
+// pushCustomers syncs customers, and those due for retry, to Bitrix24 one
+// by one, counting skipped and failed records. It returns the customers
+// pushed, for the steps that follow.
+func (e *Engine) pushCustomers(customers []shared.Customer, result *shared.SyncResult) []shared.Customer {
+	defer e.stepSucceeded(entityCustomer, result.FailedCount, result)
+
+	customers = e.addDueRetries(customers, result)
+	e.logger.Info("Starting sync of customers to Bitrix24", "count", len(customers))
+
+	for i := range customers {
+		customer := &customers[i]
+		action, err := e.pushCustomer(customer, false)
+		var duplicate *bitrix24.DuplicateError
+		if errors.As(err, &duplicate) {
+			e.logger.Warn("Customer matches existing contacts, flagged for review",
+				"customer_code", customer.Code, "name", customer.Name, "contact_ids", duplicate.ContactIDs)
+			result.FlaggedCount++
+			e.recordFailure(customer, err)
+		} else if err != nil {
+			e.logger.Error("Failed to sync customer",
+				"customer_code", customer.Code, "name", customer.Name, "error", err)
+			result.FailedCount++
+			e.recordFailure(customer, err)
+		} else if err := e.DeadLetters.Resolve(entityCustomer, customer.Code); err != nil {
+			e.logger.Error("Failed to update dead-letter queue", "customer_code", customer.Code, "error", err)
+		}
+		if action == bitrix24.ActionSkip {
+			result.SkippedCount++
+			continue
+		}
+
+		// Rate limiting - pause between requests
+		time.Sleep(e.RequestDelay)
+	}
+
+	e.logger.Info("Bitrix24 sync completed",
+		"successful", len(customers)-result.FailedCount-result.FlaggedCount-result.SkippedCount,
+		"unchanged", result.SkippedCount, "flagged", result.FlaggedCount, "errors", result.FailedCount)
+	return customers
+}
+
+// withCustomers returns customers followed by the customers with the given
+// codes that are not among them yet, read from Sage. Customers that cannot
+// be read are counted as failed.
+func (e *Engine) withCustomers(customers []shared.Customer, codes []string, result *shared.SyncResult) []shared.Customer {
+	seen := make(map[string]bool, len(customers))
+	all := make([]shared.Customer, 0, len(customers))
+	for _, customer := range customers {
+		seen[customer.Code] = true
+		all = append(all, customer)
+	}
+
+	for _, code := range codes {
+		if seen[code] {
+			continue
+		}
+		seen[code] = true
+
+		customer, err := e.source.GetCustomerDetails(code)
+		if err != nil {
+			e.logger.Error("Failed to read customer", "customer_code", code, "error", err)
+			result.FailedCount++
+			continue
+		}
+		all = append(all, *customer)
+	}
+
+	return all
+}
+
+// pushCustomer writes a customer to Bitrix24 unless the mapped payload is
+// identical to the one pushed last time or force is set, and returns the
+// action taken. Contacts edited directly in Bitrix24 are only corrected
+// once the Sage record changes again or is resynced.
+func (e *Engine) pushCustomer(customer *shared.Customer, force bool) (string, error) {
+	e.reportRejects(normalize.Customer(customer).Rejects, "customer_code", customer.Code)
+	hash := bitrix24.PayloadHash(e.bitrix24.ContactPayload(customer))
+
+	identity, known := e.Identities.Get(entityCustomer, customer.Code)
+	if known && identity.Hash == hash && !force {
+		e.logger.Debug("Customer unchanged, skipping",
+			"customer_code", customer.Code, "contact_id", identity.RemoteID)
+		e.Metrics.RecordPushed(entityCustomer, bitrix24.ActionSkip)
+		return bitrix24.ActionSkip, nil
+	}
+
+	client := e.bitrix24.WithLogger(e.logger).WithMetrics(e.Metrics)
+	contactID, action, err := client.UpsertCustomer(customer, identity.RemoteID)
+	if err != nil {
+		return action, err
+	}
+	e.Metrics.RecordPushed(entityCustomer, action)
+
+	return action, e.Identities.Put(entityCustomer, customer.Code, state.Identity{
+		RemoteID: contactID,
+		Hash:     hash,
+		SyncedAt: time.Now(),
+	})
+}
+
+// reportRejects logs the parts of phone, fax and email fields that are not
+// valid and will not reach Bitrix24; attrs identify the record
+func (e *Engine) reportRejects(rejects []normalize.Reject, attrs ...any) {
+	for _, reject := range rejects {
+		e.logger.With(attrs...).Warn("Dropping invalid contact data",
+			"field", reject.Field, "value", reject.Value, "reason", reject.Reason)
+		e.Metrics.Error(metrics.SourceSage, "INVALID_"+strings.ToUpper(reject.Field))
+	}
+}
+
+func (e *Engine) fail(result *shared.SyncResult, err error) (*shared.SyncResult, error) {
+	e.logger.Error("Sync failed", "error", err)
+	result.ErrorMessage = err.Error()
+	result.CompletedAt = time.Now()
+	return result, err
+}
@@ -0,0 +1,1159 @@
+package engine
+
+import (
+	"errors"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"saas-sync-platform/agent/bitrix24"
+	"saas-sync-platform/agent/bitrix24/bitrix24test"
+	"saas-sync-platform/agent/metrics"
+	"saas-sync-platform/agent/sage"
+	"saas-sync-platform/agent/tickelia"
+	"saas-sync-platform/agent/tickelia/tickeliatest"
+	"saas-sync-platform/internal/shared"
+)
+
+func newTestEngine(t *testing.T) (*Engine, *sage.MemorySource, *bitrix24test.Server) {
+	t.Helper()
+
+	source, err := sage.LoadMemorySource("testdata/customers.json")
+	if err != nil {
+		t.Fatalf("LoadMemorySource: %v", err)
+	}
+
+	server := bitrix24test.NewServer()
+	t.Cleanup(server.Close)
+
+	// Rate-limited requests fail at once so tests can inject failures.
+	client := bitrix24.NewClient(&shared.Bitrix24Config{APITenant: server.WebhookURL()}).
+		WithRateLimitBackoff(0, 0)
+
+	engine := NewEngine("TEST", source, client)
+	engine.RequestDelay = 0
+	engine.SetLastSync(time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC))
+
+	return engine, source, server
+}
+
+func TestSyncCustomersEndToEnd(t *testing.T) {
+	engine, source, server := newTestEngine(t)
+
+	result, err := engine.SyncCustomers()
+	if err != nil {
+		t.Fatalf("first cycle: %v", err)
+	}
+	if !result.Success || result.RecordsCount != 2 {
+		t.Fatalf("first cycle result = %+v, want 2 records", result)
+	}
+
+	contacts := server.Records("contact")
+	if len(contacts) != 2 {
+		t.Fatalf("contacts = %d, want 2", len(contacts))
+	}
+
+	// Only customers changed after the previous cycle are read again.
+	customer, _ := source.GetCustomerDetails("430000002")
+	customer.City = "Roses"
+	customer.ModifiedDate = time.Now().Add(time.Second)
+	source.PutCustomer(*customer)
+
+	result, err = engine.SyncCustomers()
+	if err != nil {
+		t.Fatalf("second cycle: %v", err)
+	}
+	if result.RecordsCount != 1 {
+		t.Errorf("second cycle records = %d, want 1", result.RecordsCount)
+	}
+	if got := server.CallCount("crm.contact.update"); got != 1 {
+		t.Errorf("crm.contact.update calls = %d, want 1", got)
+	}
+	if got := len(server.Records("contact")); got != 2 {
+		t.Errorf("contacts after update = %d, want 2", got)
+	}
+}
+
+func TestSyncCustomersCountsFailures(t *testing.T) {
+	engine, _, server := newTestEngine(t)
+	server.FailNext("crm.contact.add", bitrix24test.ErrQueryLimit)
+
+	result, err := engine.SyncCustomers()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if result.Success || result.FailedCount != 1 {
+		t.Errorf("result = %+v, want 1 failure", result)
+	}
+}
+
+func TestDryRunWritesReportWithoutChanges(t *testing.T) {
+	engine, _, server := newTestEngine(t)
+	engine.DryRun = true
+	engine.ReportDir = t.TempDir()
+
+	// Bar Roca exists with an outdated city.
+	server.Seed("contact", map[string]interface{}{
+		"NAME":            "Bar Roca",
+		"COMMENTS":        "Synced from Sage 200c - Customer Code: 430000002",
+		"ADDRESS_CITY":    "Cadaques",
+		"ADDRESS_COUNTRY": "ES",
+		"PHONE":           []interface{}{map[string]interface{}{"VALUE": "600 11 22 33", "VALUE_TYPE": "WORK"}},
+	})
+	server.ResetCalls()
+
+	report, err := engine.Preview(engine.LastSync())
+	if err != nil {
+		t.Fatalf("Preview: %v", err)
+	}
+
+	if report.Summary["create"] != 1 || report.Summary["update"] != 1 {
+		t.Fatalf("summary = %v", report.Summary)
+	}
+	for _, entry := range report.Entries {
+		if entry.Action != "update" {
+			continue
+		}
+		if len(entry.Changes) != 1 || entry.Changes[0].Field != "ADDRESS_CITY" || entry.Changes[0].New != "Figueres" {
+			t.Errorf("update changes = %+v", entry.Changes)
+		}
+	}
+
+	if _, err := engine.SyncCustomers(); err != nil {
+		t.Fatalf("dry-run cycle: %v", err)
+	}
+	for _, method := range []string{"crm.contact.add", "crm.contact.update"} {
+		if got := server.CallCount(method); got != 0 {
+			t.Errorf("%s called %d times during dry run", method, got)
+		}
+	}
+
+	files, _ := os.ReadDir(engine.ReportDir)
+	if len(files) != 2 {
+		t.Errorf("report files = %d, want JSON and CSV", len(files))
+	}
+}
+
+func TestPreviewFollowsIdentitiesHashesAndRetries(t *testing.T) {
+	engine, source, server := newTestEngine(t)
+	engine.DeadLetters.BaseDelay = 0
+
+	if _, err := engine.SyncCustomers(); err != nil {
+		t.Fatalf("first cycle: %v", err)
+	}
+	since := engine.LastSync()
+
+	// Ferreteria Puig is touched without changes, Bar Roca moves and
+	// Distribucions Vila failed in an earlier cycle.
+	unchanged, _ := source.GetCustomerDetails("430000001")
+	unchanged.ModifiedDate = time.Now().Add(time.Second)
+	source.PutCustomer(*unchanged)
+	moved, _ := source.GetCustomerDetails("430000002")
+	moved.City = "Roses"
+	moved.ModifiedDate = time.Now().Add(time.Second)
+	source.PutCustomer(*moved)
+	if _, err := engine.DeadLetters.RecordFailure(entityCustomer, "430000003", "Distribucions Vila", errors.New("timeout")); err != nil {
+		t.Fatal(err)
+	}
+	server.ResetCalls()
+
+	report, err := engine.Preview(since)
+	if err != nil {
+		t.Fatalf("Preview: %v", err)
+	}
+
+	want := map[string]string{"430000001": "skip", "430000002": "update", "430000003": "create"}
+	for _, entry := range report.Entries {
+		if entry.Action != want[entry.Code] {
+			t.Errorf("%s action = %q, want %q", entry.Code, entry.Action, want[entry.Code])
+		}
+		if identity, ok := engine.Identities.Get(entityCustomer, entry.Code); ok && entry.BitrixID != identity.RemoteID {
+			t.Errorf("%s planned against contact %s, want mapped contact %s", entry.Code, entry.BitrixID, identity.RemoteID)
+		}
+		if entry.Retry != (entry.Code == "430000003") {
+			t.Errorf("%s Retry = %t", entry.Code, entry.Retry)
+		}
+	}
+	if len(report.Entries) != len(want) {
+		t.Errorf("entries = %+v", report.Entries)
+	}
+	if len(report.NotCovered) == 0 {
+		t.Error("report does not name the sections it leaves out")
+	}
+
+	// Unchanged customers are decided from the hash alone.
+	if got := server.CallCount("crm.contact.get"); got != 1 {
+		t.Errorf("crm.contact.get calls = %d, want 1", got)
+	}
+	if letters := engine.DeadLetters.List(); len(letters) != 1 || letters[0].Attempts != 1 {
+		t.Errorf("dead letters changed by preview: %+v", letters)
+	}
+}
+
+func TestUnchangedCustomersAreSkipped(t *testing.T) {
+	engine, source, server := newTestEngine(t)
+
+	if _, err := engine.SyncCustomers(); err != nil {
+		t.Fatalf("first cycle: %v", err)
+	}
+
+	// Touching the record in Sage without changing mapped fields.
+	customer, _ := source.GetCustomerDetails("430000001")
+	customer.ModifiedDate = time.Now().Add(time.Second)
+	source.PutCustomer(*customer)
+
+	result, err := engine.SyncCustomers()
+	if err != nil {
+		t.Fatalf("second cycle: %v", err)
+	}
+	if result.RecordsCount != 1 || result.SkippedCount != 1 {
+		t.Errorf("result = %+v, want 1 skipped record", result)
+	}
+	if got := server.CallCount("crm.contact.update"); got != 0 {
+		t.Errorf("crm.contact.update calls = %d, want 0", got)
+	}
+}
+
+func TestFailedCustomersAreRetried(t *testing.T) {
+	engine, _, server := newTestEngine(t)
+	engine.DeadLetters.BaseDelay = 0
+	server.FailNext("crm.contact.add", bitrix24test.ErrQueryLimit)
+
+	if _, err := engine.SyncCustomers(); err == nil {
+		t.Fatal("expected first cycle to fail")
+	}
+	letters := engine.DeadLetters.List()
+	if len(letters) != 1 || letters[0].Attempts != 1 || letters[0].Error == "" {
+		t.Fatalf("dead letters = %+v", letters)
+	}
+
+	// The failed customer is not modified again but is retried anyway.
+	result, err := engine.SyncCustomers()
+	if err != nil {
+		t.Fatalf("retry cycle: %v", err)
+	}
+	if result.RetriedCount != 1 {
+		t.Errorf("RetriedCount = %d, want 1", result.RetriedCount)
+	}
+	if len(engine.DeadLetters.List()) != 0 {
+		t.Error("dead letter not resolved after successful retry")
+	}
+	if got := len(server.Records("contact")); got != 2 {
+		t.Errorf("contacts = %d, want 2", got)
+	}
+}
+
+func TestSyncCustomersMetrics(t *testing.T) {
+	engine, source, server := newTestEngine(t)
+	engine.Metrics = metrics.New()
+	engine.Company = "1"
+
+	if _, err := engine.SyncCustomers(); err != nil {
+		t.Fatalf("first cycle: %v", err)
+	}
+
+	// The second cycle re-reads both unchanged customers and fails to
+	// create a new one.
+	source.PutCustomer(shared.Customer{Code: "430000009", Name: "Nuevo SL", ModifiedDate: time.Now()})
+	server.FailNext("crm.contact.add", bitrix24test.ErrQueryLimit)
+	engine.SetLastSync(time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC))
+	if _, err := engine.SyncCustomers(); err == nil {
+		t.Fatal("expected second cycle to report the failed customer")
+	}
+
+	recorder := httptest.NewRecorder()
+	engine.Metrics.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body := recorder.Body.String()
+
+	for _, want := range []string{
+		`sagesync_sage_records_read_total{company="1",entity="customer"} 5`,
+		`sagesync_bitrix24_records_pushed_total{entity="customer",operation="create"} 2`,
+		`sagesync_bitrix24_records_pushed_total{entity="customer",operation="skip"} 2`,
+		`sagesync_bitrix24_request_duration_seconds_count{method="crm.contact.add"} 3`,
+		`sagesync_errors_total{code="QUERY_LIMIT_EXCEEDED",source="bitrix24"} 1`,
+		`sagesync_last_successful_sync_timestamp_seconds{company="1",entity="customer"}`,
+		// Every step records what it read and when it last succeeded
+		`sagesync_sage_records_read_total{company="1",entity="address"} 0`,
+		`sagesync_sage_records_read_total{company="1",entity="sales_order"} 0`,
+		`sagesync_last_successful_sync_timestamp_seconds{company="1",entity="address"}`,
+		`sagesync_last_successful_sync_timestamp_seconds{company="1",entity="contact_person"}`,
+		`sagesync_last_successful_sync_timestamp_seconds{company="1",entity="sales_order"}`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %q", want)
+		}
+	}
+}
+
+func TestDuplicatesFlaggedForReviewAreParked(t *testing.T) {
+	engine, _, server := newTestEngine(t)
+	engine.bitrix24 = bitrix24.NewClient(&shared.Bitrix24Config{
+		APITenant:       server.WebhookURL(),
+		DuplicatePolicy: shared.DuplicateReview,
+	})
+	existing := server.Seed("contact", map[string]interface{}{
+		"NAME":  "Puig",
+		"EMAIL": []interface{}{map[string]interface{}{"VALUE": "Info@FerreteriaPuig.example"}},
+	})
+
+	result, err := engine.SyncCustomers()
+	if err != nil {
+		t.Fatalf("SyncCustomers: %v", err)
+	}
+	if !result.Success || result.FlaggedCount != 1 || result.FailedCount != 0 {
+		t.Errorf("result = %+v, want 1 flagged record", result)
+	}
+	if got := len(server.Records("contact")); got != 2 {
+		t.Errorf("contacts = %d, want only the other customer created", got)
+	}
+
+	letter, ok := engine.DeadLetters.Get(entityCustomer, "430000001")
+	if !ok || !letter.Parked || !strings.Contains(letter.Error, existing) {
+		t.Fatalf("dead letter = %+v, want parked with contact %s", letter, existing)
+	}
+	if _, ok := engine.Identities.Get(entityCustomer, "430000001"); ok {
+		t.Error("flagged customer linked to a contact")
+	}
+}
+
+func TestContactPersonsBoundToCompany(t *testing.T) {
+	engine, source, server := newTestEngine(t)
+	modified := time.Date(2026, 10, 2, 0, 0, 0, 0, time.UTC)
+	source.PutContactPerson(shared.ContactPerson{ID: "1", CustomerCode: "430000001",
+		FirstName: "Marta", LastName: "Puig", Mobile: "600 11 22 33", ModifiedDate: modified})
+	source.PutContactPerson(shared.ContactPerson{ID: "2", CustomerCode: "430000001",
+		FirstName: "Jordi", LastName: "Vila", Email: "jordi@ferreteriapuig.example", ModifiedDate: modified})
+
+	if _, err := engine.SyncCustomers(); err != nil {
+		t.Fatalf("first cycle: %v", err)
+	}
+
+	companies := server.Records("company")
+	if len(companies) != 1 {
+		t.Fatalf("companies = %d, want 1", len(companies))
+	}
+	companyID := bitrix24.RecordID(companies[0])
+	if got := server.CompanyContacts(companyID); len(got) != 2 {
+		t.Fatalf("bound contacts = %v, want 2", got)
+	}
+
+	identity, _ := engine.Identities.Get(entityContactPerson, "430000001/1")
+	phones, _ := server.Record("contact", identity.RemoteID)["PHONE"].([]interface{})
+	if len(phones) != 1 || phones[0].(map[string]interface{})["VALUE"] != "+34600112233" {
+		t.Errorf("person phones = %v, want +34600112233", phones)
+	}
+
+	// A changed person updates only its own contact.
+	server.ResetCalls()
+	source.PutContactPerson(shared.ContactPerson{ID: "1", CustomerCode: "430000001",
+		FirstName: "Marta", LastName: "Puig", Position: "Compras", Mobile: "600 11 22 33",
+		ModifiedDate: time.Now().Add(time.Second)})
+	if _, err := engine.SyncCustomers(); err != nil {
+		t.Fatalf("second cycle: %v", err)
+	}
+	if got := server.CallCount("crm.contact.update"); got != 1 {
+		t.Errorf("crm.contact.update calls = %d, want 1", got)
+	}
+	if got := server.Record("contact", identity.RemoteID)["POST"]; got != "Compras" {
+		t.Errorf("POST = %v, want Compras", got)
+	}
+
+	// A removed person is unbound but its contact is kept.
+	removed, _ := engine.Identities.Get(entityContactPerson, "430000001/2")
+	source.DeleteContactPerson("430000001", "2")
+	customer, _ := source.GetCustomerDetails("430000001")
+	customer.ModifiedDate = time.Now().Add(2 * time.Second)
+	source.PutCustomer(*customer)
+	if _, err := engine.SyncCustomers(); err != nil {
+		t.Fatalf("third cycle: %v", err)
+	}
+	if got := server.CompanyContacts(companyID); len(got) != 1 || got[0] != identity.RemoteID {
+		t.Errorf("bound contacts = %v, want only %s", got, identity.RemoteID)
+	}
+	if server.Record("contact", removed.RemoteID) == nil {
+		t.Error("contact of removed person was deleted")
+	}
+	if _, ok := engine.Identities.Get(entityContactPerson, "430000001/2"); ok {
+		t.Error("removed person still in identity map")
+	}
+}
+
+func TestContactPersonFailuresAreRetried(t *testing.T) {
+	engine, source, server := newTestEngine(t)
+	engine.DeadLetters.BaseDelay = 0
+	source.PutContactPerson(shared.ContactPerson{ID: "1", CustomerCode: "430000001",
+		FirstName: "Marta", LastName: "Puig", ModifiedDate: time.Date(2026, 10, 2, 0, 0, 0, 0, time.UTC)})
+
+	// Failures of the person step back off on their own letter, although
+	// the customer itself is pushed and then skipped as unchanged.
+	for attempt := 1; attempt <= 2; attempt++ {
+		server.FailNext("crm.company.add", &bitrix24test.Error{Status: 400, Code: "ERROR_CORE", Description: "boom"})
+		if _, err := engine.SyncCustomers(); err == nil {
+			t.Fatalf("cycle %d succeeded, want the person failure reported", attempt)
+		}
+		letter, ok := engine.DeadLetters.Get(entityContactPerson, "430000001")
+		if !ok || letter.Attempts != attempt {
+			t.Fatalf("cycle %d: person letter = %+v (%v), want %d attempts", attempt, letter, ok, attempt)
+		}
+		if _, ok := engine.DeadLetters.Get(entityCustomer, "430000001"); ok {
+			t.Fatalf("cycle %d: customer dead-lettered for a person failure", attempt)
+		}
+	}
+
+	// Replaying the letter pushes the persons again.
+	if err := engine.ReplayDeadLetter(entityContactPerson, "430000001"); err != nil {
+		t.Fatalf("ReplayDeadLetter: %v", err)
+	}
+	companies := server.Records("company")
+	if len(companies) != 1 {
+		t.Fatalf("companies = %d, want 1", len(companies))
+	}
+	if got := server.CompanyContacts(bitrix24.RecordID(companies[0])); len(got) != 1 {
+		t.Errorf("bound contacts = %v, want 1", got)
+	}
+	if _, ok := engine.DeadLetters.Get(entityContactPerson, "430000001"); ok {
+		t.Error("dead letter not resolved after the replay")
+	}
+}
+
+func TestAddressesWrittenAsRequisites(t *testing.T) {
+	engine, source, server := newTestEngine(t)
+	customer, _ := source.GetCustomerDetails("430000001")
+	customer.Addresses = []shared.Address{
+		{ID: "10", Type: shared.AddressFiscal, Line1: "Carrer Major 12", City: "Girona", PostalCode: "17001", Country: "ES"},
+		{ID: "11", Type: shared.AddressDelivery, Name: "Magatzem", Line1: "Pol. Ind. Celrà 4", City: "Celrà", PostalCode: "17460", Country: "ES"},
+		{ID: "12", Type: shared.AddressDelivery, Name: "Botiga", Line1: "Rambla 3", City: "Figueres", PostalCode: "17600", Country: "ES"},
+	}
+	source.PutCustomer(*customer)
+
+	if _, err := engine.SyncCustomers(); err != nil {
+		t.Fatalf("first cycle: %v", err)
+	}
+
+	contact, _ := engine.Identities.Get(entityCustomer, "430000001")
+	requisites := server.Records("requisite")
+	if len(requisites) != 2 {
+		t.Fatalf("requisites = %d, want 2", len(requisites))
+	}
+	if requisites[0]["ENTITY_ID"] != contact.RemoteID || requisites[0]["XML_ID"] != "sage:430000001" ||
+		requisites[1]["XML_ID"] != "sage:430000001:1" || requisites[1]["NAME"] != "Ferreteria Puig SL - Botiga" {
+		t.Errorf("requisites = %v", requisites)
+	}
+
+	main := server.Addresses(bitrix24.RecordID(requisites[0]))
+	if len(main) != 2 || main[0]["TYPE_ID"] != "6" || main[0]["CITY"] != "Girona" ||
+		main[1]["TYPE_ID"] != "11" || main[1]["CITY"] != "Celrà" {
+		t.Errorf("main requisite addresses = %v", main)
+	}
+
+	// Unchanged addresses are not read back from Bitrix24.
+	server.ResetCalls()
+	if _, err := engine.SyncCustomers(); err != nil {
+		t.Fatalf("second cycle: %v", err)
+	}
+	if got := server.CallCount("crm.requisite.list"); got != 0 {
+		t.Errorf("crm.requisite.list calls = %d, want 0", got)
+	}
+
+	// Removing the second delivery address deletes its requisite.
+	customer.Addresses = customer.Addresses[:2]
+	customer.Addresses[0].City = "Salt"
+	customer.Addresses[0].ModifiedDate = time.Now().Add(time.Second)
+	source.PutCustomer(*customer)
+	if _, err := engine.SyncCustomers(); err != nil {
+		t.Fatalf("third cycle: %v", err)
+	}
+	if got := len(server.Records("requisite")); got != 1 {
+		t.Errorf("requisites = %d, want 1", got)
+	}
+	if got := server.CallCount("crm.address.update"); got != 1 {
+		t.Errorf("crm.address.update calls = %d, want 1", got)
+	}
+	if main := server.Addresses(bitrix24.RecordID(requisites[0])); len(main) != 2 || main[0]["CITY"] != "Salt" {
+		t.Errorf("main requisite addresses = %v", main)
+	}
+}
+
+func TestAddressFailuresAreRetried(t *testing.T) {
+	engine, source, server := newTestEngine(t)
+	engine.DeadLetters.BaseDelay = 0
+	customer, _ := source.GetCustomerDetails("430000001")
+	customer.Addresses = []shared.Address{
+		{ID: "10", Type: shared.AddressFiscal, Line1: "Carrer Major 12", City: "Girona", PostalCode: "17001", Country: "ES"},
+	}
+	source.PutCustomer(*customer)
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		server.FailNext("crm.requisite.add", &bitrix24test.Error{Status: 400, Code: "ERROR_CORE", Description: "boom"})
+		if _, err := engine.SyncCustomers(); err == nil {
+			t.Fatalf("cycle %d succeeded, want the address failure reported", attempt)
+		}
+		letter, ok := engine.DeadLetters.Get(entityAddress, "430000001")
+		if !ok || letter.Attempts != attempt {
+			t.Fatalf("cycle %d: address letter = %+v (%v), want %d attempts", attempt, letter, ok, attempt)
+		}
+		if _, ok := engine.DeadLetters.Get(entityCustomer, "430000001"); ok {
+			t.Fatalf("cycle %d: customer dead-lettered for an address failure", attempt)
+		}
+	}
+
+	if err := engine.ReplayDeadLetter(entityAddress, "430000001"); err != nil {
+		t.Fatalf("ReplayDeadLetter: %v", err)
+	}
+	if got := len(server.Records("requisite")); got != 1 {
+		t.Errorf("requisites = %d, want 1", got)
+	}
+	if _, ok := engine.DeadLetters.Get(entityAddress, "430000001"); ok {
+		t.Error("dead letter not resolved after the replay")
+	}
+}
+
+func TestSalesOrdersPushedAsDeals(t *testing.T) {
+	engine, source, server := newTestEngine(t)
+	engine.bitrix24 = bitrix24.NewClient(&shared.Bitrix24Config{
+		APITenant: server.WebhookURL(),
+		Deals:     &shared.DealSettings{CategoryID: 2, Stages: map[string]string{"order:live": "PREPARATION"}},
+	})
+	productID := server.Seed("product", map[string]interface{}{"NAME": "Tornillo M6", "XML_ID": "TORN-M6"})
+
+	modified := time.Date(2026, 10, 2, 0, 0, 0, 0, time.UTC)
+	source.PutSalesOrder(shared.SalesOrder{ID: "501", Number: "0000123", Type: shared.DocumentQuote,
+		Status: shared.DocumentLive, CustomerCode: "430000001", TotalAmount: 121, ModifiedDate: modified,
+		Lines: []shared.SalesOrderLine{{Description: "Montaje", Quantity: 1, UnitPrice: 100, TaxRate: 21}}})
+	// The customer of this order has not changed and is pushed with it.
+	order := shared.SalesOrder{ID: "502", Number: "0000456", Type: shared.DocumentOrder,
+		Status: shared.DocumentLive, CustomerCode: "430000003", TotalAmount: 108.9, ModifiedDate: modified,
+		Lines: []shared.SalesOrderLine{{ProductCode: "TORN-M6", Description: "Tornillo M6", Quantity: 10,
+			UnitPrice: 10, Discount: 10, TaxRate: 21}}}
+	source.PutSalesOrder(order)
+
+	if _, err := engine.SyncCustomers(); err != nil {
+		t.Fatalf("first cycle: %v", err)
+	}
+
+	deals := server.Records("deal")
+	if len(deals) != 2 {
+		t.Fatalf("deals = %d, want 2", len(deals))
+	}
+	quote, _ := engine.Identities.Get(entitySalesOrder, "501")
+	if deal := server.Record("deal", quote.RemoteID); deal["STAGE_ID"] != "C2:NEW" || deal["CATEGORY_ID"] != "2" {
+		t.Errorf("quote deal = %v, want stage C2:NEW in pipeline 2", deal)
+	}
+
+	contact, ok := engine.Identities.Get(entityCustomer, "430000003")
+	if !ok {
+		t.Fatal("customer of the order was not pushed")
+	}
+	identity, _ := engine.Identities.Get(entitySalesOrder, "502")
+	deal := server.Record("deal", identity.RemoteID)
+	if deal["STAGE_ID"] != "C2:PREPARATION" || deal["CONTACT_ID"] != contact.RemoteID || deal["OPPORTUNITY"] != "108.9" {
+		t.Errorf("order deal = %v", deal)
+	}
+	rows := server.ProductRows(identity.RemoteID)
+	if len(rows) != 1 || rows[0]["PRODUCT_ID"] != productID || rows[0]["PRICE"] != "10.89" {
+		t.Errorf("product rows = %v", rows)
+	}
+
+	// A completed order moves its deal to the won stage.
+	server.ResetCalls()
+	order.Status = shared.DocumentComplete
+	order.ModifiedDate = time.Now().Add(time.Second)
+	source.PutSalesOrder(order)
+	if _, err := engine.SyncCustomers(); err != nil {
+		t.Fatalf("second cycle: %v", err)
+	}
+	if got := server.CallCount("crm.deal.update"); got != 1 {
+		t.Errorf("crm.deal.update calls = %d, want 1", got)
+	}
+	if got := server.CallCount("crm.deal.add"); got != 0 {
+		t.Errorf("crm.deal.add calls = %d, want 0", got)
+	}
+	if got := server.Record("deal", identity.RemoteID)["STAGE_ID"]; got != "C2:WON" {
+		t.Errorf("STAGE_ID = %v, want C2:WON", got)
+	}
+}
+
+func TestWonDealsCreateSageOrders(t *testing.T) {
+	engine, source, server := newTestEngine(t)
+	engine.bitrix24 = bitrix24.NewClient(&shared.Bitrix24Config{
+		APITenant: server.WebhookURL(),
+		Deals:     &shared.DealSettings{OrderNumberField: "UF_CRM_SAGE_ORDER"},
+	})
+	engine.CreateSageOrders = true
+
+	if _, err := engine.SyncCustomers(); err != nil {
+		t.Fatalf("first cycle: %v", err)
+	}
+	contact, ok := engine.Identities.Get(entityCustomer, "430000001")
+	if !ok {
+		t.Fatal("customer was not pushed")
+	}
+
+	productID := server.Seed("product", map[string]interface{}{"NAME": "Tornillo M6", "XML_ID": "TORN-M6"})
+	dealID := server.Seed("deal", map[string]interface{}{
+		"TITLE": "Pedido tornillería", "STAGE_ID": "WON", "CONTACT_ID": contact.RemoteID, "CURRENCY_ID": "EUR",
+		"PRODUCT_ROWS": []interface{}{map[string]interface{}{
+			"PRODUCT_ID": productID, "PRODUCT_NAME": "Tornillo M6", "PRICE": "12.1", "QUANTITY": "10",
+			"TAX_RATE": "21", "TAX_INCLUDED": "Y",
+		}},
+	})
+
+	if _, err := engine.SyncCustomers(); err != nil {
+		t.Fatalf("second cycle: %v", err)
+	}
+
+	orders, err := source.GetRecentSalesOrders(time.Time{})
+	if err != nil {
+		t.Fatalf("GetRecentSalesOrders: %v", err)
+	}
+	if len(orders) != 1 {
+		t.Fatalf("orders = %d, want 1", len(orders))
+	}
+	order := orders[0]
+	if order.Reference != "B24-"+dealID || order.CustomerCode != "430000001" {
+		t.Errorf("order = %+v", order)
+	}
+	if len(order.Lines) != 1 || order.Lines[0].ProductCode != "TORN-M6" || order.Lines[0].UnitPrice != 10 {
+		t.Errorf("order lines = %+v", order.Lines)
+	}
+
+	deal := server.Record("deal", dealID)
+	if deal["ORIGINATOR_ID"] != bitrix24.DealOriginator || deal["ORIGIN_ID"] != order.ID ||
+		deal["UF_CRM_SAGE_ORDER"] != order.Number {
+		t.Errorf("deal = %v, want it linked to order %s", deal, order.Number)
+	}
+
+	// The new order is pushed back to the same deal, which stays won.
+	server.ResetCalls()
+	if _, err := engine.SyncCustomers(); err != nil {
+		t.Fatalf("third cycle: %v", err)
+	}
+	if got := server.CallCount("crm.deal.add"); got != 0 {
+		t.Errorf("crm.deal.add calls = %d, want 0", got)
+	}
+	if got := server.Record("deal", dealID)["STAGE_ID"]; got != "WON" {
+		t.Errorf("STAGE_ID = %v, want WON", got)
+	}
+	if orders, _ := source.GetRecentSalesOrders(time.Time{}); len(orders) != 1 {
+		t.Errorf("orders = %d after third cycle, want 1", len(orders))
+	}
+}
+
+func TestBalancesWrittenToCustomerFields(t *testing.T) {
+	engine, source, server := newTestEngine(t)
+	engine.bitrix24 = bitrix24.NewClient(&shared.Bitrix24Config{
+		APITenant: server.WebhookURL(),
+		Balances: &shared.BalanceFields{Balance: "UF_CRM_BALANCE", Overdue: "UF_CRM_OVERDUE",
+			Risk: "UF_CRM_RISK", RiskValues: map[string]string{shared.RiskOverdue: "46"}},
+	})
+	source.PutBalance(shared.CustomerBalance{CustomerCode: "430000001", Balance: 1250.456, Overdue: 300, CreditLimit: 5000})
+	source.PutBalance(shared.CustomerBalance{CustomerCode: "430000002", Balance: 900, CreditLimit: 500})
+	// Customers that were never synced have no card to write to.
+	source.PutBalance(shared.CustomerBalance{CustomerCode: "430009999", Balance: 10})
+
+	if _, err := engine.SyncCustomers(); err != nil {
+		t.Fatalf("first cycle: %v", err)
+	}
+
+	contact, _ := engine.Identities.Get(entityCustomer, "430000001")
+	record := server.Record("contact", contact.RemoteID)
+	if record["UF_CRM_BALANCE"] != "1250.46" || record["UF_CRM_OVERDUE"] != "300" || record["UF_CRM_RISK"] != "46" {
+		t.Errorf("contact = %v", record)
+	}
+	contact, _ = engine.Identities.Get(entityCustomer, "430000002")
+	if got := server.Record("contact", contact.RemoteID)["UF_CRM_RISK"]; got != shared.RiskOverLimit {
+		t.Errorf("UF_CRM_RISK = %v, want %s", got, shared.RiskOverLimit)
+	}
+
+	// Balances are refreshed on every cycle, but only changed ones are
+	// written.
+	server.ResetCalls()
+	source.PutBalance(shared.CustomerBalance{CustomerCode: "430000002", Balance: 400, CreditLimit: 500})
+	if _, err := engine.SyncCustomers(); err != nil {
+		t.Fatalf("second cycle: %v", err)
+	}
+	if got := server.CallCount("crm.contact.update"); got != 1 {
+		t.Errorf("crm.contact.update calls = %d, want 1", got)
+	}
+	if got := server.Record("contact", contact.RemoteID)["UF_CRM_RISK"]; got != shared.RiskOK {
+		t.Errorf("UF_CRM_RISK = %v, want %s", got, shared.RiskOK)
+	}
+}
+
+func TestBalanceFailuresAreRetriedNextCycle(t *testing.T) {
+	engine, source, server := newTestEngine(t)
+	engine.bitrix24 = bitrix24.NewClient(&shared.Bitrix24Config{
+		APITenant: server.WebhookURL(),
+		Balances:  &shared.BalanceFields{Balance: "UF_CRM_BALANCE"},
+	}).WithRateLimitBackoff(0, 0)
+	if _, err := engine.SyncCustomers(); err != nil {
+		t.Fatalf("first cycle: %v", err)
+	}
+	contact, _ := engine.Identities.Get(entityCustomer, "430000001")
+
+	source.PutBalance(shared.CustomerBalance{CustomerCode: "430000001", Balance: 75})
+	server.FailNext("crm.contact.update", &bitrix24test.Error{Status: 400, Code: "ERROR_CORE", Description: "boom"})
+	result, err := engine.SyncCustomers()
+	if err == nil {
+		t.Fatal("expected the cycle to report the failed balance update")
+	}
+	if result.FailedCount != 1 {
+		t.Errorf("FailedCount = %d, want 1", result.FailedCount)
+	}
+	if got := server.Record("contact", contact.RemoteID)["UF_CRM_BALANCE"]; got == "75" {
+		t.Error("failed balance update was written")
+	}
+	// Balances are read in full every cycle, so they are not dead-lettered.
+	if _, ok := engine.DeadLetters.Get(entityBalance, "430000001"); ok {
+		t.Error("failed balance update was dead-lettered")
+	}
+
+	if _, err := engine.SyncCustomers(); err != nil {
+		t.Fatalf("next cycle: %v", err)
+	}
+	if got := server.Record("contact", contact.RemoteID)["UF_CRM_BALANCE"]; got != "75" {
+		t.Errorf("UF_CRM_BALANCE = %v, want 75", got)
+	}
+}
+
+func TestSuppliersPushedToBitrixAndTickelia(t *testing.T) {
+	engine, source, server := newTestEngine(t)
+	engine.DeadLetters.BaseDelay = 0
+	engine.Metrics = metrics.New()
+	engine.bitrix24 = bitrix24.NewClient(&shared.Bitrix24Config{APITenant: server.WebhookURL(), SyncSuppliers: true})
+	vendors := tickeliatest.NewServer("secret")
+	t.Cleanup(vendors.Close)
+	engine.Tickelia = tickelia.NewClient(&shared.TickeliaConfig{APIEndpoint: vendors.URL, APIKey: "secret"})
+
+	supplier := shared.Supplier{Code: "400000001", Name: "Transportes Vidal SL", TaxNumber: "B12345678",
+		Phone: "931234567", Country: "ES", ModifiedDate: time.Date(2026, 10, 2, 0, 0, 0, 0, time.UTC)}
+	source.PutSupplier(supplier)
+
+	if _, err := engine.SyncCustomers(); err != nil {
+		t.Fatalf("first cycle: %v", err)
+	}
+
+	identity, ok := engine.Identities.Get(entitySupplier, supplier.Code)
+	if !ok {
+		t.Fatal("supplier company was not recorded")
+	}
+	company := server.Record("company", identity.RemoteID)
+	if company["TITLE"] != supplier.Name || company["COMPANY_TYPE"] != "SUPPLIER" ||
+		company["ORIGINATOR_ID"] != bitrix24.SupplierOriginator || company["ORIGIN_ID"] != supplier.Code {
+		t.Errorf("company = %v", company)
+	}
+	if got := vendors.Vendors(); len(got) != 1 || got[0]["code"] != supplier.Code || got[0]["tax_id"] != "B12345678" {
+		t.Errorf("vendors = %v", got)
+	}
+
+	// A failing destination dead-letters the supplier without holding back
+	// the other one.
+	vendors.SetAPIKey("rotated")
+	supplier.Name = "Transportes Vidal SLU"
+	supplier.ModifiedDate = time.Now().Add(time.Second)
+	source.PutSupplier(supplier)
+	if _, err := engine.SyncCustomers(); err == nil {
+		t.Fatal("second cycle succeeded, want the Tickelia failure reported")
+	}
+	if got := server.Record("company", identity.RemoteID)["TITLE"]; got != supplier.Name {
+		t.Errorf("TITLE = %v, want %s", got, supplier.Name)
+	}
+	if _, ok := engine.DeadLetters.Get(entitySupplier, supplier.Code); !ok {
+		t.Fatal("supplier was not dead-lettered")
+	}
+
+	// The retry reaches Tickelia; the company, already up to date, is
+	// skipped by hash.
+	vendors.SetAPIKey("secret")
+	server.ResetCalls()
+	result, err := engine.SyncCustomers()
+	if err != nil {
+		t.Fatalf("retry cycle: %v", err)
+	}
+	if result.RetriedCount != 1 {
+		t.Errorf("RetriedCount = %d, want 1", result.RetriedCount)
+	}
+	if got := server.CallCount("crm.company.update"); got != 0 {
+		t.Errorf("crm.company.update calls = %d, want 0", got)
+	}
+	if got := vendors.Vendors(); len(got) != 1 || got[0]["name"] != supplier.Name {
+		t.Errorf("vendors = %v", got)
+	}
+	if _, ok := engine.DeadLetters.Get(entitySupplier, supplier.Code); ok {
+		t.Error("dead letter not resolved after the retry")
+	}
+
+	// Vendor pushes are counted apart from the Bitrix24 ones
+	recorder := httptest.NewRecorder()
+	engine.Metrics.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body := recorder.Body.String()
+	for _, want := range []string{
+		`sagesync_tickelia_records_pushed_total{entity="vendor",operation="create"} 1`,
+		`sagesync_tickelia_records_pushed_total{entity="vendor",operation="update"} 1`,
+		`sagesync_bitrix24_records_pushed_total{entity="supplier",operation="skip"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %s", want)
+		}
+	}
+	if strings.Contains(body, `sagesync_bitrix24_records_pushed_total{entity="vendor"`) {
+		t.Error("vendor pushes counted as Bitrix24 pushes")
+	}
+}
+
+func TestCollectionStateWrittenToDeal(t *testing.T) {
+	engine, source, server := newTestEngine(t)
+	engine.bitrix24 = bitrix24.NewClient(&shared.Bitrix24Config{
+		APITenant: server.WebhookURL(),
+		Collections: &shared.CollectionFields{Status: "UF_CRM_COLLECTION", Paid: "UF_CRM_PAID",
+			Outstanding: "UF_CRM_OUTSTANDING", DueDate: "UF_CRM_DUE_DATE"},
+	})
+
+	modified := time.Date(2026, 10, 2, 0, 0, 0, 0, time.UTC)
+	source.PutSalesOrder(shared.SalesOrder{ID: "502", Number: "0000456", Type: shared.DocumentOrder,
+		Status: shared.DocumentComplete, CustomerCode: "430000001", TotalAmount: 300, ModifiedDate: modified})
+	// The invoice is collected in two instalments.
+	first := shared.Receivable{ID: "9001", CustomerCode: "430000001", InvoiceNumber: "F-0042", OrderID: "502",
+		DueDate: time.Date(2026, 10, 30, 0, 0, 0, 0, time.UTC), Amount: 150, Outstanding: 0, ModifiedDate: modified}
+	second := shared.Receivable{ID: "9002", CustomerCode: "430000001", InvoiceNumber: "F-0042", OrderID: "502",
+		DueDate: time.Date(2026, 11, 30, 0, 0, 0, 0, time.UTC), Amount: 150, Outstanding: 150, ModifiedDate: modified}
+	source.PutReceivable(first)
+	source.PutReceivable(second)
+	// Invoices not raised from an order have no deal.
+	source.PutReceivable(shared.Receivable{ID: "9003", CustomerCode: "430000002", InvoiceNumber: "F-0043",
+		Amount: 80, Outstanding: 80, ModifiedDate: modified})
+
+	if _, err := engine.SyncCustomers(); err != nil {
+		t.Fatalf("first cycle: %v", err)
+	}
+
+	identity, _ := engine.Identities.Get(entitySalesOrder, "502")
+	deal := server.Record("deal", identity.RemoteID)
+	if deal["UF_CRM_COLLECTION"] != shared.CollectionPartial || deal["UF_CRM_PAID"] != "150" ||
+		deal["UF_CRM_OUTSTANDING"] != "150" || deal["UF_CRM_DUE_DATE"] != "2026-11-30" {
+		t.Errorf("deal = %v", deal)
+	}
+
+	// Registering the second collection settles the deal.
+	second.Outstanding = 0
+	second.ModifiedDate = time.Now().Add(time.Second)
+	source.PutReceivable(second)
+	if _, err := engine.SyncCustomers(); err != nil {
+		t.Fatalf("second cycle: %v", err)
+	}
+	deal = server.Record("deal", identity.RemoteID)
+	if deal["UF_CRM_COLLECTION"] != shared.CollectionPaid || deal["UF_CRM_OUTSTANDING"] != "0" || deal["UF_CRM_DUE_DATE"] != "" {
+		t.Errorf("deal after collection = %v", deal)
+	}
+}
+
+func TestCollectionFailuresAreRetried(t *testing.T) {
+	engine, source, server := newTestEngine(t)
+	engine.DeadLetters.BaseDelay = 0
+	engine.bitrix24 = bitrix24.NewClient(&shared.Bitrix24Config{
+		APITenant:   server.WebhookURL(),
+		Collections: &shared.CollectionFields{Status: "UF_CRM_COLLECTION", Outstanding: "UF_CRM_OUTSTANDING"},
+	}).WithRateLimitBackoff(0, 0)
+
+	modified := time.Date(2026, 10, 2, 0, 0, 0, 0, time.UTC)
+	source.PutSalesOrder(shared.SalesOrder{ID: "502", Number: "0000456", Type: shared.DocumentOrder,
+		Status: shared.DocumentComplete, CustomerCode: "430000001", TotalAmount: 300, ModifiedDate: modified})
+	source.PutReceivable(shared.Receivable{ID: "9001", CustomerCode: "430000001", InvoiceNumber: "F-0042", OrderID: "502",
+		DueDate: time.Date(2026, 10, 30, 0, 0, 0, 0, time.UTC), Amount: 300, Outstanding: 100, ModifiedDate: modified})
+
+	server.FailNext("crm.deal.update", &bitrix24test.Error{Status: 400, Code: "ERROR_CORE", Description: "boom"})
+	if _, err := engine.SyncCustomers(); err == nil {
+		t.Fatal("expected the first cycle to report the failed collection update")
+	}
+	letter, ok := engine.DeadLetters.Get(entityCollection, "502")
+	if !ok {
+		t.Fatal("failed collection update not dead-lettered")
+	}
+	if letter.Name != "F-0042" {
+		t.Errorf("dead letter name = %q, want the invoice number", letter.Name)
+	}
+
+	// The retry writes the state although the receivable did not change
+	// again in Sage.
+	result, err := engine.SyncCustomers()
+	if err != nil {
+		t.Fatalf("retry cycle: %v", err)
+	}
+	if result.RetriedCount != 1 {
+		t.Errorf("RetriedCount = %d, want 1", result.RetriedCount)
+	}
+	identity, _ := engine.Identities.Get(entitySalesOrder, "502")
+	deal := server.Record("deal", identity.RemoteID)
+	if deal["UF_CRM_COLLECTION"] != shared.CollectionPartial || deal["UF_CRM_OUTSTANDING"] != "100" {
+		t.Errorf("deal = %v", deal)
+	}
+	if _, ok := engine.DeadLetters.Get(entityCollection, "502"); ok {
+		t.Error("dead letter not resolved after the retry")
+	}
+}
+
+func TestStockLevelsWrittenToStores(t *testing.T) {
+	engine, source, server := newTestEngine(t)
+	engine.bitrix24 = bitrix24.NewClient(&shared.Bitrix24Config{
+		APITenant: server.WebhookURL(),
+		Stock: &shared.StockSettings{Warehouses: map[string]string{
+			"Almacen Principal": "1", "Almacen Norte": "1", "Tienda": "2"}},
+	})
+	productID := server.Seed("product", map[string]interface{}{"NAME": "Tornillo M6", "XML_ID": "TORN-M6"})
+	server.SeedStoreAmount(productID, 2, 4)
+
+	modified := time.Date(2026, 10, 2, 0, 0, 0, 0, time.UTC)
+	for _, level := range []shared.StockLevel{
+		{ProductCode: "TORN-M6", Warehouse: "ALMACEN PRINCIPAL", Quantity: 100, ModifiedDate: modified},
+		{ProductCode: "TORN-M6", Warehouse: "Almacen Norte", Quantity: 20.5, ModifiedDate: modified},
+		{ProductCode: "TORN-M6", Warehouse: "Tienda", Quantity: 3, ModifiedDate: modified},
+		// Unmapped warehouses and products missing from the catalog are
+		// left alone.
+		{ProductCode: "TORN-M6", Warehouse: "Devoluciones", Quantity: 7, ModifiedDate: modified},
+		{ProductCode: "TUER-M6", Warehouse: "Tienda", Quantity: 9, ModifiedDate: modified},
+	} {
+		source.PutStockLevel(level)
+	}
+
+	if _, err := engine.SyncCustomers(); err != nil {
+		t.Fatalf("first cycle: %v", err)
+	}
+	if got := server.StoreAmount(productID, 1); got != 120.5 {
+		t.Errorf("store 1 amount = %v, want 120.5", got)
+	}
+	if got := server.StoreAmount(productID, 2); got != 3 {
+		t.Errorf("store 2 amount = %v, want 3", got)
+	}
+	if got := server.CallCount("catalog.document.conduct"); got != 2 {
+		t.Errorf("catalog.document.conduct calls = %d, want 2", got)
+	}
+
+	// Unchanged stock is not written again.
+	server.ResetCalls()
+	source.PutStockLevel(shared.StockLevel{ProductCode: "TORN-M6", Warehouse: "Tienda", Quantity: 3,
+		ModifiedDate: time.Now().Add(time.Second)})
+	if _, err := engine.SyncCustomers(); err != nil {
+		t.Fatalf("second cycle: %v", err)
+	}
+	if got := server.CallCount("catalog.document.add"); got != 0 {
+		t.Errorf("catalog.document.add calls = %d, want 0", got)
+	}
+}
+
+func TestStockFailuresAreRetried(t *testing.T) {
+	engine, source, server := newTestEngine(t)
+	engine.DeadLetters.BaseDelay = 0
+	engine.bitrix24 = bitrix24.NewClient(&shared.Bitrix24Config{
+		APITenant: server.WebhookURL(),
+		Stock:     &shared.StockSettings{Warehouses: map[string]string{"Almacen Principal": "1", "Tienda": "2"}},
+	}).WithRateLimitBackoff(0, 0)
+	productID := server.Seed("product", map[string]interface{}{"NAME": "Tornillo M6", "XML_ID": "TORN-M6"})
+	server.SeedStoreAmount(productID, 2, 4)
+
+	modified := time.Date(2026, 10, 2, 0, 0, 0, 0, time.UTC)
+	source.PutStockLevel(shared.StockLevel{ProductCode: "TORN-M6", Warehouse: "Almacen Principal", Quantity: 10, ModifiedDate: modified})
+	source.PutStockLevel(shared.StockLevel{ProductCode: "TORN-M6", Warehouse: "Tienda", Quantity: 1, ModifiedDate: modified})
+
+	server.FailNext("catalog.document.conduct", &bitrix24test.Error{Status: 400, Code: "ERROR_CORE", Description: "boom"})
+	if _, err := engine.SyncCustomers(); err == nil {
+		t.Fatal("expected the first cycle to report the failed stock update")
+	}
+	if got := server.DraftDocuments(); got != 0 {
+		t.Errorf("draft documents = %d, want the failed document deleted", got)
+	}
+	if _, ok := engine.DeadLetters.Get(entityStock, "TORN-M6"); !ok {
+		t.Fatal("failed stock update not dead-lettered")
+	}
+	if _, ok := engine.Identities.Get(entityStock, "TORN-M6"); ok {
+		t.Error("failed stock update remembered as pushed")
+	}
+
+	// The retry applies both documents although the stock did not change
+	// again in Sage.
+	result, err := engine.SyncCustomers()
+	if err != nil {
+		t.Fatalf("retry cycle: %v", err)
+	}
+	if result.RetriedCount != 1 {
+		t.Errorf("RetriedCount = %d, want 1", result.RetriedCount)
+	}
+	if got := server.StoreAmount(productID, 1); got != 10 {
+		t.Errorf("store 1 amount = %v, want 10", got)
+	}
+	if got := server.StoreAmount(productID, 2); got != 1 {
+		t.Errorf("store 2 amount = %v, want 1", got)
+	}
+	if _, ok := engine.DeadLetters.Get(entityStock, "TORN-M6"); ok {
+		t.Error("dead letter not resolved after the retry")
+	}
+}
+
+func TestReplayDeadLetterOfProduct(t *testing.T) {
+	engine, source, server := newTestEngine(t)
+	engine.bitrix24 = bitrix24.NewClient(&shared.Bitrix24Config{
+		APITenant: server.WebhookURL(),
+		Stock:     &shared.StockSettings{Warehouses: map[string]string{"Almacen Principal": "1"}},
+	}).WithRateLimitBackoff(0, 0)
+	productID := server.Seed("product", map[string]interface{}{"NAME": "Tornillo M6", "XML_ID": "TORN-M6"})
+	source.PutStockLevel(shared.StockLevel{ProductCode: "TORN-M6", Warehouse: "Almacen Principal", Quantity: 10,
+		ModifiedDate: time.Date(2026, 10, 2, 0, 0, 0, 0, time.UTC)})
+
+	server.FailNext("catalog.document.conduct", &bitrix24test.Error{Status: 400, Code: "ERROR_CORE", Description: "boom"})
+	if _, err := engine.SyncCustomers(); err == nil {
+		t.Fatal("expected the cycle to report the failed stock update")
+	}
+	if _, err := engine.DeadLetters.Park(entityStock, "TORN-M6", "TORN-M6", errors.New("parked")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := engine.ReplayDeadLetter(entityStock, "TORN-M6"); err != nil {
+		t.Fatalf("ReplayDeadLetter: %v", err)
+	}
+	if got := server.StoreAmount(productID, 1); got != 10 {
+		t.Errorf("store 1 amount = %v, want 10", got)
+	}
+	if _, ok := engine.DeadLetters.Get(entityStock, "TORN-M6"); ok {
+		t.Error("dead letter not resolved after the replay")
+	}
+	if err := engine.ReplayDeadLetter(entityBalance, "430000001"); err == nil {
+		t.Error("replaying an entity without dead letters succeeded")
+	}
+}
+
+func TestPricesAndCustomerTariffsSynced(t *testing.T) {
+	engine, source, server := newTestEngine(t)
+	engine.bitrix24 = bitrix24.NewClient(&shared.Bitrix24Config{
+		APITenant: server.WebhookURL(),
+		Pricing: &shared.PricingSettings{
+			PriceTypes:  map[string]string{"standard": "1", "mayorista": "2"},
+			TariffField: "UF_CRM_TARIFF", DiscountField: "UF_CRM_DISCOUNTS"},
+	})
+	productID := server.Seed("product", map[string]interface{}{"NAME": "Tornillo M6", "XML_ID": "TORN-M6"})
+
+	modified := time.Date(2026, 10, 2, 0, 0, 0, 0, time.UTC)
+	source.PutPrice(shared.ProductPrice{ProductCode: "TORN-M6", PriceBand: "Standard", Price: 0.125, ModifiedDate: modified})
+	source.PutPrice(shared.ProductPrice{ProductCode: "TORN-M6", PriceBand: "Mayorista", Price: 0.09, ModifiedDate: modified})
+	// Unmapped price bands are left alone.
+	source.PutPrice(shared.ProductPrice{ProductCode: "TORN-M6", PriceBand: "Promocion", Price: 0.05, ModifiedDate: modified})
+	source.PutCustomerPricing(shared.CustomerPricing{CustomerCode: "430000001", PriceBand: "Mayorista",
+		Discounts: []shared.DiscountRule{{ProductGroup: "TORNILLERIA", Percent: 12}, {Percent: 5}}})
+
+	if _, err := engine.SyncCustomers(); err != nil {
+		t.Fatalf("first cycle: %v", err)
+	}
+	if price, ok := server.Price(productID, 1); !ok || price != 0.125 {
+		t.Errorf("price type 1 = %v (%v), want 0.125", price, ok)
+	}
+	if price, ok := server.Price(productID, 2); !ok || price != 0.09 {
+		t.Errorf("price type 2 = %v (%v), want 0.09", price, ok)
+	}
+	if got := server.CallCount("catalog.price.add"); got != 2 {
+		t.Errorf("catalog.price.add calls = %d, want 2", got)
+	}
+
+	contact, _ := engine.Identities.Get(entityCustomer, "430000001")
+	record := server.Record("contact", contact.RemoteID)
+	if record["UF_CRM_TARIFF"] != "Mayorista" || record["UF_CRM_DISCOUNTS"] != "TORNILLERIA 12%; * 5%" {
+		t.Errorf("contact = %v", record)
+	}
+
+	// A changed price updates the existing one; unchanged tariffs are not
+	// written again.
+	server.ResetCalls()
+	source.PutPrice(shared.ProductPrice{ProductCode: "TORN-M6", PriceBand: "Standard", Price: 0.14,
+		ModifiedDate: time.Now().Add(time.Second)})
+	if _, err := engine.SyncCustomers(); err != nil {
+		t.Fatalf("second cycle: %v", err)
+	}
+	if price, _ := server.Price(productID, 1); price != 0.14 {
+		t.Errorf("price type 1 = %v, want 0.14", price)
+	}
+	if got := server.CallCount("catalog.price.update"); got != 1 {
+		t.Errorf("catalog.price.update calls = %d, want 1", got)
+	}
+	if got := server.CallCount("crm.contact.update"); got != 0 {
+		t.Errorf("crm.contact.update calls = %d, want 0", got)
+	}
+}
+
+func TestPriceFailuresAreRetried(t *testing.T) {
+	engine, source, server := newTestEngine(t)
+	engine.DeadLetters.BaseDelay = 0
+	engine.bitrix24 = bitrix24.NewClient(&shared.Bitrix24Config{
+		APITenant: server.WebhookURL(),
+		Pricing: &shared.PricingSettings{PriceTypes: map[string]string{"standard": "1"},
+			TariffField: "UF_CRM_TARIFF"},
+	}).WithRateLimitBackoff(0, 0)
+	productID := server.Seed("product", map[string]interface{}{"NAME": "Tornillo M6", "XML_ID": "TORN-M6"})
+
+	source.PutPrice(shared.ProductPrice{ProductCode: "TORN-M6", PriceBand: "Standard", Price: 0.125,
+		ModifiedDate: time.Date(2026, 10, 2, 0, 0, 0, 0, time.UTC)})
+	source.PutCustomerPricing(shared.CustomerPricing{CustomerCode: "430000001", PriceBand: "Standard"})
+
+	server.FailNext("catalog.price.add", &bitrix24test.Error{Status: 400, Code: "ERROR_CORE", Description: "boom"})
+	if _, err := engine.SyncCustomers(); err == nil {
+		t.Fatal("expected the first cycle to report the failed price update")
+	}
+	if _, ok := engine.DeadLetters.Get(entityPrice, "TORN-M6"); !ok {
+		t.Fatal("failed price update not dead-lettered")
+	}
+	if _, ok := engine.Identities.Get(entityPrice, "TORN-M6"); ok {
+		t.Error("failed price update remembered as pushed")
+	}
+
+	// The retry writes the price although it did not change again in Sage,
+	// while a failed tariff is simply written on the next cycle.
+	contact, _ := engine.Identities.Get(entityCustomer, "430000001")
+	source.PutCustomerPricing(shared.CustomerPricing{CustomerCode: "430000001", PriceBand: "Mayorista"})
+	server.FailNext("crm.contact.update", &bitrix24test.Error{Status: 400, Code: "ERROR_CORE", Description: "boom"})
+	result, err := engine.SyncCustomers()
+	if err == nil {
+		t.Fatal("expected the retry cycle to report the failed tariff update")
+	}
+	if result.RetriedCount != 1 || result.FailedCount != 1 {
+		t.Errorf("RetriedCount = %d, FailedCount = %d, want 1 and 1", result.RetriedCount, result.FailedCount)
+	}
+	if price, ok := server.Price(productID, 1); !ok || price != 0.125 {
+		t.Errorf("price type 1 = %v (%v), want 0.125", price, ok)
+	}
+	if _, ok := engine.DeadLetters.Get(entityPrice, "TORN-M6"); ok {
+		t.Error("dead letter not resolved after the retry")
+	}
+	if got := server.Record("contact", contact.RemoteID)["UF_CRM_TARIFF"]; got != "Standard" {
+		t.Errorf("UF_CRM_TARIFF = %v, want the tariff before the failed update", got)
+	}
+
+	if _, err := engine.SyncCustomers(); err != nil {
+		t.Fatalf("next cycle: %v", err)
+	}
+	if got := server.Record("contact", contact.RemoteID)["UF_CRM_TARIFF"]; got != "Mayorista" {
+		t.Errorf("UF_CRM_TARIFF = %v, want Mayorista", got)
+	}
+}
+
+func TestLastSyncReadDuringCycle(t *testing.T) {
+	engine, _, _ := newTestEngine(t)
+	logger := engine.logger
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			engine.LastSync()
+		}
+	}()
+
+	if _, err := engine.SyncCustomers(); err != nil {
+		t.Fatalf("SyncCustomers: %v", err)
+	}
+	<-done
+
+	if engine.LastSync().Before(time.Now().Add(-time.Minute)) {
+		t.Errorf("LastSync = %v, want the start of the cycle", engine.LastSync())
+	}
+	if engine.logger != logger {
+		t.Error("cycle replaced the engine logger")
+	}
+}
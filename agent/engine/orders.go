@@ -0,0 +1,145 @@
+// agent/engine/orders.go
+package engine
+
+import (
+	"fmt"
+	"time"
+
+	"saas-sync-platform/agent/bitrix24"
+	"saas-sync-platform/agent/metrics"
+	"saas-sync-platform/agent/sage"
+	"saas-sync-platform/agent/state"
+	"saas-sync-platform/internal/shared"
+)
+
+// entitySalesOrder is the identity map and dead-letter entity type of Sage
+// sales orders and quotes, keyed by document ID
+const entitySalesOrder = "sales_order"
+
+// syncSalesOrders pushes the sales orders and quotes modified since the
+// given time, and those due for retry, as Bitrix24 deals. Failed documents
+// go to the dead-letter queue on their own, apart from their customer.
+func (e *Engine) syncSalesOrders(since time.Time, result *shared.SyncResult) {
+	source, ok := e.source.(sage.SalesOrderSource)
+	if !ok {
+		return
+	}
+
+	defer e.stepSucceeded(entitySalesOrder, result.FailedCount, result)
+
+	orders, err := source.GetRecentSalesOrders(since)
+	if err != nil {
+		e.Metrics.Error(metrics.SourceSage, "READ_FAILED")
+		e.logger.Error("Failed to read Sage sales orders", "error", err)
+		result.FailedCount++
+		return
+	}
+	e.Metrics.RecordsRead(entitySalesOrder, e.Company, len(orders))
+	orders = e.addDueOrderRetries(source, orders, result)
+
+	for i := range orders {
+		order := &orders[i]
+		if err := e.pushSalesOrder(order); err != nil {
+			e.logger.Error("Failed to sync sales order", "order_id", order.ID,
+				"number", order.Number, "customer_code", order.CustomerCode, "error", err)
+			result.FailedCount++
+			if _, err := e.DeadLetters.RecordFailure(entitySalesOrder, order.ID, order.Number, err); err != nil {
+				e.logger.Error("Failed to update dead-letter queue", "order_id", order.ID, "error", err)
+			}
+		} else if err := e.DeadLetters.Resolve(entitySalesOrder, order.ID); err != nil {
+			e.logger.Error("Failed to update dead-letter queue", "order_id", order.ID, "error", err)
+		}
+	}
+}
+
+// addDueOrderRetries appends the dead-lettered documents due for retry
+// that are not already part of this cycle
+func (e *Engine) addDueOrderRetries(source sage.SalesOrderSource, orders []shared.SalesOrder, result *shared.SyncResult) []shared.SalesOrder {
+	inCycle := make(map[string]bool, len(orders))
+	for _, order := range orders {
+		inCycle[order.ID] = true
+	}
+
+	for _, letter := range e.DeadLetters.Due(entitySalesOrder, time.Now()) {
+		result.RetriedCount++
+		if inCycle[letter.Code] {
+			continue
+		}
+
+		order, err := source.GetSalesOrder(letter.Code)
+		if err != nil {
+			e.logger.Error("Failed to reload sales order for retry", "order_id", letter.Code, "error", err)
+			result.FailedCount++
+			if _, err := e.DeadLetters.RecordFailure(entitySalesOrder, letter.Code, letter.Name, err); err != nil {
+				e.logger.Error("Failed to update dead-letter queue", "order_id", letter.Code, "error", err)
+			}
+			continue
+		}
+		orders = append(orders, *order)
+	}
+
+	return orders
+}
+
+// pushSalesOrder creates or updates the deal of a document unless the deal
+// and its lines are unchanged since the last push. The deal is linked to
+// the customer's contact, which is pushed first if the customer was never
+// synced, and to the customer's company when it has one.
+func (e *Engine) pushSalesOrder(order *shared.SalesOrder) error {
+	contactID, err := e.customerContact(order.CustomerCode)
+	if err != nil {
+		return fmt.Errorf("customer %s: %w", order.CustomerCode, err)
+	}
+	company, _ := e.Identities.Get(entityCompany, order.CustomerCode)
+
+	client := e.bitrix24.WithLogger(e.logger).WithMetrics(e.Metrics)
+	hash := bitrix24.PayloadHash(map[string]interface{}{
+		"DEAL":  client.DealPayload(order, contactID, company.RemoteID),
+		"LINES": order.Lines,
+	})
+
+	identity, known := e.Identities.Get(entitySalesOrder, order.ID)
+	if known && identity.Hash == hash {
+		e.Metrics.RecordPushed(entitySalesOrder, bitrix24.ActionSkip)
+		return nil
+	}
+
+	dealID, action, err := client.UpsertDeal(order, identity.RemoteID, contactID, company.RemoteID)
+	if err != nil {
+		if dealID != "" {
+			// Remember the deal so the retry updates it instead of
+			// searching for it again
+			if err := e.Identities.Put(entitySalesOrder, order.ID, state.Identity{RemoteID: dealID, SyncedAt: time.Now()}); err != nil {
+				e.logger.Error("Failed to update identity map", "order_id", order.ID, "error", err)
+			}
+		}
+		return err
+	}
+	e.Metrics.RecordPushed(entitySalesOrder, action)
+
+	return e.Identities.Put(entitySalesOrder, order.ID, state.Identity{
+		RemoteID: dealID,
+		Hash:     hash,
+		SyncedAt: time.Now(),
+	})
+}
+
+// customerContact returns the ID of the contact of a customer, reading the
+// customer from Sage and pushing it when it has none yet
+func (e *Engine) customerContact(code string) (string, error) {
+	if identity, ok := e.Identities.Get(entityCustomer, code); ok {
+		return identity.RemoteID, nil
+	}
+
+	customer, err := e.source.GetCustomerDetails(code)
+	if err != nil {
+		return "", err
+	}
+	if _, err := e.pushCustomer(customer, false); err != nil {
+		e.recordFailure(customer, err)
+		return "", err
+	}
+
+	identity, _ := e.Identities.Get(entityCustomer, code)
+	return identity.RemoteID, nil
+}
@@ -0,0 +1,198 @@
+// agent/engine/persons.go
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"saas-sync-platform/agent/bitrix24"
+	"saas-sync-platform/agent/metrics"
+	"saas-sync-platform/agent/normalize"
+	"saas-sync-platform/agent/sage"
+	"saas-sync-platform/agent/state"
+	"saas-sync-platform/internal/shared"
+)
+
+// Identity map entity types of the records behind contact persons
+const (
+	// entityCompany links a customer code to the Bitrix24 company grouping
+	// its contact persons
+	entityCompany = "company"
+	// entityContactPerson links "<customer code>/<person ID>" to a contact
+	// and is the dead-letter entity type, keyed by customer code, of
+	// customers whose contact persons failed to sync
+	entityContactPerson = "contact_person"
+)
+
+// syncContactPersons syncs the contact persons of the customers of this
+// cycle and of customers whose persons changed since the given time. Each
+// such customer gets a Bitrix24 company its persons' contacts are bound to.
+// A failure sends the customer code to the dead-letter queue as a contact
+// person letter, so its persons are retried on their own, even when the
+// customer itself is unchanged.
+func (e *Engine) syncContactPersons(customers []shared.Customer, since time.Time, result *shared.SyncResult) {
+	source, ok := e.source.(sage.ContactPersonSource)
+	if !ok {
+		return
+	}
+
+	defer e.stepSucceeded(entityContactPerson, result.FailedCount, result)
+
+	changed, err := source.GetRecentContactPersons(since)
+	if err != nil {
+		e.Metrics.Error(metrics.SourceSage, "READ_FAILED")
+		e.logger.Error("Failed to read Sage contact persons", "error", err)
+		result.FailedCount++
+		return
+	}
+	e.Metrics.RecordsRead(entityContactPerson, e.Company, len(changed))
+
+	codes := make([]string, len(changed))
+	for i, person := range changed {
+		codes[i] = person.CustomerCode
+	}
+	for _, letter := range e.DeadLetters.Due(entityContactPerson, time.Now()) {
+		result.RetriedCount++
+		codes = append(codes, letter.Code)
+	}
+	customers = e.withCustomers(customers, codes, result)
+
+	for i := range customers {
+		customer := &customers[i]
+		if err := e.syncCustomerPersons(source, customer); err != nil {
+			e.logger.Error("Failed to sync contact persons",
+				"customer_code", customer.Code, "name", customer.Name, "error", err)
+			result.FailedCount++
+			e.recordEntityFailure(entityContactPerson, customer.Code, customer.Name, err)
+		} else if err := e.DeadLetters.Resolve(entityContactPerson, customer.Code); err != nil {
+			e.logger.Error("Failed to update dead-letter queue", "customer_code", customer.Code, "error", err)
+		}
+	}
+}
+
+// syncCustomerPersons pushes the contact persons of one customer and
+// unbinds the contacts of persons removed from Sage. Customers that never
+// had contact persons get no company.
+func (e *Engine) syncCustomerPersons(source sage.ContactPersonSource, customer *shared.Customer) error {
+	persons, err := source.GetContactPersons(customer.Code)
+	if err != nil {
+		return err
+	}
+
+	known := e.personIdentities(customer.Code)
+	if len(persons) == 0 && len(known) == 0 {
+		return nil
+	}
+
+	companyID, err := e.pushCompany(customer)
+	if err != nil {
+		return err
+	}
+
+	client := e.bitrix24.WithLogger(e.logger).WithMetrics(e.Metrics)
+	current := make(map[string]bool, len(persons))
+	for i := range persons {
+		person := &persons[i]
+		current[personKey(person.CustomerCode, person.ID)] = true
+		if err := e.pushContactPerson(client, person, customer.Country, companyID); err != nil {
+			return fmt.Errorf("contact person %s: %w", person.ID, err)
+		}
+	}
+
+	for key, identity := range known {
+		if current[key] {
+			continue
+		}
+		if err := client.UnbindContact(companyID, identity.RemoteID); err != nil {
+			return err
+		}
+		if err := e.Identities.Delete(entityContactPerson, key); err != nil {
+			return err
+		}
+		e.logger.Info("Unbound contact of removed contact person",
+			"customer_code", customer.Code, "contact_id", identity.RemoteID, "company_id", companyID)
+	}
+
+	return nil
+}
+
+// pushCompany creates or updates the company of a customer unless its
+// payload is unchanged, and returns the company ID
+func (e *Engine) pushCompany(customer *shared.Customer) (string, error) {
+	hash := bitrix24.PayloadHash(e.bitrix24.CompanyPayload(customer))
+
+	identity, known := e.Identities.Get(entityCompany, customer.Code)
+	if known && identity.Hash == hash {
+		return identity.RemoteID, nil
+	}
+
+	client := e.bitrix24.WithLogger(e.logger).WithMetrics(e.Metrics)
+	companyID, action, err := client.UpsertCompany(customer, identity.RemoteID)
+	if err != nil {
+		return "", err
+	}
+	e.Metrics.RecordPushed(entityCompany, action)
+
+	return companyID, e.Identities.Put(entityCompany, customer.Code, state.Identity{
+		RemoteID: companyID,
+		Hash:     hash,
+		SyncedAt: time.Now(),
+	})
+}
+
+// pushContactPerson creates or updates the contact of a person unless its
+// payload is unchanged. An identity without hash marks a contact that was
+// created but not yet bound to the company, so binding is retried.
+func (e *Engine) pushContactPerson(client *bitrix24.Client, person *shared.ContactPerson, country, companyID string) error {
+	e.reportRejects(normalize.Person(person, country).Rejects,
+		"customer_code", person.CustomerCode, "person_id", person.ID)
+
+	key := personKey(person.CustomerCode, person.ID)
+	hash := bitrix24.PayloadHash(client.ContactPersonPayload(person, country))
+
+	identity, known := e.Identities.Get(entityContactPerson, key)
+	if known && identity.Hash == hash {
+		e.Metrics.RecordPushed(entityContactPerson, bitrix24.ActionSkip)
+		return nil
+	}
+
+	contactID, action, err := client.UpsertContactPerson(person, country, identity.RemoteID)
+	if err != nil {
+		return err
+	}
+	e.Metrics.RecordPushed(entityContactPerson, action)
+
+	if !known || identity.Hash == "" {
+		// Remember the contact before binding so a failed bind does not
+		// create it a second time
+		if err := e.Identities.Put(entityContactPerson, key, state.Identity{RemoteID: contactID, SyncedAt: time.Now()}); err != nil {
+			return err
+		}
+		if err := client.BindContact(companyID, contactID); err != nil {
+			return err
+		}
+	}
+
+	return e.Identities.Put(entityContactPerson, key, state.Identity{
+		RemoteID: contactID,
+		Hash:     hash,
+		SyncedAt: time.Now(),
+	})
+}
+
+// personIdentities returns the contact person identities of a customer
+func (e *Engine) personIdentities(customerCode string) map[string]state.Identity {
+	prefix := customerCode + "/"
+	identities := make(map[string]state.Identity)
+	for key, identity := range e.Identities.All(entityContactPerson) {
+		if strings.HasPrefix(key, prefix) {
+			identities[key] = identity
+		}
+	}
+	return identities
+}
+
+func personKey(customerCode, personID string) string {
+	return customerCode + "/" + personID
+}
@@ -0,0 +1,218 @@
+// agent/engine/preview.go
+package engine
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"saas-sync-platform/agent/bitrix24"
+	"saas-sync-platform/agent/normalize"
+	"saas-sync-platform/internal/shared"
+)
+
+// PreviewEntry is the planned action for a single Sage record
+type PreviewEntry struct {
+	Entity   string                 `json:"entity"`
+	Code     string                 `json:"code"`
+	Name     string                 `json:"name"`
+	Action   string                 `json:"action"` // "create", "update", "skip" or "error"
+	BitrixID string                 `json:"bitrix_id,omitempty"`
+	Changes  []bitrix24.FieldChange `json:"changes,omitempty"`
+	Rejects  []normalize.Reject     `json:"rejects,omitempty"` // phone and email parts that will be dropped
+	Retry    bool                   `json:"retry,omitempty"`   // due for retry from the dead-letter queue
+	Error    string                 `json:"error,omitempty"`
+}
+
+// PreviewReport lists what a sync cycle would do without doing it
+type PreviewReport struct {
+	ClientID    string         `json:"client_id"`
+	GeneratedAt time.Time      `json:"generated_at"`
+	Since       time.Time      `json:"since"`
+	Summary     map[string]int `json:"summary"`
+	Entries     []PreviewEntry `json:"entries"`
+	// NotCovered names the parts of a cycle the preview does not plan
+	NotCovered []string `json:"not_covered"`
+}
+
+// actionError marks records whose plan could not be computed
+const actionError = "error"
+
+// previewNotCovered lists what a cycle pushes after the customers
+// themselves, which the preview does not plan
+var previewNotCovered = []string{
+	"addresses", "contact persons", "balances", "customer pricing", "won deals",
+	"sales orders", "collections", "stock", "prices", "suppliers",
+}
+
+// Preview computes the actions a customer sync cycle would take for
+// customers modified since the given time and those due for retry, using
+// the identity map and payload hashes like the cycle does. Only customers
+// are planned; the report names the sections left out. Nothing is written
+// to Bitrix24, the identity map or the dead-letter queue.
+func (e *Engine) Preview(since time.Time) (*PreviewReport, error) {
+	if err := e.source.TestConnection(); err != nil {
+		return nil, fmt.Errorf("Sage connection test failed: %w", err)
+	}
+
+	customers, err := e.source.GetRecentCustomers(since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Sage customers: %w", err)
+	}
+
+	return e.previewCustomers(customers, since), nil
+}
+
+func (e *Engine) previewCustomers(customers []shared.Customer, since time.Time) *PreviewReport {
+	report := &PreviewReport{
+		ClientID:    e.clientCode,
+		GeneratedAt: time.Now(),
+		Since:       since,
+		Summary:     make(map[string]int),
+		NotCovered:  previewNotCovered,
+	}
+
+	add := func(entry PreviewEntry) {
+		report.Summary[entry.Action]++
+		report.Entries = append(report.Entries, entry)
+	}
+
+	inCycle := make(map[string]bool, len(customers))
+	for i := range customers {
+		inCycle[customers[i].Code] = true
+		add(e.previewCustomer(&customers[i]))
+	}
+
+	for _, letter := range e.DeadLetters.Due(entityCustomer, time.Now()) {
+		if inCycle[letter.Code] {
+			continue
+		}
+
+		customer, err := e.source.GetCustomerDetails(letter.Code)
+		if err != nil {
+			add(PreviewEntry{Entity: entityCustomer, Code: letter.Code, Name: letter.Name,
+				Action: actionError, Retry: true, Error: err.Error()})
+			continue
+		}
+
+		entry := e.previewCustomer(customer)
+		entry.Retry = true
+		add(entry)
+	}
+
+	return report
+}
+
+// previewCustomer plans a customer the way pushCustomer decides: records
+// whose payload hash matches the last push are skipped and linked records
+// are planned against their contact
+func (e *Engine) previewCustomer(customer *shared.Customer) PreviewEntry {
+	entry := PreviewEntry{
+		Entity:  entityCustomer,
+		Code:    customer.Code,
+		Name:    customer.Name,
+		Rejects: normalize.Customer(customer).Rejects,
+	}
+	if e.bitrix24 == nil {
+		entry.Action = bitrix24.ActionSkip
+		return entry
+	}
+
+	identity, known := e.Identities.Get(entityCustomer, customer.Code)
+	if known && identity.Hash == bitrix24.PayloadHash(e.bitrix24.ContactPayload(customer)) {
+		entry.Action = bitrix24.ActionSkip
+		entry.BitrixID = identity.RemoteID
+		return entry
+	}
+
+	plan, err := e.bitrix24.PlanCustomer(customer, identity.RemoteID)
+	if err != nil {
+		entry.Action = actionError
+		entry.Error = err.Error()
+		return entry
+	}
+
+	entry.Action = plan.Action
+	entry.BitrixID = plan.ContactID
+	entry.Changes = plan.Changes
+	return entry
+}
+
+// WriteJSON writes the report as indented JSON
+func (r *PreviewReport) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "    ")
+	return encoder.Encode(r)
+}
+
+// WriteCSV writes one row per changed field, or a single row for records
+// without field changes
+func (r *PreviewReport) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+
+	header := []string{"entity", "code", "name", "action", "bitrix_id", "field", "old_value", "new_value", "error"}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, entry := range r.Entries {
+		changes := entry.Changes
+		if len(changes) == 0 {
+			changes = []bitrix24.FieldChange{{}}
+		}
+
+		for _, change := range changes {
+			row := []string{
+				entry.Entity, entry.Code, entry.Name, entry.Action, entry.BitrixID,
+				change.Field, change.Old, change.New, entry.Error,
+			}
+			if err := writer.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// SaveFiles writes the report as JSON and CSV into dir and returns the
+// paths of both files
+func (r *PreviewReport) SaveFiles(dir string) (jsonPath, csvPath string, err error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", "", err
+	}
+
+	base := filepath.Join(dir, "preview-"+r.GeneratedAt.Format("20060102-150405"))
+	jsonPath = base + ".json"
+	csvPath = base + ".csv"
+
+	if err := writeFile(jsonPath, r.WriteJSON); err != nil {
+		return "", "", err
+	}
+	if err := writeFile(csvPath, r.WriteCSV); err != nil {
+		return "", "", err
+	}
+
+	slog.Info("Dry-run report written", "json", jsonPath, "csv", csvPath)
+	return jsonPath, csvPath, nil
+}
+
+func writeFile(path string, write func(io.Writer) error) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
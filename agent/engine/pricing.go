@@ -0,0 +1,107 @@
+// agent/engine/pricing.go
+package engine
+
+import (
+	"strconv"
+	"time"
+
+	"saas-sync-platform/agent/bitrix24"
+	"saas-sync-platform/agent/metrics"
+	"saas-sync-platform/agent/sage"
+	"saas-sync-platform/internal/shared"
+)
+
+const (
+	// entityPrice links a product code to the catalog product whose prices
+	// were last set from it and is the dead-letter entity type of those
+	// updates
+	entityPrice = "price"
+	// entityPricing links a customer code to the contact its tariff and
+	// discount fields were last written to
+	entityPricing = "pricing"
+)
+
+// syncPrices writes the prices of the products with a Sage price changed
+// since the given time, and of those due for retry, to the price types
+// their price bands are mapped to. Products that are not in the Bitrix24
+// catalog are skipped.
+func (e *Engine) syncPrices(since time.Time, result *shared.SyncResult) {
+	source, ok := e.source.(sage.PriceSource)
+	if !ok || !e.bitrix24.SyncsPrices() {
+		return
+	}
+
+	defer e.stepSucceeded(entityPrice, result.FailedCount, result)
+
+	changed, err := source.GetRecentProductPrices(since)
+	if err != nil {
+		e.Metrics.Error(metrics.SourceSage, "READ_FAILED")
+		e.logger.Error("Failed to read Sage product prices", "error", err)
+		result.FailedCount++
+		return
+	}
+	e.Metrics.RecordsRead(entityPrice, e.Company, len(changed))
+
+	var codes []string
+	prices := make(map[string][]shared.ProductPrice)
+	for _, price := range changed {
+		if _, seen := prices[price.ProductCode]; !seen {
+			codes = append(codes, price.ProductCode)
+		}
+		prices[price.ProductCode] = append(prices[price.ProductCode], price)
+	}
+
+	e.syncProducts(e.pricePush(source, prices), codes, result)
+}
+
+// pricePush writes the prices of the products in prices, keyed by product
+// code; products due for retry are read into prices
+func (e *Engine) pricePush(source sage.PriceSource, prices map[string][]shared.ProductPrice) productPush {
+	return productPush{
+		entity: entityPrice,
+		reload: func(code string) error {
+			reloaded, err := source.GetProductPrices(code)
+			prices[code] = reloaded
+			return err
+		},
+		payload: func(client *bitrix24.Client, code, productID string) map[string]interface{} {
+			types := make(map[string]interface{})
+			for priceType, price := range client.PricePayload(prices[code]) {
+				types[strconv.Itoa(priceType)] = price
+			}
+			return map[string]interface{}{"PRODUCT_ID": productID, "PRICE_TYPES": types}
+		},
+		write: func(client *bitrix24.Client, code, productID string) error {
+			return client.SetProductPrices(productID, client.PricePayload(prices[code]))
+		},
+	}
+}
+
+// syncCustomerPricing writes the tariff and discount rules of every
+// customer that changed to the customers' contacts and companies
+func (e *Engine) syncCustomerPricing(result *shared.SyncResult) {
+	source, ok := e.source.(sage.PriceSource)
+	if !ok || !e.bitrix24.SyncsCustomerPricing() {
+		return
+	}
+
+	defer e.stepSucceeded(entityPricing, result.FailedCount, result)
+
+	pricing, err := source.GetCustomerPricing()
+	if err != nil {
+		e.Metrics.Error(metrics.SourceSage, "READ_FAILED")
+		e.logger.Error("Failed to read Sage customer pricing", "error", err)
+		result.FailedCount++
+		return
+	}
+	e.Metrics.RecordsRead(entityPricing, e.Company, len(pricing))
+
+	customers := make([]customerFields, len(pricing))
+	for i := range pricing {
+		customers[i] = customerFields{
+			code:   pricing[i].CustomerCode,
+			fields: e.bitrix24.CustomerPricingPayload(&pricing[i]),
+		}
+	}
+	e.syncCustomerFields(entityPricing, customers, result)
+}
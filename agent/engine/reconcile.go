@@ -0,0 +1,269 @@
+// agent/engine/reconcile.go
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"saas-sync-platform/agent/bitrix24"
+	"saas-sync-platform/agent/state"
+	"saas-sync-platform/internal/shared"
+)
+
+// Kinds of reconciliation findings
+const (
+	// FindingMissing is a Sage customer without a Bitrix24 contact
+	FindingMissing = "missing"
+	// FindingStale is an identity pointing to a contact that no longer exists
+	FindingStale = "stale_identity"
+	// FindingUnlinked is a contact created by the sync that the identity
+	// map does not know about
+	FindingUnlinked = "unlinked"
+	// FindingMismatch is a contact whose fields differ from Sage
+	FindingMismatch = "mismatch"
+	// FindingDuplicate is a customer with more than one contact
+	FindingDuplicate = "duplicate"
+	// FindingOrphan is a contact or identity for a customer no longer in Sage
+	FindingOrphan = "orphan"
+)
+
+// ReconcileFinding is one discrepancy between Sage and Bitrix24
+type ReconcileFinding struct {
+	Kind      string                 `json:"kind"`
+	Code      string                 `json:"code"`
+	Name      string                 `json:"name,omitempty"`
+	BitrixID  string                 `json:"bitrix_id,omitempty"`
+	OtherIDs  []string               `json:"other_ids,omitempty"` // further contacts of a duplicate
+	Changes   []bitrix24.FieldChange `json:"changes,omitempty"`
+	Fixed     bool                   `json:"fixed"`
+	FixAction string                 `json:"fix_action,omitempty"`
+	Error     string                 `json:"error,omitempty"`
+}
+
+// ReconcileReport is the outcome of a full reconciliation
+type ReconcileReport struct {
+	ClientID       string             `json:"client_id"`
+	StartedAt      time.Time          `json:"started_at"`
+	CompletedAt    time.Time          `json:"completed_at"`
+	Fix            bool               `json:"fix"`
+	SageCustomers  int                `json:"sage_customers"`
+	BitrixContacts int                `json:"bitrix_contacts"`
+	Summary        map[string]int     `json:"summary"`
+	Findings       []ReconcileFinding `json:"findings"`
+}
+
+// Reconcile compares every Sage customer with every Bitrix24 contact,
+// matching them through the identity map and the customer code the sync
+// writes into contact comments. With fix set, missing and mismatched
+// contacts are pushed again and the identity map is repaired. Duplicates
+// and orphans are only reported; deleting contacts is left to a person.
+func (e *Engine) Reconcile(fix bool) (*ReconcileReport, error) {
+	if e.bitrix24 == nil {
+		return nil, fmt.Errorf("Bitrix24 is not configured")
+	}
+
+	report := &ReconcileReport{
+		ClientID:  e.clientCode,
+		StartedAt: time.Now(),
+		Fix:       fix,
+		Summary:   make(map[string]int),
+		Findings:  []ReconcileFinding{},
+	}
+
+	customers, err := e.source.GetAllCustomers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Sage customers: %w", err)
+	}
+
+	contacts, err := e.bitrix24.ListContacts()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Bitrix24 contacts: %w", err)
+	}
+
+	report.SageCustomers = len(customers)
+	report.BitrixContacts = len(contacts)
+	e.logger.Info("Reconciling customers", "sage_customers", len(customers),
+		"bitrix_contacts", len(contacts), "fix", fix)
+
+	// Index contacts by ID and by the customer code in their comments
+	contactsByID := make(map[string]map[string]interface{}, len(contacts))
+	contactsByCode := make(map[string][]string)
+	for _, contact := range contacts {
+		id := bitrix24.RecordID(contact)
+		contactsByID[id] = contact
+
+		comments, _ := contact["COMMENTS"].(string)
+		if code := bitrix24.CustomerCodeFromComments(comments); code != "" {
+			contactsByCode[code] = append(contactsByCode[code], id)
+		}
+	}
+
+	identities := e.Identities.All(entityCustomer)
+	inSage := make(map[string]bool, len(customers))
+
+	for i := range customers {
+		customer := &customers[i]
+		inSage[customer.Code] = true
+		e.reconcileCustomer(report, customer, identities, contactsByID, contactsByCode[customer.Code])
+	}
+
+	e.reconcileOrphans(report, inSage, identities, contactsByCode)
+
+	for _, finding := range report.Findings {
+		report.Summary[finding.Kind]++
+	}
+	report.CompletedAt = time.Now()
+
+	e.logger.Info("Reconciliation completed", "summary", report.Summary,
+		"duration", report.CompletedAt.Sub(report.StartedAt))
+	return report, nil
+}
+
+// reconcileCustomer checks one Sage customer against its contacts
+func (e *Engine) reconcileCustomer(report *ReconcileReport, customer *shared.Customer,
+	identities map[string]state.Identity, contactsByID map[string]map[string]interface{}, claimed []string) {
+
+	identity, known := identities[customer.Code]
+	contactID := ""
+
+	if known {
+		if _, exists := contactsByID[identity.RemoteID]; exists {
+			contactID = identity.RemoteID
+		} else {
+			finding := ReconcileFinding{Kind: FindingStale, Code: customer.Code, Name: customer.Name, BitrixID: identity.RemoteID}
+			if report.Fix {
+				e.applyFix(&finding, "forget_identity", e.Identities.Delete(entityCustomer, customer.Code))
+			}
+			report.Findings = append(report.Findings, finding)
+		}
+	}
+
+	// Contacts the sync created but the identity map lost track of
+	if contactID == "" && len(claimed) > 0 {
+		contactID = claimed[0]
+		finding := ReconcileFinding{Kind: FindingUnlinked, Code: customer.Code, Name: customer.Name, BitrixID: contactID}
+		if report.Fix {
+			err := e.Identities.Put(entityCustomer, customer.Code, state.Identity{RemoteID: contactID, SyncedAt: time.Now()})
+			e.applyFix(&finding, "link", err)
+		}
+		report.Findings = append(report.Findings, finding)
+	}
+
+	if others := otherIDs(claimed, contactID); len(others) > 0 {
+		report.Findings = append(report.Findings, ReconcileFinding{
+			Kind:     FindingDuplicate,
+			Code:     customer.Code,
+			Name:     customer.Name,
+			BitrixID: contactID,
+			OtherIDs: others,
+		})
+	}
+
+	if contactID == "" {
+		finding := ReconcileFinding{Kind: FindingMissing, Code: customer.Code, Name: customer.Name}
+		if report.Fix {
+			e.fixByPush(&finding, customer)
+		}
+		report.Findings = append(report.Findings, finding)
+		return
+	}
+
+	changes := e.bitrix24.ContactChanges(customer, contactsByID[contactID])
+	if len(changes) == 0 {
+		return
+	}
+
+	finding := ReconcileFinding{Kind: FindingMismatch, Code: customer.Code, Name: customer.Name, BitrixID: contactID, Changes: changes}
+	if report.Fix {
+		// Without a linked identity the push would search by name and
+		// could pick another contact
+		var err error
+		if _, linked := e.Identities.Get(entityCustomer, customer.Code); !linked {
+			err = e.Identities.Put(entityCustomer, customer.Code, state.Identity{RemoteID: contactID, SyncedAt: time.Now()})
+		}
+		if err != nil {
+			e.applyFix(&finding, "link", err)
+		} else {
+			e.fixByPush(&finding, customer)
+		}
+	}
+	report.Findings = append(report.Findings, finding)
+}
+
+// reconcileOrphans reports contacts and identities of customers that no
+// longer exist in Sage. With fix set, orphaned identities are forgotten;
+// the contacts themselves are kept.
+func (e *Engine) reconcileOrphans(report *ReconcileReport, inSage map[string]bool,
+	identities map[string]state.Identity, contactsByCode map[string][]string) {
+
+	orphans := make(map[string]bool)
+	for code := range contactsByCode {
+		if !inSage[code] {
+			orphans[code] = true
+		}
+	}
+	for code := range identities {
+		if !inSage[code] {
+			orphans[code] = true
+		}
+	}
+
+	codes := make([]string, 0, len(orphans))
+	for code := range orphans {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	for _, code := range codes {
+		finding := ReconcileFinding{Kind: FindingOrphan, Code: code}
+
+		ids := contactsByCode[code]
+		if identity, known := identities[code]; known {
+			finding.BitrixID = identity.RemoteID
+			ids = otherIDs(ids, identity.RemoteID)
+			if report.Fix {
+				e.applyFix(&finding, "forget_identity", e.Identities.Delete(entityCustomer, code))
+			}
+		} else if len(ids) > 0 {
+			finding.BitrixID, ids = ids[0], ids[1:]
+		}
+		finding.OtherIDs = ids
+
+		report.Findings = append(report.Findings, finding)
+	}
+}
+
+// fixByPush pushes a customer to Bitrix24 regardless of its stored hash
+func (e *Engine) fixByPush(finding *ReconcileFinding, customer *shared.Customer) {
+	action, err := e.pushCustomer(customer, true)
+	if err == nil {
+		if identity, ok := e.Identities.Get(entityCustomer, customer.Code); ok {
+			finding.BitrixID = identity.RemoteID
+		}
+	}
+	e.applyFix(finding, action, err)
+}
+
+// applyFix records the outcome of a fix on a finding
+func (e *Engine) applyFix(finding *ReconcileFinding, action string, err error) {
+	finding.FixAction = action
+	if err != nil {
+		finding.Error = err.Error()
+		e.logger.Error("Reconciliation fix failed", "kind", finding.Kind,
+			"customer_code", finding.Code, "action", action, "error", err)
+		return
+	}
+	finding.Fixed = true
+}
+
+// otherIDs returns ids without exclude
+func otherIDs(ids []string, exclude string) []string {
+	var others []string
+	for _, id := range ids {
+		if id != exclude {
+			others = append(others, id)
+		}
+	}
+	return others
+}
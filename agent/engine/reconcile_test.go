@@ -0,0 +1,114 @@
+package engine
+
+import (
+	"testing"
+
+	"saas-sync-platform/agent/sage"
+	"saas-sync-platform/agent/state"
+	"saas-sync-platform/internal/shared"
+)
+
+func TestReconcileReportsAndFixesDrift(t *testing.T) {
+	engine, source, server := newTestEngine(t)
+	server.PageSize = 2
+
+	// 430000001 and 430000002 are synced; 430000003 is older than the
+	// watermark and never reaches Bitrix24.
+	if _, err := engine.SyncCustomers(); err != nil {
+		t.Fatalf("SyncCustomers: %v", err)
+	}
+
+	// A manual edit in Bitrix24 and a lost identity for 430000002
+	bar, _ := source.GetCustomerDetails("430000002")
+	identity, _ := engine.Identities.Get(entityCustomer, "430000002")
+	edited := *bar
+	edited.City = "Roses"
+	if err := engine.bitrix24.UpdateContact(identity.RemoteID, &edited); err != nil {
+		t.Fatalf("UpdateContact: %v", err)
+	}
+	engine.Identities.Delete(entityCustomer, "430000002")
+
+	// A second contact for 430000001 and one for a customer deleted in Sage
+	server.Seed("contact", map[string]interface{}{
+		"NAME":     "Ferreteria Puig SL",
+		"COMMENTS": "Synced from Sage 200c - Customer Code: 430000001",
+	})
+	server.Seed("contact", map[string]interface{}{
+		"NAME":     "Antic Client SA",
+		"COMMENTS": "Synced from Sage 200c - Customer Code: 439999999",
+	})
+
+	report, err := engine.Reconcile(false)
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+
+	if report.SageCustomers != 3 || report.BitrixContacts != 4 {
+		t.Errorf("counts = %d customers, %d contacts, want 3 and 4", report.SageCustomers, report.BitrixContacts)
+	}
+	want := map[string]int{
+		FindingMissing:   1,
+		FindingUnlinked:  1,
+		FindingMismatch:  1,
+		FindingDuplicate: 1,
+		FindingOrphan:    1,
+	}
+	assertSummary(t, report.Summary, want)
+	if got := len(server.Records("contact")); got != 4 {
+		t.Errorf("report-only run changed contacts: %d, want 4", got)
+	}
+
+	report, err = engine.Reconcile(true)
+	if err != nil {
+		t.Fatalf("Reconcile(fix): %v", err)
+	}
+	for _, finding := range report.Findings {
+		fixable := finding.Kind != FindingDuplicate && finding.Kind != FindingOrphan
+		if finding.Fixed != fixable {
+			t.Errorf("finding %+v: fixed = %v, want %v", finding, finding.Fixed, fixable)
+		}
+	}
+
+	// Only the findings left for a person remain
+	report, err = engine.Reconcile(false)
+	if err != nil {
+		t.Fatalf("Reconcile after fix: %v", err)
+	}
+	assertSummary(t, report.Summary, map[string]int{FindingDuplicate: 1, FindingOrphan: 1})
+
+	if _, ok := engine.Identities.Get(entityCustomer, "430000003"); !ok {
+		t.Error("missing customer was not linked after fix")
+	}
+}
+
+func TestReconcileForgetsStaleIdentities(t *testing.T) {
+	engine, _, _ := newTestEngine(t)
+	engine.source = sage.NewMemorySource(shared.Customer{Code: "430000009", Name: "Nou Client"})
+	engine.Identities.Put(entityCustomer, "430000009", state.Identity{RemoteID: "999"})
+
+	report, err := engine.Reconcile(true)
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	assertSummary(t, report.Summary, map[string]int{FindingStale: 1, FindingMissing: 1})
+
+	identity, ok := engine.Identities.Get(entityCustomer, "430000009")
+	if !ok || identity.RemoteID == "999" {
+		t.Errorf("identity = %+v, %v; want a newly created contact", identity, ok)
+	}
+}
+
+func assertSummary(t *testing.T, got, want map[string]int) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Errorf("summary = %v, want %v", got, want)
+		return
+	}
+	for kind, count := range want {
+		if got[kind] != count {
+			t.Errorf("summary = %v, want %v", got, want)
+			return
+		}
+	}
+}
@@ -0,0 +1,276 @@
+// agent/engine/retry.go
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"saas-sync-platform/agent/bitrix24"
+	"saas-sync-platform/agent/sage"
+	"saas-sync-platform/internal/shared"
+)
+
+// addDueRetries appends the dead-lettered customers due for retry that are
+// not already part of this cycle
+func (e *Engine) addDueRetries(customers []shared.Customer, result *shared.SyncResult) []shared.Customer {
+	due := e.DeadLetters.Due(entityCustomer, time.Now())
+	if len(due) == 0 {
+		return customers
+	}
+
+	inCycle := make(map[string]bool, len(customers))
+	for _, customer := range customers {
+		inCycle[customer.Code] = true
+	}
+
+	for _, letter := range due {
+		result.RetriedCount++
+		if inCycle[letter.Code] {
+			continue
+		}
+
+		customer, err := e.source.GetCustomerDetails(letter.Code)
+		if err != nil {
+			e.logger.Error("Failed to reload customer for retry", "customer_code", letter.Code, "error", err)
+			result.FailedCount++
+			e.recordFailure(&shared.Customer{Code: letter.Code, Name: letter.Name}, err)
+			continue
+		}
+
+		customers = append(customers, *customer)
+		result.RecordsCount++
+	}
+
+	e.logger.Info("Retrying previously failed customers", "count", result.RetriedCount)
+	return customers
+}
+
+// recordFailure stores a failed customer in the dead-letter queue. Customers
+// flagged for duplicate review are parked, since retrying cannot help until
+// a person decides.
+func (e *Engine) recordFailure(customer *shared.Customer, failure error) {
+	var duplicate *bitrix24.DuplicateError
+	if errors.As(failure, &duplicate) {
+		if _, err := e.DeadLetters.Park(entityCustomer, customer.Code, customer.Name, failure); err != nil {
+			e.logger.Error("Failed to update dead-letter queue", "customer_code", customer.Code, "error", err)
+		}
+		return
+	}
+
+	e.recordEntityFailure(entityCustomer, customer.Code, customer.Name, failure)
+}
+
+// recordEntityFailure stores a record that failed to sync in the
+// dead-letter queue under the given entity type, warning when it is parked
+// after too many attempts
+func (e *Engine) recordEntityFailure(entity, code, name string, failure error) {
+	letter, err := e.DeadLetters.RecordFailure(entity, code, name, failure)
+	if err != nil {
+		e.logger.Error("Failed to update dead-letter queue", "entity", entity, "code", code, "error", err)
+		return
+	}
+
+	if letter.Parked {
+		e.logger.Warn("Record parked after repeated failures",
+			"entity", entity, "code", code, "attempts", letter.Attempts)
+	}
+}
+
+// ReplayDeadLetter retries a dead-lettered record immediately, running the
+// step that failed for it, and removes it from the queue on success
+func (e *Engine) ReplayDeadLetter(entity, code string) error {
+	// Suppliers may only go to Tickelia
+	if e.bitrix24 == nil && entity != entitySupplier {
+		return fmt.Errorf("Bitrix24 is not configured")
+	}
+	letter, ok := e.DeadLetters.Get(entity, code)
+	if !ok {
+		return fmt.Errorf("no dead letter for %s %s", entity, code)
+	}
+
+	var err error
+	switch entity {
+	case entityCustomer:
+		err = e.replayCustomer(code)
+	case entityContactPerson:
+		err = e.replayContactPersons(code)
+	case entityAddress:
+		err = e.replayAddresses(code)
+	case entitySalesOrder:
+		err = e.replaySalesOrder(code)
+	case entityWonDeal:
+		err = e.replayWonDeal(code)
+	case entityCollection:
+		err = e.replayCollection(code)
+	case entitySupplier:
+		err = e.replaySupplier(code)
+	case entityStock:
+		err = e.replayStock(code)
+	case entityPrice:
+		err = e.replayPrices(code)
+	default:
+		return fmt.Errorf("dead letters of entity %q cannot be replayed", entity)
+	}
+	if err != nil {
+		if entity != entityCustomer {
+			e.recordEntityFailure(entity, code, letter.Name, err)
+		}
+		return err
+	}
+
+	return e.DeadLetters.Resolve(entity, code)
+}
+
+// replayCustomer pushes a dead-lettered customer, recording a new failure
+// like a regular cycle would
+func (e *Engine) replayCustomer(code string) error {
+	customer, err := e.source.GetCustomerDetails(code)
+	if err != nil {
+		e.recordFailure(&shared.Customer{Code: code}, err)
+		return err
+	}
+
+	if _, err := e.pushCustomer(customer, false); err != nil {
+		e.recordFailure(customer, err)
+		return err
+	}
+	return nil
+}
+
+// replayContactPersons pushes the contact persons of a customer
+func (e *Engine) replayContactPersons(code string) error {
+	source, ok := e.source.(sage.ContactPersonSource)
+	if !ok {
+		return fmt.Errorf("the Sage source has no contact persons")
+	}
+
+	customer, err := e.source.GetCustomerDetails(code)
+	if err != nil {
+		return err
+	}
+	return e.syncCustomerPersons(source, customer)
+}
+
+// replayAddresses writes the addresses of a customer to its contact
+func (e *Engine) replayAddresses(code string) error {
+	source, ok := e.source.(sage.AddressSource)
+	if !ok {
+		return fmt.Errorf("the Sage source has no addresses")
+	}
+	contact, ok := e.Identities.Get(entityCustomer, code)
+	if !ok {
+		return fmt.Errorf("customer %s has no Bitrix24 contact yet", code)
+	}
+
+	customer, err := e.source.GetCustomerDetails(code)
+	if err != nil {
+		return err
+	}
+	return e.pushAddresses(source, customer, contact.RemoteID)
+}
+
+// replaySalesOrder pushes a sales order or quote as a deal
+func (e *Engine) replaySalesOrder(id string) error {
+	source, ok := e.source.(sage.SalesOrderSource)
+	if !ok {
+		return fmt.Errorf("the Sage source has no sales orders")
+	}
+
+	order, err := source.GetSalesOrder(id)
+	if err != nil {
+		return err
+	}
+	return e.pushSalesOrder(order)
+}
+
+// replayWonDeal creates the Sage sales order of a won deal
+func (e *Engine) replayWonDeal(dealID string) error {
+	writer, ok := e.source.(sage.SalesOrderWriter)
+	if !ok {
+		return fmt.Errorf("the Sage source cannot create sales orders")
+	}
+
+	client := e.bitrix24.WithLogger(e.logger).WithMetrics(e.Metrics)
+	deal, err := client.GetDeal(dealID)
+	if err != nil {
+		return err
+	}
+	return e.createOrderFromDeal(client, writer, deal)
+}
+
+// replayCollection writes the collection state of a sales order to its
+// deal
+func (e *Engine) replayCollection(orderID string) error {
+	source, ok := e.source.(sage.ReceivableSource)
+	if !ok {
+		return fmt.Errorf("the Sage source has no receivables")
+	}
+
+	client := e.bitrix24.WithLogger(e.logger).WithMetrics(e.Metrics)
+	return e.pushCollection(client, source, orderID)
+}
+
+// replaySupplier pushes a supplier to every configured destination
+func (e *Engine) replaySupplier(code string) error {
+	source, ok := e.source.(sage.SupplierSource)
+	if !ok {
+		return fmt.Errorf("the Sage source has no suppliers")
+	}
+
+	supplier, err := source.GetSupplier(code)
+	if err != nil {
+		return err
+	}
+	return e.pushSupplier(supplier, e.bitrix24 != nil && e.bitrix24.SyncsSuppliers())
+}
+
+// replayStock sets the store quantities of a product
+func (e *Engine) replayStock(code string) error {
+	source, ok := e.source.(sage.StockSource)
+	if !ok {
+		return fmt.Errorf("the Sage source has no stock levels")
+	}
+	return e.replayProduct(e.stockPush(source, make(map[string][]shared.StockLevel)), code)
+}
+
+// replayPrices writes the prices of a product
+func (e *Engine) replayPrices(code string) error {
+	source, ok := e.source.(sage.PriceSource)
+	if !ok {
+		return fmt.Errorf("the Sage source has no prices")
+	}
+	return e.replayProduct(e.pricePush(source, make(map[string][]shared.ProductPrice)), code)
+}
+
+// replayProduct reads the data of a product and writes it to the catalog
+func (e *Engine) replayProduct(push productPush, code string) error {
+	if err := push.reload(code); err != nil {
+		return err
+	}
+
+	client := e.bitrix24.WithLogger(e.logger).WithMetrics(e.Metrics)
+	return e.pushProduct(client, push, code)
+}
+
+// ResyncCustomer reads a customer from Sage and pushes it to Bitrix24 even
+// if it has not changed since the last push, returning the action taken.
+// Failures go to the dead-letter queue like those of a regular cycle.
+func (e *Engine) ResyncCustomer(code string) (string, error) {
+	if e.bitrix24 == nil {
+		return "", fmt.Errorf("Bitrix24 is not configured")
+	}
+
+	customer, err := e.source.GetCustomerDetails(code)
+	if err != nil {
+		return "", err
+	}
+
+	action, err := e.pushCustomer(customer, true)
+	if err != nil {
+		e.recordFailure(customer, err)
+		return action, err
+	}
+
+	return action, e.DeadLetters.Resolve(entityCustomer, code)
+}
@@ -0,0 +1,101 @@
+// agent/engine/stock.go
+package engine
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"saas-sync-platform/agent/bitrix24"
+	"saas-sync-platform/agent/metrics"
+	"saas-sync-platform/agent/sage"
+	"saas-sync-platform/internal/shared"
+)
+
+// entityStock links a product code to the catalog product whose store
+// quantities were last set from it and is the dead-letter entity type of
+// those updates
+const entityStock = "stock"
+
+// syncStock sets the store quantities of the products whose Sage stock
+// changed since the given time, and of those due for retry, to their stock
+// in the warehouses mapped to each store. Products that are not in the
+// Bitrix24 catalog are skipped.
+func (e *Engine) syncStock(since time.Time, result *shared.SyncResult) {
+	source, ok := e.source.(sage.StockSource)
+	if !ok || !e.bitrix24.SyncsStock() {
+		return
+	}
+
+	defer e.stepSucceeded(entityStock, result.FailedCount, result)
+
+	changed, err := source.GetRecentStockLevels(since)
+	if err != nil {
+		e.Metrics.Error(metrics.SourceSage, "READ_FAILED")
+		e.logger.Error("Failed to read Sage stock levels", "error", err)
+		result.FailedCount++
+		return
+	}
+	e.Metrics.RecordsRead(entityStock, e.Company, len(changed))
+
+	var codes []string
+	levels := make(map[string][]shared.StockLevel)
+	for _, level := range changed {
+		if _, seen := levels[level.ProductCode]; !seen {
+			codes = append(codes, level.ProductCode)
+		}
+		levels[level.ProductCode] = append(levels[level.ProductCode], level)
+	}
+
+	e.syncProducts(e.stockPush(source, levels), codes, result)
+}
+
+// stockPush writes the store quantities of the products in levels, keyed by
+// product code; products due for retry are read into levels
+func (e *Engine) stockPush(source sage.StockSource, levels map[string][]shared.StockLevel) productPush {
+	return productPush{
+		entity: entityStock,
+		reload: func(code string) error {
+			reloaded, err := source.GetProductStockLevels(code)
+			levels[code] = reloaded
+			return err
+		},
+		payload: func(client *bitrix24.Client, code, productID string) map[string]interface{} {
+			stores := make(map[string]interface{})
+			for store, quantity := range client.StockPayload(levels[code]) {
+				stores[strconv.Itoa(store)] = quantity
+			}
+			return map[string]interface{}{"PRODUCT_ID": productID, "STORES": stores}
+		},
+		write: func(client *bitrix24.Client, code, productID string) error {
+			return e.moveStock(client, code, productID, levels[code])
+		},
+	}
+}
+
+// moveStock moves the store quantities of a product to its Sage stock. The
+// quantities are read back first, so a retry after a partial failure only
+// applies what is still missing.
+func (e *Engine) moveStock(client *bitrix24.Client, code, productID string, levels []shared.StockLevel) error {
+	wanted := client.StockPayload(levels)
+	current, err := client.StoreQuantities([]string{productID})
+	if err != nil {
+		return err
+	}
+
+	var changes []bitrix24.StockChange
+	for store, quantity := range wanted {
+		if delta := quantity - current[productID][store]; delta != 0 {
+			changes = append(changes, bitrix24.StockChange{ProductID: productID, StoreID: store, Delta: delta})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].StoreID < changes[j].StoreID })
+
+	if err := client.AdjustStock(changes); err != nil {
+		return err
+	}
+
+	e.logger.Info("Updated store quantities", "product_code", code, "product_id", productID,
+		"stores", len(wanted), "changes", len(changes))
+	return nil
+}
@@ -0,0 +1,159 @@
+// agent/engine/suppliers.go
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"saas-sync-platform/agent/bitrix24"
+	"saas-sync-platform/agent/metrics"
+	"saas-sync-platform/agent/sage"
+	"saas-sync-platform/agent/state"
+	"saas-sync-platform/agent/tickelia"
+	"saas-sync-platform/internal/shared"
+)
+
+const (
+	// entitySupplier links a supplier code to its Bitrix24 company and is
+	// the dead-letter entity type of suppliers
+	entitySupplier = "supplier"
+	// entityVendor links a supplier code to its Tickelia vendor
+	entityVendor = "vendor"
+)
+
+// syncSuppliers pushes the suppliers modified since the given time, and
+// those due for retry, as Bitrix24 supplier companies when SyncSuppliers is
+// configured and as Tickelia vendors when Tickelia is set. A supplier that
+// fails in either goes to the dead-letter queue; on retry the destination
+// that already has it is skipped by hash.
+func (e *Engine) syncSuppliers(since time.Time, result *shared.SyncResult) {
+	source, ok := e.source.(sage.SupplierSource)
+	toBitrix := e.bitrix24 != nil && e.bitrix24.SyncsSuppliers()
+	if !ok || (!toBitrix && e.Tickelia == nil) {
+		return
+	}
+
+	defer e.stepSucceeded(entitySupplier, result.FailedCount, result)
+
+	suppliers, err := source.GetRecentSuppliers(since)
+	if err != nil {
+		e.Metrics.Error(metrics.SourceSage, "READ_FAILED")
+		e.logger.Error("Failed to read Sage suppliers", "error", err)
+		result.FailedCount++
+		return
+	}
+	e.Metrics.RecordsRead(entitySupplier, e.Company, len(suppliers))
+	suppliers = e.addDueSupplierRetries(source, suppliers, result)
+
+	for i := range suppliers {
+		supplier := &suppliers[i]
+		if err := e.pushSupplier(supplier, toBitrix); err != nil {
+			e.logger.Error("Failed to sync supplier", "supplier_code", supplier.Code,
+				"name", supplier.Name, "error", err)
+			result.FailedCount++
+			if _, err := e.DeadLetters.RecordFailure(entitySupplier, supplier.Code, supplier.Name, err); err != nil {
+				e.logger.Error("Failed to update dead-letter queue", "supplier_code", supplier.Code, "error", err)
+			}
+		} else if err := e.DeadLetters.Resolve(entitySupplier, supplier.Code); err != nil {
+			e.logger.Error("Failed to update dead-letter queue", "supplier_code", supplier.Code, "error", err)
+		}
+	}
+}
+
+// addDueSupplierRetries appends the dead-lettered suppliers due for retry
+// that are not already part of this cycle
+func (e *Engine) addDueSupplierRetries(source sage.SupplierSource, suppliers []shared.Supplier, result *shared.SyncResult) []shared.Supplier {
+	inCycle := make(map[string]bool, len(suppliers))
+	for _, supplier := range suppliers {
+		inCycle[supplier.Code] = true
+	}
+
+	for _, letter := range e.DeadLetters.Due(entitySupplier, time.Now()) {
+		result.RetriedCount++
+		if inCycle[letter.Code] {
+			continue
+		}
+
+		supplier, err := source.GetSupplier(letter.Code)
+		if err != nil {
+			e.logger.Error("Failed to reload supplier for retry", "supplier_code", letter.Code, "error", err)
+			result.FailedCount++
+			if _, err := e.DeadLetters.RecordFailure(entitySupplier, letter.Code, letter.Name, err); err != nil {
+				e.logger.Error("Failed to update dead-letter queue", "supplier_code", letter.Code, "error", err)
+			}
+			continue
+		}
+		suppliers = append(suppliers, *supplier)
+	}
+
+	return suppliers
+}
+
+// pushSupplier pushes a supplier to every configured destination, going on
+// to the next one when a destination fails
+func (e *Engine) pushSupplier(supplier *shared.Supplier, toBitrix bool) error {
+	var errs []error
+	if toBitrix {
+		if err := e.pushSupplierCompany(supplier); err != nil {
+			errs = append(errs, fmt.Errorf("Bitrix24: %w", err))
+		}
+	}
+	if e.Tickelia != nil {
+		if err := e.pushVendor(supplier); err != nil {
+			errs = append(errs, fmt.Errorf("Tickelia: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// pushSupplierCompany creates or updates the Bitrix24 company of a
+// supplier unless it is unchanged since the last push
+func (e *Engine) pushSupplierCompany(supplier *shared.Supplier) error {
+	client := e.bitrix24.WithLogger(e.logger).WithMetrics(e.Metrics)
+	hash := bitrix24.PayloadHash(client.SupplierPayload(supplier))
+
+	identity, known := e.Identities.Get(entitySupplier, supplier.Code)
+	if known && identity.Hash == hash {
+		e.Metrics.RecordPushed(entitySupplier, bitrix24.ActionSkip)
+		return nil
+	}
+
+	companyID, action, err := client.UpsertSupplier(supplier, identity.RemoteID)
+	if err != nil {
+		return err
+	}
+	e.Metrics.RecordPushed(entitySupplier, action)
+
+	return e.Identities.Put(entitySupplier, supplier.Code, state.Identity{
+		RemoteID: companyID,
+		Hash:     hash,
+		SyncedAt: time.Now(),
+	})
+}
+
+// pushVendor creates or updates the Tickelia vendor of a supplier unless it
+// is unchanged since the last push
+func (e *Engine) pushVendor(supplier *shared.Supplier) error {
+	client := e.Tickelia.WithLogger(e.logger).WithMetrics(e.Metrics)
+	vendor := tickelia.VendorPayload(supplier)
+	hash := tickelia.VendorHash(vendor)
+
+	identity, known := e.Identities.Get(entityVendor, supplier.Code)
+	if known && identity.Hash == hash {
+		e.Metrics.TickeliaRecordPushed(entityVendor, tickelia.ActionSkip)
+		return nil
+	}
+
+	vendorID, action, err := client.UpsertVendor(vendor, identity.RemoteID)
+	if err != nil {
+		return err
+	}
+	e.Metrics.TickeliaRecordPushed(entityVendor, action)
+
+	return e.Identities.Put(entityVendor, supplier.Code, state.Identity{
+		RemoteID: vendorID,
+		Hash:     hash,
+		SyncedAt: time.Now(),
+	})
+}
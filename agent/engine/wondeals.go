@@ -0,0 +1,148 @@
+// agent/engine/wondeals.go
+package engine
+
+import (
+	"fmt"
+	"time"
+
+	"saas-sync-platform/agent/bitrix24"
+	"saas-sync-platform/agent/sage"
+	"saas-sync-platform/agent/state"
+	"saas-sync-platform/internal/shared"
+)
+
+// entityWonDeal is the dead-letter entity type of won deals whose Sage
+// sales order could not be created, keyed by deal ID
+const entityWonDeal = "won_deal"
+
+// syncWonDeals creates a Sage sales order for every deal that entered the
+// won stage since the given time, and for those due for retry, when
+// CreateSageOrders is set and the source can write orders
+func (e *Engine) syncWonDeals(since time.Time, result *shared.SyncResult) {
+	if !e.CreateSageOrders {
+		return
+	}
+	writer, ok := e.source.(sage.SalesOrderWriter)
+	if !ok {
+		e.logger.Warn("Sage source cannot create sales orders, skipping won deals")
+		return
+	}
+
+	defer e.stepSucceeded(entityWonDeal, result.FailedCount, result)
+
+	client := e.bitrix24.WithLogger(e.logger).WithMetrics(e.Metrics)
+	deals, err := client.ListWonDeals(since)
+	if err != nil {
+		e.logger.Error("Failed to read won Bitrix24 deals", "error", err)
+		result.FailedCount++
+		return
+	}
+	e.Metrics.RecordsRead(entityWonDeal, e.Company, len(deals))
+	deals = e.addDueDealRetries(client, deals, result)
+
+	for _, deal := range deals {
+		dealID := bitrix24.RecordID(deal)
+		if err := e.createOrderFromDeal(client, writer, deal); err != nil {
+			e.logger.Error("Failed to create Sage sales order for won deal",
+				"deal_id", dealID, "title", bitrix24.FieldString(deal, "TITLE"), "error", err)
+			result.FailedCount++
+			if _, err := e.DeadLetters.RecordFailure(entityWonDeal, dealID, bitrix24.FieldString(deal, "TITLE"), err); err != nil {
+				e.logger.Error("Failed to update dead-letter queue", "deal_id", dealID, "error", err)
+			}
+		} else if err := e.DeadLetters.Resolve(entityWonDeal, dealID); err != nil {
+			e.logger.Error("Failed to update dead-letter queue", "deal_id", dealID, "error", err)
+		}
+	}
+}
+
+// addDueDealRetries appends the dead-lettered deals due for retry that are
+// not already part of this cycle
+func (e *Engine) addDueDealRetries(client *bitrix24.Client, deals []map[string]interface{}, result *shared.SyncResult) []map[string]interface{} {
+	inCycle := make(map[string]bool, len(deals))
+	for _, deal := range deals {
+		inCycle[bitrix24.RecordID(deal)] = true
+	}
+
+	for _, letter := range e.DeadLetters.Due(entityWonDeal, time.Now()) {
+		result.RetriedCount++
+		if inCycle[letter.Code] {
+			continue
+		}
+
+		deal, err := client.GetDeal(letter.Code)
+		if err != nil {
+			e.logger.Error("Failed to reload deal for retry", "deal_id", letter.Code, "error", err)
+			result.FailedCount++
+			if _, err := e.DeadLetters.RecordFailure(entityWonDeal, letter.Code, letter.Name, err); err != nil {
+				e.logger.Error("Failed to update dead-letter queue", "deal_id", letter.Code, "error", err)
+			}
+			continue
+		}
+		deals = append(deals, deal)
+	}
+
+	return deals
+}
+
+// createOrderFromDeal creates the Sage sales order of a won deal and links
+// the deal to it. Deals already linked to a Sage document are left alone.
+func (e *Engine) createOrderFromDeal(client *bitrix24.Client, writer sage.SalesOrderWriter, deal map[string]interface{}) error {
+	if bitrix24.FieldString(deal, "ORIGINATOR_ID") == bitrix24.DealOriginator {
+		return nil
+	}
+	dealID := bitrix24.RecordID(deal)
+
+	code, err := e.dealCustomer(deal)
+	if err != nil {
+		return err
+	}
+
+	order, err := client.SalesOrderFromDeal(deal, code)
+	if err != nil {
+		return err
+	}
+
+	created, err := writer.CreateSalesOrder(order)
+	if err != nil {
+		return fmt.Errorf("failed to create Sage sales order: %w", err)
+	}
+
+	// Without a hash the order is pushed to this deal the next time it is
+	// read from Sage
+	if err := e.Identities.Put(entitySalesOrder, created.ID, state.Identity{RemoteID: dealID, SyncedAt: time.Now()}); err != nil {
+		return err
+	}
+	if err := client.LinkDealToOrder(dealID, created); err != nil {
+		return err
+	}
+	e.Metrics.RecordPushed(entityWonDeal, bitrix24.ActionCreate)
+
+	e.logger.Info("Created Sage sales order for won deal", "deal_id", dealID,
+		"order_id", created.ID, "number", created.Number, "customer_code", code)
+	return nil
+}
+
+// dealCustomer returns the code of the Sage customer whose contact, or
+// whose company, the deal belongs to
+func (e *Engine) dealCustomer(deal map[string]interface{}) (string, error) {
+	links := []struct {
+		field, entity string
+	}{
+		{"CONTACT_ID", entityCustomer},
+		{"COMPANY_ID", entityCompany},
+	}
+
+	for _, link := range links {
+		id := bitrix24.FieldString(deal, link.field)
+		if id == "" || id == "0" {
+			continue
+		}
+		for code, identity := range e.Identities.All(link.entity) {
+			if identity.RemoteID == id {
+				return code, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("deal %s does not belong to a synced Sage customer", bitrix24.RecordID(deal))
+}
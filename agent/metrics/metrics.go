@@ -0,0 +1,203 @@
+// agent/metrics/metrics.go
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace prefixes every metric exported by the agent
+const namespace = "sagesync"
+
+// Error sources used as the "source" label of the errors counter
+const (
+	SourceSage     = "sage"
+	SourceBitrix24 = "bitrix24"
+	SourceTickelia = "tickelia"
+)
+
+// Metrics holds the agent's Prometheus collectors. A nil *Metrics is valid
+// and records nothing, so metrics stay opt-in for callers.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	recordsRead      *prometheus.CounterVec
+	recordsPushed    *prometheus.CounterVec
+	tickeliaPushed   *prometheus.CounterVec
+	apiLatency       *prometheus.HistogramVec
+	rateLimitWaits   prometheus.Counter
+	rateLimitSeconds prometheus.Counter
+	errors           *prometheus.CounterVec
+	lastSuccess      *prometheus.GaugeVec
+}
+
+// New creates the collectors and registers them, together with the Go
+// runtime and process collectors, in a dedicated registry
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		recordsRead: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "sage_records_read_total",
+			Help:      "Records read by each sync step, from Sage or, for won deals, from Bitrix24.",
+		}, []string{"entity", "company"}),
+		recordsPushed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "bitrix24_records_pushed_total",
+			Help:      "Records pushed to Bitrix24 by operation (create, update, skip).",
+		}, []string{"entity", "operation"}),
+		tickeliaPushed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "tickelia_records_pushed_total",
+			Help:      "Records pushed to Tickelia by operation (create, update, skip).",
+		}, []string{"entity", "operation"}),
+		apiLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "bitrix24_request_duration_seconds",
+			Help:      "Latency of Bitrix24 REST calls by method.",
+			Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+		}, []string{"method"}),
+		rateLimitWaits: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "bitrix24_rate_limit_waits_total",
+			Help:      "Backoffs after Bitrix24 rejected a request with QUERY_LIMIT_EXCEEDED.",
+		}),
+		rateLimitSeconds: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "bitrix24_rate_limit_wait_seconds_total",
+			Help:      "Time spent backing off after QUERY_LIMIT_EXCEEDED.",
+		}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "errors_total",
+			Help:      "Errors by source and error code.",
+		}, []string{"source", "code"}),
+		lastSuccess: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "last_successful_sync_timestamp_seconds",
+			Help:      "Unix time of the last sync step of an entity that completed without errors.",
+		}, []string{"entity", "company"}),
+	}
+
+	m.registry.MustRegister(
+		m.recordsRead,
+		m.recordsPushed,
+		m.tickeliaPushed,
+		m.apiLatency,
+		m.rateLimitWaits,
+		m.rateLimitSeconds,
+		m.errors,
+		m.lastSuccess,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// Registry exposes the underlying registry, e.g. for tests
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+// RecordsRead counts records read from Sage for an entity and company
+func (m *Metrics) RecordsRead(entity, company string, n int) {
+	if m == nil {
+		return
+	}
+	m.recordsRead.WithLabelValues(entity, company).Add(float64(n))
+}
+
+// RecordPushed counts one record handled by a Bitrix24 operation
+func (m *Metrics) RecordPushed(entity, operation string) {
+	if m == nil {
+		return
+	}
+	m.recordsPushed.WithLabelValues(entity, operation).Inc()
+}
+
+// TickeliaRecordPushed counts one record handled by a Tickelia operation
+func (m *Metrics) TickeliaRecordPushed(entity, operation string) {
+	if m == nil {
+		return
+	}
+	m.tickeliaPushed.WithLabelValues(entity, operation).Inc()
+}
+
+// ObserveRequest records the latency of a Bitrix24 call and, when it
+// failed, counts the error under code
+func (m *Metrics) ObserveRequest(method string, duration time.Duration, code string) {
+	if m == nil {
+		return
+	}
+	m.apiLatency.WithLabelValues(method).Observe(duration.Seconds())
+	if code != "" {
+		m.errors.WithLabelValues(SourceBitrix24, code).Inc()
+	}
+}
+
+// RateLimitWait records a backoff after Bitrix24 rejected a request with
+// QUERY_LIMIT_EXCEEDED
+func (m *Metrics) RateLimitWait(d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.rateLimitWaits.Inc()
+	m.rateLimitSeconds.Add(d.Seconds())
+}
+
+// Error counts an error from source under code
+func (m *Metrics) Error(source, code string) {
+	if m == nil {
+		return
+	}
+	m.errors.WithLabelValues(source, code).Inc()
+}
+
+// SyncSucceeded sets the last successful sync time for an entity and company
+func (m *Metrics) SyncSucceeded(entity, company string, at time.Time) {
+	if m == nil {
+		return
+	}
+	m.lastSuccess.WithLabelValues(entity, company).Set(float64(at.Unix()))
+}
+
+// Serve exposes /metrics on addr until the returned server is closed
+func (m *Metrics) Serve(addr string) (*http.Server, error) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.Handler())
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	// Listen synchronously so a busy port is reported to the caller
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for metrics on %s: %w", addr, err)
+	}
+
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Metrics endpoint stopped", "addr", addr, "error", err)
+		}
+	}()
+
+	slog.Info("Serving metrics", "addr", addr, "path", "/metrics")
+	return server, nil
+}
@@ -0,0 +1,87 @@
+// agent/normalize/customer.go
+package normalize
+
+import "saas-sync-platform/internal/shared"
+
+// Reject is a part of a phone or email field that could not be used
+type Reject struct {
+	Field  string `json:"field"` // "phone", "fax" or "email"
+	Value  string `json:"value"`
+	Reason string `json:"reason"`
+}
+
+// Contact is the normalised contact information of a Sage record
+type Contact struct {
+	Phones  []Phone  `json:"phones,omitempty"`
+	Emails  []string `json:"emails,omitempty"`
+	Rejects []Reject `json:"rejects,omitempty"`
+}
+
+// Customer normalises the phone, fax and email fields of a customer,
+// reading national numbers in the customer's country
+func Customer(customer *shared.Customer) Contact {
+	var contact Contact
+
+	phones, rejects := Phones(customer.Phone, customer.Country, KindLandline)
+	contact.Phones = append(contact.Phones, phones...)
+	contact.Rejects = append(contact.Rejects, rejects...)
+
+	faxes, rejects := Phones(customer.Fax, customer.Country, KindFax)
+	for _, fax := range faxes {
+		if !contact.hasPhone(fax.Number) {
+			contact.Phones = append(contact.Phones, fax)
+		}
+	}
+	contact.Rejects = append(contact.Rejects, rejects...)
+
+	contact.Emails, rejects = Emails(customer.Email)
+	contact.Rejects = append(contact.Rejects, rejects...)
+
+	return contact
+}
+
+// Person normalises the phone, mobile and email fields of a contact
+// person, reading national numbers in the country of its customer
+func Person(person *shared.ContactPerson, country string) Contact {
+	var contact Contact
+
+	phones, rejects := Phones(person.Phone, country, KindLandline)
+	contact.Phones = append(contact.Phones, phones...)
+	contact.Rejects = append(contact.Rejects, rejects...)
+
+	mobiles, rejects := Phones(person.Mobile, country, KindMobile)
+	for _, mobile := range mobiles {
+		if !contact.hasPhone(mobile.Number) {
+			contact.Phones = append(contact.Phones, mobile)
+		}
+	}
+	contact.Rejects = append(contact.Rejects, rejects...)
+
+	contact.Emails, rejects = Emails(person.Email)
+	contact.Rejects = append(contact.Rejects, rejects...)
+
+	return contact
+}
+
+// Supplier normalises the phone and email fields of a supplier, reading
+// national numbers in the supplier's country
+func Supplier(supplier *shared.Supplier) Contact {
+	var contact Contact
+
+	contact.Phones, contact.Rejects = Phones(supplier.Phone, supplier.Country, KindLandline)
+
+	emails, rejects := Emails(supplier.Email)
+	contact.Emails = emails
+	contact.Rejects = append(contact.Rejects, rejects...)
+
+	return contact
+}
+
+func (c *Contact) hasPhone(number string) bool {
+	for _, phone := range c.Phones {
+		if phone.Number == number {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+// agent/normalize/email.go
+package normalize
+
+import (
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+)
+
+// emailSeparators split a field holding several addresses
+var emailSeparators = regexp.MustCompile(`[;,\s]+`)
+
+// Emails splits a free-text email field into valid, lowercased addresses.
+// Parts that are not a plain address are returned as rejects.
+func Emails(field string) ([]string, []Reject) {
+	var emails []string
+	var rejects []Reject
+	seen := make(map[string]bool)
+
+	for _, part := range emailSeparators.Split(field, -1) {
+		if part == "" {
+			continue
+		}
+
+		email, err := Email(part)
+		if err != nil {
+			rejects = append(rejects, Reject{Field: "email", Value: part, Reason: err.Error()})
+			continue
+		}
+		if !seen[email] {
+			seen[email] = true
+			emails = append(emails, email)
+		}
+	}
+
+	return emails, rejects
+}
+
+// Email validates a single address and returns it trimmed and lowercased
+func Email(value string) (string, error) {
+	email := strings.ToLower(strings.TrimSpace(value))
+	email = strings.TrimPrefix(email, "mailto:")
+
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return "", fmt.Errorf("not a valid email address")
+	}
+
+	at := strings.LastIndex(email, "@")
+	domain := email[at+1:]
+	if !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
+		return "", fmt.Errorf("email domain %q is not valid", domain)
+	}
+
+	return email, nil
+}
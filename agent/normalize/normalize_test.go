@@ -0,0 +1,112 @@
+package normalize
+
+import (
+	"reflect"
+	"testing"
+
+	"saas-sync-platform/internal/shared"
+)
+
+func TestPhones(t *testing.T) {
+	tests := []struct {
+		field   string
+		country string
+		want    []Phone
+		rejects int
+	}{
+		{
+			field: "93 123 45 67 / 600 11 22 33",
+			want: []Phone{
+				{Number: "+34931234567", Kind: KindLandline, Raw: "93 123 45 67"},
+				{Number: "+34600112233", Kind: KindMobile, Raw: "600 11 22 33"},
+			},
+		},
+		{
+			field: "Tel. 931234567 - Fax 931234568",
+			want: []Phone{
+				{Number: "+34931234567", Kind: KindLandline, Raw: "Tel. 931234567"},
+				{Number: "+34931234568", Kind: KindFax, Raw: "Fax 931234568"},
+			},
+		},
+		{
+			field: "931234567600112233",
+			want: []Phone{
+				{Number: "+34931234567", Kind: KindLandline, Raw: "931234567600112233"},
+				{Number: "+34600112233", Kind: KindMobile, Raw: "931234567600112233"},
+			},
+		},
+		{
+			field: "(+34) 972.20.30.40 ext 12; 0034 972 20 30 40",
+			want:  []Phone{{Number: "+34972203040", Kind: KindLandline, Raw: "(+34) 972.20.30.40 ext 12"}},
+		},
+		{
+			field:   "01 23 45 67 89",
+			country: "Francia",
+			want:    []Phone{{Number: "+33123456789", Kind: KindLandline, Raw: "01 23 45 67 89"}},
+		},
+		{
+			field: "34 931 234 567",
+			want:  []Phone{{Number: "+34931234567", Kind: KindLandline, Raw: "34 931 234 567"}},
+		},
+		{
+			field:   "12345 y pendiente",
+			rejects: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		got, rejects := Phones(tt.field, tt.country, KindLandline)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Phones(%q) = %+v, want %+v", tt.field, got, tt.want)
+		}
+		if len(rejects) != tt.rejects {
+			t.Errorf("Phones(%q) rejects = %+v, want %d", tt.field, rejects, tt.rejects)
+		}
+	}
+}
+
+func TestCountryCode(t *testing.T) {
+	for input, want := range map[string]string{
+		"":         "ES",
+		"es":       "ES",
+		"España":   "ES",
+		"PRT":      "PT",
+		"Atlantis": "ES",
+	} {
+		if got := CountryCode(input); got != want {
+			t.Errorf("CountryCode(%q) = %s, want %s", input, got, want)
+		}
+	}
+}
+
+func TestEmails(t *testing.T) {
+	emails, rejects := Emails(" Info@Puig.Example; comandes@puig.example, info@puig.example no-at-sign user@localhost")
+
+	want := []string{"info@puig.example", "comandes@puig.example"}
+	if !reflect.DeepEqual(emails, want) {
+		t.Errorf("emails = %v, want %v", emails, want)
+	}
+	if len(rejects) != 2 || rejects[0].Value != "no-at-sign" || rejects[1].Value != "user@localhost" {
+		t.Errorf("rejects = %+v", rejects)
+	}
+}
+
+func TestCustomer(t *testing.T) {
+	contact := Customer(&shared.Customer{
+		Phone:   "+351 912 345 678",
+		Fax:     "912345678 / 213456789",
+		Email:   "geral@lisboa.example",
+		Country: "Portugal",
+	})
+
+	want := []Phone{
+		{Number: "+351912345678", Kind: KindMobile, Raw: "+351 912 345 678"},
+		{Number: "+351213456789", Kind: KindFax, Raw: "213456789"},
+	}
+	if !reflect.DeepEqual(contact.Phones, want) {
+		t.Errorf("phones = %+v, want %+v", contact.Phones, want)
+	}
+	if len(contact.Emails) != 1 || len(contact.Rejects) != 0 {
+		t.Errorf("contact = %+v", contact)
+	}
+}
@@ -0,0 +1,286 @@
+// agent/normalize/phone.go
+
+// Package normalize cleans up the free-text phone and email fields of Sage
+// records before they are sent to an integration.
+package normalize
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DefaultCountry is assumed for national numbers of customers without a
+// recognised country
+const DefaultCountry = "ES"
+
+// Kinds of phone numbers
+const (
+	KindLandline = "landline"
+	KindMobile   = "mobile"
+	KindFax      = "fax"
+)
+
+// Phone is a phone number in E.164 form
+type Phone struct {
+	Number string `json:"number"` // e.g. "+34931234567"
+	Kind   string `json:"kind"`
+	Raw    string `json:"raw"` // the text it was read from
+}
+
+// numbering describes the national numbering plan of a country
+type numbering struct {
+	callingCode string
+	// nationalLengths are the valid lengths of a national number without
+	// trunk prefix; nil accepts 4 to 14 digits
+	nationalLengths []int
+	// trunkPrefix is dropped from national numbers before adding the
+	// calling code
+	trunkPrefix    string
+	mobilePrefixes []string
+}
+
+// numberingPlans covers the countries Sage customers are usually in
+var numberingPlans = map[string]numbering{
+	"ES": {callingCode: "34", nationalLengths: []int{9}, mobilePrefixes: []string{"6", "7"}},
+	"PT": {callingCode: "351", nationalLengths: []int{9}, mobilePrefixes: []string{"9"}},
+	"FR": {callingCode: "33", nationalLengths: []int{9}, trunkPrefix: "0", mobilePrefixes: []string{"6", "7"}},
+	"AD": {callingCode: "376", nationalLengths: []int{6}, mobilePrefixes: []string{"3", "4", "6"}},
+	"IT": {callingCode: "39", nationalLengths: []int{6, 7, 8, 9, 10, 11}, mobilePrefixes: []string{"3"}},
+	"DE": {callingCode: "49", trunkPrefix: "0", mobilePrefixes: []string{"15", "16", "17"}},
+	"GB": {callingCode: "44", nationalLengths: []int{10}, trunkPrefix: "0", mobilePrefixes: []string{"7"}},
+	"IE": {callingCode: "353", nationalLengths: []int{7, 8, 9}, trunkPrefix: "0", mobilePrefixes: []string{"8"}},
+	"NL": {callingCode: "31", nationalLengths: []int{9}, trunkPrefix: "0", mobilePrefixes: []string{"6"}},
+	"BE": {callingCode: "32", nationalLengths: []int{8, 9}, trunkPrefix: "0", mobilePrefixes: []string{"4"}},
+	"CH": {callingCode: "41", nationalLengths: []int{9}, trunkPrefix: "0", mobilePrefixes: []string{"7"}},
+	"US": {callingCode: "1", nationalLengths: []int{10}},
+	"MX": {callingCode: "52", nationalLengths: []int{10}},
+}
+
+// countryAliases maps the country names and ISO 3166 alpha-3 codes found
+// in Sage addresses to alpha-2 codes
+var countryAliases = map[string]string{
+	"ESP": "ES", "ESPANA": "ES", "ESPAÑA": "ES", "SPAIN": "ES", "ESPANYA": "ES",
+	"PRT": "PT", "PORTUGAL": "PT",
+	"FRA": "FR", "FRANCIA": "FR", "FRANCE": "FR", "FRANÇA": "FR",
+	"AND": "AD", "ANDORRA": "AD",
+	"ITA": "IT", "ITALIA": "IT", "ITALY": "IT", "ITÀLIA": "IT",
+	"DEU": "DE", "ALEMANIA": "DE", "GERMANY": "DE", "ALEMANYA": "DE",
+	"GBR": "GB", "UK": "GB", "REINO UNIDO": "GB", "UNITED KINGDOM": "GB", "REGNE UNIT": "GB",
+	"IRL": "IE", "IRLANDA": "IE", "IRELAND": "IE",
+	"NLD": "NL", "PAISES BAJOS": "NL", "PAÍSES BAJOS": "NL", "HOLANDA": "NL", "NETHERLANDS": "NL",
+	"BEL": "BE", "BELGICA": "BE", "BÉLGICA": "BE", "BELGIUM": "BE",
+	"CHE": "CH", "SUIZA": "CH", "SWITZERLAND": "CH", "SUÏSSA": "CH",
+	"USA": "US", "ESTADOS UNIDOS": "US", "UNITED STATES": "US",
+	"MEX": "MX", "MEXICO": "MX", "MÉXICO": "MX",
+}
+
+// CountryCode returns the ISO 3166 alpha-2 code of a country name or code,
+// or DefaultCountry if it is empty or not recognised
+func CountryCode(country string) string {
+	country = strings.ToUpper(strings.TrimSpace(country))
+	if _, ok := numberingPlans[country]; ok {
+		return country
+	}
+	if code, ok := countryAliases[country]; ok {
+		return code
+	}
+	return DefaultCountry
+}
+
+// phoneSeparators split a field holding several numbers, e.g.
+// "93 123 45 67 / 600 11 22 33" or "931234567 - móvil 600112233"
+var phoneSeparators = regexp.MustCompile(`[/,;|\n]+|\s+-\s+|\s+(?i:y|o|or|i|and)\s+`)
+
+// Labels that tell what a number is from the text around it
+var (
+	faxLabel    = regexp.MustCompile(`(?i)\bfax\b`)
+	mobileLabel = regexp.MustCompile(`(?i)m[oòó]vil|mobile|\bcell|\bm[oò]bil`)
+)
+
+// extensionPattern matches an extension written after a number
+var extensionPattern = regexp.MustCompile(`(?i)\s+(ext\.?|extensi[oó]n|x)\s*\d{1,5}\s*$`)
+
+// Phones splits a free-text phone field into E.164 numbers for the given
+// country. Numbers labelled as fax or mobile, or recognised as mobile from
+// their prefix, get that kind; the rest get defaultKind. Parts that are
+// not valid numbers are returned as rejects.
+func Phones(field, country, defaultKind string) ([]Phone, []Reject) {
+	country = CountryCode(country)
+
+	var phones []Phone
+	var rejects []Reject
+	seen := make(map[string]bool)
+
+	for _, part := range phoneSeparators.Split(field, -1) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		numbers, err := parsePhones(part, country)
+		if err != nil {
+			rejects = append(rejects, Reject{Field: defaultKindField(defaultKind), Value: part, Reason: err.Error()})
+			continue
+		}
+
+		for _, number := range numbers {
+			if seen[number] {
+				continue
+			}
+			seen[number] = true
+
+			kind := defaultKind
+			switch {
+			case faxLabel.MatchString(part):
+				kind = KindFax
+			case mobileLabel.MatchString(part):
+				kind = KindMobile
+			case kind == KindLandline && isMobile(number, country):
+				kind = KindMobile
+			}
+			phones = append(phones, Phone{Number: number, Kind: kind, Raw: part})
+		}
+	}
+
+	return phones, rejects
+}
+
+// parsePhones converts one part of a phone field to E.164. A part whose
+// digits are an exact multiple of the national length, such as two Spanish
+// numbers written without a separator, yields several numbers.
+func parsePhones(part, country string) ([]string, error) {
+	text := extensionPattern.ReplaceAllString(part, "")
+	digits := digitsOf(text)
+	if digits == "" {
+		return nil, fmt.Errorf("no digits")
+	}
+
+	international := startsInternational(text)
+	if !international && strings.HasPrefix(digits, "00") {
+		digits, international = digits[2:], true
+	}
+	if international {
+		if err := validInternational(digits); err != nil {
+			return nil, err
+		}
+		return []string{"+" + digits}, nil
+	}
+
+	plan := numberingPlans[country]
+	if len(plan.nationalLengths) == 1 {
+		n := plan.nationalLengths[0]
+		if len(digits) > n && len(digits)%n == 0 && !strings.HasPrefix(digits, plan.callingCode) {
+			var numbers []string
+			for i := 0; i < len(digits); i += n {
+				number, err := nationalToE164(digits[i:i+n], plan)
+				if err != nil {
+					return nil, err
+				}
+				numbers = append(numbers, number)
+			}
+			return numbers, nil
+		}
+	}
+
+	number, err := nationalToE164(digits, plan)
+	if err != nil {
+		return nil, err
+	}
+	return []string{number}, nil
+}
+
+// nationalToE164 adds the calling code to a national number, also
+// accepting numbers that already start with it but lack the "+"
+func nationalToE164(digits string, plan numbering) (string, error) {
+	if plan.callingCode != "" && strings.HasPrefix(digits, plan.callingCode) &&
+		validNationalLength(digits[len(plan.callingCode):], plan) && !validNationalLength(digits, plan) {
+		return "+" + digits, nil
+	}
+
+	if plan.trunkPrefix != "" {
+		digits = strings.TrimPrefix(digits, plan.trunkPrefix)
+	}
+	if !validNationalLength(digits, plan) {
+		return "", fmt.Errorf("invalid length for a national number")
+	}
+
+	if err := validInternational(plan.callingCode + digits); err != nil {
+		return "", err
+	}
+	return "+" + plan.callingCode + digits, nil
+}
+
+func validNationalLength(digits string, plan numbering) bool {
+	if plan.nationalLengths == nil {
+		return len(digits) >= 4 && len(digits) <= 14
+	}
+	for _, n := range plan.nationalLengths {
+		if len(digits) == n {
+			return true
+		}
+	}
+	return false
+}
+
+// validInternational checks the E.164 limits on a number without its "+"
+func validInternational(digits string) error {
+	if len(digits) < 8 || len(digits) > 15 {
+		return fmt.Errorf("invalid length for an international number")
+	}
+	if digits[0] == '0' {
+		return fmt.Errorf("country calling code cannot start with 0")
+	}
+	return nil
+}
+
+// isMobile reports whether an E.164 number is a mobile number of country
+func isMobile(number, country string) bool {
+	plan := numberingPlans[country]
+	national := strings.TrimPrefix(number, "+"+plan.callingCode)
+	if plan.callingCode == "" || national == number {
+		return false
+	}
+	for _, prefix := range plan.mobilePrefixes {
+		if strings.HasPrefix(national, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// PhoneKey returns the E.164 form of a single number for comparisons,
+// falling back to its digits when it cannot be parsed
+func PhoneKey(phone, country string) string {
+	numbers, err := parsePhones(strings.TrimSpace(phone), CountryCode(country))
+	if err != nil || len(numbers) != 1 {
+		return digitsOf(phone)
+	}
+	return numbers[0]
+}
+
+// startsInternational reports whether the first digit of text follows a "+"
+func startsInternational(text string) bool {
+	i := strings.IndexFunc(text, func(r rune) bool { return r >= '0' && r <= '9' })
+	if i < 0 {
+		return false
+	}
+	return strings.HasSuffix(strings.TrimRight(text[:i], " ("), "+")
+}
+
+func digitsOf(text string) string {
+	var digits strings.Builder
+	for _, r := range text {
+		if r >= '0' && r <= '9' {
+			digits.WriteRune(r)
+		}
+	}
+	return digits.String()
+}
+
+func defaultKindField(kind string) string {
+	if kind == KindFax {
+		return "fax"
+	}
+	return "phone"
+}
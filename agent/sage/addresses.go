@@ -0,0 +1,144 @@
+// agent/sage/addresses.go
+package sage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"saas-sync-platform/internal/shared"
+)
+
+// addressesTable lists the main (fiscal) address and the delivery
+// locations of every customer as one table
+const addressesTable = `
+        (
+            SELECT
+                addr.PostalAddressID,
+                c.CustomerAccountNumber,
+                'fiscal' AS AddressType,
+                NULL AS LocationName,
+                addr.Address1,
+                addr.Address2,
+                addr.City,
+                addr.County,
+                addr.PostCode,
+                addr.Country,
+                addr.DateTimeModified
+            FROM SLCustomers c
+            INNER JOIN PLPostalAddresses addr ON c.MainAddressID = addr.PostalAddressID
+            UNION ALL
+            SELECT
+                addr.PostalAddressID,
+                c.CustomerAccountNumber,
+                'delivery',
+                l.Name,
+                addr.Address1,
+                addr.Address2,
+                addr.City,
+                addr.County,
+                addr.PostCode,
+                addr.Country,
+                addr.DateTimeModified
+            FROM SLCustomerLocations l
+            INNER JOIN SLCustomers c ON c.SLCustomerAccountID = l.SLCustomerAccountID
+            INNER JOIN PLPostalAddresses addr ON l.AddressID = addr.PostalAddressID
+        ) a`
+
+// GetCustomerAddresses retrieves the fiscal address and delivery addresses
+// of a customer, fiscal first
+func (c *Connector) GetCustomerAddresses(customerCode string) ([]shared.Address, error) {
+	query := `
+        SELECT * FROM` + addressesTable + `
+        WHERE a.CustomerAccountNumber = ?
+        ORDER BY CASE a.AddressType WHEN 'fiscal' THEN 0 ELSE 1 END, a.PostalAddressID
+    `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := c.db.QueryContext(ctx, query, customerCode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query customer addresses: %w", err)
+	}
+	defer rows.Close()
+
+	return scanAddresses(rows)
+}
+
+// GetRecentAddresses retrieves customer addresses modified since lastSync,
+// oldest first
+func (c *Connector) GetRecentAddresses(lastSync time.Time) ([]shared.Address, error) {
+	query := fmt.Sprintf(`
+        SELECT TOP %d * FROM`+addressesTable+`
+        WHERE a.DateTimeModified > ?
+            OR (a.DateTimeModified = ? AND a.PostalAddressID > ?)
+        ORDER BY a.DateTimeModified, a.PostalAddressID
+    `, modifiedPageSize)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var addresses []shared.Address
+	err := c.readModified(ctx, query, lastSync, func(rows *sql.Rows) (int, pageKey, error) {
+		page, err := scanAddresses(rows)
+		if err != nil || len(page) == 0 {
+			return 0, pageKey{}, err
+		}
+		addresses = append(addresses, page...)
+
+		last := page[len(page)-1]
+		key, err := recordKey(last.ModifiedDate, last.ID)
+		return len(page), key, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query customer addresses: %w", err)
+	}
+
+	slog.Debug("Read modified customer addresses from Sage", "count", len(addresses), "since", lastSync)
+	return addresses, nil
+}
+
+// scanAddresses reads the rows of a customer address query
+func scanAddresses(rows *sql.Rows) ([]shared.Address, error) {
+	var addresses []shared.Address
+	for rows.Next() {
+		var address shared.Address
+		var name, line1, line2, city, region, postalCode, country sql.NullString
+
+		err := rows.Scan(
+			&address.ID,
+			&address.CustomerCode,
+			&address.Type,
+			&name,
+			&line1,
+			&line2,
+			&city,
+			&region,
+			&postalCode,
+			&country,
+			&address.ModifiedDate,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan customer address row: %w", err)
+		}
+
+		address.Name = name.String
+		address.Line1 = line1.String
+		address.Line2 = line2.String
+		address.City = city.String
+		address.Region = region.String
+		address.PostalCode = postalCode.String
+		address.Country = country.String
+
+		addresses = append(addresses, address)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating customer address rows: %w", err)
+	}
+
+	return addresses, nil
+}
@@ -0,0 +1,67 @@
+// agent/sage/balances.go
+package sage
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"saas-sync-platform/internal/shared"
+)
+
+// GetCustomerBalances computes the outstanding balance, overdue amount and
+// credit data of every customer. The overdue amount nets the outstanding
+// value of the posted transactions past their due date, so credit notes
+// reduce it.
+func (c *Connector) GetCustomerBalances() ([]shared.CustomerBalance, error) {
+	query := `
+        SELECT
+            c.CustomerAccountNumber,
+            c.AccountBalance,
+            c.CreditLimit,
+            c.AccountIsOnHold,
+            ISNULL(od.Overdue, 0)
+        FROM SLCustomers c
+        LEFT JOIN (
+            SELECT SLCustomerAccountID, SUM(OutstandingValue) AS Overdue
+            FROM SLPostedCustomerTran
+            WHERE OutstandingValue <> 0 AND DueDate < CAST(GETDATE() AS date)
+            GROUP BY SLCustomerAccountID
+        ) od ON od.SLCustomerAccountID = c.SLCustomerAccountID
+        ORDER BY c.CustomerAccountNumber
+    `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	rows, err := c.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query customer balances: %w", err)
+	}
+	defer rows.Close()
+
+	var balances []shared.CustomerBalance
+	for rows.Next() {
+		var balance shared.CustomerBalance
+		if err := rows.Scan(
+			&balance.CustomerCode,
+			&balance.Balance,
+			&balance.CreditLimit,
+			&balance.OnHold,
+			&balance.Overdue,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan customer balance row: %w", err)
+		}
+		if balance.Overdue < 0 {
+			balance.Overdue = 0
+		}
+		balances = append(balances, balance)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating customer balance rows: %w", err)
+	}
+
+	slog.Debug("Read customer balances from Sage", "count", len(balances))
+	return balances, nil
+}
@@ -5,7 +5,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
 	"time"
 
 	"saas-sync-platform/internal/shared"
@@ -28,8 +28,15 @@ func NewConnector(config *shared.DatabaseConfig) *Connector {
 func (c *Connector) Connect() error {
 	connStr := c.config.GetSageConnectionString()
 
-	log.Printf("Connecting to Sage database: %s:%s/%s",
-		c.config.Host, c.config.Port, c.config.Database)
+	host, instance := c.config.ServerAddress()
+	if instance != "" {
+		host += `\` + instance
+	} else {
+		host += ":" + c.config.Port
+	}
+
+	slog.Info("Connecting to Sage database",
+		"server", host, "database", c.config.Database, "encrypt", c.config.EncryptMode())
 
 	var err error
 	c.db, err = sql.Open("sqlserver", connStr)
@@ -46,7 +53,7 @@ func (c *Connector) Connect() error {
 		return fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	log.Println("Successfully connected to Sage database")
+	slog.Info("Successfully connected to Sage database")
 	return nil
 }
 
@@ -82,6 +89,50 @@ func (c *Connector) GetRecentCustomers(lastSync time.Time) ([]shared.Customer, e
 	}
 	defer rows.Close()
 
+	customers, err := scanCustomers(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Debug("Read modified customers from Sage", "count", len(customers), "since", lastSync)
+	return customers, nil
+}
+
+// GetAllCustomers retrieves every customer ordered by code. It reads the
+// same columns as GetRecentCustomers, without addresses.
+func (c *Connector) GetAllCustomers() ([]shared.Customer, error) {
+	query := `
+        SELECT
+            CustomerAccountNumber,
+            CustomerName,
+            TelephoneNumber,
+            FaxNumber,
+            EmailAddress,
+            DateTimeModified
+        FROM SLCustomers
+        ORDER BY CustomerAccountNumber
+    `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	rows, err := c.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query customers: %w", err)
+	}
+	defer rows.Close()
+
+	customers, err := scanCustomers(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Debug("Read all customers from Sage", "count", len(customers))
+	return customers, nil
+}
+
+// scanCustomers reads the rows of a customer list query
+func scanCustomers(rows *sql.Rows) ([]shared.Customer, error) {
 	var customers []shared.Customer
 	for rows.Next() {
 		var customer shared.Customer
@@ -102,6 +153,7 @@ func (c *Connector) GetRecentCustomers(lastSync time.Time) ([]shared.Customer, e
 		// Set ID and handle nullable fields
 		customer.ID = customer.Code
 		customer.Phone = phone.String
+		customer.Fax = fax.String
 		customer.Email = email.String
 
 		customers = append(customers, customer)
@@ -111,11 +163,11 @@ func (c *Connector) GetRecentCustomers(lastSync time.Time) ([]shared.Customer, e
 		return nil, fmt.Errorf("error iterating customer rows: %w", err)
 	}
 
-	log.Printf("Found %d customers modified since %v", len(customers), lastSync)
 	return customers, nil
 }
 
-// GetCustomerDetails retrieves detailed customer information including addresses
+// GetCustomerDetails retrieves detailed customer information including its
+// main address and all fiscal and delivery addresses
 func (c *Connector) GetCustomerDetails(customerCode string) (*shared.Customer, error) {
 	query := `
         SELECT 
@@ -167,6 +219,7 @@ func (c *Connector) GetCustomerDetails(customerCode string) (*shared.Customer, e
 	// Set fields
 	customer.ID = customer.Code
 	customer.Phone = phone.String
+	customer.Fax = fax.String
 	customer.Email = email.String
 	customer.Address = address1.String
 	if address2.String != "" {
@@ -176,6 +229,11 @@ func (c *Connector) GetCustomerDetails(customerCode string) (*shared.Customer, e
 	customer.PostalCode = postalCode.String
 	customer.Country = country.String
 
+	customer.Addresses, err = c.GetCustomerAddresses(customerCode)
+	if err != nil {
+		return nil, err
+	}
+
 	return &customer, nil
 }
 
@@ -193,9 +251,9 @@ func (c *Connector) TestConnection() error {
 	}
 
 	if err != sql.ErrNoRows {
-		log.Printf("Database test successful - found customer: %s (%s)", customerCode, customerName)
+		slog.Debug("Database test successful", "customer_code", customerCode, "name", customerName)
 	} else {
-		log.Println("Database test successful - no customers found but connection works")
+		slog.Debug("Database test successful - no customers found but connection works")
 	}
 
 	return nil
@@ -236,7 +294,7 @@ func (c *Connector) GetDatabaseInfo() (map[string]interface{}, error) {
 	var version string
 	err = c.db.QueryRowContext(ctx, query).Scan(&version)
 	if err != nil {
-		log.Printf("Could not get database version: %v", err)
+		slog.Warn("Could not get database version", "error", err)
 		info["database_version"] = "Unknown"
 	} else {
 		info["database_version"] = version
@@ -0,0 +1,118 @@
+// agent/sage/contacts.go
+package sage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"saas-sync-platform/internal/shared"
+)
+
+// contactPersonColumns are read by both contact person queries
+const contactPersonColumns = `
+            p.SLCustomerContactID,
+            c.CustomerAccountNumber,
+            p.FirstName,
+            p.LastName,
+            p.JobTitle,
+            p.TelephoneNumber,
+            p.MobileNumber,
+            p.EmailAddress,
+            p.DateTimeModified
+        FROM SLCustomerContacts p
+        INNER JOIN SLCustomers c ON c.SLCustomerAccountID = p.SLCustomerAccountID`
+
+// GetContactPersons retrieves the contact persons of a customer
+func (c *Connector) GetContactPersons(customerCode string) ([]shared.ContactPerson, error) {
+	query := `
+        SELECT` + contactPersonColumns + `
+        WHERE c.CustomerAccountNumber = ?
+        ORDER BY p.SLCustomerContactID
+    `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := c.db.QueryContext(ctx, query, customerCode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query contact persons: %w", err)
+	}
+	defer rows.Close()
+
+	return scanContactPersons(rows)
+}
+
+// GetRecentContactPersons retrieves contact persons modified since
+// lastSync, oldest first
+func (c *Connector) GetRecentContactPersons(lastSync time.Time) ([]shared.ContactPerson, error) {
+	query := fmt.Sprintf(`
+        SELECT TOP %d`+contactPersonColumns+`
+        WHERE p.DateTimeModified > ?
+            OR (p.DateTimeModified = ? AND p.SLCustomerContactID > ?)
+        ORDER BY p.DateTimeModified, p.SLCustomerContactID
+    `, modifiedPageSize)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var persons []shared.ContactPerson
+	err := c.readModified(ctx, query, lastSync, func(rows *sql.Rows) (int, pageKey, error) {
+		page, err := scanContactPersons(rows)
+		if err != nil || len(page) == 0 {
+			return 0, pageKey{}, err
+		}
+		persons = append(persons, page...)
+
+		last := page[len(page)-1]
+		key, err := recordKey(last.ModifiedDate, last.ID)
+		return len(page), key, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query contact persons: %w", err)
+	}
+
+	slog.Debug("Read modified contact persons from Sage", "count", len(persons), "since", lastSync)
+	return persons, nil
+}
+
+// scanContactPersons reads the rows of a contact person query
+func scanContactPersons(rows *sql.Rows) ([]shared.ContactPerson, error) {
+	var persons []shared.ContactPerson
+	for rows.Next() {
+		var person shared.ContactPerson
+		var firstName, lastName, position, phone, mobile, email sql.NullString
+
+		err := rows.Scan(
+			&person.ID,
+			&person.CustomerCode,
+			&firstName,
+			&lastName,
+			&position,
+			&phone,
+			&mobile,
+			&email,
+			&person.ModifiedDate,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan contact person row: %w", err)
+		}
+
+		person.FirstName = firstName.String
+		person.LastName = lastName.String
+		person.Position = position.String
+		person.Phone = phone.String
+		person.Mobile = mobile.String
+		person.Email = email.String
+
+		persons = append(persons, person)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating contact person rows: %w", err)
+	}
+
+	return persons, nil
+}
@@ -0,0 +1,217 @@
+package sage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"saas-sync-platform/internal/shared"
+)
+
+// fakeSage is a scripted Sage database answering the statements of the
+// queries under test
+type fakeSage struct {
+	isolation  driver.IsolationLevel
+	committed  bool
+	rolledBack bool
+	lastNumber int64
+	taxRates   map[float64]int64
+	orders     [][]driver.NamedValue
+	lines      [][]driver.NamedValue
+	// receivables are returned by receivable queries, ordered by
+	// modification time and ID
+	receivables []shared.Receivable
+	// stockItems and priceItems are returned by stock level and product
+	// price queries, ordered by the time of their latest change and item ID
+	stockItems []fakeProduct
+	priceItems []fakeProduct
+	// modified are returned by the queries of modified records containing
+	// their key, ordered by modification time and ID
+	modified map[string][]fakeRecord
+	queries  int
+}
+
+// fakeRecord is a record read by a query of modified records
+type fakeRecord struct {
+	id       int64
+	modified time.Time
+	row      []driver.Value
+}
+
+// fakeProduct is a product and the rows read for it, without the leading
+// item ID and latest change columns
+type fakeProduct struct {
+	id           int64
+	lastModified time.Time
+	rows         [][]driver.Value
+}
+
+func (f *fakeSage) open(t *testing.T) *Connector {
+	db := sql.OpenDB(fakeConnector{f})
+	t.Cleanup(func() { db.Close() })
+	return &Connector{db: db}
+}
+
+func (f *fakeSage) query(query string, args []driver.NamedValue) (driver.Rows, error) {
+	f.queries++
+	for table, records := range f.modified {
+		if strings.Contains(query, table) {
+			return modifiedPage(records, args), nil
+		}
+	}
+
+	switch {
+	case strings.Contains(query, "FROM SLPostedCustomerTran"):
+		return f.receivablePage(args), nil
+	case strings.Contains(query, "FROM WarehouseItem wi"):
+		return productPage(f.stockItems, args), nil
+	case strings.Contains(query, "FROM StockItemPrice sip"):
+		return productPage(f.priceItems, args), nil
+	case strings.Contains(query, "FROM SOPOrderReturnLine l"):
+		return &fakeRows{columns: make([]string, 6)}, nil
+	case strings.Contains(query, "CustomerDocumentNo = ?"):
+		return &fakeRows{columns: []string{"SOPOrderReturnID"}}, nil
+	case strings.Contains(query, "FROM SLCustomers"):
+		return &fakeRows{columns: []string{"SLCustomerAccountID"}, rows: [][]driver.Value{{int64(7)}}}, nil
+	case strings.Contains(query, "FROM SYSTaxRate"):
+		rows := &fakeRows{columns: []string{"SYSTaxRateID"}}
+		if id, ok := f.taxRates[args[0].Value.(float64)]; ok {
+			rows.rows = [][]driver.Value{{id}}
+		}
+		return rows, nil
+	case strings.Contains(query, "MAX(TRY_CAST(DocumentNo"):
+		return &fakeRows{columns: []string{"DocumentNo"}, rows: [][]driver.Value{{f.lastNumber}}}, nil
+	case strings.Contains(query, "INSERT INTO SOPOrderReturn ("):
+		f.orders = append(f.orders, args)
+		return &fakeRows{columns: []string{"SOPOrderReturnID"}, rows: [][]driver.Value{{int64(101)}}}, nil
+	}
+	return nil, errors.New("unexpected query: " + query)
+}
+
+// receivablePage answers a receivable page query: the first receivables
+// modified after args[0], or at args[1] with an ID above args[2]
+func (f *fakeSage) receivablePage(args []driver.NamedValue) driver.Rows {
+	after, at, afterID := args[0].Value.(time.Time), args[1].Value.(time.Time), args[2].Value.(int64)
+
+	rows := &fakeRows{columns: make([]string, 8)}
+	for _, r := range f.receivables {
+		id, _ := strconv.ParseInt(r.ID, 10, 64)
+		if !r.ModifiedDate.After(after) && !(r.ModifiedDate.Equal(at) && id > afterID) {
+			continue
+		}
+		if len(rows.rows) == modifiedPageSize {
+			break
+		}
+		rows.rows = append(rows.rows, []driver.Value{id, r.CustomerCode, r.InvoiceNumber, nil,
+			r.DueDate, r.Amount, r.Outstanding, r.ModifiedDate})
+	}
+	return rows
+}
+
+// modifiedPage answers a query of modified records: the first records
+// modified after args[0], or at args[1] with an ID above args[2]
+func modifiedPage(records []fakeRecord, args []driver.NamedValue) driver.Rows {
+	after, at, afterID := args[0].Value.(time.Time), args[1].Value.(time.Time), args[2].Value.(int64)
+
+	rows := &fakeRows{}
+	for _, record := range records {
+		if !record.modified.After(after) && !(record.modified.Equal(at) && record.id > afterID) {
+			continue
+		}
+		if len(rows.rows) == modifiedPageSize {
+			break
+		}
+		rows.columns = make([]string, len(record.row))
+		rows.rows = append(rows.rows, record.row)
+	}
+	return rows
+}
+
+// productPage answers a stock level or price page query: the rows of the
+// first products changed after args[0], or at args[1] with an ID above
+// args[2]
+func productPage(products []fakeProduct, args []driver.NamedValue) driver.Rows {
+	after, at, afterID := args[0].Value.(time.Time), args[1].Value.(time.Time), args[2].Value.(int64)
+
+	rows := &fakeRows{columns: make([]string, 6)}
+	read := 0
+	for _, product := range products {
+		if !product.lastModified.After(after) && !(product.lastModified.Equal(at) && product.id > afterID) {
+			continue
+		}
+		if read == modifiedPageSize {
+			break
+		}
+		read++
+		for _, row := range product.rows {
+			rows.rows = append(rows.rows, append([]driver.Value{product.id, product.lastModified}, row...))
+		}
+	}
+	return rows
+}
+
+func (f *fakeSage) exec(query string, args []driver.NamedValue) (driver.Result, error) {
+	if strings.Contains(query, "INSERT INTO SOPOrderReturnLine") {
+		f.lines = append(f.lines, args)
+		return driver.RowsAffected(1), nil
+	}
+	return nil, errors.New("unexpected statement: " + query)
+}
+
+type fakeConnector struct{ sage *fakeSage }
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) { return &fakeConn{c.sage}, nil }
+func (c fakeConnector) Driver() driver.Driver                        { return fakeDriver{} }
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) { return nil, errors.New("use sql.OpenDB") }
+
+type fakeConn struct{ sage *fakeSage }
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c *fakeConn) Close() error                        { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *fakeConn) BeginTx(_ context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	c.sage.isolation = opts.Isolation
+	return fakeTx{c.sage}, nil
+}
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.sage.query(query, args)
+}
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.sage.exec(query, args)
+}
+
+type fakeTx struct{ sage *fakeSage }
+
+func (tx fakeTx) Commit() error   { tx.sage.committed = true; return nil }
+func (tx fakeTx) Rollback() error { tx.sage.rolledBack = true; return nil }
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
@@ -0,0 +1,569 @@
+// agent/sage/memory.go
+package sage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"saas-sync-platform/internal/shared"
+)
+
+// recentCustomersLimit mirrors the TOP clause of the SQL Server query
+const recentCustomersLimit = 100
+
+// MemorySource is an in-memory CustomerSource used for tests and demos
+// where no Sage SQL Server is available
+type MemorySource struct {
+	mu          sync.RWMutex
+	customers   map[string]shared.Customer
+	persons     map[string]map[string]shared.ContactPerson // by customer code and ID
+	orders      map[string]shared.SalesOrder               // by ID
+	balances    map[string]shared.CustomerBalance          // by customer code
+	suppliers   map[string]shared.Supplier                 // by code
+	receivables map[string]shared.Receivable               // by ID
+	stock       map[string]map[string]shared.StockLevel    // by product code and warehouse
+	prices      map[string]map[string]shared.ProductPrice  // by product code and price band
+	pricing     map[string]shared.CustomerPricing          // by customer code
+}
+
+// NewMemorySource creates an in-memory source holding customers
+func NewMemorySource(customers ...shared.Customer) *MemorySource {
+	source := &MemorySource{
+		customers:   make(map[string]shared.Customer),
+		persons:     make(map[string]map[string]shared.ContactPerson),
+		orders:      make(map[string]shared.SalesOrder),
+		balances:    make(map[string]shared.CustomerBalance),
+		suppliers:   make(map[string]shared.Supplier),
+		receivables: make(map[string]shared.Receivable),
+		stock:       make(map[string]map[string]shared.StockLevel),
+		prices:      make(map[string]map[string]shared.ProductPrice),
+		pricing:     make(map[string]shared.CustomerPricing),
+	}
+	for _, customer := range customers {
+		source.PutCustomer(customer)
+	}
+	return source
+}
+
+// LoadMemorySource creates an in-memory source seeded from a JSON fixture
+// file containing an array of customers
+func LoadMemorySource(path string) (*MemorySource, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixtures: %w", err)
+	}
+
+	var customers []shared.Customer
+	if err := json.Unmarshal(data, &customers); err != nil {
+		return nil, fmt.Errorf("failed to parse fixtures: %w", err)
+	}
+
+	return NewMemorySource(customers...), nil
+}
+
+// PutCustomer adds or replaces a customer, keyed by its code
+func (m *MemorySource) PutCustomer(customer shared.Customer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if customer.ID == "" {
+		customer.ID = customer.Code
+	}
+	m.customers[customer.Code] = customer
+}
+
+// GetRecentCustomers retrieves customers modified since lastSync
+func (m *MemorySource) GetRecentCustomers(lastSync time.Time) ([]shared.Customer, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var customers []shared.Customer
+	for _, customer := range m.customers {
+		if customer.ModifiedDate.After(lastSync) {
+			customers = append(customers, customer)
+		}
+	}
+
+	sort.Slice(customers, func(i, j int) bool {
+		return customers[i].ModifiedDate.After(customers[j].ModifiedDate)
+	})
+
+	if len(customers) > recentCustomersLimit {
+		customers = customers[:recentCustomersLimit]
+	}
+
+	return customers, nil
+}
+
+// GetAllCustomers returns every customer ordered by code
+func (m *MemorySource) GetAllCustomers() ([]shared.Customer, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	customers := make([]shared.Customer, 0, len(m.customers))
+	for _, customer := range m.customers {
+		customers = append(customers, customer)
+	}
+
+	sort.Slice(customers, func(i, j int) bool {
+		return customers[i].Code < customers[j].Code
+	})
+
+	return customers, nil
+}
+
+// GetCustomerDetails retrieves a single customer
+func (m *MemorySource) GetCustomerDetails(customerCode string) (*shared.Customer, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	customer, ok := m.customers[customerCode]
+	if !ok {
+		return nil, fmt.Errorf("customer %s not found", customerCode)
+	}
+	return &customer, nil
+}
+
+// PutContactPerson adds or replaces a contact person, keyed by its
+// customer code and ID
+func (m *MemorySource) PutContactPerson(person shared.ContactPerson) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.persons[person.CustomerCode] == nil {
+		m.persons[person.CustomerCode] = make(map[string]shared.ContactPerson)
+	}
+	m.persons[person.CustomerCode][person.ID] = person
+}
+
+// DeleteContactPerson removes a contact person
+func (m *MemorySource) DeleteContactPerson(customerCode, id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.persons[customerCode], id)
+}
+
+// GetContactPersons returns the contact persons of a customer ordered by ID
+func (m *MemorySource) GetContactPersons(customerCode string) ([]shared.ContactPerson, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	persons := make([]shared.ContactPerson, 0, len(m.persons[customerCode]))
+	for _, person := range m.persons[customerCode] {
+		persons = append(persons, person)
+	}
+
+	sort.Slice(persons, func(i, j int) bool {
+		return persons[i].ID < persons[j].ID
+	})
+
+	return persons, nil
+}
+
+// GetRecentContactPersons returns contact persons modified since lastSync
+func (m *MemorySource) GetRecentContactPersons(lastSync time.Time) ([]shared.ContactPerson, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var persons []shared.ContactPerson
+	for _, byID := range m.persons {
+		for _, person := range byID {
+			if person.ModifiedDate.After(lastSync) {
+				persons = append(persons, person)
+			}
+		}
+	}
+
+	sort.Slice(persons, func(i, j int) bool {
+		return persons[i].ModifiedDate.After(persons[j].ModifiedDate)
+	})
+
+	return persons, nil
+}
+
+// GetCustomerAddresses returns the addresses stored with a customer
+func (m *MemorySource) GetCustomerAddresses(customerCode string) ([]shared.Address, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	customer, ok := m.customers[customerCode]
+	if !ok {
+		return nil, fmt.Errorf("customer %s not found", customerCode)
+	}
+	return customerAddresses(customer), nil
+}
+
+// GetRecentAddresses returns customer addresses modified since lastSync
+func (m *MemorySource) GetRecentAddresses(lastSync time.Time) ([]shared.Address, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var addresses []shared.Address
+	for _, customer := range m.customers {
+		for _, address := range customerAddresses(customer) {
+			if address.ModifiedDate.After(lastSync) {
+				addresses = append(addresses, address)
+			}
+		}
+	}
+
+	sort.Slice(addresses, func(i, j int) bool {
+		return addresses[i].ModifiedDate.After(addresses[j].ModifiedDate)
+	})
+
+	return addresses, nil
+}
+
+// customerAddresses returns a copy of the addresses of a customer with the
+// customer code filled in
+func customerAddresses(customer shared.Customer) []shared.Address {
+	addresses := make([]shared.Address, len(customer.Addresses))
+	for i, address := range customer.Addresses {
+		address.CustomerCode = customer.Code
+		addresses[i] = address
+	}
+	return addresses
+}
+
+// PutSalesOrder adds or replaces a sales order or quote, keyed by its ID
+func (m *MemorySource) PutSalesOrder(order shared.SalesOrder) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.orders[order.ID] = order
+}
+
+// GetRecentSalesOrders returns orders and quotes modified since lastSync
+func (m *MemorySource) GetRecentSalesOrders(lastSync time.Time) ([]shared.SalesOrder, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var orders []shared.SalesOrder
+	for _, order := range m.orders {
+		if order.ModifiedDate.After(lastSync) {
+			orders = append(orders, order)
+		}
+	}
+
+	sort.Slice(orders, func(i, j int) bool {
+		return orders[i].ModifiedDate.After(orders[j].ModifiedDate)
+	})
+
+	return orders, nil
+}
+
+// GetSalesOrder retrieves a single sales order or quote
+func (m *MemorySource) GetSalesOrder(id string) (*shared.SalesOrder, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	order, ok := m.orders[id]
+	if !ok {
+		return nil, fmt.Errorf("sales order %s not found", id)
+	}
+	return &order, nil
+}
+
+// CreateSalesOrder stores a live sales order under the next free numeric
+// ID, which is also its document number
+func (m *MemorySource) CreateSalesOrder(order *shared.SalesOrder) (*shared.SalesOrder, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if order.Reference != "" {
+		for _, existing := range m.orders {
+			if existing.Type == shared.DocumentOrder && existing.Reference == order.Reference {
+				return &existing, nil
+			}
+		}
+	}
+	if _, ok := m.customers[order.CustomerCode]; !ok {
+		return nil, fmt.Errorf("customer %s not found", order.CustomerCode)
+	}
+
+	id := len(m.orders) + 1
+	for m.orders[strconv.Itoa(id)].ID != "" {
+		id++
+	}
+
+	created := *order
+	created.ID = strconv.Itoa(id)
+	created.Number = fmt.Sprintf("%010d", id)
+	created.Type = shared.DocumentOrder
+	created.Status = shared.DocumentLive
+	created.ModifiedDate = time.Now()
+	m.orders[created.ID] = created
+
+	return &created, nil
+}
+
+// PutBalance adds or replaces the balance of a customer
+func (m *MemorySource) PutBalance(balance shared.CustomerBalance) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.balances[balance.CustomerCode] = balance
+}
+
+// GetCustomerBalances returns the stored balances ordered by customer code
+func (m *MemorySource) GetCustomerBalances() ([]shared.CustomerBalance, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	balances := make([]shared.CustomerBalance, 0, len(m.balances))
+	for _, balance := range m.balances {
+		balances = append(balances, balance)
+	}
+
+	sort.Slice(balances, func(i, j int) bool {
+		return balances[i].CustomerCode < balances[j].CustomerCode
+	})
+
+	return balances, nil
+}
+
+// PutSupplier adds or replaces a supplier, keyed by its code
+func (m *MemorySource) PutSupplier(supplier shared.Supplier) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if supplier.ID == "" {
+		supplier.ID = supplier.Code
+	}
+	m.suppliers[supplier.Code] = supplier
+}
+
+// GetRecentSuppliers returns suppliers modified since lastSync, newest
+// first
+func (m *MemorySource) GetRecentSuppliers(lastSync time.Time) ([]shared.Supplier, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var suppliers []shared.Supplier
+	for _, supplier := range m.suppliers {
+		if supplier.ModifiedDate.After(lastSync) {
+			suppliers = append(suppliers, supplier)
+		}
+	}
+
+	sort.Slice(suppliers, func(i, j int) bool {
+		return suppliers[i].ModifiedDate.After(suppliers[j].ModifiedDate)
+	})
+
+	return suppliers, nil
+}
+
+// GetSupplier retrieves a single supplier
+func (m *MemorySource) GetSupplier(supplierCode string) (*shared.Supplier, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	supplier, ok := m.suppliers[supplierCode]
+	if !ok {
+		return nil, fmt.Errorf("supplier %s not found", supplierCode)
+	}
+	return &supplier, nil
+}
+
+// PutReceivable adds or replaces a receivable, keyed by its ID
+func (m *MemorySource) PutReceivable(receivable shared.Receivable) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.receivables[receivable.ID] = receivable
+}
+
+// GetRecentReceivables returns receivables modified since lastSync, oldest
+// first
+func (m *MemorySource) GetRecentReceivables(lastSync time.Time) ([]shared.Receivable, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var receivables []shared.Receivable
+	for _, receivable := range m.receivables {
+		if receivable.ModifiedDate.After(lastSync) {
+			receivables = append(receivables, receivable)
+		}
+	}
+
+	sort.Slice(receivables, func(i, j int) bool {
+		return receivables[i].ModifiedDate.Before(receivables[j].ModifiedDate)
+	})
+
+	return receivables, nil
+}
+
+// GetOrderReceivables returns the receivables of a sales order by due date
+func (m *MemorySource) GetOrderReceivables(orderID string) ([]shared.Receivable, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var receivables []shared.Receivable
+	for _, receivable := range m.receivables {
+		if receivable.OrderID == orderID {
+			receivables = append(receivables, receivable)
+		}
+	}
+
+	sort.Slice(receivables, func(i, j int) bool {
+		if !receivables[i].DueDate.Equal(receivables[j].DueDate) {
+			return receivables[i].DueDate.Before(receivables[j].DueDate)
+		}
+		return receivables[i].ID < receivables[j].ID
+	})
+
+	return receivables, nil
+}
+
+// PutStockLevel adds or replaces the stock of a product in a warehouse
+func (m *MemorySource) PutStockLevel(level shared.StockLevel) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.stock[level.ProductCode] == nil {
+		m.stock[level.ProductCode] = make(map[string]shared.StockLevel)
+	}
+	m.stock[level.ProductCode][level.Warehouse] = level
+}
+
+// GetRecentStockLevels returns the stock in every warehouse of the
+// products whose stock changed since lastSync, by product and warehouse
+func (m *MemorySource) GetRecentStockLevels(lastSync time.Time) ([]shared.StockLevel, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var levels []shared.StockLevel
+	for _, warehouses := range m.stock {
+		changed := false
+		for _, level := range warehouses {
+			changed = changed || level.ModifiedDate.After(lastSync)
+		}
+		if changed {
+			levels = append(levels, sortedStockLevels(warehouses)...)
+		}
+	}
+
+	sort.SliceStable(levels, func(i, j int) bool {
+		return levels[i].ProductCode < levels[j].ProductCode
+	})
+
+	return levels, nil
+}
+
+// GetProductStockLevels returns the stock of a product by warehouse
+func (m *MemorySource) GetProductStockLevels(productCode string) ([]shared.StockLevel, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return sortedStockLevels(m.stock[productCode]), nil
+}
+
+// sortedStockLevels returns the stock levels of a product by warehouse
+func sortedStockLevels(warehouses map[string]shared.StockLevel) []shared.StockLevel {
+	levels := make([]shared.StockLevel, 0, len(warehouses))
+	for _, level := range warehouses {
+		levels = append(levels, level)
+	}
+	sort.Slice(levels, func(i, j int) bool {
+		return levels[i].Warehouse < levels[j].Warehouse
+	})
+	return levels
+}
+
+// PutPrice adds or replaces the price of a product in a price band
+func (m *MemorySource) PutPrice(price shared.ProductPrice) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.prices[price.ProductCode] == nil {
+		m.prices[price.ProductCode] = make(map[string]shared.ProductPrice)
+	}
+	m.prices[price.ProductCode][price.PriceBand] = price
+}
+
+// GetRecentProductPrices returns the prices in every price band of the
+// products with a price changed since lastSync, by product and price band
+func (m *MemorySource) GetRecentProductPrices(lastSync time.Time) ([]shared.ProductPrice, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var prices []shared.ProductPrice
+	for _, bands := range m.prices {
+		changed := false
+		for _, price := range bands {
+			changed = changed || price.ModifiedDate.After(lastSync)
+		}
+		if changed {
+			prices = append(prices, sortedPrices(bands)...)
+		}
+	}
+
+	sort.SliceStable(prices, func(i, j int) bool {
+		return prices[i].ProductCode < prices[j].ProductCode
+	})
+
+	return prices, nil
+}
+
+// GetProductPrices returns the prices of a product by price band
+func (m *MemorySource) GetProductPrices(productCode string) ([]shared.ProductPrice, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return sortedPrices(m.prices[productCode]), nil
+}
+
+// sortedPrices returns the prices of a product by price band
+func sortedPrices(bands map[string]shared.ProductPrice) []shared.ProductPrice {
+	prices := make([]shared.ProductPrice, 0, len(bands))
+	for _, price := range bands {
+		prices = append(prices, price)
+	}
+	sort.Slice(prices, func(i, j int) bool {
+		return prices[i].PriceBand < prices[j].PriceBand
+	})
+	return prices
+}
+
+// PutCustomerPricing adds or replaces the price band and discounts of a
+// customer
+func (m *MemorySource) PutCustomerPricing(pricing shared.CustomerPricing) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.pricing[pricing.CustomerCode] = pricing
+}
+
+// GetCustomerPricing returns the stored customer pricing ordered by
+// customer code
+func (m *MemorySource) GetCustomerPricing() ([]shared.CustomerPricing, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	pricing := make([]shared.CustomerPricing, 0, len(m.pricing))
+	for _, customer := range m.pricing {
+		pricing = append(pricing, customer)
+	}
+
+	sort.Slice(pricing, func(i, j int) bool {
+		return pricing[i].CustomerCode < pricing[j].CustomerCode
+	})
+
+	return pricing, nil
+}
+
+// TestConnection always succeeds for the in-memory source
+func (m *MemorySource) TestConnection() error {
+	return nil
+}
+
+// Close is a no-op for the in-memory source
+func (m *MemorySource) Close() error {
+	return nil
+}
@@ -0,0 +1,330 @@
+// agent/sage/orders.go
+package sage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"saas-sync-platform/internal/shared"
+)
+
+// SOP document type IDs of the documents read as orders and quotes
+const (
+	sopTypeOrder = 0
+	sopTypeQuote = 2
+)
+
+// sopStatuses maps SOP document status IDs to document statuses
+var sopStatuses = map[int]string{
+	0: shared.DocumentLive,
+	1: shared.DocumentComplete,
+	2: shared.DocumentCancelled,
+	3: shared.DocumentHeld,
+}
+
+// salesOrderColumns are read by both sales order queries
+const salesOrderColumns = `
+            o.SOPOrderReturnID,
+            o.DocumentNo,
+            o.DocumentTypeID,
+            o.DocumentStatusID,
+            c.CustomerAccountNumber,
+            o.DocumentDate,
+            iso.Code,
+            o.CustomerDocumentNo,
+            o.TotalNetValue,
+            o.TotalTaxValue,
+            o.TotalGrossValue,
+            o.DateTimeModified
+        FROM SOPOrderReturn o
+        INNER JOIN SLCustomers c ON c.SLCustomerAccountID = o.CustomerID
+        LEFT JOIN SYSCurrency cur ON cur.SYSCurrencyID = o.CurrencyID
+        LEFT JOIN SYSCurrencyISOCode iso ON iso.SYSCurrencyISOCodeID = cur.SYSCurrencyISOCodeID`
+
+// GetRecentSalesOrders retrieves sales orders and quotes modified since
+// lastSync, with their lines, oldest first
+func (c *Connector) GetRecentSalesOrders(lastSync time.Time) ([]shared.SalesOrder, error) {
+	query := fmt.Sprintf(`
+        SELECT TOP %d`+salesOrderColumns+`
+        WHERE o.DocumentTypeID IN (%d, %d) AND (o.DateTimeModified > ?
+            OR (o.DateTimeModified = ? AND o.SOPOrderReturnID > ?))
+        ORDER BY o.DateTimeModified, o.SOPOrderReturnID
+    `, modifiedPageSize, sopTypeOrder, sopTypeQuote)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var orders []shared.SalesOrder
+	err := c.readModified(ctx, query, lastSync, func(rows *sql.Rows) (int, pageKey, error) {
+		page, err := scanSalesOrders(rows)
+		if err != nil || len(page) == 0 {
+			return 0, pageKey{}, err
+		}
+		orders = append(orders, page...)
+
+		last := page[len(page)-1]
+		key, err := recordKey(last.ModifiedDate, last.ID)
+		return len(page), key, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sales orders: %w", err)
+	}
+
+	for i := range orders {
+		if orders[i].Lines, err = c.getSalesOrderLines(ctx, orders[i].ID); err != nil {
+			return nil, err
+		}
+	}
+
+	slog.Debug("Read modified sales orders from Sage", "count", len(orders), "since", lastSync)
+	return orders, nil
+}
+
+// GetSalesOrder retrieves a single sales order or quote with its lines
+func (c *Connector) GetSalesOrder(id string) (*shared.SalesOrder, error) {
+	query := `
+        SELECT` + salesOrderColumns + `
+        WHERE o.SOPOrderReturnID = ?
+    `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := c.db.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query sales order: %w", err)
+	}
+	orders, err := scanSalesOrders(rows)
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return nil, fmt.Errorf("sales order %s not found", id)
+	}
+
+	order := &orders[0]
+	if order.Lines, err = c.getSalesOrderLines(ctx, order.ID); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// getSalesOrderLines retrieves the lines of a sales order in print order
+func (c *Connector) getSalesOrderLines(ctx context.Context, orderID string) ([]shared.SalesOrderLine, error) {
+	query := `
+        SELECT
+            l.ItemCode,
+            l.ItemDescription,
+            l.LineQuantity,
+            l.UnitSellingPrice,
+            l.UnitDiscountPercent,
+            t.TaxRate
+        FROM SOPOrderReturnLine l
+        LEFT JOIN SYSTaxRate t ON t.SYSTaxRateID = l.SYSTaxRateID
+        WHERE l.SOPOrderReturnID = ?
+        ORDER BY l.PrintSequenceNumber
+    `
+
+	rows, err := c.db.QueryContext(ctx, query, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query lines of sales order %s: %w", orderID, err)
+	}
+	defer rows.Close()
+
+	var lines []shared.SalesOrderLine
+	for rows.Next() {
+		var line shared.SalesOrderLine
+		var code, description sql.NullString
+		var discount, taxRate sql.NullFloat64
+
+		if err := rows.Scan(&code, &description, &line.Quantity, &line.UnitPrice, &discount, &taxRate); err != nil {
+			return nil, fmt.Errorf("failed to scan sales order line row: %w", err)
+		}
+
+		line.ProductCode = code.String
+		line.Description = description.String
+		line.Discount = discount.Float64
+		line.TaxRate = taxRate.Float64
+
+		lines = append(lines, line)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating sales order line rows: %w", err)
+	}
+
+	return lines, nil
+}
+
+// scanSalesOrders reads the rows of a sales order query
+func scanSalesOrders(rows *sql.Rows) ([]shared.SalesOrder, error) {
+	var orders []shared.SalesOrder
+	for rows.Next() {
+		var order shared.SalesOrder
+		var docType, status int
+		var currency, reference sql.NullString
+
+		err := rows.Scan(
+			&order.ID,
+			&order.Number,
+			&docType,
+			&status,
+			&order.CustomerCode,
+			&order.Date,
+			&currency,
+			&reference,
+			&order.NetAmount,
+			&order.TaxAmount,
+			&order.TotalAmount,
+			&order.ModifiedDate,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan sales order row: %w", err)
+		}
+
+		order.Type = shared.DocumentOrder
+		if docType == sopTypeQuote {
+			order.Type = shared.DocumentQuote
+		}
+		order.Status = sopStatuses[status]
+		if order.Status == "" {
+			order.Status = "status_" + strconv.Itoa(status)
+		}
+		order.Currency = currency.String
+		order.Reference = reference.String
+
+		orders = append(orders, order)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating sales order rows: %w", err)
+	}
+
+	return orders, nil
+}
+
+// CreateSalesOrder inserts a live sales order with its lines and returns it
+// with the ID and document number Sage assigned. If an order with the same
+// reference exists it is returned instead, so retrying after a failure
+// that followed the insert does not duplicate the order.
+// The reference check, numbering and inserts run in one serializable
+// transaction, so concurrent writers can neither take the same number nor
+// insert the same reference twice. Lines whose tax rate has no Sage tax
+// code fail the whole order.
+func (c *Connector) CreateSalesOrder(order *shared.SalesOrder) (*shared.SalesOrder, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := c.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if order.Reference != "" {
+		var existingID string
+		err := tx.QueryRowContext(ctx, `
+            SELECT SOPOrderReturnID FROM SOPOrderReturn
+            WHERE DocumentTypeID = ? AND CustomerDocumentNo = ?
+        `, sopTypeOrder, order.Reference).Scan(&existingID)
+		if err == nil {
+			tx.Rollback()
+			return c.GetSalesOrder(existingID)
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("failed to look up sales order %s: %w", order.Reference, err)
+		}
+	}
+
+	var customerID int64
+	err = tx.QueryRowContext(ctx, `
+        SELECT SLCustomerAccountID FROM SLCustomers WHERE CustomerAccountNumber = ?
+    `, order.CustomerCode).Scan(&customerID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("customer %s not found", order.CustomerCode)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query customer: %w", err)
+	}
+
+	taxRateIDs := make([]int64, len(order.Lines))
+	for i, line := range order.Lines {
+		if taxRateIDs[i], err = lookupTaxRate(ctx, tx, line.TaxRate); err != nil {
+			return nil, fmt.Errorf("line %d of sales order: %w", i+1, err)
+		}
+	}
+
+	// The range lock keeps concurrent inserts from taking the same number
+	// until this transaction ends
+	var lastNumber sql.NullInt64
+	err = tx.QueryRowContext(ctx, `
+        SELECT MAX(TRY_CAST(DocumentNo AS BIGINT)) FROM SOPOrderReturn WITH (UPDLOCK, HOLDLOCK)
+        WHERE DocumentTypeID = ?
+    `, sopTypeOrder).Scan(&lastNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read last sales order number: %w", err)
+	}
+
+	created := *order
+	created.Type = shared.DocumentOrder
+	created.Status = shared.DocumentLive
+	created.Number = fmt.Sprintf("%010d", lastNumber.Int64+1)
+
+	err = tx.QueryRowContext(ctx, `
+        INSERT INTO SOPOrderReturn (
+            DocumentNo, DocumentTypeID, DocumentStatusID, CustomerID, DocumentDate,
+            CustomerDocumentNo, TotalNetValue, TotalTaxValue, TotalGrossValue,
+            DateTimeCreated, DateTimeModified
+        )
+        OUTPUT INSERTED.SOPOrderReturnID
+        VALUES (?, ?, 0, ?, ?, ?, ?, ?, ?, GETDATE(), GETDATE())
+    `, created.Number, sopTypeOrder, customerID, created.Date, created.Reference,
+		created.NetAmount, created.TaxAmount, created.TotalAmount).Scan(&created.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert sales order: %w", err)
+	}
+
+	for i, line := range created.Lines {
+		_, err := tx.ExecContext(ctx, `
+            INSERT INTO SOPOrderReturnLine (
+                SOPOrderReturnID, PrintSequenceNumber, ItemCode, ItemDescription,
+                LineQuantity, UnitSellingPrice, UnitDiscountPercent, LineTotalValue, SYSTaxRateID
+            )
+            VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+        `, created.ID, i+1, line.ProductCode, line.Description, line.Quantity, line.UnitPrice,
+			line.Discount, line.Quantity*line.UnitPrice*(1-line.Discount/100), taxRateIDs[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to insert line %d of sales order: %w", i+1, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit sales order: %w", err)
+	}
+
+	slog.Info("Created Sage sales order", "order_id", created.ID, "number", created.Number,
+		"customer_code", created.CustomerCode, "reference", created.Reference)
+	return &created, nil
+}
+
+// lookupTaxRate returns the ID of the Sage tax code with the given rate,
+// the lowest one when several codes share it
+func lookupTaxRate(ctx context.Context, tx *sql.Tx, rate float64) (int64, error) {
+	var id int64
+	err := tx.QueryRowContext(ctx, `
+        SELECT TOP 1 SYSTaxRateID FROM SYSTaxRate WHERE TaxRate = ? ORDER BY SYSTaxRateID
+    `, rate).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("no Sage tax code with rate %g%%", rate)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to query tax code: %w", err)
+	}
+	return id, nil
+}
@@ -0,0 +1,69 @@
+package sage
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"time"
+
+	"saas-sync-platform/internal/shared"
+)
+
+func testOrder(taxRates ...float64) *shared.SalesOrder {
+	order := &shared.SalesOrder{
+		CustomerCode: "430000001",
+		Date:         time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC),
+		Reference:    "B24-DEAL-17",
+	}
+	for _, rate := range taxRates {
+		order.Lines = append(order.Lines, shared.SalesOrderLine{
+			ProductCode: "TOR-8", Quantity: 2, UnitPrice: 10, TaxRate: rate,
+		})
+	}
+	return order
+}
+
+func TestCreateSalesOrderInOneSerializableTransaction(t *testing.T) {
+	sage := &fakeSage{lastNumber: 41, taxRates: map[float64]int64{21: 3, 10: 5}}
+
+	created, err := sage.open(t).CreateSalesOrder(testOrder(21, 10))
+	if err != nil {
+		t.Fatalf("CreateSalesOrder: %v", err)
+	}
+
+	if sage.isolation != driver.IsolationLevel(sql.LevelSerializable) {
+		t.Errorf("isolation = %d, want serializable", sage.isolation)
+	}
+	if !sage.committed {
+		t.Error("transaction not committed")
+	}
+	if created.ID != "101" || created.Number != "0000000042" {
+		t.Errorf("created ID %s number %s, want 101 and 0000000042", created.ID, created.Number)
+	}
+	if len(sage.orders) != 1 || len(sage.lines) != 2 {
+		t.Fatalf("inserted %d orders and %d lines, want 1 and 2", len(sage.orders), len(sage.lines))
+	}
+	for i, want := range []int64{3, 5} {
+		args := sage.lines[i]
+		if got := args[len(args)-1].Value; got != want {
+			t.Errorf("line %d tax code = %v, want %d", i+1, got, want)
+		}
+	}
+}
+
+func TestCreateSalesOrderFailsOnUnknownTaxRate(t *testing.T) {
+	sage := &fakeSage{lastNumber: 41, taxRates: map[float64]int64{21: 3}}
+
+	_, err := sage.open(t).CreateSalesOrder(testOrder(21, 7))
+	if err == nil || !strings.Contains(err.Error(), "no Sage tax code with rate 7%") {
+		t.Fatalf("error = %v, want the missing tax code named", err)
+	}
+
+	if sage.committed || !sage.rolledBack {
+		t.Errorf("committed %t, rolled back %t; want the transaction rolled back", sage.committed, sage.rolledBack)
+	}
+	if len(sage.orders) != 0 || len(sage.lines) != 0 {
+		t.Errorf("inserted %d orders and %d lines, want none", len(sage.orders), len(sage.lines))
+	}
+}
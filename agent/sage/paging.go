@@ -0,0 +1,79 @@
+// agent/sage/paging.go
+package sage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// modifiedPageSize is the number of records read per query of modified
+// records
+const modifiedPageSize = 500
+
+// pageKey is the position of a record in the order modified records are
+// read in: by modification time, then by ID
+type pageKey struct {
+	modified time.Time
+	id       int64
+}
+
+// recordKey returns the page key of a record with a numeric ID
+func recordKey(modified time.Time, id string) (pageKey, error) {
+	number, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return pageKey{}, fmt.Errorf("unexpected record ID %q: %w", id, err)
+	}
+	return pageKey{modified: modified, id: number}, nil
+}
+
+// readModified reads the records modified since lastSync page by page,
+// oldest first, so a busy period is read in full and rows modified while
+// reading are not skipped. query selects the first modifiedPageSize records
+// modified after its first argument, or at its second with an ID above its
+// third, ordered by modification time and ID. readPage scans a page and
+// returns how many records it held and the key of the last one.
+func (c *Connector) readModified(ctx context.Context, query string, lastSync time.Time, readPage func(*sql.Rows) (int, pageKey, error)) error {
+	// The first page starts after every record modified at lastSync
+	after := pageKey{modified: lastSync, id: math.MaxInt64}
+	for {
+		rows, err := c.db.QueryContext(ctx, query, after.modified, after.modified, after.id)
+		if err != nil {
+			return err
+		}
+		count, last, err := readPage(rows)
+		rows.Close()
+		if err != nil {
+			return err
+		}
+
+		if count < modifiedPageSize {
+			return nil
+		}
+		after = last
+	}
+}
+
+// readProductPage reads a page of a query that selects the item ID and the
+// time of the latest change of a product ahead of the other columns of
+// each row. scanRow scans a row into the given destinations for those two
+// columns and its own. It returns the number of products in the page and
+// the key of the last one.
+func readProductPage(rows *sql.Rows, scanRow func(id *int64, modified *time.Time) error) (int, pageKey, error) {
+	products := 0
+	var last pageKey
+	for rows.Next() {
+		var key pageKey
+		if err := scanRow(&key.id, &key.modified); err != nil {
+			return 0, last, err
+		}
+		if products == 0 || key.id != last.id {
+			products++
+		}
+		last = key
+	}
+	return products, last, rows.Err()
+}
@@ -0,0 +1,180 @@
+package sage
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// changedProducts returns more products than fit in two pages, many
+// sharing the time of their latest change, each with a row per warehouse
+// or price band
+func changedProducts(since time.Time, row func(code, place string, modified time.Time) []driver.Value) []fakeProduct {
+	var products []fakeProduct
+	for i := 1; i <= 2*modifiedPageSize+10; i++ {
+		modified := since.Add(time.Duration(i/100+1) * time.Second)
+		code := "ITEM-" + strconv.Itoa(i)
+		products = append(products, fakeProduct{
+			id:           int64(i),
+			lastModified: modified,
+			rows:         [][]driver.Value{row(code, "A", since), row(code, "B", modified)},
+		})
+	}
+	return products
+}
+
+func TestGetRecentStockLevelsReadsEveryPage(t *testing.T) {
+	since := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	sage := &fakeSage{stockItems: changedProducts(since, func(code, warehouse string, modified time.Time) []driver.Value {
+		return []driver.Value{code, warehouse, 2.0, modified}
+	})}
+
+	levels, err := sage.open(t).GetRecentStockLevels(since)
+	if err != nil {
+		t.Fatalf("GetRecentStockLevels: %v", err)
+	}
+
+	if got, want := len(levels), 2*(2*modifiedPageSize+10); got != want {
+		t.Fatalf("stock levels = %d, want %d", got, want)
+	}
+	if levels[0].ProductCode != "ITEM-1" || levels[len(levels)-1].ProductCode != "ITEM-"+strconv.Itoa(2*modifiedPageSize+10) {
+		t.Errorf("first %s last %s, want the oldest change first", levels[0].ProductCode, levels[len(levels)-1].ProductCode)
+	}
+	if sage.queries != 3 {
+		t.Errorf("queries = %d, want 3 pages", sage.queries)
+	}
+}
+
+func TestGetRecentProductPricesReadsEveryPage(t *testing.T) {
+	since := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	sage := &fakeSage{priceItems: changedProducts(since, func(code, band string, modified time.Time) []driver.Value {
+		return []driver.Value{code, band, 0.125, modified}
+	})}
+
+	prices, err := sage.open(t).GetRecentProductPrices(since)
+	if err != nil {
+		t.Fatalf("GetRecentProductPrices: %v", err)
+	}
+
+	if got, want := len(prices), 2*(2*modifiedPageSize+10); got != want {
+		t.Fatalf("prices = %d, want %d", got, want)
+	}
+	if prices[0].ProductCode != "ITEM-1" || prices[len(prices)-1].ProductCode != "ITEM-"+strconv.Itoa(2*modifiedPageSize+10) {
+		t.Errorf("first %s last %s, want the oldest change first", prices[0].ProductCode, prices[len(prices)-1].ProductCode)
+	}
+	if sage.queries != 3 {
+		t.Errorf("queries = %d, want 3 pages", sage.queries)
+	}
+}
+
+// changedRecords returns more records than fit in two pages, many sharing a
+// modification time, built by row from their ID and modification time
+func changedRecords(since time.Time, row func(id int64, modified time.Time) []driver.Value) []fakeRecord {
+	var records []fakeRecord
+	for i := 1; i <= 2*modifiedPageSize+10; i++ {
+		modified := since.Add(time.Duration(i/100+1) * time.Second)
+		records = append(records, fakeRecord{id: int64(i), modified: modified, row: row(int64(i), modified)})
+	}
+	return records
+}
+
+func TestGetRecentSalesOrdersReadsEveryPage(t *testing.T) {
+	since := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	sage := &fakeSage{modified: map[string][]fakeRecord{
+		"FROM SOPOrderReturn o": changedRecords(since, func(id int64, modified time.Time) []driver.Value {
+			return []driver.Value{id, strconv.FormatInt(id, 10), int64(sopTypeOrder), int64(0), "430000001",
+				since, "EUR", nil, 100.0, 21.0, 121.0, modified}
+		}),
+	}}
+
+	orders, err := sage.open(t).GetRecentSalesOrders(since)
+	if err != nil {
+		t.Fatalf("GetRecentSalesOrders: %v", err)
+	}
+
+	if got, want := len(orders), 2*modifiedPageSize+10; got != want {
+		t.Fatalf("orders = %d, want %d", got, want)
+	}
+	if orders[0].ID != "1" || orders[len(orders)-1].ID != strconv.Itoa(2*modifiedPageSize+10) {
+		t.Errorf("first %s last %s, want the oldest change first", orders[0].ID, orders[len(orders)-1].ID)
+	}
+	// Three pages, then the lines of every order
+	if want := 3 + len(orders); sage.queries != want {
+		t.Errorf("queries = %d, want %d", sage.queries, want)
+	}
+}
+
+func TestGetRecentSuppliersReadsEveryPage(t *testing.T) {
+	since := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	sage := &fakeSage{modified: map[string][]fakeRecord{
+		"FROM PLSuppliers s": changedRecords(since, func(id int64, modified time.Time) []driver.Value {
+			return []driver.Value{id, fmt.Sprintf("P%05d", id), "Supplier", nil, nil, nil, nil, nil, nil, nil, modified}
+		}),
+	}}
+
+	suppliers, err := sage.open(t).GetRecentSuppliers(since)
+	if err != nil {
+		t.Fatalf("GetRecentSuppliers: %v", err)
+	}
+
+	if got, want := len(suppliers), 2*modifiedPageSize+10; got != want {
+		t.Fatalf("suppliers = %d, want %d", got, want)
+	}
+	if suppliers[0].Code != "P00001" || suppliers[len(suppliers)-1].Code != fmt.Sprintf("P%05d", 2*modifiedPageSize+10) {
+		t.Errorf("first %s last %s, want the oldest change first", suppliers[0].Code, suppliers[len(suppliers)-1].Code)
+	}
+	if sage.queries != 3 {
+		t.Errorf("queries = %d, want 3", sage.queries)
+	}
+}
+
+func TestGetRecentContactPersonsReadsEveryPage(t *testing.T) {
+	since := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	sage := &fakeSage{modified: map[string][]fakeRecord{
+		"FROM SLCustomerContacts p": changedRecords(since, func(id int64, modified time.Time) []driver.Value {
+			return []driver.Value{id, "430000001", "Marta", nil, nil, nil, nil, nil, modified}
+		}),
+	}}
+
+	persons, err := sage.open(t).GetRecentContactPersons(since)
+	if err != nil {
+		t.Fatalf("GetRecentContactPersons: %v", err)
+	}
+
+	if got, want := len(persons), 2*modifiedPageSize+10; got != want {
+		t.Fatalf("persons = %d, want %d", got, want)
+	}
+	if persons[0].ID != "1" || persons[len(persons)-1].ID != strconv.Itoa(2*modifiedPageSize+10) {
+		t.Errorf("first %s last %s, want the oldest change first", persons[0].ID, persons[len(persons)-1].ID)
+	}
+	if sage.queries != 3 {
+		t.Errorf("queries = %d, want 3", sage.queries)
+	}
+}
+
+func TestGetRecentAddressesReadsEveryPage(t *testing.T) {
+	since := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	sage := &fakeSage{modified: map[string][]fakeRecord{
+		"FROM SLCustomerLocations l": changedRecords(since, func(id int64, modified time.Time) []driver.Value {
+			return []driver.Value{id, "430000001", "delivery", "Almacén", "Calle Mayor 1", nil,
+				"Madrid", nil, "28001", "ES", modified}
+		}),
+	}}
+
+	addresses, err := sage.open(t).GetRecentAddresses(since)
+	if err != nil {
+		t.Fatalf("GetRecentAddresses: %v", err)
+	}
+
+	if got, want := len(addresses), 2*modifiedPageSize+10; got != want {
+		t.Fatalf("addresses = %d, want %d", got, want)
+	}
+	if addresses[0].ID != "1" || addresses[len(addresses)-1].ID != strconv.Itoa(2*modifiedPageSize+10) {
+		t.Errorf("first %s last %s, want the oldest change first", addresses[0].ID, addresses[len(addresses)-1].ID)
+	}
+	if sage.queries != 3 {
+		t.Errorf("queries = %d, want 3", sage.queries)
+	}
+}
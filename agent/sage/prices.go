@@ -0,0 +1,164 @@
+// agent/sage/prices.go
+package sage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"saas-sync-platform/internal/shared"
+)
+
+// priceColumns are read by both price queries
+const priceColumns = `
+            si.Code,
+            pb.Name,
+            sip.Price,
+            sip.DateTimeModified
+        FROM StockItemPrice sip
+        INNER JOIN StockItem si ON si.ItemID = sip.ItemID
+        INNER JOIN PriceBand pb ON pb.PriceBandID = sip.PriceBandID`
+
+// GetRecentProductPrices retrieves the prices in every price band of the
+// products with a price modified since lastSync, the product with the
+// oldest change first. Products are paged on the time of their latest
+// price change and their item ID.
+func (c *Connector) GetRecentProductPrices(lastSync time.Time) ([]shared.ProductPrice, error) {
+	query := fmt.Sprintf(`
+        SELECT p.ItemID, p.LastModified,`+priceColumns+`
+        INNER JOIN (
+            SELECT TOP %d ItemID, MAX(DateTimeModified) AS LastModified
+            FROM StockItemPrice
+            GROUP BY ItemID
+            HAVING MAX(DateTimeModified) > ?
+                OR (MAX(DateTimeModified) = ? AND ItemID > ?)
+            ORDER BY MAX(DateTimeModified), ItemID
+        ) p ON p.ItemID = sip.ItemID
+        ORDER BY p.LastModified, p.ItemID, pb.Name
+    `, modifiedPageSize)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var prices []shared.ProductPrice
+	err := c.readModified(ctx, query, lastSync, func(rows *sql.Rows) (int, pageKey, error) {
+		return readProductPage(rows, func(id *int64, modified *time.Time) error {
+			var price shared.ProductPrice
+			if err := rows.Scan(id, modified, &price.ProductCode, &price.PriceBand,
+				&price.Price, &price.ModifiedDate); err != nil {
+				return fmt.Errorf("failed to scan product price row: %w", err)
+			}
+			prices = append(prices, price)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query product prices: %w", err)
+	}
+
+	slog.Debug("Read modified product prices from Sage", "count", len(prices), "since", lastSync)
+	return prices, nil
+}
+
+// GetProductPrices retrieves the prices of a product in every price band
+func (c *Connector) GetProductPrices(productCode string) ([]shared.ProductPrice, error) {
+	query := `
+        SELECT` + priceColumns + `
+        WHERE si.Code = ?
+        ORDER BY pb.Name
+    `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := c.db.QueryContext(ctx, query, productCode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query product prices: %w", err)
+	}
+	defer rows.Close()
+
+	return scanProductPrices(rows)
+}
+
+// scanProductPrices reads the rows of a price query
+func scanProductPrices(rows *sql.Rows) ([]shared.ProductPrice, error) {
+	var prices []shared.ProductPrice
+	for rows.Next() {
+		var price shared.ProductPrice
+		if err := rows.Scan(&price.ProductCode, &price.PriceBand, &price.Price, &price.ModifiedDate); err != nil {
+			return nil, fmt.Errorf("failed to scan product price row: %w", err)
+		}
+		prices = append(prices, price)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating product price rows: %w", err)
+	}
+
+	return prices, nil
+}
+
+// GetCustomerPricing retrieves the price band of every customer and the
+// discounts of its customer discount group, by product group. A discount
+// without a product group applies to every product.
+func (c *Connector) GetCustomerPricing() ([]shared.CustomerPricing, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	rows, err := c.db.QueryContext(ctx, `
+        SELECT c.CustomerAccountNumber, ISNULL(pb.Name, '')
+        FROM SLCustomers c
+        LEFT JOIN PriceBand pb ON pb.PriceBandID = c.PriceBandID
+        ORDER BY c.CustomerAccountNumber
+    `)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query customer price bands: %w", err)
+	}
+	defer rows.Close()
+
+	var pricing []shared.CustomerPricing
+	index := make(map[string]int)
+	for rows.Next() {
+		var customer shared.CustomerPricing
+		if err := rows.Scan(&customer.CustomerCode, &customer.PriceBand); err != nil {
+			return nil, fmt.Errorf("failed to scan customer price band row: %w", err)
+		}
+		index[customer.CustomerCode] = len(pricing)
+		pricing = append(pricing, customer)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating customer price band rows: %w", err)
+	}
+
+	discounts, err := c.db.QueryContext(ctx, `
+        SELECT c.CustomerAccountNumber, ISNULL(pg.Code, ''), d.DiscountPercent
+        FROM SLCustomers c
+        INNER JOIN ProductGroupDiscount d ON d.CustDiscountGroupID = c.CustDiscountGroupID
+        LEFT JOIN ProductGroup pg ON pg.ProductGroupID = d.ProductGroupID
+        WHERE d.DiscountPercent <> 0
+        ORDER BY c.CustomerAccountNumber, pg.Code
+    `)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query customer discounts: %w", err)
+	}
+	defer discounts.Close()
+
+	for discounts.Next() {
+		var code string
+		var rule shared.DiscountRule
+		if err := discounts.Scan(&code, &rule.ProductGroup, &rule.Percent); err != nil {
+			return nil, fmt.Errorf("failed to scan customer discount row: %w", err)
+		}
+		if i, ok := index[code]; ok {
+			pricing[i].Discounts = append(pricing[i].Discounts, rule)
+		}
+	}
+	if err := discounts.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating customer discount rows: %w", err)
+	}
+
+	slog.Debug("Read customer pricing from Sage", "count", len(pricing))
+	return pricing, nil
+}
@@ -0,0 +1,123 @@
+// agent/sage/receivables.go
+package sage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"saas-sync-platform/internal/shared"
+)
+
+// traderTranInvoice is the SYSTraderTranType of customer invoices
+const traderTranInvoice = 4
+
+// receivableColumns are read by both receivable queries. The sales order
+// of an invoice is found through the order lines it was raised from.
+const receivableColumns = `
+            t.PostedCustomerTranID,
+            c.CustomerAccountNumber,
+            t.TransactionReference,
+            o.SOPOrderReturnID,
+            t.DueDate,
+            t.DocumentGoodsValue + t.DocumentTaxValue,
+            t.OutstandingValue,
+            t.DateTimeModified
+        FROM SLPostedCustomerTran t
+        INNER JOIN SLCustomers c ON c.SLCustomerAccountID = t.SLCustomerAccountID
+        OUTER APPLY (
+            SELECT TOP 1 ol.SOPOrderReturnID
+            FROM SOPInvoiceCredit i
+            INNER JOIN SOPInvoiceCreditLine il ON il.SOPInvoiceCreditID = i.SOPInvoiceCreditID
+            INNER JOIN SOPOrderReturnLine ol ON ol.SOPOrderReturnLineID = il.SOPOrderReturnLineID
+            WHERE i.DocumentNo = t.TransactionReference
+        ) o`
+
+// GetRecentReceivables retrieves the invoice receivables modified since
+// lastSync, oldest first. Registering a collection in Sage updates the
+// outstanding value and modification time of the receivables it settles.
+func (c *Connector) GetRecentReceivables(lastSync time.Time) ([]shared.Receivable, error) {
+	query := fmt.Sprintf(`
+        SELECT TOP %d`+receivableColumns+`
+        WHERE t.SYSTraderTranTypeID = %d AND (t.DateTimeModified > ?
+            OR (t.DateTimeModified = ? AND t.PostedCustomerTranID > ?))
+        ORDER BY t.DateTimeModified, t.PostedCustomerTranID
+    `, modifiedPageSize, traderTranInvoice)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var receivables []shared.Receivable
+	err := c.readModified(ctx, query, lastSync, func(rows *sql.Rows) (int, pageKey, error) {
+		page, err := scanReceivables(rows)
+		if err != nil || len(page) == 0 {
+			return 0, pageKey{}, err
+		}
+		receivables = append(receivables, page...)
+
+		last := page[len(page)-1]
+		key, err := recordKey(last.ModifiedDate, last.ID)
+		return len(page), key, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query receivables: %w", err)
+	}
+
+	slog.Debug("Read modified receivables from Sage", "count", len(receivables), "since", lastSync)
+	return receivables, nil
+}
+
+// GetOrderReceivables retrieves the receivables of the invoices raised
+// from a sales order, by due date
+func (c *Connector) GetOrderReceivables(orderID string) ([]shared.Receivable, error) {
+	query := fmt.Sprintf(`
+        SELECT`+receivableColumns+`
+        WHERE t.SYSTraderTranTypeID = %d AND o.SOPOrderReturnID = ?
+        ORDER BY t.DueDate, t.PostedCustomerTranID
+    `, traderTranInvoice)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := c.db.QueryContext(ctx, query, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query order receivables: %w", err)
+	}
+	defer rows.Close()
+
+	return scanReceivables(rows)
+}
+
+// scanReceivables reads the rows of a receivable query
+func scanReceivables(rows *sql.Rows) ([]shared.Receivable, error) {
+	var receivables []shared.Receivable
+	for rows.Next() {
+		var receivable shared.Receivable
+		var orderID sql.NullString
+
+		err := rows.Scan(
+			&receivable.ID,
+			&receivable.CustomerCode,
+			&receivable.InvoiceNumber,
+			&orderID,
+			&receivable.DueDate,
+			&receivable.Amount,
+			&receivable.Outstanding,
+			&receivable.ModifiedDate,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan receivable row: %w", err)
+		}
+		receivable.OrderID = orderID.String
+
+		receivables = append(receivables, receivable)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating receivable rows: %w", err)
+	}
+
+	return receivables, nil
+}
@@ -0,0 +1,48 @@
+package sage
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"saas-sync-platform/internal/shared"
+)
+
+func TestGetRecentReceivablesReadsEveryPage(t *testing.T) {
+	since := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	sage := &fakeSage{}
+	// More changes than fit in two pages, many sharing a modification time,
+	// and one modified exactly at the watermark that was read last cycle.
+	sage.receivables = append(sage.receivables, shared.Receivable{ID: "1", ModifiedDate: since})
+	for i := 2; i <= 2*modifiedPageSize+10; i++ {
+		sage.receivables = append(sage.receivables, shared.Receivable{
+			ID:           strconv.Itoa(i),
+			CustomerCode: "430000001",
+			Amount:       100,
+			Outstanding:  100,
+			ModifiedDate: since.Add(time.Duration(i/100+1) * time.Second),
+		})
+	}
+
+	receivables, err := sage.open(t).GetRecentReceivables(since)
+	if err != nil {
+		t.Fatalf("GetRecentReceivables: %v", err)
+	}
+
+	if got, want := len(receivables), 2*modifiedPageSize+9; got != want {
+		t.Fatalf("receivables = %d, want %d", got, want)
+	}
+	if receivables[0].ID != "2" || receivables[len(receivables)-1].ID != strconv.Itoa(2*modifiedPageSize+10) {
+		t.Errorf("first %s last %s, want the oldest change first", receivables[0].ID, receivables[len(receivables)-1].ID)
+	}
+	seen := make(map[string]bool)
+	for _, receivable := range receivables {
+		if seen[receivable.ID] {
+			t.Fatalf("receivable %s read twice", receivable.ID)
+		}
+		seen[receivable.ID] = true
+	}
+	if sage.queries != 3 {
+		t.Errorf("queries = %d, want 3 pages", sage.queries)
+	}
+}
@@ -0,0 +1,145 @@
+// agent/sage/source.go
+package sage
+
+import (
+	"time"
+
+	"saas-sync-platform/internal/shared"
+)
+
+// CustomerSource provides Sage customer data to the sync engine
+type CustomerSource interface {
+	// GetRecentCustomers returns customers modified after since, newest first
+	GetRecentCustomers(since time.Time) ([]shared.Customer, error)
+	// GetAllCustomers returns every customer ordered by code, for
+	// reconciliation
+	GetAllCustomers() ([]shared.Customer, error)
+	// GetCustomerDetails returns a single customer including its addresses
+	GetCustomerDetails(customerCode string) (*shared.Customer, error)
+	// TestConnection verifies the source is reachable
+	TestConnection() error
+	Close() error
+}
+
+// ContactPersonSource provides the contact persons of Sage customers. The
+// engine syncs them when its customer source also implements this
+// interface.
+type ContactPersonSource interface {
+	// GetContactPersons returns the contact persons of a customer ordered by
+	// ID
+	GetContactPersons(customerCode string) ([]shared.ContactPerson, error)
+	// GetRecentContactPersons returns contact persons modified after since
+	GetRecentContactPersons(since time.Time) ([]shared.ContactPerson, error)
+}
+
+// AddressSource provides the fiscal and delivery addresses of Sage
+// customers. The engine syncs them when its customer source also
+// implements this interface.
+type AddressSource interface {
+	// GetCustomerAddresses returns the addresses of a customer, fiscal first
+	GetCustomerAddresses(customerCode string) ([]shared.Address, error)
+	// GetRecentAddresses returns addresses modified after since
+	GetRecentAddresses(since time.Time) ([]shared.Address, error)
+}
+
+// SalesOrderSource provides Sage sales orders and quotes with their lines.
+// The engine syncs them as deals when its customer source also implements
+// this interface.
+type SalesOrderSource interface {
+	// GetRecentSalesOrders returns orders and quotes modified after since
+	GetRecentSalesOrders(since time.Time) ([]shared.SalesOrder, error)
+	// GetSalesOrder returns a single order or quote by ID
+	GetSalesOrder(id string) (*shared.SalesOrder, error)
+}
+
+// SalesOrderWriter creates Sage sales orders from won Bitrix24 deals
+type SalesOrderWriter interface {
+	// CreateSalesOrder creates a live sales order and returns it with its
+	// Sage ID and number; an existing order with the same reference is
+	// returned instead
+	CreateSalesOrder(order *shared.SalesOrder) (*shared.SalesOrder, error)
+}
+
+// BalanceSource provides the outstanding balance and credit data of Sage
+// customers. The engine pushes them to the customers' cards on every cycle
+// when its customer source also implements this interface.
+type BalanceSource interface {
+	// GetCustomerBalances returns the balance of every customer ordered by
+	// code
+	GetCustomerBalances() ([]shared.CustomerBalance, error)
+}
+
+// SupplierSource provides Sage suppliers. The engine pushes them to
+// Bitrix24 and Tickelia when its customer source also implements this
+// interface.
+type SupplierSource interface {
+	// GetRecentSuppliers returns suppliers modified after since, newest first
+	GetRecentSuppliers(since time.Time) ([]shared.Supplier, error)
+	// GetSupplier returns a single supplier by code
+	GetSupplier(supplierCode string) (*shared.Supplier, error)
+}
+
+// ReceivableSource provides the receivables (efectos) of Sage invoices.
+// The engine writes their collection state to the deals of the sales
+// orders they were invoiced from when its customer source also implements
+// this interface.
+type ReceivableSource interface {
+	// GetRecentReceivables returns every receivable modified after since,
+	// oldest first
+	GetRecentReceivables(since time.Time) ([]shared.Receivable, error)
+	// GetOrderReceivables returns every receivable of the invoices of a
+	// sales order
+	GetOrderReceivables(orderID string) ([]shared.Receivable, error)
+}
+
+// StockSource provides the stock of Sage products per warehouse. The
+// engine writes it to Bitrix24 store quantities when its customer source
+// also implements this interface.
+type StockSource interface {
+	// GetRecentStockLevels returns the stock in every warehouse of the
+	// products whose stock changed after since
+	GetRecentStockLevels(since time.Time) ([]shared.StockLevel, error)
+	// GetProductStockLevels returns the stock of a product in every
+	// warehouse
+	GetProductStockLevels(productCode string) ([]shared.StockLevel, error)
+}
+
+// PriceSource provides the prices of Sage products per price band and the
+// tariff and discounts of each customer. The engine writes them to
+// Bitrix24 price types and customer fields when its customer source also
+// implements this interface.
+type PriceSource interface {
+	// GetRecentProductPrices returns the prices in every price band of the
+	// products with a price changed after since
+	GetRecentProductPrices(since time.Time) ([]shared.ProductPrice, error)
+	// GetProductPrices returns the prices of a product in every price band
+	GetProductPrices(productCode string) ([]shared.ProductPrice, error)
+	// GetCustomerPricing returns the price band and discount rules of every
+	// customer ordered by customer code
+	GetCustomerPricing() ([]shared.CustomerPricing, error)
+}
+
+// Both the SQL Server connector and the in-memory source implement every
+// source interface
+var (
+	_ CustomerSource      = (*Connector)(nil)
+	_ CustomerSource      = (*MemorySource)(nil)
+	_ ContactPersonSource = (*Connector)(nil)
+	_ ContactPersonSource = (*MemorySource)(nil)
+	_ AddressSource       = (*Connector)(nil)
+	_ AddressSource       = (*MemorySource)(nil)
+	_ SalesOrderSource    = (*Connector)(nil)
+	_ SalesOrderSource    = (*MemorySource)(nil)
+	_ SalesOrderWriter    = (*Connector)(nil)
+	_ SalesOrderWriter    = (*MemorySource)(nil)
+	_ BalanceSource       = (*Connector)(nil)
+	_ BalanceSource       = (*MemorySource)(nil)
+	_ SupplierSource      = (*Connector)(nil)
+	_ SupplierSource      = (*MemorySource)(nil)
+	_ ReceivableSource    = (*Connector)(nil)
+	_ ReceivableSource    = (*MemorySource)(nil)
+	_ StockSource         = (*Connector)(nil)
+	_ StockSource         = (*MemorySource)(nil)
+	_ PriceSource         = (*Connector)(nil)
+	_ PriceSource         = (*MemorySource)(nil)
+)
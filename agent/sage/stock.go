@@ -0,0 +1,103 @@
+// agent/sage/stock.go
+package sage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"saas-sync-platform/internal/shared"
+)
+
+// stockColumns are read by both stock queries; the quantity in stock
+// includes movements not yet confirmed
+const stockColumns = `
+            si.Code,
+            w.Name,
+            wi.ConfirmedQtyInStock + wi.UnconfirmedQtyInStock,
+            wi.DateTimeModified
+        FROM WarehouseItem wi
+        INNER JOIN StockItem si ON si.ItemID = wi.ItemID
+        INNER JOIN Warehouse w ON w.WarehouseID = wi.WarehouseID`
+
+// GetRecentStockLevels retrieves the stock in every warehouse of the
+// products whose stock changed in any warehouse since lastSync, the product
+// with the oldest change first. Products are paged on the time of their
+// latest change and their item ID.
+func (c *Connector) GetRecentStockLevels(lastSync time.Time) ([]shared.StockLevel, error) {
+	query := fmt.Sprintf(`
+        SELECT p.ItemID, p.LastModified,`+stockColumns+`
+        INNER JOIN (
+            SELECT TOP %d ItemID, MAX(DateTimeModified) AS LastModified
+            FROM WarehouseItem
+            GROUP BY ItemID
+            HAVING MAX(DateTimeModified) > ?
+                OR (MAX(DateTimeModified) = ? AND ItemID > ?)
+            ORDER BY MAX(DateTimeModified), ItemID
+        ) p ON p.ItemID = wi.ItemID
+        ORDER BY p.LastModified, p.ItemID, w.Name
+    `, modifiedPageSize)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var levels []shared.StockLevel
+	err := c.readModified(ctx, query, lastSync, func(rows *sql.Rows) (int, pageKey, error) {
+		return readProductPage(rows, func(id *int64, modified *time.Time) error {
+			var level shared.StockLevel
+			if err := rows.Scan(id, modified, &level.ProductCode, &level.Warehouse,
+				&level.Quantity, &level.ModifiedDate); err != nil {
+				return fmt.Errorf("failed to scan stock level row: %w", err)
+			}
+			levels = append(levels, level)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query stock levels: %w", err)
+	}
+
+	slog.Debug("Read modified stock levels from Sage", "count", len(levels), "since", lastSync)
+	return levels, nil
+}
+
+// GetProductStockLevels retrieves the stock of a product in every
+// warehouse
+func (c *Connector) GetProductStockLevels(productCode string) ([]shared.StockLevel, error) {
+	query := `
+        SELECT` + stockColumns + `
+        WHERE si.Code = ?
+        ORDER BY w.Name
+    `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := c.db.QueryContext(ctx, query, productCode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query product stock levels: %w", err)
+	}
+	defer rows.Close()
+
+	return scanStockLevels(rows)
+}
+
+// scanStockLevels reads the rows of a stock query
+func scanStockLevels(rows *sql.Rows) ([]shared.StockLevel, error) {
+	var levels []shared.StockLevel
+	for rows.Next() {
+		var level shared.StockLevel
+		if err := rows.Scan(&level.ProductCode, &level.Warehouse, &level.Quantity, &level.ModifiedDate); err != nil {
+			return nil, fmt.Errorf("failed to scan stock level row: %w", err)
+		}
+		levels = append(levels, level)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating stock level rows: %w", err)
+	}
+
+	return levels, nil
+}
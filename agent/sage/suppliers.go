@@ -0,0 +1,129 @@
+// agent/sage/suppliers.go
+package sage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"saas-sync-platform/internal/shared"
+)
+
+// supplierColumns are read by both supplier queries
+const supplierColumns = `
+            s.PLSupplierAccountID,
+            s.SupplierAccountNumber,
+            s.SupplierAccountName,
+            s.TaxRegistrationCode,
+            s.EmailAddress,
+            s.TelephoneNumber,
+            addr.Address1,
+            addr.City,
+            addr.PostCode,
+            addr.Country,
+            s.DateTimeModified
+        FROM PLSuppliers s
+        LEFT JOIN PLPostalAddresses addr ON s.MainAddressID = addr.PostalAddressID`
+
+// GetRecentSuppliers retrieves suppliers modified since lastSync, oldest
+// first
+func (c *Connector) GetRecentSuppliers(lastSync time.Time) ([]shared.Supplier, error) {
+	query := fmt.Sprintf(`
+        SELECT TOP %d`+supplierColumns+`
+        WHERE s.DateTimeModified > ?
+            OR (s.DateTimeModified = ? AND s.PLSupplierAccountID > ?)
+        ORDER BY s.DateTimeModified, s.PLSupplierAccountID
+    `, modifiedPageSize)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var suppliers []shared.Supplier
+	err := c.readModified(ctx, query, lastSync, func(rows *sql.Rows) (int, pageKey, error) {
+		page, err := scanSuppliers(rows)
+		if err != nil || len(page) == 0 {
+			return 0, pageKey{}, err
+		}
+		suppliers = append(suppliers, page...)
+
+		last := page[len(page)-1]
+		key, err := recordKey(last.ModifiedDate, last.ID)
+		return len(page), key, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query suppliers: %w", err)
+	}
+
+	slog.Debug("Read modified suppliers from Sage", "count", len(suppliers), "since", lastSync)
+	return suppliers, nil
+}
+
+// GetSupplier retrieves a single supplier by account number
+func (c *Connector) GetSupplier(supplierCode string) (*shared.Supplier, error) {
+	query := `
+        SELECT` + supplierColumns + `
+        WHERE s.SupplierAccountNumber = ?
+    `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := c.db.QueryContext(ctx, query, supplierCode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query supplier: %w", err)
+	}
+	defer rows.Close()
+
+	suppliers, err := scanSuppliers(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(suppliers) == 0 {
+		return nil, fmt.Errorf("supplier %s not found", supplierCode)
+	}
+	return &suppliers[0], nil
+}
+
+// scanSuppliers reads the rows of a supplier query
+func scanSuppliers(rows *sql.Rows) ([]shared.Supplier, error) {
+	var suppliers []shared.Supplier
+	for rows.Next() {
+		var supplier shared.Supplier
+		var taxNumber, email, phone, address, city, postalCode, country sql.NullString
+
+		err := rows.Scan(
+			&supplier.ID,
+			&supplier.Code,
+			&supplier.Name,
+			&taxNumber,
+			&email,
+			&phone,
+			&address,
+			&city,
+			&postalCode,
+			&country,
+			&supplier.ModifiedDate,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan supplier row: %w", err)
+		}
+
+		supplier.TaxNumber = taxNumber.String
+		supplier.Email = email.String
+		supplier.Phone = phone.String
+		supplier.Address = address.String
+		supplier.City = city.String
+		supplier.PostalCode = postalCode.String
+		supplier.Country = country.String
+
+		suppliers = append(suppliers, supplier)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating supplier rows: %w", err)
+	}
+
+	return suppliers, nil
+}
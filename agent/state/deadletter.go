@@ -0,0 +1,248 @@
+// agent/state/deadletter.go
+package state
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Default retry policy for dead letters
+const (
+	DefaultRetryBaseDelay   = 5 * time.Minute
+	DefaultRetryMaxDelay    = 24 * time.Hour
+	DefaultRetryMaxAttempts = 10
+)
+
+// DeadLetter is a record that failed to sync, kept for automatic retry
+type DeadLetter struct {
+	Entity        string    `json:"entity"`
+	Code          string    `json:"code"`
+	Name          string    `json:"name"`
+	Error         string    `json:"error"`
+	Attempts      int       `json:"attempts"`
+	FirstFailedAt time.Time `json:"first_failed_at"`
+	LastFailedAt  time.Time `json:"last_failed_at"`
+	NextRetryAt   time.Time `json:"next_retry_at"`
+	// Parked letters exceeded the retry limit and are only retried on replay
+	Parked bool `json:"parked"`
+}
+
+// DeadLetterQueue persists failed records with exponential backoff between
+// retries
+type DeadLetterQueue struct {
+	file    *stateFile // nil for queues kept in memory only
+	mu      sync.Mutex
+	letters map[string]*DeadLetter
+
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	MaxAttempts int
+}
+
+// OpenDeadLetterQueue loads the queue stored at path, starting empty if the
+// file does not exist yet
+func OpenDeadLetterQueue(path string) (*DeadLetterQueue, error) {
+	q := NewMemoryDeadLetterQueue()
+	q.file = &stateFile{path: path}
+	if err := q.reloadLocked(); err != nil {
+		return nil, err
+	}
+
+	return q, nil
+}
+
+// NewMemoryDeadLetterQueue creates a queue that is never written to disk
+func NewMemoryDeadLetterQueue() *DeadLetterQueue {
+	return &DeadLetterQueue{
+		letters:     make(map[string]*DeadLetter),
+		BaseDelay:   DefaultRetryBaseDelay,
+		MaxDelay:    DefaultRetryMaxDelay,
+		MaxAttempts: DefaultRetryMaxAttempts,
+	}
+}
+
+func letterKey(entity, code string) string {
+	return entity + "/" + code
+}
+
+// RecordFailure adds a failed record or increments its attempt count, and
+// schedules the next retry
+func (q *DeadLetterQueue) RecordFailure(entity, code, name string, failure error) (*DeadLetter, error) {
+	return q.record(entity, code, name, failure, false)
+}
+
+// Park adds a record that must not be retried automatically, e.g. one
+// waiting for a person to decide how it should be synced. It stays parked
+// until it is replayed or requeued.
+func (q *DeadLetterQueue) Park(entity, code, name string, reason error) (*DeadLetter, error) {
+	return q.record(entity, code, name, reason, true)
+}
+
+func (q *DeadLetterQueue) record(entity, code, name string, failure error, park bool) (*DeadLetter, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var copied DeadLetter
+	err := q.updateLocked(func() error {
+		now := time.Now()
+		key := letterKey(entity, code)
+
+		letter, ok := q.letters[key]
+		if !ok {
+			letter = &DeadLetter{
+				Entity:        entity,
+				Code:          code,
+				FirstFailedAt: now,
+			}
+			q.letters[key] = letter
+		}
+
+		if name != "" {
+			letter.Name = name
+		}
+		letter.Error = failure.Error()
+		letter.Attempts++
+		letter.LastFailedAt = now
+		letter.NextRetryAt = now.Add(q.backoff(letter.Attempts))
+		letter.Parked = park || (q.MaxAttempts > 0 && letter.Attempts >= q.MaxAttempts)
+
+		copied = *letter
+		return nil
+	})
+	return &copied, err
+}
+
+// backoff doubles the delay with every attempt up to MaxDelay
+func (q *DeadLetterQueue) backoff(attempts int) time.Duration {
+	delay := q.BaseDelay
+	for i := 1; i < attempts && delay < q.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > q.MaxDelay {
+		delay = q.MaxDelay
+	}
+	return delay
+}
+
+// Resolve removes a record after it synced successfully. It is a no-op for
+// records that are not in the queue.
+func (q *DeadLetterQueue) Resolve(entity, code string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	refresh(q.file, q.reloadLocked)
+	if _, ok := q.letters[letterKey(entity, code)]; !ok {
+		return nil
+	}
+
+	return q.updateLocked(func() error {
+		delete(q.letters, letterKey(entity, code))
+		return nil
+	})
+}
+
+// Due returns the unparked letters of an entity type whose retry time has
+// come
+func (q *DeadLetterQueue) Due(entity string, now time.Time) []DeadLetter {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	refresh(q.file, q.reloadLocked)
+	var due []DeadLetter
+	for _, letter := range q.sortedLocked() {
+		if letter.Entity == entity && !letter.Parked && !letter.NextRetryAt.After(now) {
+			due = append(due, letter)
+		}
+	}
+	return due
+}
+
+// List returns all letters ordered by entity and code
+func (q *DeadLetterQueue) List() []DeadLetter {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	refresh(q.file, q.reloadLocked)
+	return q.sortedLocked()
+}
+
+// Get returns a single letter
+func (q *DeadLetterQueue) Get(entity, code string) (DeadLetter, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	refresh(q.file, q.reloadLocked)
+	letter, ok := q.letters[letterKey(entity, code)]
+	if !ok {
+		return DeadLetter{}, false
+	}
+	return *letter, true
+}
+
+// Requeue makes a letter due immediately, unparking it if needed
+func (q *DeadLetterQueue) Requeue(entity, code string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.updateLocked(func() error {
+		letter, ok := q.letters[letterKey(entity, code)]
+		if !ok {
+			return fmt.Errorf("no dead letter for %s %s", entity, code)
+		}
+
+		letter.NextRetryAt = time.Now()
+		letter.Parked = false
+		return nil
+	})
+}
+
+// Discard drops a letter without retrying it
+func (q *DeadLetterQueue) Discard(entity, code string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.updateLocked(func() error {
+		key := letterKey(entity, code)
+		if _, ok := q.letters[key]; !ok {
+			return fmt.Errorf("no dead letter for %s %s", entity, code)
+		}
+
+		delete(q.letters, key)
+		return nil
+	})
+}
+
+func (q *DeadLetterQueue) sortedLocked() []DeadLetter {
+	letters := make([]DeadLetter, 0, len(q.letters))
+	for _, letter := range q.letters {
+		letters = append(letters, *letter)
+	}
+	sort.Slice(letters, func(i, j int) bool {
+		if letters[i].Entity != letters[j].Entity {
+			return letters[i].Entity < letters[j].Entity
+		}
+		return letters[i].Code < letters[j].Code
+	})
+	return letters
+}
+
+// updateLocked applies a change to the latest letters on disk and saves
+// them. Nothing is written when apply fails.
+func (q *DeadLetterQueue) updateLocked(apply func() error) error {
+	if q.file == nil {
+		return apply()
+	}
+	return q.file.update(q.reloadLocked, apply, &q.letters)
+}
+
+func (q *DeadLetterQueue) reloadLocked() error {
+	letters := make(map[string]*DeadLetter)
+	if err := q.file.load(&letters); err != nil {
+		return fmt.Errorf("failed to load dead-letter queue: %w", err)
+	}
+
+	q.letters = letters
+	return nil
+}
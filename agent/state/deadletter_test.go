@@ -0,0 +1,63 @@
+package state
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDeadLetterBackoffAndParking(t *testing.T) {
+	q := NewMemoryDeadLetterQueue()
+	q.BaseDelay = time.Minute
+	q.MaxDelay = 3 * time.Minute
+	q.MaxAttempts = 3
+
+	failure := errors.New("HTTP error 503")
+	var letter *DeadLetter
+	for _, want := range []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute} {
+		letter, _ = q.RecordFailure("customer", "C1", "Bar Roca", failure)
+		if got := letter.NextRetryAt.Sub(letter.LastFailedAt); got != want {
+			t.Errorf("attempt %d delay = %v, want %v", letter.Attempts, got, want)
+		}
+	}
+
+	if !letter.Parked {
+		t.Error("letter not parked after MaxAttempts")
+	}
+	if due := q.Due("customer", time.Now().Add(time.Hour)); len(due) != 0 {
+		t.Errorf("parked letter is due: %+v", due)
+	}
+
+	if err := q.Requeue("customer", "C1"); err != nil {
+		t.Fatalf("Requeue: %v", err)
+	}
+	if due := q.Due("customer", time.Now()); len(due) != 1 {
+		t.Errorf("requeued letter not due")
+	}
+}
+
+func TestDeadLetterQueuePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead_letters.json")
+
+	q, err := OpenDeadLetterQueue(path)
+	if err != nil {
+		t.Fatalf("OpenDeadLetterQueue: %v", err)
+	}
+	q.RecordFailure("customer", "C1", "Bar Roca", errors.New("boom"))
+
+	reopened, err := OpenDeadLetterQueue(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if letter, ok := reopened.Get("customer", "C1"); !ok || letter.Error != "boom" {
+		t.Fatalf("Get = %+v, %t", letter, ok)
+	}
+
+	if err := reopened.Discard("customer", "C1"); err != nil {
+		t.Fatalf("Discard: %v", err)
+	}
+	if err := reopened.Discard("customer", "C1"); err == nil {
+		t.Error("expected error discarding a missing letter")
+	}
+}
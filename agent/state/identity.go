@@ -0,0 +1,147 @@
+// agent/state/identity.go
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Identity links a Sage record to the entity it was pushed to and keeps a
+// hash of the last pushed payload. RemoteID is the ID of that entity in its
+// target; it is stored as bitrix_id, from when Bitrix24 was the only target.
+type Identity struct {
+	RemoteID string    `json:"bitrix_id"`
+	Hash     string    `json:"hash,omitempty"`
+	SyncedAt time.Time `json:"synced_at"`
+}
+
+// IdentityMap persists identities per entity type ("customer", ...) and
+// Sage code in a JSON file
+type IdentityMap struct {
+	file       *stateFile // nil for maps kept in memory only
+	mu         sync.Mutex
+	identities map[string]map[string]Identity
+}
+
+// OpenIdentityMap loads the identity map stored at path, starting empty if
+// the file does not exist yet
+func OpenIdentityMap(path string) (*IdentityMap, error) {
+	m := &IdentityMap{file: &stateFile{path: path}}
+	if err := m.reloadLocked(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// NewMemoryIdentityMap creates an identity map that is never written to disk
+func NewMemoryIdentityMap() *IdentityMap {
+	return &IdentityMap{identities: make(map[string]map[string]Identity)}
+}
+
+// Get returns the identity stored for a Sage record
+func (m *IdentityMap) Get(entity, code string) (Identity, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	refresh(m.file, m.reloadLocked)
+
+	identity, ok := m.identities[entity][code]
+	return identity, ok
+}
+
+// Put stores the identity of a Sage record and saves the map
+func (m *IdentityMap) Put(entity, code string, identity Identity) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.updateLocked(func() {
+		if m.identities[entity] == nil {
+			m.identities[entity] = make(map[string]Identity)
+		}
+		m.identities[entity][code] = identity
+	})
+}
+
+// Delete removes the identity of a Sage record and saves the map
+func (m *IdentityMap) Delete(entity, code string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.updateLocked(func() {
+		delete(m.identities[entity], code)
+	})
+}
+
+// All returns a copy of the identities stored for an entity type, keyed by
+// Sage code
+func (m *IdentityMap) All(entity string) map[string]Identity {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	refresh(m.file, m.reloadLocked)
+
+	identities := make(map[string]Identity, len(m.identities[entity]))
+	for code, identity := range m.identities[entity] {
+		identities[code] = identity
+	}
+	return identities
+}
+
+// updateLocked applies a change to the latest identities on disk and saves
+// them
+func (m *IdentityMap) updateLocked(apply func()) error {
+	if m.file == nil {
+		apply()
+		return nil
+	}
+
+	return m.file.update(m.reloadLocked, func() error {
+		apply()
+		return nil
+	}, &m.identities)
+}
+
+func (m *IdentityMap) reloadLocked() error {
+	identities := make(map[string]map[string]Identity)
+	if err := m.file.load(&identities); err != nil {
+		return fmt.Errorf("failed to load identity map: %w", err)
+	}
+
+	m.identities = identities
+	return nil
+}
+
+// readJSON decodes path into v, leaving v untouched if the file is missing
+func readJSON(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// writeJSON atomically replaces path with the JSON encoding of v
+func writeJSON(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
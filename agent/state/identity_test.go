@@ -0,0 +1,51 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIdentityMapPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "identities.json")
+
+	identities, err := OpenIdentityMap(path)
+	if err != nil {
+		t.Fatalf("OpenIdentityMap: %v", err)
+	}
+	if err := identities.Put("customer", "430000001", Identity{RemoteID: "12", Hash: "abc"}); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	reopened, err := OpenIdentityMap(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	identity, ok := reopened.Get("customer", "430000001")
+	if !ok || identity.RemoteID != "12" || identity.Hash != "abc" {
+		t.Errorf("Get = %+v, %t", identity, ok)
+	}
+
+	if err := reopened.Delete("customer", "430000001"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if len(reopened.All("customer")) != 0 {
+		t.Error("identity not deleted")
+	}
+}
+
+func TestIdentityMapReadsStoredBitrixIDs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "identities.json")
+	stored := `{"vendor": {"P00001": {"bitrix_id": "v-7", "synced_at": "2026-10-01T00:00:00Z"}}}`
+	if err := os.WriteFile(path, []byte(stored), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	identities, err := OpenIdentityMap(path)
+	if err != nil {
+		t.Fatalf("OpenIdentityMap: %v", err)
+	}
+	if identity, ok := identities.Get("vendor", "P00001"); !ok || identity.RemoteID != "v-7" {
+		t.Errorf("Get = %+v, %t, want the stored ID", identity, ok)
+	}
+}
@@ -0,0 +1,141 @@
+// agent/state/state.go
+package state
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// File names of the stores kept in the agent's state directory
+const (
+	IdentitiesFile  = "identities.json"
+	DeadLettersFile = "dead_letters.json"
+)
+
+// Lock file timing. A lock older than staleLockAge was left behind by a
+// process that died while writing and is broken.
+const (
+	lockRetryInterval = 10 * time.Millisecond
+	lockTimeout       = 10 * time.Second
+	staleLockAge      = time.Minute
+)
+
+// Open loads the identity map and dead-letter queue kept in dir, so the
+// tray agent and the CLI share the same sync state
+func Open(dir string) (*IdentityMap, *DeadLetterQueue, error) {
+	identities, err := OpenIdentityMap(filepath.Join(dir, IdentitiesFile))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	deadLetters, err := OpenDeadLetterQueue(filepath.Join(dir, DeadLettersFile))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return identities, deadLetters, nil
+}
+
+// stateFile is a JSON file shared by the processes of an agent. Changes are
+// applied to the latest content under a lock file, so a CLI command and the
+// tray agent writing at the same time do not drop each other's changes.
+type stateFile struct {
+	path    string
+	modTime time.Time
+	size    int64
+}
+
+// load decodes the file into v and remembers which version was read
+func (f *stateFile) load(v interface{}) error {
+	if err := readJSON(f.path, v); err != nil {
+		return err
+	}
+
+	f.modTime, f.size = time.Time{}, 0
+	if info, err := os.Stat(f.path); err == nil {
+		f.modTime, f.size = info.ModTime(), info.Size()
+	}
+	return nil
+}
+
+// changed reports whether another process wrote the file since it was last
+// loaded or saved
+func (f *stateFile) changed() bool {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return !f.modTime.IsZero()
+	}
+	return !info.ModTime().Equal(f.modTime) || info.Size() != f.size
+}
+
+// update locks the file, reloads it through reload, applies the change and
+// writes v back
+func (f *stateFile) update(reload func() error, apply func() error, v interface{}) error {
+	unlock, err := lockFile(f.path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := reload(); err != nil {
+		return err
+	}
+	if err := apply(); err != nil {
+		return err
+	}
+
+	if err := writeJSON(f.path, v); err != nil {
+		return err
+	}
+	if info, err := os.Stat(f.path); err == nil {
+		f.modTime, f.size = info.ModTime(), info.Size()
+	}
+	return nil
+}
+
+// refresh reloads a store written by another process before it is read.
+// A store that cannot be reloaded keeps serving what it last read.
+func refresh(f *stateFile, reload func() error) {
+	if f == nil || !f.changed() {
+		return
+	}
+	if err := reload(); err != nil {
+		slog.Warn("Failed to reload sync state", "path", f.path, "error", err)
+	}
+}
+
+// lockFile takes the lock file next to path, waiting for other processes
+// to release it, and returns the function that releases it
+func lockFile(path string) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	lockPath := path + ".lock"
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		file, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			fmt.Fprintf(file, "%d\n", os.Getpid())
+			file.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+		}
+
+		if info, err := os.Stat(lockPath); err == nil && time.Since(info.ModTime()) > staleLockAge {
+			slog.Warn("Breaking stale sync state lock", "path", lockPath)
+			os.Remove(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for the lock on %s", path)
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
@@ -0,0 +1,83 @@
+package state
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOpenStoresShareChanges(t *testing.T) {
+	dir := t.TempDir()
+
+	// The tray agent and a CLI command hold the same files open.
+	trayIdentities, trayLetters, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	cliIdentities, cliLetters, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	if err := trayIdentities.Put("customer", "430000001", Identity{RemoteID: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cliIdentities.Put("customer", "430000002", Identity{RemoteID: "2"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := trayLetters.RecordFailure("customer", "430000003", "Vila", errors.New("timeout")); err != nil {
+		t.Fatal(err)
+	}
+	if err := cliLetters.Discard("customer", "430000003"); err != nil {
+		t.Fatalf("Discard of a letter recorded by the other process: %v", err)
+	}
+	if _, err := cliLetters.RecordFailure("customer", "430000004", "Roca", errors.New("timeout")); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, letters, err := Open(dir)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	if got := len(reopened.All("customer")); got != 2 {
+		t.Errorf("identities on disk = %d, want both writers' entries", got)
+	}
+	if list := letters.List(); len(list) != 1 || list[0].Code != "430000004" {
+		t.Errorf("dead letters on disk = %+v", list)
+	}
+
+	// Each process reads what the other wrote.
+	if _, ok := trayIdentities.Get("customer", "430000002"); !ok {
+		t.Error("tray does not see the identity written by the CLI")
+	}
+	if _, ok := trayLetters.Get("customer", "430000003"); ok {
+		t.Error("tray still sees the letter discarded by the CLI")
+	}
+}
+
+func TestLockFileBreaksStaleLocks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), IdentitiesFile)
+
+	unlock, err := lockFile(path)
+	if err != nil {
+		t.Fatalf("lockFile: %v", err)
+	}
+	// A process that died while writing leaves its lock behind.
+	old := time.Now().Add(-2 * staleLockAge)
+	if err := os.Chtimes(path+".lock", old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	again, err := lockFile(path)
+	if err != nil {
+		t.Fatalf("lockFile over a stale lock: %v", err)
+	}
+	again()
+	unlock()
+
+	if _, err := os.Stat(path + ".lock"); !os.IsNotExist(err) {
+		t.Errorf("lock file left behind: %v", err)
+	}
+}
@@ -0,0 +1,259 @@
+// agent/tickelia/client.go
+package tickelia
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"saas-sync-platform/agent/metrics"
+	"saas-sync-platform/agent/normalize"
+	"saas-sync-platform/internal/shared"
+)
+
+// Actions reported by UpsertVendor, matching those of the Bitrix24 client;
+// ActionSkip is reported by callers for vendors unchanged since the last
+// push
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionSkip   = "skip"
+)
+
+// ErrVendorNotFound is returned when no Tickelia vendor has a given code
+var ErrVendorNotFound = errors.New("vendor not found")
+
+// Client handles communication with the Tickelia REST API
+type Client struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+	logger     *slog.Logger
+	metrics    *metrics.Metrics
+}
+
+// NewClient creates a Tickelia API client authenticated by API key
+func NewClient(config *shared.TickeliaConfig) *Client {
+	return &Client{
+		baseURL:    strings.TrimSuffix(config.APIEndpoint, "/"),
+		apiKey:     config.APIKey,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		logger:     slog.Default(),
+	}
+}
+
+// WithLogger returns a copy of the client that logs through logger
+func (c *Client) WithLogger(logger *slog.Logger) *Client {
+	clone := *c
+	clone.logger = logger
+	return &clone
+}
+
+// WithMetrics returns a copy of the client that counts API errors in m
+func (c *Client) WithMetrics(m *metrics.Metrics) *Client {
+	clone := *c
+	clone.metrics = m
+	return &clone
+}
+
+// Vendor is an expense vendor (proveedor) in Tickelia. Code holds the Sage
+// supplier code and identifies the vendor across syncs.
+type Vendor struct {
+	ID         string `json:"id,omitempty"`
+	Code       string `json:"code"`
+	Name       string `json:"name"`
+	TaxID      string `json:"tax_id,omitempty"`
+	Email      string `json:"email,omitempty"`
+	Phone      string `json:"phone,omitempty"`
+	Address    string `json:"address,omitempty"`
+	City       string `json:"city,omitempty"`
+	PostalCode string `json:"postal_code,omitempty"`
+	Country    string `json:"country,omitempty"`
+}
+
+// APIError is an error response of the Tickelia API
+type APIError struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("Tickelia API error %d %s: %s", e.Status, e.Code, e.Message)
+}
+
+// VendorPayload returns the vendor of a Sage supplier, with its first valid
+// phone and email normalised
+func VendorPayload(supplier *shared.Supplier) *Vendor {
+	vendor := &Vendor{
+		Code:       supplier.Code,
+		Name:       supplier.Name,
+		TaxID:      supplier.TaxNumber,
+		Address:    supplier.Address,
+		City:       supplier.City,
+		PostalCode: supplier.PostalCode,
+		Country:    supplier.Country,
+	}
+
+	info := normalize.Supplier(supplier)
+	if len(info.Phones) > 0 {
+		vendor.Phone = info.Phones[0].Number
+	}
+	if len(info.Emails) > 0 {
+		vendor.Email = info.Emails[0]
+	}
+
+	return vendor
+}
+
+// VendorHash returns a hash of a vendor payload, used to skip vendors
+// unchanged since the last push
+func VendorHash(vendor *Vendor) string {
+	data, err := json.Marshal(vendor)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// UpsertVendor updates the vendor with the given ID, or finds the vendor by
+// code when vendorID is empty, creating it if none exists. It returns the
+// vendor ID and ActionCreate or ActionUpdate.
+func (c *Client) UpsertVendor(vendor *Vendor, vendorID string) (string, string, error) {
+	if vendorID == "" {
+		existing, err := c.FindVendor(vendor.Code)
+		if err != nil && !errors.Is(err, ErrVendorNotFound) {
+			return "", ActionCreate, err
+		}
+		vendorID = existing
+	}
+
+	var saved Vendor
+	action := ActionUpdate
+	if vendorID == "" {
+		action = ActionCreate
+		if err := c.doRequest(http.MethodPost, "/vendors", vendor, &saved); err != nil {
+			return "", action, fmt.Errorf("failed to create vendor %s: %w", vendor.Code, err)
+		}
+	} else {
+		if err := c.doRequest(http.MethodPut, "/vendors/"+url.PathEscape(vendorID), vendor, &saved); err != nil {
+			return vendorID, action, fmt.Errorf("failed to update vendor %s: %w", vendor.Code, err)
+		}
+		if saved.ID == "" {
+			saved.ID = vendorID
+		}
+	}
+
+	c.logger.Info("Synced Tickelia vendor", "supplier_code", vendor.Code,
+		"vendor_id", saved.ID, "action", action)
+	return saved.ID, action, nil
+}
+
+// FindVendor returns the ID of the vendor with the given code
+func (c *Client) FindVendor(code string) (string, error) {
+	var page struct {
+		Data []Vendor `json:"data"`
+	}
+	if err := c.doRequest(http.MethodGet, "/vendors?code="+url.QueryEscape(code), nil, &page); err != nil {
+		return "", fmt.Errorf("failed to search vendor: %w", err)
+	}
+	for _, vendor := range page.Data {
+		if vendor.Code == code {
+			return vendor.ID, nil
+		}
+	}
+	return "", ErrVendorNotFound
+}
+
+// TestConnection verifies the API endpoint and key
+func (c *Client) TestConnection() error {
+	var page struct {
+		Data []Vendor `json:"data"`
+	}
+	if err := c.doRequest(http.MethodGet, "/vendors?limit=1", nil, &page); err != nil {
+		return fmt.Errorf("Tickelia connection test failed: %w", err)
+	}
+
+	c.logger.Info("Tickelia connection test successful")
+	return nil
+}
+
+// doRequest performs a single HTTP call to the Tickelia API, decoding the
+// JSON response into result
+func (c *Client) doRequest(method, path string, body, result interface{}) (err error) {
+	defer func() {
+		if err != nil {
+			c.metrics.Error(metrics.SourceTickelia, errorCode(err))
+		}
+	}()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request data: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := &APIError{Status: resp.StatusCode}
+		if json.Unmarshal(data, apiErr) != nil || apiErr.Message == "" {
+			apiErr.Message = strings.TrimSpace(string(data))
+		}
+		return apiErr
+	}
+
+	if result == nil || len(data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, result); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
+
+// errorCode returns the error code of err for metrics: the API code, the
+// HTTP status, or a generic code for transport failures
+func errorCode(err error) string {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		if apiErr.Code != "" {
+			return apiErr.Code
+		}
+		return "HTTP_" + strconv.Itoa(apiErr.Status)
+	}
+	return "REQUEST_FAILED"
+}
@@ -0,0 +1,62 @@
+package tickelia
+
+import (
+	"errors"
+	"testing"
+
+	"saas-sync-platform/agent/tickelia/tickeliatest"
+	"saas-sync-platform/internal/shared"
+)
+
+func newTestClient(t *testing.T) (*Client, *tickeliatest.Server) {
+	t.Helper()
+
+	server := tickeliatest.NewServer("secret")
+	t.Cleanup(server.Close)
+
+	client := NewClient(&shared.TickeliaConfig{APIEndpoint: server.URL + "/", APIKey: "secret"})
+	return client, server
+}
+
+func TestUpsertVendorCreatesThenFindsByCode(t *testing.T) {
+	client, server := newTestClient(t)
+	vendor := VendorPayload(&shared.Supplier{Code: "400000001", Name: "Transportes Vidal SL",
+		TaxNumber: "B12345678", Phone: "93 123 45 67", Email: "Admin@Vidal.es", Country: "ES"})
+
+	id, action, err := client.UpsertVendor(vendor, "")
+	if err != nil {
+		t.Fatalf("UpsertVendor: %v", err)
+	}
+	if action != ActionCreate || id == "" {
+		t.Errorf("action = %s, id = %q, want create with an ID", action, id)
+	}
+
+	vendor.Name = "Transportes Vidal SLU"
+	again, action, err := client.UpsertVendor(vendor, "")
+	if err != nil {
+		t.Fatalf("second UpsertVendor: %v", err)
+	}
+	if again != id || action != ActionUpdate {
+		t.Errorf("second upsert = %s %s, want update of %s", again, action, id)
+	}
+
+	vendors := server.Vendors()
+	if len(vendors) != 1 {
+		t.Fatalf("vendors = %d, want 1", len(vendors))
+	}
+	if got := vendors[0]; got["name"] != "Transportes Vidal SLU" || got["phone"] != "+34931234567" ||
+		got["email"] != "admin@vidal.es" || got["tax_id"] != "B12345678" {
+		t.Errorf("vendor = %v", got)
+	}
+}
+
+func TestInvalidAPIKeyIsReported(t *testing.T) {
+	client, _ := newTestClient(t)
+	client.apiKey = "wrong"
+
+	err := client.TestConnection()
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Status != 401 || errorCode(err) != "unauthorized" {
+		t.Errorf("TestConnection error = %v, want a 401 API error", err)
+	}
+}
@@ -0,0 +1,177 @@
+// agent/tickelia/tickeliatest/server.go
+
+// Package tickeliatest provides an in-process fake of the Tickelia vendor
+// API so tickelia.Client can be exercised without a live account.
+package tickeliatest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Server is a stateful fake Tickelia API holding vendors.
+type Server struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	apiKey  string                            // bearer token requests must carry
+	vendors map[string]map[string]interface{} // by ID
+	nextID  int
+	calls   []string
+}
+
+// NewServer starts a fake API accepting apiKey and supporting GET, POST
+// and PUT on /vendors.
+func NewServer(apiKey string) *Server {
+	s := &Server{
+		apiKey:  apiKey,
+		vendors: make(map[string]map[string]interface{}),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// SetAPIKey changes the API key requests must carry, e.g. to simulate a
+// revoked key.
+func (s *Server) SetAPIKey(apiKey string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.apiKey = apiKey
+}
+
+// Seed stores a vendor and returns its ID.
+func (s *Server) Seed(vendor map[string]interface{}) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.add(vendor)
+}
+
+// Vendors returns a copy of every vendor ordered by ID.
+func (s *Server) Vendors() []map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]string, 0, len(s.vendors))
+	for id := range s.vendors {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, _ := strconv.Atoi(ids[i])
+		b, _ := strconv.Atoi(ids[j])
+		return a < b
+	})
+
+	vendors := make([]map[string]interface{}, len(ids))
+	for i, id := range ids {
+		vendors[i] = copyVendor(s.vendors[id])
+	}
+	return vendors
+}
+
+// CallCount returns how many requests were received for "<METHOD> <path>",
+// e.g. "PUT /vendors/1"; the query string is not part of the path.
+func (s *Server) CallCount(call string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for _, c := range s.calls {
+		if c == call {
+			count++
+		}
+	}
+	return count
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls = append(s.calls, r.Method+" "+r.URL.Path)
+
+	if r.Header.Get("Authorization") != "Bearer "+s.apiKey {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"code": "unauthorized", "message": "Invalid API key"})
+		return
+	}
+
+	id, hasID := strings.CutPrefix(r.URL.Path, "/vendors/")
+	switch {
+	case r.URL.Path == "/vendors" && r.Method == http.MethodGet:
+		code := r.URL.Query().Get("code")
+		data := []map[string]interface{}{}
+		for _, vendor := range s.vendors {
+			if code == "" || vendor["code"] == code {
+				data = append(data, copyVendor(vendor))
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"data": data})
+
+	case r.URL.Path == "/vendors" && r.Method == http.MethodPost:
+		vendor, ok := readVendor(w, r)
+		if !ok {
+			return
+		}
+		id := s.add(vendor)
+		writeJSON(w, http.StatusCreated, s.vendors[id])
+
+	case hasID && r.Method == http.MethodPut:
+		if _, ok := s.vendors[id]; !ok {
+			writeJSON(w, http.StatusNotFound, map[string]string{"code": "not_found", "message": "Vendor not found"})
+			return
+		}
+		vendor, ok := readVendor(w, r)
+		if !ok {
+			return
+		}
+		vendor["id"] = id
+		s.vendors[id] = vendor
+		writeJSON(w, http.StatusOK, vendor)
+
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]string{"code": "not_found", "message": "Unknown endpoint"})
+	}
+}
+
+// add stores a new vendor under the next ID. The caller must hold s.mu.
+func (s *Server) add(vendor map[string]interface{}) string {
+	s.nextID++
+	id := strconv.Itoa(s.nextID)
+	stored := copyVendor(vendor)
+	stored["id"] = id
+	s.vendors[id] = stored
+	return id
+}
+
+func readVendor(w http.ResponseWriter, r *http.Request) (map[string]interface{}, bool) {
+	var vendor map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&vendor); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"code": "invalid_json", "message": err.Error()})
+		return nil, false
+	}
+	if code, _ := vendor["code"].(string); code == "" {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"code": "validation_error", "message": "code is required"})
+		return nil, false
+	}
+	return vendor, true
+}
+
+func copyVendor(vendor map[string]interface{}) map[string]interface{} {
+	clone := make(map[string]interface{}, len(vendor))
+	for key, value := range vendor {
+		clone[key] = value
+	}
+	return clone
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,412 @@
+// cmd/sagesync/commands.go
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+
+	"saas-sync-platform/agent/bitrix24"
+	"saas-sync-platform/agent/engine"
+	"saas-sync-platform/agent/sage"
+	"saas-sync-platform/agent/state"
+	"saas-sync-platform/agent/tickelia"
+	"saas-sync-platform/internal/logging"
+	"saas-sync-platform/internal/shared"
+)
+
+// entityCustomer is the identity map entity type whose contacts resync
+// reports
+const entityCustomer = "customer"
+
+// connectionCheck is the outcome of testing one connection
+type connectionCheck struct {
+	OK    bool                   `json:"ok"`
+	Error string                 `json:"error,omitempty"`
+	Info  map[string]interface{} `json:"info,omitempty"`
+}
+
+// resyncResult is the outcome of resyncing one customer
+type resyncResult struct {
+	Code      string `json:"code"`
+	Action    string `json:"action,omitempty"`
+	ContactID string `json:"contact_id,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// validationResult lists every problem found in the configuration
+type validationResult struct {
+	Valid  bool     `json:"valid"`
+	Errors []string `json:"errors"`
+}
+
+// test checks the Sage and, when configured, Bitrix24 connections
+func (c *cli) test(args []string) (interface{}, error) {
+	if err := c.parseFlags("test", args, nil); err != nil {
+		return nil, err
+	}
+
+	checks := map[string]*connectionCheck{}
+	failed := false
+
+	connector := sage.NewConnector(&c.config.Database)
+	sageCheck := &connectionCheck{}
+	checks["sage"] = sageCheck
+	if err := connector.Connect(); err != nil {
+		sageCheck.Error = logging.Redact(err.Error())
+	} else {
+		defer connector.Close()
+		if info, err := connector.GetDatabaseInfo(); err != nil {
+			sageCheck.Error = logging.Redact(err.Error())
+		} else {
+			sageCheck.OK = true
+			sageCheck.Info = info
+		}
+	}
+	failed = failed || !sageCheck.OK
+
+	if c.config.Bitrix24 != nil {
+		bitrixCheck := &connectionCheck{}
+		checks["bitrix24"] = bitrixCheck
+
+		client, err := c.bitrix24Client()
+		if err == nil {
+			err = client.TestConnection()
+		}
+		if err != nil {
+			bitrixCheck.Error = logging.Redact(err.Error())
+		} else {
+			bitrixCheck.OK = true
+		}
+		failed = failed || !bitrixCheck.OK
+	}
+
+	if failed {
+		return checks, errors.New("connection test failed")
+	}
+	return checks, nil
+}
+
+// sync runs one customer sync cycle, or previews it with -dry-run
+func (c *cli) sync(args []string) (interface{}, error) {
+	var dryRun bool
+	var since string
+	err := c.parseFlags("sync", args, func(flags *flag.FlagSet) {
+		flags.BoolVar(&dryRun, "dry-run", c.config.SyncSettings.DryRun, "print the planned changes without writing to Bitrix24")
+		flags.StringVar(&since, "since", "", "read changes since this RFC 3339 time or duration ago (default 24h)")
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sinceTime, err := parseSince(since)
+	if err != nil {
+		return nil, err
+	}
+
+	syncEngine, closeEngine, err := c.newEngine()
+	if err != nil {
+		return nil, err
+	}
+	defer closeEngine()
+
+	if dryRun {
+		if sinceTime.IsZero() {
+			sinceTime = time.Now().Add(-24 * time.Hour)
+		}
+		report, err := syncEngine.Preview(sinceTime)
+		if err != nil {
+			return nil, err
+		}
+		return report, nil
+	}
+
+	syncEngine.SetLastSync(sinceTime)
+	return syncEngine.SyncCustomers()
+}
+
+// resync pushes the given customers even if they are unchanged
+func (c *cli) resync(args []string) (interface{}, error) {
+	codes, err := c.parseArgs("resync", args, 1, -1, "CODE...")
+	if err != nil {
+		return nil, err
+	}
+
+	syncEngine, closeEngine, err := c.newEngine()
+	if err != nil {
+		return nil, err
+	}
+	defer closeEngine()
+
+	results := make([]resyncResult, 0, len(codes))
+	failed := 0
+	for _, code := range codes {
+		result := resyncResult{Code: code}
+
+		action, err := syncEngine.ResyncCustomer(code)
+		if err != nil {
+			result.Error = logging.Redact(err.Error())
+			failed++
+		} else {
+			result.Action = action
+			if identity, ok := syncEngine.Identities.Get(entityCustomer, code); ok {
+				result.ContactID = identity.RemoteID
+			}
+		}
+		results = append(results, result)
+	}
+
+	if failed > 0 {
+		return results, fmt.Errorf("%d of %d customers failed", failed, len(codes))
+	}
+	return results, nil
+}
+
+// reconcile reports, and with -fix repairs, drift between Sage customers
+// and Bitrix24 contacts
+func (c *cli) reconcile(args []string) (interface{}, error) {
+	var fix bool
+	err := c.parseFlags("reconcile", args, func(flags *flag.FlagSet) {
+		flags.BoolVar(&fix, "fix", false, "push missing and mismatched customers and repair the identity map")
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	syncEngine, closeEngine, err := c.newEngine()
+	if err != nil {
+		return nil, err
+	}
+	defer closeEngine()
+
+	report, err := syncEngine.Reconcile(fix)
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// showConfig prints the merged JSON and environment configuration
+func (c *cli) showConfig(args []string) (interface{}, error) {
+	if err := c.parseFlags("config", args, nil); err != nil {
+		return nil, err
+	}
+	return shared.RedactedConfig(c.config), nil
+}
+
+// validate checks the configuration and company mappings without
+// connecting to anything
+func (c *cli) validate(args []string) (interface{}, error) {
+	if err := c.parseFlags("validate", args, nil); err != nil {
+		return nil, err
+	}
+
+	result := &validationResult{Errors: []string{}}
+	if err := shared.ValidateConfig(c.config); err != nil {
+		result.Errors = append(result.Errors, err.Error())
+	}
+	result.Errors = append(result.Errors, validateMappings(c.config.Companies)...)
+
+	if len(result.Errors) > 0 {
+		return result, errors.New("configuration is invalid")
+	}
+	result.Valid = true
+	return result, nil
+}
+
+// validateMappings reports incomplete and duplicated company mappings
+func validateMappings(mappings []shared.CompanyMapping) []string {
+	var problems []string
+	seenSage := make(map[string]int)
+	seenBitrix := make(map[string]int)
+
+	for i, mapping := range mappings {
+		n := i + 1
+		if mapping.SageCompany == "" {
+			problems = append(problems, fmt.Sprintf("company mapping %d has no Sage company", n))
+		} else if first, ok := seenSage[mapping.SageCompany]; ok {
+			problems = append(problems, fmt.Sprintf("company mapping %d repeats Sage company %s of mapping %d", n, mapping.SageCompany, first))
+		} else {
+			seenSage[mapping.SageCompany] = n
+		}
+
+		if mapping.BitrixCompany == "" {
+			problems = append(problems, fmt.Sprintf("company mapping %d has no Bitrix24 company", n))
+		} else if first, ok := seenBitrix[mapping.BitrixCompany]; ok {
+			problems = append(problems, fmt.Sprintf("company mapping %d repeats Bitrix24 company %s of mapping %d", n, mapping.BitrixCompany, first))
+		} else {
+			seenBitrix[mapping.BitrixCompany] = n
+		}
+	}
+
+	return problems
+}
+
+// deadLetters lists, replays, requeues or discards failed records
+func (c *cli) deadLetters(args []string) (interface{}, error) {
+	action := "list"
+	if len(args) > 0 {
+		action, args = args[0], args[1:]
+	}
+
+	switch action {
+	case "list", "replay", "requeue", "discard":
+	default:
+		return nil, fmt.Errorf("unknown dead-letters action %q", action)
+	}
+
+	if action == "list" {
+		if _, err := c.parseArgs("dead-letters list", args, 0, 0, ""); err != nil {
+			return nil, err
+		}
+		_, deadLetters, err := c.openState()
+		if err != nil {
+			return nil, err
+		}
+		return deadLetters.List(), nil
+	}
+
+	keys, err := c.parseArgs("dead-letters "+action, args, 2, 2, "ENTITY CODE")
+	if err != nil {
+		return nil, err
+	}
+	entity, code := keys[0], keys[1]
+
+	switch action {
+	case "replay":
+		syncEngine, closeEngine, err := c.newEngine()
+		if err != nil {
+			return nil, err
+		}
+		defer closeEngine()
+
+		if err := syncEngine.ReplayDeadLetter(entity, code); err != nil {
+			return nil, err
+		}
+
+	case "requeue", "discard":
+		_, deadLetters, err := c.openState()
+		if err != nil {
+			return nil, err
+		}
+
+		change := deadLetters.Requeue
+		if action == "discard" {
+			change = deadLetters.Discard
+		}
+		if err := change(entity, code); err != nil {
+			return nil, err
+		}
+	}
+
+	return map[string]string{"entity": entity, "code": code, "action": action, "status": "ok"}, nil
+}
+
+// newEngine connects to Sage and Bitrix24 and loads the agent's sync state.
+// The returned function closes the Sage connection.
+func (c *cli) newEngine() (*engine.Engine, func(), error) {
+	if err := shared.ValidateConfig(c.config); err != nil {
+		return nil, nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	identities, deadLetters, err := c.openState()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var client *bitrix24.Client
+	if c.config.Bitrix24 != nil {
+		if client, err = c.bitrix24Client(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	connector := sage.NewConnector(&c.config.Database)
+	if err := connector.Connect(); err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to Sage database: %w", err)
+	}
+
+	syncEngine := engine.NewEngine(c.config.ClientCode, connector, client)
+	syncEngine.ReportDir = filepath.Join(c.configLoader.DataDir(), "reports")
+	syncEngine.Identities = identities
+	syncEngine.DeadLetters = deadLetters
+	if len(c.config.Companies) > 0 {
+		syncEngine.Company = c.config.Companies[0].SageCompany
+	}
+	if c.config.Bitrix24 != nil && c.config.Bitrix24.Deals != nil {
+		syncEngine.CreateSageOrders = c.config.Bitrix24.Deals.CreateOrders
+	}
+	if c.config.Tickelia != nil {
+		syncEngine.Tickelia = tickelia.NewClient(c.config.Tickelia)
+	}
+
+	return syncEngine, func() { connector.Close() }, nil
+}
+
+// openState loads the identity map and dead-letter queue of the agent
+func (c *cli) openState() (*state.IdentityMap, *state.DeadLetterQueue, error) {
+	return state.Open(filepath.Join(c.configLoader.DataDir(), "state"))
+}
+
+// bitrix24Client creates a webhook or OAuth client. The OAuth application
+// must have been installed through the tray agent.
+func (c *cli) bitrix24Client() (*bitrix24.Client, error) {
+	if !c.config.Bitrix24.UsesOAuth() {
+		return bitrix24.NewClient(c.config.Bitrix24), nil
+	}
+
+	store := bitrix24.NewFileTokenStore(
+		filepath.Join(c.configLoader.DataDir(), bitrix24.TokenFileName),
+		c.configLoader.Secrets(),
+	)
+
+	client, err := bitrix24.NewOAuthClient(c.config.Bitrix24, store)
+	if errors.Is(err, bitrix24.ErrNotInstalled) {
+		return nil, fmt.Errorf("%w: install it from the tray agent first", err)
+	}
+	return client, err
+}
+
+// parseFlags parses a subcommand's flags, rejecting positional arguments
+func (c *cli) parseFlags(name string, args []string, define func(*flag.FlagSet)) error {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	if define != nil {
+		define(flags)
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("%s: unexpected arguments %v", name, flags.Args())
+	}
+	return nil
+}
+
+// parseArgs checks the number of positional arguments; maxArgs < 0 means no
+// upper limit
+func (c *cli) parseArgs(name string, args []string, minArgs, maxArgs int, synopsis string) ([]string, error) {
+	if len(args) < minArgs || (maxArgs >= 0 && len(args) > maxArgs) {
+		return nil, fmt.Errorf("usage: sagesync %s %s", name, synopsis)
+	}
+	return args, nil
+}
+
+// parseSince accepts an RFC 3339 time or a duration before now. An empty
+// value returns the zero time.
+func parseSince(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid -since %q: use an RFC 3339 time or a duration such as 48h", value)
+}
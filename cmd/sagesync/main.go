@@ -0,0 +1,145 @@
+// cmd/sagesync/main.go
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"saas-sync-platform/internal/logging"
+	"saas-sync-platform/internal/shared"
+
+	_ "github.com/microsoft/go-mssqldb"
+)
+
+const usage = `Usage: sagesync [flags] <command> [arguments]
+
+Commands:
+  test                               Test the Sage and Bitrix24 connections
+  sync [-dry-run] [-since T]         Run one customer sync cycle
+  resync CODE...                     Push customers to Bitrix24 even if unchanged
+  reconcile [-fix]                   Compare all Sage customers with all Bitrix24 contacts
+  config                             Print the effective configuration, secrets redacted
+  validate                           Validate the configuration and company mappings
+  dead-letters [list]                List records waiting for retry
+  dead-letters replay ENTITY CODE    Retry a failed record now
+  dead-letters requeue ENTITY CODE   Make a failed record due at the next cycle
+  dead-letters discard ENTITY CODE   Drop a failed record without retrying it
+
+ENTITY is the entity type shown by dead-letters list, such as customer,
+address, sales_order or stock.
+
+Results are written to stdout as JSON; logs go to stderr.
+
+Flags:
+`
+
+// command runs a subcommand and returns the value to print
+type command func(c *cli, args []string) (interface{}, error)
+
+var commands = map[string]command{
+	"test":         (*cli).test,
+	"sync":         (*cli).sync,
+	"resync":       (*cli).resync,
+	"reconcile":    (*cli).reconcile,
+	"config":       (*cli).showConfig,
+	"validate":     (*cli).validate,
+	"dead-letters": (*cli).deadLetters,
+}
+
+// cli holds the configuration shared by all subcommands
+type cli struct {
+	configLoader *shared.ConfigLoader
+	config       *shared.AgentConfig
+	out          io.Writer
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	configPath, envPath := defaultConfigPaths()
+
+	flags := flag.NewFlagSet("sagesync", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&configPath, "config", configPath, "path of the JSON configuration file")
+	flags.StringVar(&envPath, "env", envPath, "path of the .env file")
+	verbose := flags.Bool("v", false, "log at debug level")
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	name := flags.Arg(0)
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(stderr, "sagesync: unknown command %q\n\n", name)
+		flags.Usage()
+		return 2
+	}
+
+	c := &cli{
+		configLoader: shared.NewConfigLoader(configPath, envPath),
+		out:          stdout,
+	}
+
+	config, err := c.configLoader.LoadConfig()
+	if err != nil {
+		return c.fail(fmt.Errorf("failed to load configuration: %w", err))
+	}
+	c.config = config
+
+	level := config.SyncSettings.LogLevel
+	if *verbose {
+		level = "debug"
+	}
+	if _, _, err := logging.Setup(logging.Options{Level: level, Format: config.SyncSettings.LogFormat}); err != nil {
+		return c.fail(err)
+	}
+
+	result, err := cmd(c, flags.Args()[1:])
+	if result != nil {
+		if printErr := c.print(result); printErr != nil {
+			return c.fail(printErr)
+		}
+	}
+	if err != nil {
+		// Commands that printed a result already describe the failure
+		if result == nil {
+			return c.fail(err)
+		}
+		return 1
+	}
+
+	return 0
+}
+
+// defaultConfigPaths picks the same configuration files as the tray agent
+func defaultConfigPaths() (configPath, envPath string) {
+	if os.Getenv("ENV") == "development" {
+		return shared.GetDevelopmentConfigPaths()
+	}
+	return shared.GetDefaultConfigPaths()
+}
+
+func (c *cli) print(value interface{}) error {
+	encoder := json.NewEncoder(c.out)
+	encoder.SetIndent("", "    ")
+	return encoder.Encode(value)
+}
+
+func (c *cli) fail(err error) int {
+	c.print(map[string]string{"error": logging.Redact(err.Error())})
+	return 1
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"saas-sync-platform/agent/state"
+)
+
+const testConfig = `{
+    "CodigoCliente": "TEST",
+    "DB": {"DB_Host": "sage.local", "DB_Port": "1433", "DB_Database": "Sage", "DB_Username": "sa", "DB_Password": "hunter2"},
+    "Bitrix24": {"API_Tenant": "https://portal.bitrix24.es/rest/1/webhooksecret/"},
+    "Empresas": [
+        {"EmpresaBitrix": "10", "EmpresaSage": "1"},
+        {"EmpresaBitrix": "", "EmpresaSage": "1"}
+    ]
+}`
+
+func runCLI(t *testing.T, args ...string) (int, string) {
+	t.Helper()
+	return runCLIIn(t, t.TempDir(), args...)
+}
+
+// runCLIIn runs the CLI with its configuration and state in dir
+func runCLIIn(t *testing.T, dir string, args ...string) (int, string) {
+	t.Helper()
+
+	configPath := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(configPath, []byte(testConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	args = append([]string{"-config", configPath, "-env", filepath.Join(dir, "missing.env")}, args...)
+	code := run(args, &stdout, &stderr)
+	return code, stdout.String()
+}
+
+func TestConfigCommandRedactsSecrets(t *testing.T) {
+	code, out := runCLI(t, "config")
+	if code != 0 {
+		t.Fatalf("exit code = %d, output %s", code, out)
+	}
+
+	for _, secret := range []string{"hunter2", "webhooksecret", "enc:"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("output contains %q:\n%s", secret, out)
+		}
+	}
+	if !strings.Contains(out, `"CodigoCliente": "TEST"`) {
+		t.Errorf("output missing client code:\n%s", out)
+	}
+}
+
+func TestValidateCommandReportsMappingProblems(t *testing.T) {
+	code, out := runCLI(t, "validate")
+	if code != 1 {
+		t.Fatalf("exit code = %d, want 1", code)
+	}
+
+	var result validationResult
+	if err := json.Unmarshal([]byte(out), &result); err != nil {
+		t.Fatalf("invalid JSON output %q: %v", out, err)
+	}
+	if result.Valid || len(result.Errors) != 2 {
+		t.Errorf("result = %+v, want two mapping errors", result)
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	if code, _ := runCLI(t, "frobnicate"); code != 2 {
+		t.Errorf("exit code = %d, want 2", code)
+	}
+	if code, out := runCLI(t, "dead-letters", "frobnicate", "X"); code != 1 || !strings.Contains(out, "unknown dead-letters action") {
+		t.Errorf("exit code = %d, output %s", code, out)
+	}
+}
+
+func TestDeadLettersOfAnyEntity(t *testing.T) {
+	dir := t.TempDir()
+	_, deadLetters, err := state.Open(filepath.Join(dir, "state"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := deadLetters.Park("stock", "TORN-M6", "TORN-M6", errors.New("boom")); err != nil {
+		t.Fatal(err)
+	}
+
+	if code, out := runCLIIn(t, dir, "dead-letters", "requeue", "TORN-M6"); code != 1 || !strings.Contains(out, "ENTITY CODE") {
+		t.Errorf("requeue without entity: exit code = %d, output %s", code, out)
+	}
+	if code, out := runCLIIn(t, dir, "dead-letters", "requeue", "stock", "TORN-M6"); code != 0 {
+		t.Fatalf("requeue: exit code = %d, output %s", code, out)
+	}
+	if letter, ok := deadLetters.Get("stock", "TORN-M6"); !ok || letter.Parked {
+		t.Errorf("letter after requeue = %+v (%v), want it unparked", letter, ok)
+	}
+	if code, out := runCLIIn(t, dir, "dead-letters", "discard", "stock", "TORN-M6"); code != 0 {
+		t.Fatalf("discard: exit code = %d, output %s", code, out)
+	}
+	if _, ok := deadLetters.Get("stock", "TORN-M6"); ok {
+		t.Error("letter still queued after discard")
+	}
+}
@@ -2,26 +2,61 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
 	"time"
 
 	"saas-sync-platform/agent/bitrix24"
+	"saas-sync-platform/agent/control"
+	"saas-sync-platform/agent/engine"
+	"saas-sync-platform/agent/metrics"
 	"saas-sync-platform/agent/sage"
+	"saas-sync-platform/agent/state"
+	"saas-sync-platform/agent/tickelia"
+	"saas-sync-platform/internal/logging"
 	"saas-sync-platform/internal/shared"
 
-	_ "github.com/denisenkom/go-mssqldb"
 	"github.com/getlantern/systray"
+	_ "github.com/microsoft/go-mssqldb"
 )
 
+// maxResults is how many sync results the control API keeps
+const maxResults = 20
+
 type TrayAgent struct {
 	config         *shared.AgentConfig
 	configLoader   *shared.ConfigLoader
 	sageConnector  *sage.Connector
 	bitrix24Client *bitrix24.Client
+	engine         *engine.Engine
+	deadLetters    *state.DeadLetterQueue
 	isRunning      bool
-	lastSync       time.Time
+	installServer  *http.Server
+	logCloser      io.Closer
+	metrics        *metrics.Metrics
+	metricsServer  *http.Server
+	controlServer  *http.Server
+
+	// syncMu serializes sync cycles from the ticker and the control API
+	syncMu sync.Mutex
+	// mu guards the state read by the control API
+	mu         sync.Mutex
+	paused     bool
+	statusText string
+	results    []shared.SyncResult
 
 	// Menu items
 	mStatus *systray.MenuItem
@@ -33,7 +68,7 @@ type TrayAgent struct {
 }
 
 func main() {
-	log.Println("Starting Sage Sync Agent...")
+	slog.Info("Starting Sage Sync Agent")
 
 	// Run the system tray application
 	systray.Run(onReady, onExit)
@@ -42,7 +77,7 @@ func main() {
 func onReady() {
 	agent := &TrayAgent{}
 
-	log.Println("Initializing tray agent...")
+	slog.Info("Initializing tray agent")
 
 	// Initialize system tray UI
 	agent.initSystemTray()
@@ -54,13 +89,79 @@ func onReady() {
 		return
 	}
 
+	// Switch to structured logging now that the level and data dir are known
+	if err := agent.setupLogging(); err != nil {
+		agent.showError("Failed to set up logging: " + err.Error())
+	}
+
+	// Metrics are opt-in through SyncSettings.MetricsAddr
+	if err := agent.startMetrics(); err != nil {
+		agent.showError("Failed to start metrics endpoint: " + err.Error())
+	}
+
+	// The control API is opt-in through SyncSettings.ControlAddr
+	if err := agent.startControlAPI(); err != nil {
+		agent.showError("Failed to start control API: " + err.Error())
+	}
+
 	// Agent is ready
 	agent.updateStatus("Ready - Click 'Start Sync' to begin")
-	log.Printf("Sage Sync Agent ready for client: %s", agent.config.ClientCode)
+	slog.Info("Sage Sync Agent ready", "client_code", agent.config.ClientCode)
 }
 
 func onExit() {
-	log.Println("Sage Sync Agent shutting down...")
+	slog.Info("Sage Sync Agent shutting down")
+}
+
+func (a *TrayAgent) setupLogging() error {
+	_, closer, err := logging.Setup(logging.Options{
+		Level:  a.config.SyncSettings.LogLevel,
+		Format: a.config.SyncSettings.LogFormat,
+		Dir:    a.logDir(),
+	})
+	if err != nil {
+		return err
+	}
+
+	a.logCloser = closer
+	return nil
+}
+
+func (a *TrayAgent) startMetrics() error {
+	addr := a.config.SyncSettings.MetricsAddr
+	if addr == "" {
+		return nil
+	}
+
+	m := metrics.New()
+	server, err := m.Serve(addr)
+	if err != nil {
+		return err
+	}
+
+	a.metrics = m
+	a.metricsServer = server
+	return nil
+}
+
+func (a *TrayAgent) startControlAPI() error {
+	addr := a.config.SyncSettings.ControlAddr
+	if addr == "" {
+		return nil
+	}
+
+	logPath := filepath.Join(a.logDir(), logging.LogFileName)
+	server, err := control.NewServer(a, a.config.SyncSettings.ControlToken, logPath).Serve(addr)
+	if err != nil {
+		return err
+	}
+
+	a.controlServer = server
+	return nil
+}
+
+func (a *TrayAgent) logDir() string {
+	return filepath.Join(a.configLoader.DataDir(), "logs")
 }
 
 func (a *TrayAgent) initSystemTray() {
@@ -110,6 +211,15 @@ func (a *TrayAgent) handleMenuClicks() {
 			if a.isRunning {
 				a.stopSync()
 			}
+			if a.controlServer != nil {
+				a.controlServer.Close()
+			}
+			if a.metricsServer != nil {
+				a.metricsServer.Close()
+			}
+			if a.logCloser != nil {
+				a.logCloser.Close()
+			}
 			systray.Quit()
 			return
 		}
@@ -123,10 +233,10 @@ func (a *TrayAgent) loadConfiguration() error {
 	var configPath, envPath string
 	if isDev {
 		configPath, envPath = shared.GetDevelopmentConfigPaths()
-		log.Println("Development mode: using local config files")
+		slog.Info("Development mode: using local config files")
 	} else {
 		configPath, envPath = shared.GetDefaultConfigPaths()
-		log.Println("Production mode: using user config files")
+		slog.Info("Production mode: using user config files")
 	}
 
 	// Create config loader
@@ -145,7 +255,7 @@ func (a *TrayAgent) loadConfiguration() error {
 		return fmt.Errorf("invalid configuration: %w", err)
 	}
 
-	log.Printf("Configuration loaded successfully for client: %s", config.ClientCode)
+	slog.Info("Configuration loaded successfully", "client_code", config.ClientCode)
 	return nil
 }
 
@@ -154,7 +264,7 @@ func (a *TrayAgent) startSync() {
 		return
 	}
 
-	log.Println("Starting sync operation...")
+	slog.Info("Starting sync operation")
 	a.updateStatus("Starting...")
 
 	// Initialize Sage connector
@@ -167,7 +277,15 @@ func (a *TrayAgent) startSync() {
 
 	// Initialize Bitrix24 client
 	if a.config.Bitrix24 != nil {
-		a.bitrix24Client = bitrix24.NewClient(a.config.Bitrix24)
+		client, err := a.newBitrix24Client()
+		if err != nil {
+			a.showError("Failed to initialize Bitrix24: " + err.Error())
+			a.updateStatus("Bitrix24 not connected")
+			a.sageConnector.Close()
+			return
+		}
+
+		a.bitrix24Client = client
 		if err := a.bitrix24Client.TestConnection(); err != nil {
 			a.showError("Failed to connect to Bitrix24: " + err.Error())
 			a.updateStatus("Bitrix24 connection failed")
@@ -176,32 +294,147 @@ func (a *TrayAgent) startSync() {
 		}
 	}
 
+	identities, deadLetters, err := state.Open(filepath.Join(a.configLoader.DataDir(), "state"))
+	if err != nil {
+		a.showError("Failed to load sync state: " + err.Error())
+		a.updateStatus("Sync state error")
+		a.sageConnector.Close()
+		return
+	}
+
+	syncEngine := engine.NewEngine(a.config.ClientCode, a.sageConnector, a.bitrix24Client)
+	syncEngine.DryRun = a.config.SyncSettings.DryRun
+	syncEngine.ReportDir = filepath.Join(a.configLoader.DataDir(), "reports")
+	syncEngine.Identities = identities
+	syncEngine.DeadLetters = deadLetters
+	syncEngine.Metrics = a.metrics
+	syncEngine.Company = a.config.Companies[0].SageCompany
+	if a.config.Bitrix24 != nil && a.config.Bitrix24.Deals != nil {
+		syncEngine.CreateSageOrders = a.config.Bitrix24.Deals.CreateOrders
+	}
+	if a.config.Tickelia != nil {
+		syncEngine.Tickelia = tickelia.NewClient(a.config.Tickelia)
+	}
+
+	a.mu.Lock()
+	a.engine = syncEngine
+	a.deadLetters = deadLetters
+	a.paused = false
+	a.mu.Unlock()
+
 	a.isRunning = true
 	a.mStart.Disable()
 	a.mStop.Enable()
 
 	// Update status
 	interval := a.config.SyncSettings.IntervalMinutes
-	a.updateStatus(fmt.Sprintf("Connected - Syncing every %d minutes", interval))
+	if syncEngine.DryRun {
+		a.updateStatus(fmt.Sprintf("Connected - Dry run every %d minutes", interval))
+	} else {
+		a.updateStatus(fmt.Sprintf("Connected - Syncing every %d minutes", interval))
+	}
 
-	log.Printf("Sync started with %d minute interval", interval)
+	slog.Info("Sync started", "interval_minutes", interval, "dry_run", syncEngine.DryRun)
 
 	// Start sync loop
 	go a.syncLoop()
 }
 
+// newBitrix24Client creates a webhook or OAuth client depending on the
+// configuration. When the OAuth application is not installed yet it starts
+// the install flow and returns an error asking the user to authorize it.
+func (a *TrayAgent) newBitrix24Client() (*bitrix24.Client, error) {
+	if !a.config.Bitrix24.UsesOAuth() {
+		return bitrix24.NewClient(a.config.Bitrix24), nil
+	}
+
+	store := bitrix24.NewFileTokenStore(
+		filepath.Join(a.configLoader.DataDir(), bitrix24.TokenFileName),
+		a.configLoader.Secrets(),
+	)
+
+	client, err := bitrix24.NewOAuthClient(a.config.Bitrix24, store)
+	if errors.Is(err, bitrix24.ErrNotInstalled) {
+		authorizeURL, installErr := a.startBitrix24Install(store)
+		if installErr != nil {
+			return nil, installErr
+		}
+		return nil, fmt.Errorf("authorize the application at %s and start sync again", authorizeURL)
+	}
+
+	return client, err
+}
+
+// startBitrix24Install listens on the configured redirect URI for the OAuth
+// callback and returns the URL the administrator must open.
+func (a *TrayAgent) startBitrix24Install(store bitrix24.TokenStore) (string, error) {
+	oauthConfig := a.config.Bitrix24.OAuth
+	app := bitrix24.NewOAuthApp(oauthConfig)
+
+	redirect, err := url.Parse(oauthConfig.RedirectURI)
+	if err != nil || redirect.Host == "" {
+		return "", fmt.Errorf("Bitrix24 OAuth redirect URI is required to install the application")
+	}
+
+	stateBytes := make([]byte, 16)
+	if _, err := rand.Read(stateBytes); err != nil {
+		return "", err
+	}
+	installState := hex.EncodeToString(stateBytes)
+
+	if a.installServer != nil {
+		a.installServer.Close()
+	}
+
+	// The listener is only needed until the token is stored; it shuts down
+	// once the response is written.
+	server := &http.Server{Addr: redirect.Host}
+	installed := func() {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := server.Shutdown(ctx); err != nil {
+				slog.Warn("Failed to stop Bitrix24 install listener", "error", err)
+			}
+		}()
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(redirect.Path, app.InstallHandler(store, installState, installed))
+	server.Handler = mux
+	a.installServer = server
+
+	go func(server *http.Server) {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error("Bitrix24 install listener failed", "error", err)
+		}
+	}(a.installServer)
+
+	authorizeURL := app.AuthorizeURL(installState)
+	slog.Info("Waiting for Bitrix24 authorization", "redirect_uri", oauthConfig.RedirectURI)
+	return authorizeURL, nil
+}
+
 func (a *TrayAgent) stopSync() {
 	if !a.isRunning {
 		return
 	}
 
-	log.Println("Stopping sync operation...")
+	slog.Info("Stopping sync operation")
 
 	a.isRunning = false
 	a.mStart.Enable()
 	a.mStop.Disable()
 	a.updateStatus("Stopped")
 
+	// Wait for a cycle in progress before dropping the engine
+	a.syncMu.Lock()
+	a.mu.Lock()
+	a.engine = nil
+	a.paused = false
+	a.mu.Unlock()
+	a.syncMu.Unlock()
+
 	// Close connections
 	if a.sageConnector != nil {
 		a.sageConnector.Close()
@@ -210,101 +443,216 @@ func (a *TrayAgent) stopSync() {
 
 	a.bitrix24Client = nil
 
-	log.Println("Sync stopped successfully")
+	slog.Info("Sync stopped successfully")
 }
 
 func (a *TrayAgent) openLogs() {
-	log.Println("Opening logs...")
-	// TODO: Open log file in default text editor
-	// exec.Command("notepad", "path/to/logfile.log").Start()
+	if a.configLoader == nil {
+		return
+	}
+
+	logPath := filepath.Join(a.logDir(), logging.LogFileName)
+	slog.Info("Opening logs", "path", logPath)
+
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		cmd = exec.Command("notepad", logPath)
+	case "darwin":
+		cmd = exec.Command("open", logPath)
+	default:
+		cmd = exec.Command("xdg-open", logPath)
+	}
+
+	if err := cmd.Start(); err != nil {
+		a.showError("Failed to open log file: " + err.Error())
+	}
 }
 
 func (a *TrayAgent) updateStatus(status string) {
+	a.mu.Lock()
+	a.statusText = status
+	a.mu.Unlock()
+
 	a.mStatus.SetTitle("Status: " + status)
 	systray.SetTooltip("Sage Sync Agent - " + status)
 }
 
 func (a *TrayAgent) showError(message string) {
-	log.Printf("ERROR: %s", message)
+	slog.Error(message)
 	// TODO: Show Windows notification or dialog in the future
 }
 
 func (a *TrayAgent) showConfiguration() {
-	log.Println("=== Current Configuration ===")
-	log.Printf("Client Code: %s", a.config.ClientCode)
-	log.Printf("Database: %s:%s/%s", a.config.Database.Host, a.config.Database.Port, a.config.Database.Database)
-	log.Printf("Sync Interval: %d minutes", a.config.SyncSettings.IntervalMinutes)
-
-	if a.config.Bitrix24 != nil {
-		log.Printf("Bitrix24: %s", a.config.Bitrix24.APITenant)
-		log.Printf("Pack Empresa: %t", a.config.Bitrix24.PackEmpresa)
+	host, instance := a.config.Database.ServerAddress()
+	slog.Info("Current configuration",
+		"client_code", a.config.ClientCode,
+		"database_host", host,
+		"database_instance", instance,
+		"database_port", a.config.Database.Port,
+		"database_name", a.config.Database.Database,
+		"interval_minutes", a.config.SyncSettings.IntervalMinutes,
+		"dry_run", a.config.SyncSettings.DryRun,
+		"log_level", a.config.SyncSettings.LogLevel,
+		"metrics_addr", a.config.SyncSettings.MetricsAddr,
+		"control_addr", a.config.SyncSettings.ControlAddr)
+
+	if a.config.Bitrix24 != nil && a.config.Bitrix24.UsesOAuth() {
+		slog.Info("Bitrix24 configuration", "mode", "oauth",
+			"portal", a.config.Bitrix24.OAuth.Portal, "pack_empresa", a.config.Bitrix24.PackEmpresa,
+			"duplicate_policy", a.config.Bitrix24.DuplicateMode())
+	} else if a.config.Bitrix24 != nil {
+		slog.Info("Bitrix24 configuration", "mode", "webhook",
+			"endpoint", a.config.Bitrix24.APITenant, "pack_empresa", a.config.Bitrix24.PackEmpresa,
+			"duplicate_policy", a.config.Bitrix24.DuplicateMode())
 	} else {
-		log.Println("Bitrix24: Not configured")
+		slog.Info("Bitrix24 not configured")
 	}
 
-	log.Printf("Companies: %d configured", len(a.config.Companies))
 	for i, company := range a.config.Companies {
-		log.Printf("  %d. Bitrix: %s -> Sage: %s", i+1, company.BitrixCompany, company.SageCompany)
+		slog.Info("Company mapping", "index", i+1,
+			"bitrix_company", company.BitrixCompany, "sage_company", company.SageCompany)
 	}
 
 	// Show database info if connected
 	if a.sageConnector != nil {
 		if info, err := a.sageConnector.GetDatabaseInfo(); err == nil {
-			log.Printf("Database Info:")
+			attrs := make([]any, 0, len(info)*2)
 			for key, value := range info {
-				log.Printf("  %s: %v", key, value)
+				attrs = append(attrs, key, value)
 			}
+			slog.Info("Database info", attrs...)
 		}
 	}
 }
 
-func (a *TrayAgent) performSync() {
+// performSync runs one customer sync cycle and records its result. Cycles
+// from the ticker and the control API never overlap.
+func (a *TrayAgent) performSync() (*shared.SyncResult, error) {
+	a.syncMu.Lock()
+	defer a.syncMu.Unlock()
+
+	a.mu.Lock()
+	syncEngine := a.engine
+	a.mu.Unlock()
+	if syncEngine == nil {
+		return nil, control.ErrNotRunning
+	}
+
 	a.updateStatus("Syncing...")
-	a.lastSync = time.Now()
 
-	log.Println("Starting sync operation...")
+	result, err := syncEngine.SyncCustomers()
+	if result != nil {
+		a.recordResult(*result)
+	}
+	if err != nil {
+		a.showError("Sync failed: " + err.Error())
+		a.updateStatus("Sync failed")
+		return result, err
+	}
 
-	// Test Sage connection first
-	if err := a.sageConnector.TestConnection(); err != nil {
-		a.showError("Sage connection test failed: " + err.Error())
-		a.updateStatus("Sync failed - Sage connection")
-		return
+	// Update status with results
+	status := fmt.Sprintf("Last sync: %s (%d customers, %d unchanged)",
+		syncEngine.LastSync().Format("15:04:05"), result.RecordsCount, result.SkippedCount)
+	if pending := len(a.deadLetters.List()); pending > 0 {
+		status += fmt.Sprintf(" - %d pending retry", pending)
 	}
+	a.updateStatus(status)
+	return result, nil
+}
 
-	// Get recent customers from Sage (last 24 hours if no previous sync)
-	since := a.lastSync.Add(-24 * time.Hour)
-	if !a.lastSync.IsZero() {
-		since = a.lastSync.Add(-time.Duration(a.config.SyncSettings.IntervalMinutes) * time.Minute)
+func (a *TrayAgent) recordResult(result shared.SyncResult) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.results = append(a.results, result)
+	if len(a.results) > maxResults {
+		a.results = a.results[len(a.results)-maxResults:]
 	}
+}
 
-	customers, err := a.sageConnector.GetRecentCustomers(since)
-	if err != nil {
-		a.showError("Failed to read Sage customers: " + err.Error())
-		a.updateStatus("Sync failed - Sage data")
-		return
+// Status implements control.Agent
+func (a *TrayAgent) Status() control.Status {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	status := control.Status{
+		ClientCode: a.config.ClientCode,
+		Running:    a.engine != nil,
+		Paused:     a.paused,
+		DryRun:     a.config.SyncSettings.DryRun,
+		Status:     a.statusText,
+	}
+	if a.engine != nil {
+		status.LastSync = a.engine.LastSync()
 	}
+	if a.deadLetters != nil {
+		status.PendingRetries = len(a.deadLetters.List())
+	}
+	return status
+}
 
-	log.Printf("Found %d customers to sync", len(customers))
+// Results implements control.Agent, returning the most recent results first
+func (a *TrayAgent) Results() []shared.SyncResult {
+	a.mu.Lock()
+	defer a.mu.Unlock()
 
-	// Sync to Bitrix24 if configured
-	if a.bitrix24Client != nil {
-		a.updateStatus(fmt.Sprintf("Syncing %d customers to Bitrix24...", len(customers)))
+	results := make([]shared.SyncResult, len(a.results))
+	for i, result := range a.results {
+		results[len(a.results)-1-i] = result
+	}
+	return results
+}
 
-		if err := a.bitrix24Client.SyncCustomers(customers); err != nil {
-			a.showError("Bitrix24 sync failed: " + err.Error())
-			a.updateStatus("Sync failed - Bitrix24")
-			return
+// SyncNow implements control.Agent. A sync always runs the full cycle, so
+// a sync requested for any entity the engine syncs, such as "customers" or
+// "stock", syncs every entity. Paused agents still run requested cycles;
+// pausing only stops the schedule.
+func (a *TrayAgent) SyncNow(entity string) (*shared.SyncResult, error) {
+	name := strings.ToLower(entity)
+	for _, synced := range engine.SyncedEntities() {
+		if name == synced || name == synced+"s" || name == synced+"es" {
+			return a.performSync()
 		}
+	}
+	return nil, fmt.Errorf("%w %q: a sync always runs the full cycle, requested as one of %s",
+		control.ErrUnknownEntity, entity, strings.Join(engine.SyncedEntities(), ", "))
+}
+
+// Pause implements control.Agent, suspending scheduled cycles
+func (a *TrayAgent) Pause() error {
+	return a.setPaused(true)
+}
 
-		log.Printf("Successfully synced %d customers to Bitrix24", len(customers))
+// Resume implements control.Agent, restarting scheduled cycles
+func (a *TrayAgent) Resume() error {
+	return a.setPaused(false)
+}
+
+func (a *TrayAgent) setPaused(paused bool) error {
+	a.mu.Lock()
+	if a.engine == nil {
+		a.mu.Unlock()
+		return control.ErrNotRunning
 	}
+	a.paused = paused
+	a.mu.Unlock()
 
-	// Update status with results
-	status := fmt.Sprintf("Last sync: %s (%d customers)",
-		a.lastSync.Format("15:04:05"), len(customers))
-	a.updateStatus(status)
+	if paused {
+		slog.Info("Scheduled sync paused")
+		a.updateStatus("Paused")
+	} else {
+		slog.Info("Scheduled sync resumed")
+		a.updateStatus(fmt.Sprintf("Resumed - Syncing every %d minutes", a.config.SyncSettings.IntervalMinutes))
+	}
+	return nil
+}
+
+func (a *TrayAgent) isPaused() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
 
-	log.Printf("Sync completed successfully: %d customers processed", len(customers))
+	return a.paused
 }
 
 func (a *TrayAgent) syncLoop() {
@@ -319,7 +667,7 @@ func (a *TrayAgent) syncLoop() {
 	for a.isRunning {
 		select {
 		case <-ticker.C:
-			if a.isRunning {
+			if a.isRunning && !a.isPaused() {
 				a.performSync()
 			}
 		case <-time.After(1 * time.Second):
@@ -0,0 +1,97 @@
+// Package logging configures structured, leveled logging for the agent.
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Supported log formats.
+const (
+	FormatJSON   = "json"
+	FormatLogfmt = "logfmt"
+)
+
+// LogFileName is the name of the active log file in the log directory.
+const LogFileName = "agent.log"
+
+// Options configures Setup.
+type Options struct {
+	Level  string // "debug", "info", "warn" or "error"
+	Format string // "json" or "logfmt"
+	Dir    string // directory for rotating log files; empty logs to stderr only
+
+	MaxSizeBytes int64 // size at which the log file is rotated
+	MaxBackups   int   // number of rotated files kept
+}
+
+// Setup builds the logger described by opts and installs it as the slog
+// default, which also routes the standard log package through it. The
+// returned closer flushes and closes the log file.
+func Setup(opts Options) (*slog.Logger, io.Closer, error) {
+	level, err := ParseLevel(opts.Level)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var output io.Writer = os.Stderr
+	var closer io.Closer = nopCloser{}
+
+	if opts.Dir != "" {
+		file, err := NewRotatingFile(filepath.Join(opts.Dir, LogFileName), opts.MaxSizeBytes, opts.MaxBackups)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open log file: %w", err)
+		}
+		output = io.MultiWriter(os.Stderr, file)
+		closer = file
+	}
+
+	logger := slog.New(NewRedactingHandler(newHandler(output, opts.Format, level)))
+	slog.SetDefault(logger)
+
+	return logger, closer, nil
+}
+
+// ParseLevel converts a configured level name to an slog level. An empty
+// name means info.
+func ParseLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return slog.LevelInfo, fmt.Errorf("unknown log level %q", name)
+}
+
+func newHandler(w io.Writer, format string, level slog.Level) slog.Handler {
+	opts := &slog.HandlerOptions{Level: level}
+	if strings.EqualFold(format, FormatLogfmt) {
+		return slog.NewTextHandler(w, opts)
+	}
+	return slog.NewJSONHandler(w, opts)
+}
+
+// NewCorrelationID returns a short random identifier used to tie together
+// the log lines of one sync cycle.
+func NewCorrelationID() string {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
@@ -0,0 +1,146 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Rotation defaults.
+const (
+	DefaultMaxSizeBytes = 10 << 20
+	DefaultMaxBackups   = 5
+)
+
+// RotatingFile is an io.WriteCloser that renames the file to path.1,
+// path.2, ... once it grows past a size limit, keeping a fixed number of
+// backups.
+type RotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// NewRotatingFile opens path for appending. Zero limits use the defaults.
+func NewRotatingFile(path string, maxSize int64, maxBackups int) (*RotatingFile, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSizeBytes
+	}
+	if maxBackups <= 0 {
+		maxBackups = DefaultMaxBackups
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	rf := &RotatingFile{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+// Path returns the path of the active log file.
+func (rf *RotatingFile) Path() string {
+	return rf.path
+}
+
+// Write appends p, rotating first if p would exceed the size limit. When
+// rotation fails p is still appended to the current file, rotation is
+// tried again on the next write and the rotation error is returned.
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	var rotateErr error
+	if rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		rotateErr = rf.rotate()
+	}
+	if rf.file == nil {
+		return 0, rotateErr
+	}
+
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	if err != nil {
+		return n, err
+	}
+	return n, rotateErr
+}
+
+// Close closes the active file.
+func (rf *RotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.file == nil {
+		return nil
+	}
+	return rf.file.Close()
+}
+
+func (rf *RotatingFile) open() error {
+	rf.file = nil
+
+	file, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	rf.file = file
+	rf.size = info.Size()
+	return nil
+}
+
+// rotate moves the active file to path.1 and opens a new one. If a backup
+// cannot be moved, for example because another process holds it open, the
+// current file is reopened so logging carries on and the error is returned.
+func (rf *RotatingFile) rotate() error {
+	if err := rf.file.Close(); err != nil {
+		return rf.reopen(err)
+	}
+
+	// Shift path.N-1 -> path.N, dropping the oldest backup.
+	if err := os.Remove(rf.backupPath(rf.maxBackups)); err != nil && !os.IsNotExist(err) {
+		return rf.reopen(err)
+	}
+	for i := rf.maxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(rf.backupPath(i), rf.backupPath(i+1)); err != nil && !os.IsNotExist(err) {
+			return rf.reopen(err)
+		}
+	}
+	if err := os.Rename(rf.path, rf.backupPath(1)); err != nil {
+		return rf.reopen(err)
+	}
+
+	return rf.open()
+}
+
+// reopen opens the active file again after a failed rotation and returns
+// the rotation error.
+func (rf *RotatingFile) reopen(rotateErr error) error {
+	if err := rf.open(); err != nil {
+		return fmt.Errorf("log rotation failed: %w; reopening %s: %v", rotateErr, rf.path, err)
+	}
+	return fmt.Errorf("log rotation failed: %w", rotateErr)
+}
+
+func (rf *RotatingFile) backupPath(n int) string {
+	return fmt.Sprintf("%s.%d", rf.path, n)
+}
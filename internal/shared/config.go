@@ -3,9 +3,12 @@ package shared
 import (
 	"encoding/json"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -14,6 +17,7 @@ import (
 type ConfigLoader struct {
 	configPath string
 	envPath    string
+	secrets    *SecretCodec
 }
 
 // NewConfigLoader creates a new configuration loader.
@@ -21,6 +25,7 @@ func NewConfigLoader(configPath, envPath string) *ConfigLoader {
 	return &ConfigLoader{
 		configPath: configPath,
 		envPath:    envPath,
+		secrets:    NewSecretCodec(filepath.Dir(configPath)),
 	}
 }
 
@@ -40,6 +45,18 @@ func (cl *ConfigLoader) LoadConfig() (*AgentConfig, error) {
 		if err := cl.loadFromJSON(config); err != nil {
 			return nil, fmt.Errorf("error loading JSON config: %w", err)
 		}
+
+		hasPlainSecrets, err := cl.decryptSecrets(config)
+		if err != nil {
+			return nil, fmt.Errorf("error decrypting config secrets: %w", err)
+		}
+
+		// Migrate configs written before secrets were encrypted at rest.
+		if hasPlainSecrets {
+			if err := cl.SaveConfig(config); err != nil {
+				return nil, fmt.Errorf("error encrypting config secrets: %w", err)
+			}
+		}
 	}
 
 	// Override/supplement with environment variables.
@@ -67,6 +84,9 @@ func (cl *ConfigLoader) loadFromEnv(config *AgentConfig) {
 	if config.Database.Host == "" {
 		config.Database.Host = getEnv("SAGE_DB_HOST", "")
 	}
+	if config.Database.HostSage == "" {
+		config.Database.HostSage = getEnv("SAGE_DB_HOST_SAGE", "")
+	}
 	if config.Database.Port == "" {
 		config.Database.Port = getEnv("SAGE_DB_PORT", "1433")
 	}
@@ -82,16 +102,115 @@ func (cl *ConfigLoader) loadFromEnv(config *AgentConfig) {
 	if config.Database.LicenseID == "" {
 		config.Database.LicenseID = getEnv("LICENSE_ID", "")
 	}
+	if config.Database.Encrypt == "" {
+		config.Database.Encrypt = getEnv("SAGE_DB_ENCRYPT", "")
+	}
+	if !config.Database.TrustServerCertificate {
+		config.Database.TrustServerCertificate = getBoolEnv("SAGE_DB_TRUST_SERVER_CERTIFICATE", false)
+	}
+	if config.Database.CertificatePath == "" {
+		config.Database.CertificatePath = getEnv("SAGE_DB_CERTIFICATE", "")
+	}
+	if !config.Database.IntegratedAuth {
+		config.Database.IntegratedAuth = getBoolEnv("SAGE_DB_INTEGRATED_AUTH", false)
+	}
 
 	// Bitrix24 configuration.
 	if config.Bitrix24 == nil {
 		bitrixEndpoint := getEnv("BITRIX_ENDPOINT", "")
-		if bitrixEndpoint != "" {
+		bitrixPortal := getEnv("BITRIX_OAUTH_PORTAL", "")
+		if bitrixEndpoint != "" || bitrixPortal != "" {
 			config.Bitrix24 = &Bitrix24Config{
 				APITenant:   bitrixEndpoint,
 				PackEmpresa: getBoolEnv("PACK_EMPRESA", false),
 			}
 		}
+		if bitrixPortal != "" {
+			config.Bitrix24.OAuth = &Bitrix24OAuthConfig{
+				Portal:       bitrixPortal,
+				ClientID:     getEnv("BITRIX_OAUTH_CLIENT_ID", ""),
+				ClientSecret: getEnv("BITRIX_OAUTH_CLIENT_SECRET", ""),
+				RedirectURI:  getEnv("BITRIX_OAUTH_REDIRECT_URI", ""),
+			}
+		}
+	}
+	if config.Bitrix24 != nil && config.Bitrix24.DuplicatePolicy == "" {
+		config.Bitrix24.DuplicatePolicy = getEnv("BITRIX_DUPLICATE_POLICY", "")
+	}
+	if config.Bitrix24 != nil && config.Bitrix24.RequisitePreset == 0 {
+		config.Bitrix24.RequisitePreset = getIntEnv("BITRIX_REQUISITE_PRESET_ID", 0)
+	}
+	if config.Bitrix24 != nil && config.Bitrix24.Deals == nil {
+		deals := &DealSettings{
+			CategoryID:       getIntEnv("BITRIX_DEAL_CATEGORY_ID", 0),
+			Stages:           parseValueMap(getEnv("BITRIX_DEAL_STAGES", "")),
+			CreateOrders:     getBoolEnv("BITRIX_DEAL_CREATE_ORDERS", false),
+			WonStage:         getEnv("BITRIX_DEAL_WON_STAGE", ""),
+			OrderNumberField: getEnv("BITRIX_DEAL_ORDER_FIELD", ""),
+		}
+		if deals.CategoryID != 0 || len(deals.Stages) > 0 || deals.CreateOrders {
+			config.Bitrix24.Deals = deals
+		}
+	}
+	if config.Bitrix24 != nil && !config.Bitrix24.SyncSuppliers {
+		config.Bitrix24.SyncSuppliers = getBoolEnv("BITRIX_SYNC_SUPPLIERS", false)
+	}
+	if config.Bitrix24 != nil && config.Bitrix24.SupplierType == "" {
+		config.Bitrix24.SupplierType = getEnv("BITRIX_SUPPLIER_COMPANY_TYPE", "")
+	}
+	if config.Bitrix24 != nil && config.Bitrix24.Balances == nil {
+		balances := &BalanceFields{
+			Balance:     getEnv("BITRIX_BALANCE_FIELD", ""),
+			Overdue:     getEnv("BITRIX_OVERDUE_FIELD", ""),
+			CreditLimit: getEnv("BITRIX_CREDIT_LIMIT_FIELD", ""),
+			Risk:        getEnv("BITRIX_RISK_FIELD", ""),
+			RiskValues:  parseValueMap(getEnv("BITRIX_RISK_VALUES", "")),
+		}
+		if balances.Enabled() {
+			config.Bitrix24.Balances = balances
+		}
+	}
+	if config.Bitrix24 != nil && config.Bitrix24.Collections == nil {
+		collections := &CollectionFields{
+			Status:       getEnv("BITRIX_COLLECTION_STATUS_FIELD", ""),
+			Paid:         getEnv("BITRIX_COLLECTION_PAID_FIELD", ""),
+			Outstanding:  getEnv("BITRIX_COLLECTION_OUTSTANDING_FIELD", ""),
+			DueDate:      getEnv("BITRIX_COLLECTION_DUE_DATE_FIELD", ""),
+			StatusValues: parseValueMap(getEnv("BITRIX_COLLECTION_STATUS_VALUES", "")),
+		}
+		if collections.Enabled() {
+			config.Bitrix24.Collections = collections
+		}
+	}
+	if config.Bitrix24 != nil && config.Bitrix24.Stock == nil {
+		if warehouses := parseValueMap(getEnv("BITRIX_STOCK_WAREHOUSES", "")); len(warehouses) > 0 {
+			config.Bitrix24.Stock = &StockSettings{
+				Warehouses: warehouses,
+				Currency:   getEnv("BITRIX_STOCK_CURRENCY", ""),
+			}
+		}
+	}
+	if config.Bitrix24 != nil && config.Bitrix24.Pricing == nil {
+		pricing := &PricingSettings{
+			PriceTypes:    parseValueMap(getEnv("BITRIX_PRICE_TYPES", "")),
+			Currency:      getEnv("BITRIX_PRICE_CURRENCY", ""),
+			TariffField:   getEnv("BITRIX_TARIFF_FIELD", ""),
+			DiscountField: getEnv("BITRIX_DISCOUNT_FIELD", ""),
+		}
+		if len(pricing.PriceTypes) > 0 || pricing.TariffField != "" || pricing.DiscountField != "" {
+			config.Bitrix24.Pricing = pricing
+		}
+	}
+
+	// Tickelia configuration.
+	if config.Tickelia == nil {
+		if endpoint := getEnv("TICKELIA_API_ENDPOINT", ""); endpoint != "" {
+			config.Tickelia = &TickeliaConfig{
+				APIEndpoint: endpoint,
+				APIKey:      getEnv("TICKELIA_API_KEY", ""),
+				Environment: getEnv("TICKELIA_ENVIRONMENT", ""),
+			}
+		}
 	}
 
 	// Company mapping from environment.
@@ -120,6 +239,21 @@ func (cl *ConfigLoader) loadFromEnv(config *AgentConfig) {
 	if config.SyncSettings.LogLevel == "" {
 		config.SyncSettings.LogLevel = getEnv("LOG_LEVEL", "info")
 	}
+	if config.SyncSettings.LogFormat == "" {
+		config.SyncSettings.LogFormat = getEnv("LOG_FORMAT", "json")
+	}
+	if !config.SyncSettings.DryRun {
+		config.SyncSettings.DryRun = getBoolEnv("SYNC_DRY_RUN", false)
+	}
+	if config.SyncSettings.MetricsAddr == "" {
+		config.SyncSettings.MetricsAddr = getEnv("METRICS_ADDR", "")
+	}
+	if config.SyncSettings.ControlAddr == "" {
+		config.SyncSettings.ControlAddr = getEnv("CONTROL_ADDR", "")
+	}
+	if config.SyncSettings.ControlToken == "" {
+		config.SyncSettings.ControlToken = getEnv("CONTROL_TOKEN", "")
+	}
 }
 
 // setDefaults sets default values for missing configuration.
@@ -130,6 +264,9 @@ func (cl *ConfigLoader) setDefaults(config *AgentConfig) {
 	if config.SyncSettings.LogLevel == "" {
 		config.SyncSettings.LogLevel = "info"
 	}
+	if config.SyncSettings.LogFormat == "" {
+		config.SyncSettings.LogFormat = "json"
+	}
 	if config.SaaSConfig.BaseURL == "" {
 		config.SaaSConfig.BaseURL = "https://api.btic.cat"
 	}
@@ -138,9 +275,54 @@ func (cl *ConfigLoader) setDefaults(config *AgentConfig) {
 	}
 }
 
-// SaveConfig saves the current configuration to JSON file.
+// decryptSecrets decrypts secret fields in place and reports whether any of
+// them were stored in plain text.
+func (cl *ConfigLoader) decryptSecrets(config *AgentConfig) (bool, error) {
+	hasPlainSecrets := false
+
+	for _, field := range secretFields(config) {
+		if *field == "" {
+			continue
+		}
+		if !IsEncryptedSecret(*field) {
+			hasPlainSecrets = true
+			continue
+		}
+
+		plain, err := cl.secrets.Decrypt(*field)
+		if err != nil {
+			return false, err
+		}
+		*field = plain
+	}
+
+	return hasPlainSecrets, nil
+}
+
+// DataDir returns the directory holding the configuration file, where the
+// agent also keeps its local state.
+func (cl *ConfigLoader) DataDir() string {
+	return filepath.Dir(cl.configPath)
+}
+
+// Secrets returns the codec used to encrypt secrets in the data directory.
+func (cl *ConfigLoader) Secrets() *SecretCodec {
+	return cl.secrets
+}
+
+// SaveConfig saves the current configuration to JSON file. Secrets are
+// encrypted on a copy so the caller keeps working with plain values.
 func (cl *ConfigLoader) SaveConfig(config *AgentConfig) error {
-	data, err := json.MarshalIndent(config, "", "    ")
+	encrypted := cloneConfig(config)
+	for _, field := range secretFields(encrypted) {
+		value, err := cl.secrets.Encrypt(*field)
+		if err != nil {
+			return err
+		}
+		*field = value
+	}
+
+	data, err := json.MarshalIndent(encrypted, "", "    ")
 	if err != nil {
 		return err
 	}
@@ -151,7 +333,71 @@ func (cl *ConfigLoader) SaveConfig(config *AgentConfig) error {
 		return err
 	}
 
-	return os.WriteFile(cl.configPath, data, 0644)
+	if err := os.WriteFile(cl.configPath, data, 0600); err != nil {
+		return err
+	}
+
+	// WriteFile keeps the mode of an existing file, so tighten it explicitly.
+	return os.Chmod(cl.configPath, 0600)
+}
+
+// secretFields returns pointers to every configuration value that must be
+// encrypted at rest.
+func secretFields(config *AgentConfig) []*string {
+	fields := []*string{
+		&config.Database.Password,
+		&config.SaaSConfig.APIKey,
+		&config.SyncSettings.ControlToken,
+	}
+	if config.Tickelia != nil {
+		fields = append(fields, &config.Tickelia.APIKey)
+	}
+	if config.Bitrix24 != nil && config.Bitrix24.OAuth != nil {
+		fields = append(fields, &config.Bitrix24.OAuth.ClientSecret)
+	}
+	return fields
+}
+
+// RedactedConfig returns a copy of config with every secret replaced by a
+// placeholder, suitable for display.
+func RedactedConfig(config *AgentConfig) *AgentConfig {
+	clone := cloneConfig(config)
+	for _, field := range secretFields(clone) {
+		if *field != "" {
+			*field = redactedPlaceholder
+		}
+	}
+
+	// Incoming webhook URLs carry their secret in the path.
+	if clone.Bitrix24 != nil {
+		clone.Bitrix24.APITenant = webhookSecretPattern.ReplaceAllString(clone.Bitrix24.APITenant, "${1}"+redactedPlaceholder)
+	}
+	return clone
+}
+
+// redactedPlaceholder replaces secrets in RedactedConfig.
+const redactedPlaceholder = "********"
+
+// webhookSecretPattern matches the secret of a Bitrix24 webhook URL.
+var webhookSecretPattern = regexp.MustCompile(`(/rest/\d+/)[^/]+`)
+
+// cloneConfig copies config deeply enough that its secret fields can be
+// modified without affecting the original.
+func cloneConfig(config *AgentConfig) *AgentConfig {
+	clone := *config
+	if config.Bitrix24 != nil {
+		bitrix := *config.Bitrix24
+		if bitrix.OAuth != nil {
+			oauth := *bitrix.OAuth
+			bitrix.OAuth = &oauth
+		}
+		clone.Bitrix24 = &bitrix
+	}
+	if config.Tickelia != nil {
+		tickelia := *config.Tickelia
+		clone.Tickelia = &tickelia
+	}
+	return &clone
 }
 
 // GetDefaultConfigPaths returns default configuration file paths.
@@ -204,6 +450,21 @@ func getIntEnv(key string, defaultValue int) int {
 	return defaultValue
 }
 
+// parseValueMap parses a mapping written as "key=value,key=value", such as
+// the deal stages "quote=NEW,order:held=PREPAYMENT_INVOICE". Keys are
+// lowercased.
+func parseValueMap(value string) map[string]string {
+	stages := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		key, stage, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		stages[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(stage)
+	}
+	return stages
+}
+
 // ValidateConfig validates the configuration.
 func ValidateConfig(config *AgentConfig) error {
 	if config.ClientCode == "" {
@@ -214,13 +475,116 @@ func ValidateConfig(config *AgentConfig) error {
 		return fmt.Errorf("database configuration is incomplete")
 	}
 
+	switch config.Database.EncryptMode() {
+	case EncryptDisable, EncryptFalse, EncryptTrue, EncryptStrict:
+	default:
+		return fmt.Errorf("invalid database encrypt mode %q", config.Database.Encrypt)
+	}
+
+	if config.Database.CertificatePath != "" && !fileExists(config.Database.CertificatePath) {
+		return fmt.Errorf("database certificate %s not found", config.Database.CertificatePath)
+	}
+
 	if config.Bitrix24 == nil && config.Tickelia == nil {
 		return fmt.Errorf("at least one integration (Bitrix24 or Tickelia) must be configured")
 	}
 
+	if config.Bitrix24 != nil {
+		if config.Bitrix24.UsesOAuth() {
+			if config.Bitrix24.OAuth.ClientID == "" || config.Bitrix24.OAuth.ClientSecret == "" {
+				return fmt.Errorf("Bitrix24 OAuth client ID and secret are required")
+			}
+		} else if config.Bitrix24.APITenant == "" {
+			return fmt.Errorf("Bitrix24 webhook URL or OAuth portal is required")
+		}
+
+		switch config.Bitrix24.DuplicateMode() {
+		case DuplicateLink, DuplicateMerge, DuplicateCreate, DuplicateReview:
+		default:
+			return fmt.Errorf("invalid Bitrix24 duplicate policy %q", config.Bitrix24.DuplicatePolicy)
+		}
+		if config.Bitrix24.RequisitePreset < 0 {
+			return fmt.Errorf("invalid Bitrix24 requisite preset ID %d", config.Bitrix24.RequisitePreset)
+		}
+		if deals := config.Bitrix24.Deals; deals != nil {
+			if deals.CategoryID < 0 {
+				return fmt.Errorf("invalid Bitrix24 deal category ID %d", deals.CategoryID)
+			}
+			for key, stage := range deals.Stages {
+				if stage == "" {
+					return fmt.Errorf("empty Bitrix24 deal stage for %q", key)
+				}
+			}
+		}
+		if balances := config.Bitrix24.Balances; balances != nil {
+			for status := range balances.RiskValues {
+				switch status {
+				case RiskOnHold, RiskOverdue, RiskOverLimit, RiskOK:
+				default:
+					return fmt.Errorf("invalid customer risk status %q", status)
+				}
+			}
+		}
+		if collections := config.Bitrix24.Collections; collections != nil {
+			for status := range collections.StatusValues {
+				switch status {
+				case CollectionPending, CollectionPartial, CollectionPaid:
+				default:
+					return fmt.Errorf("invalid collection status %q", status)
+				}
+			}
+		}
+		if stock := config.Bitrix24.Stock; stock != nil {
+			for warehouse, store := range stock.Warehouses {
+				if id, err := strconv.Atoi(store); err != nil || id <= 0 {
+					return fmt.Errorf("invalid Bitrix24 store ID %q for warehouse %q", store, warehouse)
+				}
+			}
+		}
+		if pricing := config.Bitrix24.Pricing; pricing != nil {
+			for band, priceType := range pricing.PriceTypes {
+				if id, err := strconv.Atoi(priceType); err != nil || id <= 0 {
+					return fmt.Errorf("invalid Bitrix24 price type ID %q for price band %q", priceType, band)
+				}
+			}
+		}
+	}
+
+	if config.Tickelia != nil && (config.Tickelia.APIEndpoint == "" || config.Tickelia.APIKey == "") {
+		return fmt.Errorf("Tickelia API endpoint and API key are required")
+	}
+
 	if len(config.Companies) == 0 {
 		return fmt.Errorf("at least one company mapping is required")
 	}
 
+	if addr := config.SyncSettings.MetricsAddr; addr != "" {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return fmt.Errorf("invalid metrics address %q: %w", addr, err)
+		}
+	}
+
+	if addr := config.SyncSettings.ControlAddr; addr != "" {
+		if !isLoopbackAddr(addr) {
+			return fmt.Errorf("control API address %q must be a loopback address", addr)
+		}
+		if config.SyncSettings.ControlToken == "" {
+			return fmt.Errorf("control API token is required")
+		}
+	}
+
 	return nil
 }
+
+// isLoopbackAddr reports whether addr is a host:port on the local machine.
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -2,6 +2,10 @@ package shared
 
 import (
 	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -19,18 +23,284 @@ type AgentConfig struct {
 // DatabaseConfig contains Sage 200c database connection details.
 type DatabaseConfig struct {
 	Host      string `json:"DB_Host" mapstructure:"host"`
-	HostSage  string `json:"DB_Host_Sage" mapstructure:"host_sage"`
+	HostSage  string `json:"DB_Host_Sage" mapstructure:"host_sage"` // "SERVER\INSTANCE" for named instances
 	Port      string `json:"DB_Port" mapstructure:"port"`
 	Database  string `json:"DB_Database" mapstructure:"database"`
 	Username  string `json:"DB_Username" mapstructure:"username"`
 	Password  string `json:"DB_Password" mapstructure:"password"`
 	LicenseID string `json:"IdLlicencia" mapstructure:"license_id"`
+
+	// TLS and authentication options.
+	Encrypt                string `json:"DB_Encrypt,omitempty" mapstructure:"encrypt"` // "disable", "false", "true", "strict"
+	TrustServerCertificate bool   `json:"DB_TrustServerCertificate,omitempty" mapstructure:"trust_server_certificate"`
+	CertificatePath        string `json:"DB_Certificate,omitempty" mapstructure:"certificate"`
+	HostNameInCertificate  string `json:"DB_HostNameInCertificate,omitempty" mapstructure:"host_name_in_certificate"`
+	IntegratedAuth         bool   `json:"DB_IntegratedAuth,omitempty" mapstructure:"integrated_auth"`
 }
 
-// Bitrix24Config contains Bitrix24 integration settings.
+// Supported values for DatabaseConfig.Encrypt.
+const (
+	EncryptDisable = "disable" // no TLS at all
+	EncryptFalse   = "false"   // TLS for the login packet only (default)
+	EncryptTrue    = "true"    // TLS for the whole session
+	EncryptStrict  = "strict"  // TDS 8.0, TLS before any TDS traffic
+)
+
+// Bitrix24Config contains Bitrix24 integration settings. Either APITenant
+// (an incoming webhook URL) or OAuth must be set.
 type Bitrix24Config struct {
-	APITenant   string `json:"API_Tenant" mapstructure:"api_tenant"`
-	PackEmpresa bool   `json:"pack_empresa" mapstructure:"pack_empresa"`
+	APITenant       string               `json:"API_Tenant" mapstructure:"api_tenant"`
+	PackEmpresa     bool                 `json:"pack_empresa" mapstructure:"pack_empresa"`
+	OAuth           *Bitrix24OAuthConfig `json:"OAuth,omitempty" mapstructure:"oauth"`
+	DuplicatePolicy string               `json:"duplicate_policy,omitempty" mapstructure:"duplicate_policy"`       // "link", "merge", "create", "review"
+	RequisitePreset int                  `json:"requisite_preset_id,omitempty" mapstructure:"requisite_preset_id"` // requisite template holding customer addresses
+	Deals           *DealSettings        `json:"deals,omitempty" mapstructure:"deals"`
+	Balances        *BalanceFields       `json:"balance_fields,omitempty" mapstructure:"balance_fields"`
+	SyncSuppliers   bool                 `json:"sync_suppliers,omitempty" mapstructure:"sync_suppliers"`               // push Sage suppliers as companies
+	SupplierType    string               `json:"supplier_company_type,omitempty" mapstructure:"supplier_company_type"` // COMPANY_TYPE of supplier companies
+	Collections     *CollectionFields    `json:"collection_fields,omitempty" mapstructure:"collection_fields"`
+	Stock           *StockSettings       `json:"stock,omitempty" mapstructure:"stock"`
+	Pricing         *PricingSettings     `json:"pricing,omitempty" mapstructure:"pricing"`
+}
+
+// PricingSettings maps Sage price bands (tariffs) to Bitrix24 price types
+// (catalog.group.list) and names the custom fields of the customer's
+// contact and company that receive its tariff and discount rules.
+type PricingSettings struct {
+	// PriceTypes maps Sage price band names to price type IDs; the prices
+	// of unmapped bands are not synced
+	PriceTypes    map[string]string `json:"price_types,omitempty" mapstructure:"price_types"`
+	Currency      string            `json:"currency,omitempty" mapstructure:"currency"`             // of the prices, defaults to "EUR"
+	TariffField   string            `json:"tariff_field,omitempty" mapstructure:"tariff_field"`     // receives the customer's price band
+	DiscountField string            `json:"discount_field,omitempty" mapstructure:"discount_field"` // receives the customer's discount rules
+}
+
+// StockSettings maps Sage warehouses to the Bitrix24 stores
+// (catalog.store.list) whose product quantities the sync keeps up to date.
+type StockSettings struct {
+	// Warehouses maps Sage warehouse names to store IDs; the stock of
+	// unmapped warehouses is not synced. Several warehouses may share a
+	// store, which then holds their total.
+	Warehouses map[string]string `json:"warehouses" mapstructure:"warehouses"`
+	Currency   string            `json:"currency,omitempty" mapstructure:"currency"` // of the stock documents, defaults to "EUR"
+}
+
+// CollectionFields names the custom fields of deals that receive the
+// collection status of the invoices of their Sage sales order, e.g.
+// "UF_CRM_SAGE_PAID". Fields left empty are not written.
+type CollectionFields struct {
+	Status      string `json:"status,omitempty" mapstructure:"status"`           // collection status
+	Paid        string `json:"paid,omitempty" mapstructure:"paid"`               // amount collected
+	Outstanding string `json:"outstanding,omitempty" mapstructure:"outstanding"` // amount still to collect
+	DueDate     string `json:"due_date,omitempty" mapstructure:"due_date"`       // earliest due date still to collect
+	// StatusValues maps collection statuses to the values written to the
+	// Status field, such as the item IDs of a list field; unmapped statuses
+	// are written as they are
+	StatusValues map[string]string `json:"status_values,omitempty" mapstructure:"status_values"`
+}
+
+// Enabled reports whether any collection field is configured.
+func (f *CollectionFields) Enabled() bool {
+	return f != nil && (f.Status != "" || f.Paid != "" || f.Outstanding != "" || f.DueDate != "")
+}
+
+// BalanceFields names the custom fields of the customer's contact and
+// company that receive its Sage balance and credit data, e.g.
+// "UF_CRM_SAGE_BALANCE". Fields left empty are not written.
+type BalanceFields struct {
+	Balance     string `json:"balance,omitempty" mapstructure:"balance"`           // outstanding balance
+	Overdue     string `json:"overdue,omitempty" mapstructure:"overdue"`           // outstanding amount past its due date
+	CreditLimit string `json:"credit_limit,omitempty" mapstructure:"credit_limit"` // credit limit, 0 for none
+	Risk        string `json:"risk,omitempty" mapstructure:"risk"`                 // risk status
+	// RiskValues maps risk statuses to the values written to the Risk
+	// field, such as the item IDs of a list field; unmapped statuses are
+	// written as they are
+	RiskValues map[string]string `json:"risk_values,omitempty" mapstructure:"risk_values"`
+}
+
+// Enabled reports whether any balance field is configured.
+func (f *BalanceFields) Enabled() bool {
+	return f != nil && (f.Balance != "" || f.Overdue != "" || f.CreditLimit != "" || f.Risk != "")
+}
+
+// DealSettings maps Sage sales orders and quotes to Bitrix24 deals.
+type DealSettings struct {
+	CategoryID int `json:"category_id" mapstructure:"category_id"` // pipeline; 0 is the default one
+	// Stages maps "<type>:<status>", "<status>" or "<type>" of Sage
+	// documents to stage IDs, e.g. {"quote": "NEW", "order:held": "PREPAYMENT_INVOICE"}
+	Stages map[string]string `json:"stages,omitempty" mapstructure:"stages"`
+	// CreateOrders creates a Sage sales order for each deal entering
+	// WonStage that did not come from Sage
+	CreateOrders     bool   `json:"create_orders,omitempty" mapstructure:"create_orders"`
+	WonStage         string `json:"won_stage,omitempty" mapstructure:"won_stage"`                   // defaults to "WON"
+	OrderNumberField string `json:"order_number_field,omitempty" mapstructure:"order_number_field"` // deal field receiving the Sage order number, e.g. "UF_CRM_SAGE_ORDER"
+}
+
+// defaultDealStages are the stages of documents the configuration does not
+// map.
+var defaultDealStages = map[string]string{
+	DocumentComplete:  "WON",
+	DocumentCancelled: "LOSE",
+	DocumentQuote:     "NEW",
+	DocumentOrder:     "EXECUTING",
+}
+
+// Supported values for Bitrix24Config.DuplicatePolicy, applied when a new
+// customer shares a phone or email with existing contacts.
+const (
+	DuplicateLink   = "link"   // adopt the oldest match and overwrite it (default)
+	DuplicateMerge  = "merge"  // adopt the oldest match, only filling its empty fields
+	DuplicateCreate = "create" // create a new contact anyway
+	DuplicateReview = "review" // create nothing and park the customer for a person
+)
+
+// Bitrix24OAuthConfig contains the OAuth 2.0 application credentials for a
+// single Bitrix24 portal. Tokens are kept in a separate token store.
+type Bitrix24OAuthConfig struct {
+	Portal       string `json:"portal" mapstructure:"portal"` // e.g. "company.bitrix24.es"
+	ClientID     string `json:"client_id" mapstructure:"client_id"`
+	ClientSecret string `json:"client_secret" mapstructure:"client_secret"`
+	RedirectURI  string `json:"redirect_uri,omitempty" mapstructure:"redirect_uri"`
+	OAuthServer  string `json:"oauth_server,omitempty" mapstructure:"oauth_server"`
+}
+
+// UsesOAuth reports whether the integration authenticates as an OAuth app
+// instead of through a webhook.
+func (b *Bitrix24Config) UsesOAuth() bool {
+	return b.OAuth != nil && b.OAuth.Portal != ""
+}
+
+// DuplicateMode returns the configured duplicate policy, defaulting to
+// linking the existing contact.
+func (b *Bitrix24Config) DuplicateMode() string {
+	if b.DuplicatePolicy == "" {
+		return DuplicateLink
+	}
+	return strings.ToLower(b.DuplicatePolicy)
+}
+
+// RequisitePresetID returns the ID of the requisite template customer
+// addresses are stored under, defaulting to the portal's first preset.
+func (b *Bitrix24Config) RequisitePresetID() int {
+	if b.RequisitePreset <= 0 {
+		return 1
+	}
+	return b.RequisitePreset
+}
+
+// SupplierCompanyType returns the company type (COMPANY_TYPE) of the
+// companies created for Sage suppliers, defaulting to "SUPPLIER".
+func (b *Bitrix24Config) SupplierCompanyType() string {
+	if b.SupplierType == "" {
+		return "SUPPLIER"
+	}
+	return b.SupplierType
+}
+
+// StoreID returns the ID of the Bitrix24 store a Sage warehouse is mapped
+// to. Warehouse names are matched without regard to case.
+func (b *Bitrix24Config) StoreID(warehouse string) (int, bool) {
+	if b.Stock == nil {
+		return 0, false
+	}
+	return mappedID(b.Stock.Warehouses, warehouse)
+}
+
+// StockCurrency returns the currency of the documents that adjust store
+// quantities.
+func (b *Bitrix24Config) StockCurrency() string {
+	if b.Stock == nil || b.Stock.Currency == "" {
+		return "EUR"
+	}
+	return b.Stock.Currency
+}
+
+// PriceTypeID returns the ID of the Bitrix24 price type a Sage price band
+// is mapped to. Price band names are matched without regard to case.
+func (b *Bitrix24Config) PriceTypeID(priceBand string) (int, bool) {
+	if b.Pricing == nil {
+		return 0, false
+	}
+	return mappedID(b.Pricing.PriceTypes, priceBand)
+}
+
+// PriceCurrency returns the currency of the prices written to price types.
+func (b *Bitrix24Config) PriceCurrency() string {
+	if b.Pricing == nil || b.Pricing.Currency == "" {
+		return "EUR"
+	}
+	return b.Pricing.Currency
+}
+
+// mappedID looks up name in a map of names to positive numeric IDs
+// without regard to case.
+func mappedID(ids map[string]string, name string) (int, bool) {
+	for key, value := range ids {
+		if strings.EqualFold(strings.TrimSpace(key), strings.TrimSpace(name)) {
+			id, err := strconv.Atoi(value)
+			return id, err == nil && id > 0
+		}
+	}
+	return 0, false
+}
+
+// DealCategory returns the ID of the pipeline deals are created in.
+func (b *Bitrix24Config) DealCategory() int {
+	if b.Deals == nil {
+		return 0
+	}
+	return b.Deals.CategoryID
+}
+
+// DealStage returns the stage ID of the deal of a Sage document of the
+// given type and status. The most specific configured mapping wins, then
+// the defaults; stages of other pipelines than the default one get their
+// "C<category>:" prefix.
+func (b *Bitrix24Config) DealStage(docType, status string) string {
+	var configured map[string]string
+	if b.Deals != nil {
+		configured = b.Deals.Stages
+	}
+
+	stage := ""
+	for _, stages := range []map[string]string{configured, defaultDealStages} {
+		for _, key := range []string{docType + ":" + status, status, docType} {
+			if stage = stages[key]; stage != "" {
+				break
+			}
+		}
+		if stage != "" {
+			break
+		}
+	}
+
+	return b.categoryStage(stage)
+}
+
+// DealWonStage returns the stage ID whose deals become Sage sales orders
+// when DealSettings.CreateOrders is set.
+func (b *Bitrix24Config) DealWonStage() string {
+	if b.Deals == nil || b.Deals.WonStage == "" {
+		return b.categoryStage("WON")
+	}
+	return b.categoryStage(b.Deals.WonStage)
+}
+
+// categoryStage prefixes a stage ID with "C<category>:" when deals are in
+// another pipeline than the default one.
+func (b *Bitrix24Config) categoryStage(stage string) string {
+	if category := b.DealCategory(); category > 0 && stage != "" && !strings.Contains(stage, ":") {
+		return fmt.Sprintf("C%d:%s", category, stage)
+	}
+	return stage
+}
+
+// GetOAuthServer returns the Bitrix24 OAuth server URL.
+func (o *Bitrix24OAuthConfig) GetOAuthServer() string {
+	if o.OAuthServer == "" {
+		return "https://oauth.bitrix.info"
+	}
+	return strings.TrimSuffix(o.OAuthServer, "/")
 }
 
 // TickeliaConfig contains Tickelia integration settings.
@@ -51,6 +321,11 @@ type SyncSettings struct {
 	IntervalMinutes int      `json:"interval_minutes" mapstructure:"interval_minutes"`
 	EnabledModules  []string `json:"enabled_modules" mapstructure:"enabled_modules"`
 	LogLevel        string   `json:"log_level" mapstructure:"log_level"`
+	LogFormat       string   `json:"log_format,omitempty" mapstructure:"log_format"` // "json" or "logfmt"
+	DryRun          bool     `json:"dry_run,omitempty" mapstructure:"dry_run"`
+	MetricsAddr     string   `json:"metrics_addr,omitempty" mapstructure:"metrics_addr"` // e.g. "127.0.0.1:9464"; empty disables /metrics
+	ControlAddr     string   `json:"control_addr,omitempty" mapstructure:"control_addr"` // loopback address of the control API; empty disables it
+	ControlToken    string   `json:"control_token,omitempty" mapstructure:"control_token"`
 }
 
 // SaaSConnection contains connection details for the SaaS platform.
@@ -61,21 +336,75 @@ type SaaSConnection struct {
 	TLSEnabled bool   `json:"tls_enabled" mapstructure:"tls_enabled"`
 }
 
-// GetSageConnectionsTring returns the SQL Server connection string.
+// GetSageConnectionString returns the SQL Server connection string. It is
+// built in URL form so every value is escaped by net/url and passwords may
+// contain any character.
 func (db *DatabaseConfig) GetSageConnectionString() string {
-	// Handle SQL Server named instance format.
-	host := db.Host
-	if host == "" {
-		host = db.HostSage
+	host, instance := db.ServerAddress()
+
+	u := &url.URL{
+		Scheme: "sqlserver",
+		Host:   host,
+	}
+
+	// The SQL Browser resolves the port of a named instance, and an explicit
+	// port would bypass it.
+	if instance != "" {
+		u.Path = "/" + instance
+	} else if db.Port != "" {
+		u.Host = net.JoinHostPort(host, db.Port)
 	}
 
-	return fmt.Sprintf("server=%s;port=%s;database=%s;user id=%s;password=%s;encrypt=false",
-		host, db.Port, db.Database, db.Username, db.Password)
+	// Without credentials the driver falls back to integrated (SSPI) auth.
+	if !db.IntegratedAuth {
+		u.User = url.UserPassword(db.Username, db.Password)
+	}
+
+	query := url.Values{}
+	query.Set("database", db.Database)
+	query.Set("encrypt", db.EncryptMode())
+	if db.TrustServerCertificate {
+		query.Set("TrustServerCertificate", "true")
+	}
+	if db.CertificatePath != "" {
+		query.Set("certificate", db.CertificatePath)
+	}
+	if db.HostNameInCertificate != "" {
+		query.Set("hostNameInCertificate", db.HostNameInCertificate)
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+// ServerAddress returns the host and optional instance name to connect to.
+// DB_Host_Sage takes precedence when it names an instance ("SERVER\SAGE").
+func (db *DatabaseConfig) ServerAddress() (host, instance string) {
+	server := db.Host
+	if server == "" || strings.Contains(db.HostSage, `\`) {
+		server = db.HostSage
+	}
+
+	host, instance, _ = strings.Cut(server, `\`)
+	return host, instance
+}
+
+// EncryptMode returns the configured encryption mode, defaulting to
+// encrypting the login packet only.
+func (db *DatabaseConfig) EncryptMode() string {
+	if db.Encrypt == "" {
+		return EncryptFalse
+	}
+	return strings.ToLower(db.Encrypt)
 }
 
 // IsValid checks if the database configuration is complete.
 func (db *DatabaseConfig) IsValid() bool {
-	return db.Host != "" && db.Database != "" && db.Username != "" && db.Password != ""
+	host, _ := db.ServerAddress()
+	if host == "" || db.Database == "" {
+		return false
+	}
+	return db.IntegratedAuth || (db.Username != "" && db.Password != "")
 }
 
 // GetSaaSURL returns the complete SaaS API URL.
@@ -104,6 +433,10 @@ type SyncResult struct {
 	ClientID     string    `json:"client_id"`
 	Success      bool      `json:"success"`
 	RecordsCount int       `json:"records_count"`
+	SkippedCount int       `json:"skipped_count"`
+	RetriedCount int       `json:"retried_count"`
+	FailedCount  int       `json:"failed_count"`
+	FlaggedCount int       `json:"flagged_count"` // parked for a person to review
 	ErrorMessage string    `json:"error_message,omitempty"`
 	CompletedAt  time.Time `json:"completed_at"`
 }
@@ -115,13 +448,228 @@ type Customer struct {
 	Name         string    `json:"name"`
 	Email        string    `json:"email"`
 	Phone        string    `json:"phone"`
+	Fax          string    `json:"fax,omitempty"`
 	Address      string    `json:"address"`
 	City         string    `json:"city"`
 	PostalCode   string    `json:"postal_code"`
 	Country      string    `json:"country"`
+	Addresses    []Address `json:"addresses,omitempty"` // fiscal and delivery addresses
+	ModifiedDate time.Time `json:"modified_date"`
+}
+
+// Risk statuses of a customer, from the most to the least severe.
+const (
+	RiskOnHold    = "on_hold"    // account on hold in Sage
+	RiskOverdue   = "overdue"    // has amounts past their due date
+	RiskOverLimit = "over_limit" // balance above the credit limit
+	RiskOK        = "ok"
+)
+
+// CustomerBalance is the outstanding balance and credit data of a Sage
+// customer.
+type CustomerBalance struct {
+	CustomerCode string  `json:"customer_code"`
+	Balance      float64 `json:"balance"`      // outstanding balance
+	Overdue      float64 `json:"overdue"`      // outstanding amount past its due date
+	CreditLimit  float64 `json:"credit_limit"` // 0 when the customer has no limit
+	OnHold       bool    `json:"on_hold"`
+}
+
+// Risk returns the most severe risk status that applies to the customer.
+func (b *CustomerBalance) Risk() string {
+	switch {
+	case b.OnHold:
+		return RiskOnHold
+	case b.Overdue > 0:
+		return RiskOverdue
+	case b.CreditLimit > 0 && b.Balance > b.CreditLimit:
+		return RiskOverLimit
+	}
+	return RiskOK
+}
+
+// Types of customer addresses.
+const (
+	AddressFiscal   = "fiscal"   // main address, used for invoicing
+	AddressDelivery = "delivery" // delivery location
+)
+
+// Address is a structured postal address of a Sage customer.
+type Address struct {
+	ID           string    `json:"id"` // Sage postal address ID
+	CustomerCode string    `json:"customer_code"`
+	Type         string    `json:"type"`           // AddressFiscal or AddressDelivery
+	Name         string    `json:"name,omitempty"` // delivery location name
+	Line1        string    `json:"line1"`
+	Line2        string    `json:"line2,omitempty"`
+	City         string    `json:"city"`
+	PostalCode   string    `json:"postal_code"`
+	Region       string    `json:"region,omitempty"`
+	Country      string    `json:"country"`
+	ModifiedDate time.Time `json:"modified_date"`
+}
+
+// Types of Sage sales documents.
+const (
+	DocumentOrder = "order"
+	DocumentQuote = "quote"
+)
+
+// Statuses of Sage sales documents.
+const (
+	DocumentLive      = "live"      // open, not yet fully dispatched or converted
+	DocumentComplete  = "complete"  // dispatched, or quote converted to an order
+	DocumentCancelled = "cancelled" // cancelled, or quote lost
+	DocumentHeld      = "held"      // on hold
+)
+
+// SalesOrder represents a Sage sales order or quote.
+type SalesOrder struct {
+	ID           string           `json:"id"`
+	Number       string           `json:"number"`
+	Type         string           `json:"type"`   // DocumentOrder or DocumentQuote
+	Status       string           `json:"status"` // DocumentLive, DocumentComplete, ...
+	CustomerCode string           `json:"customer_code"`
+	Date         time.Time        `json:"date"`
+	Currency     string           `json:"currency,omitempty"`  // ISO 4217
+	Reference    string           `json:"reference,omitempty"` // customer document number
+	NetAmount    float64          `json:"net_amount"`
+	TaxAmount    float64          `json:"tax_amount"`
+	TotalAmount  float64          `json:"total_amount"`
+	Lines        []SalesOrderLine `json:"lines,omitempty"`
+	ModifiedDate time.Time        `json:"modified_date"`
+}
+
+// SalesOrderLine is a line of a Sage sales order or quote.
+type SalesOrderLine struct {
+	ProductCode string  `json:"product_code,omitempty"`
+	Description string  `json:"description"`
+	Quantity    float64 `json:"quantity"`
+	UnitPrice   float64 `json:"unit_price"`         // before discount and tax
+	Discount    float64 `json:"discount,omitempty"` // percent
+	TaxRate     float64 `json:"tax_rate,omitempty"` // percent
+}
+
+// ContactPerson represents a contact person (persona de contacto) of a Sage
+// customer.
+type ContactPerson struct {
+	ID           string    `json:"id"`
+	CustomerCode string    `json:"customer_code"`
+	FirstName    string    `json:"first_name"`
+	LastName     string    `json:"last_name"`
+	Position     string    `json:"position,omitempty"`
+	Phone        string    `json:"phone,omitempty"`
+	Mobile       string    `json:"mobile,omitempty"`
+	Email        string    `json:"email,omitempty"`
+	ModifiedDate time.Time `json:"modified_date"`
+}
+
+// Supplier represents a Sage supplier (proveedor) account.
+type Supplier struct {
+	ID           string    `json:"id"`
+	Code         string    `json:"code"`
+	Name         string    `json:"name"`
+	TaxNumber    string    `json:"tax_number,omitempty"` // NIF/CIF
+	Email        string    `json:"email,omitempty"`
+	Phone        string    `json:"phone,omitempty"`
+	Address      string    `json:"address,omitempty"`
+	City         string    `json:"city,omitempty"`
+	PostalCode   string    `json:"postal_code,omitempty"`
+	Country      string    `json:"country,omitempty"`
+	ModifiedDate time.Time `json:"modified_date"`
+}
+
+// StockLevel is the quantity in stock of a Sage product in one warehouse.
+type StockLevel struct {
+	ProductCode  string    `json:"product_code"`
+	Warehouse    string    `json:"warehouse"`
+	Quantity     float64   `json:"quantity"`
+	ModifiedDate time.Time `json:"modified_date"`
+}
+
+// ProductPrice is the price of a Sage product in one price band.
+type ProductPrice struct {
+	ProductCode  string    `json:"product_code"`
+	PriceBand    string    `json:"price_band"`
+	Price        float64   `json:"price"`
 	ModifiedDate time.Time `json:"modified_date"`
 }
 
+// CustomerPricing is the price band a Sage customer buys at and the
+// discounts it is granted on top of it.
+type CustomerPricing struct {
+	CustomerCode string         `json:"customer_code"`
+	PriceBand    string         `json:"price_band"`
+	Discounts    []DiscountRule `json:"discounts,omitempty"`
+}
+
+// DiscountRule is a discount granted to a customer on a product group, or
+// on every product when ProductGroup is empty.
+type DiscountRule struct {
+	ProductGroup string  `json:"product_group,omitempty"`
+	Percent      float64 `json:"percent"`
+}
+
+// Collection statuses of the invoices of a sales order.
+const (
+	CollectionPending = "pending" // nothing collected yet
+	CollectionPartial = "partial" // partly collected
+	CollectionPaid    = "paid"    // fully collected
+)
+
+// Receivable is a Sage receivable (efecto): an invoice, or one instalment
+// of it, to be collected from a customer.
+type Receivable struct {
+	ID            string    `json:"id"`
+	CustomerCode  string    `json:"customer_code"`
+	InvoiceNumber string    `json:"invoice_number"`
+	OrderID       string    `json:"order_id,omitempty"` // sales order the invoice was raised from
+	DueDate       time.Time `json:"due_date"`
+	Amount        float64   `json:"amount"`
+	Outstanding   float64   `json:"outstanding"` // amount still to collect
+	ModifiedDate  time.Time `json:"modified_date"`
+}
+
+// Paid reports whether the receivable has been collected in full.
+func (r *Receivable) Paid() bool {
+	return r.Outstanding < 0.005
+}
+
+// CollectionSummary is the collection state of a set of receivables.
+type CollectionSummary struct {
+	Amount      float64   `json:"amount"`
+	Outstanding float64   `json:"outstanding"`
+	NextDueDate time.Time `json:"next_due_date,omitempty"` // earliest due date not collected, zero when paid
+	Status      string    `json:"status"`
+}
+
+// SummarizeReceivables totals receivables and derives their collection
+// status from the amount still outstanding.
+func SummarizeReceivables(receivables []Receivable) CollectionSummary {
+	var summary CollectionSummary
+	for i := range receivables {
+		receivable := &receivables[i]
+		summary.Amount += receivable.Amount
+		if receivable.Paid() {
+			continue
+		}
+		summary.Outstanding += receivable.Outstanding
+		if summary.NextDueDate.IsZero() || receivable.DueDate.Before(summary.NextDueDate) {
+			summary.NextDueDate = receivable.DueDate
+		}
+	}
+
+	switch {
+	case summary.Outstanding < 0.005:
+		summary.Status = CollectionPaid
+	case summary.Outstanding < summary.Amount:
+		summary.Status = CollectionPartial
+	default:
+		summary.Status = CollectionPending
+	}
+	return summary
+}
+
 // Invoice represents a Sage invoice record.
 type Invoice struct {
 	ID           string    `json:"id"`
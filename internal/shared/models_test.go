@@ -0,0 +1,141 @@
+package shared
+
+import (
+	"testing"
+	"time"
+
+	"github.com/microsoft/go-mssqldb/msdsn"
+)
+
+func TestGetSageConnectionString(t *testing.T) {
+	tests := []struct {
+		name   string
+		db     DatabaseConfig
+		want   msdsn.Config
+		noUser bool
+	}{
+		{
+			name: "password with separators",
+			db:   DatabaseConfig{Host: "sage01", Port: "1433", Database: "Sage200", Username: "sync", Password: "a;b@c%d/e"},
+			want: msdsn.Config{Host: "sage01", Port: 1433, Database: "Sage200", User: "sync", Password: "a;b@c%d/e",
+				Encryption: msdsn.EncryptionOff},
+		},
+		{
+			name: "named instance ignores the port",
+			db:   DatabaseConfig{HostSage: `sage01\SAGE200`, Port: "1433", Database: "Sage200", Username: "sync", Password: "pw"},
+			want: msdsn.Config{Host: "sage01", Instance: "SAGE200", Database: "Sage200", User: "sync", Password: "pw",
+				Encryption: msdsn.EncryptionOff},
+		},
+		{
+			name: "named instance in HostSage wins over Host",
+			db:   DatabaseConfig{Host: "10.0.0.5", HostSage: `SAGESRV\SAGEEXPRESS`, Database: "Sage200", Username: "sync", Password: "pw"},
+			want: msdsn.Config{Host: "SAGESRV", Instance: "SAGEEXPRESS", Database: "Sage200", User: "sync", Password: "pw",
+				Encryption: msdsn.EncryptionOff},
+		},
+		{
+			name: "encrypt disable",
+			db:   DatabaseConfig{Host: "sage01", Database: "Sage200", Username: "sync", Password: "pw", Encrypt: EncryptDisable},
+			want: msdsn.Config{Host: "sage01", Database: "Sage200", User: "sync", Password: "pw", Encryption: msdsn.EncryptionDisabled},
+		},
+		{
+			name: "encrypt false",
+			db:   DatabaseConfig{Host: "sage01", Database: "Sage200", Username: "sync", Password: "pw", Encrypt: EncryptFalse},
+			want: msdsn.Config{Host: "sage01", Database: "Sage200", User: "sync", Password: "pw", Encryption: msdsn.EncryptionOff},
+		},
+		{
+			name: "encrypt true",
+			db: DatabaseConfig{Host: "sage01", Database: "Sage200", Username: "sync", Password: "pw", Encrypt: "TRUE",
+				TrustServerCertificate: true},
+			want: msdsn.Config{Host: "sage01", Database: "Sage200", User: "sync", Password: "pw", Encryption: msdsn.EncryptionRequired},
+		},
+		{
+			name: "encrypt strict",
+			db: DatabaseConfig{Host: "sage01", Database: "Sage200", Username: "sync", Password: "pw", Encrypt: EncryptStrict,
+				HostNameInCertificate: "sage01.example.local"},
+			want: msdsn.Config{Host: "sage01", Database: "Sage200", User: "sync", Password: "pw", Encryption: msdsn.EncryptionStrict},
+		},
+		{
+			name: "integrated auth leaves out credentials",
+			db: DatabaseConfig{HostSage: `sage01\SAGE200`, Database: "Sage200", Username: "ignored", Password: "ignored",
+				IntegratedAuth: true},
+			want:   msdsn.Config{Host: "sage01", Instance: "SAGE200", Database: "Sage200", Encryption: msdsn.EncryptionOff},
+			noUser: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dsn := tt.db.GetSageConnectionString()
+			got, err := msdsn.Parse(dsn)
+			if err != nil {
+				t.Fatalf("driver rejected %q: %v", dsn, err)
+			}
+
+			if got.Host != tt.want.Host || got.Instance != tt.want.Instance || got.Port != tt.want.Port ||
+				got.Database != tt.want.Database || got.Encryption != tt.want.Encryption {
+				t.Errorf("%q parsed as host %q instance %q port %d database %q encryption %d",
+					dsn, got.Host, got.Instance, got.Port, got.Database, got.Encryption)
+			}
+			if got.User != tt.want.User || got.Password != tt.want.Password {
+				t.Errorf("%q parsed as user %q password %q, want %q %q",
+					dsn, got.User, got.Password, tt.want.User, tt.want.Password)
+			}
+			if tt.noUser && (got.User != "" || got.Password != "") {
+				t.Errorf("%q carries credentials, want integrated auth", dsn)
+			}
+			if tt.db.TrustServerCertificate && (got.TLSConfig == nil || !got.TLSConfig.InsecureSkipVerify) {
+				t.Errorf("%q does not trust the server certificate", dsn)
+			}
+			if name := tt.db.HostNameInCertificate; name != "" && (got.TLSConfig == nil || got.TLSConfig.ServerName != name) {
+				t.Errorf("%q does not check the certificate for %s", dsn, name)
+			}
+		})
+	}
+}
+
+func TestDatabaseConfigIsValid(t *testing.T) {
+	tests := []struct {
+		name string
+		db   DatabaseConfig
+		want bool
+	}{
+		{"sql auth", DatabaseConfig{Host: "sage01", Database: "Sage200", Username: "sync", Password: "pw"}, true},
+		{"missing password", DatabaseConfig{Host: "sage01", Database: "Sage200", Username: "sync"}, false},
+		{"integrated auth", DatabaseConfig{HostSage: `sage01\SAGE200`, Database: "Sage200", IntegratedAuth: true}, true},
+		{"missing host", DatabaseConfig{Database: "Sage200", IntegratedAuth: true}, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.db.IsValid(); got != tt.want {
+			t.Errorf("%s: IsValid = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSummarizeReceivables(t *testing.T) {
+	due := time.Date(2026, 11, 30, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		receivables []Receivable
+		status      string
+		outstanding float64
+	}{
+		{"pending", []Receivable{{Amount: 100, Outstanding: 100, DueDate: due}}, CollectionPending, 100},
+		{"partial", []Receivable{
+			{Amount: 60, Outstanding: 0, DueDate: due.AddDate(0, -1, 0)},
+			{Amount: 40, Outstanding: 40, DueDate: due},
+		}, CollectionPartial, 40},
+		{"paid", []Receivable{{Amount: 100, Outstanding: 0.001, DueDate: due}}, CollectionPaid, 0},
+		{"outstanding without due date", []Receivable{{Amount: 100, Outstanding: 100}}, CollectionPending, 100},
+		{"none", nil, CollectionPaid, 0},
+	}
+
+	for _, tt := range tests {
+		summary := SummarizeReceivables(tt.receivables)
+		if summary.Status != tt.status || summary.Outstanding != tt.outstanding {
+			t.Errorf("%s: status %q outstanding %.2f, want %q %.2f",
+				tt.name, summary.Status, summary.Outstanding, tt.status, tt.outstanding)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package shared
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// secretPrefix marks a configuration value as encrypted. The full format is
+// "enc:<scheme>:<base64 ciphertext>".
+const secretPrefix = "enc:"
+
+// secretKeyFileName is the name of the AES-GCM key file kept next to the
+// configuration when no OS-level protection is available.
+const secretKeyFileName = "secret.key"
+
+// SecretStore protects configuration secrets at rest.
+type SecretStore interface {
+	// Scheme identifies the store in encrypted values.
+	Scheme() string
+	Protect(plaintext []byte) ([]byte, error)
+	Unprotect(ciphertext []byte) ([]byte, error)
+}
+
+// SecretCodec encrypts secrets with a preferred store and decrypts values
+// produced by any of the stores it knows about.
+type SecretCodec struct {
+	preferred SecretStore
+	stores    map[string]SecretStore
+}
+
+// NewSecretCodec creates a codec for the given configuration directory. The
+// platform store (DPAPI on Windows) is preferred; the AES-GCM file-key store
+// is always available for decryption and used where nothing better exists.
+func NewSecretCodec(dir string) *SecretCodec {
+	fileStore := NewFileKeyStore(filepath.Join(dir, secretKeyFileName))
+
+	codec := &SecretCodec{
+		preferred: fileStore,
+		stores:    map[string]SecretStore{fileStore.Scheme(): fileStore},
+	}
+
+	if platform := platformSecretStore(); platform != nil {
+		codec.preferred = platform
+		codec.stores[platform.Scheme()] = platform
+	}
+
+	return codec
+}
+
+// IsEncryptedSecret reports whether value carries the encrypted secret prefix.
+func IsEncryptedSecret(value string) bool {
+	return strings.HasPrefix(value, secretPrefix)
+}
+
+// Encrypt returns the encrypted form of value. Empty and already encrypted
+// values are returned unchanged.
+func (sc *SecretCodec) Encrypt(value string) (string, error) {
+	if value == "" || IsEncryptedSecret(value) {
+		return value, nil
+	}
+
+	ciphertext, err := sc.preferred.Protect([]byte(value))
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt secret: %w", err)
+	}
+
+	return secretPrefix + sc.preferred.Scheme() + ":" + base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// Decrypt returns the plain form of value. Values without the encrypted
+// prefix are returned unchanged.
+func (sc *SecretCodec) Decrypt(value string) (string, error) {
+	if !IsEncryptedSecret(value) {
+		return value, nil
+	}
+
+	scheme, encoded, ok := strings.Cut(strings.TrimPrefix(value, secretPrefix), ":")
+	if !ok {
+		return "", fmt.Errorf("malformed encrypted secret")
+	}
+
+	store, ok := sc.stores[scheme]
+	if !ok {
+		return "", fmt.Errorf("unsupported secret scheme %q", scheme)
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode encrypted secret: %w", err)
+	}
+
+	plaintext, err := store.Unprotect(ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret: %w", err)
+	}
+
+	return string(plaintext), nil
+}
+
+// FileKeyStore encrypts secrets with AES-256-GCM using a random key stored
+// in a file readable only by the current user.
+type FileKeyStore struct {
+	keyPath string
+}
+
+// NewFileKeyStore creates a file-key store backed by keyPath.
+func NewFileKeyStore(keyPath string) *FileKeyStore {
+	return &FileKeyStore{keyPath: keyPath}
+}
+
+// Scheme returns the identifier used in encrypted values.
+func (fs *FileKeyStore) Scheme() string {
+	return "aesgcm"
+}
+
+// Protect encrypts plaintext, creating the key file on first use.
+func (fs *FileKeyStore) Protect(plaintext []byte) ([]byte, error) {
+	key, err := fs.loadKey(true)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// Unprotect decrypts ciphertext produced by Protect.
+func (fs *FileKeyStore) Unprotect(ciphertext []byte) ([]byte, error) {
+	key, err := fs.loadKey(false)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+
+	nonce, sealed := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, sealed, nil)
+}
+
+// loadKey reads the key file, generating it when create is set and the file
+// does not exist yet.
+func (fs *FileKeyStore) loadKey(create bool) ([]byte, error) {
+	key, err := os.ReadFile(fs.keyPath)
+	if err == nil {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("invalid key file %s", fs.keyPath)
+		}
+		return key, nil
+	}
+	if !os.IsNotExist(err) || !create {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+
+	key = make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fs.keyPath), 0700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(fs.keyPath, key, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write key file: %w", err)
+	}
+
+	return key, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package shared
+
+// platformSecretStore returns nil on platforms without DPAPI so the AES-GCM
+// file-key store is used instead.
+func platformSecretStore() SecretStore {
+	return nil
+}
@@ -0,0 +1,159 @@
+package shared
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestSecretCodecRoundTrip(t *testing.T) {
+	codec := NewSecretCodec(t.TempDir())
+
+	for _, plain := range []string{"s3cret", "p@ss;word/100%", "contraseña"} {
+		encrypted, err := codec.Encrypt(plain)
+		if err != nil {
+			t.Fatalf("Encrypt(%q): %v", plain, err)
+		}
+		if !IsEncryptedSecret(encrypted) || strings.Contains(encrypted, plain) {
+			t.Errorf("Encrypt(%q) = %q, want an enc: value hiding the secret", plain, encrypted)
+		}
+
+		decrypted, err := codec.Decrypt(encrypted)
+		if err != nil {
+			t.Fatalf("Decrypt(%q): %v", encrypted, err)
+		}
+		if decrypted != plain {
+			t.Errorf("Decrypt = %q, want %q", decrypted, plain)
+		}
+
+		// Encrypted values are not encrypted twice.
+		if again, _ := codec.Encrypt(encrypted); again != encrypted {
+			t.Errorf("Encrypt of an encrypted value = %q, want it unchanged", again)
+		}
+	}
+
+	if got, _ := codec.Encrypt(""); got != "" {
+		t.Errorf("Encrypt(\"\") = %q, want empty", got)
+	}
+	if got, _ := codec.Decrypt("plain"); got != "plain" {
+		t.Errorf("Decrypt(plain) = %q, want it unchanged", got)
+	}
+}
+
+func TestSecretCodecRejectsBadValues(t *testing.T) {
+	codec := NewSecretCodec(t.TempDir())
+
+	for _, value := range []string{"enc:", "enc:unknown:AAAA", "enc:aesgcm:not base64!"} {
+		if _, err := codec.Decrypt(value); err == nil {
+			t.Errorf("Decrypt(%q) succeeded, want an error", value)
+		}
+	}
+}
+
+func TestFileKeyStoreWrongKey(t *testing.T) {
+	dir := t.TempDir()
+	store := NewFileKeyStore(filepath.Join(dir, "a", secretKeyFileName))
+	other := NewFileKeyStore(filepath.Join(dir, "b", secretKeyFileName))
+
+	ciphertext, err := store.Protect([]byte("s3cret"))
+	if err != nil {
+		t.Fatalf("Protect: %v", err)
+	}
+	if _, err := other.Protect([]byte("other")); err != nil {
+		t.Fatalf("Protect with other key: %v", err)
+	}
+
+	if _, err := other.Unprotect(ciphertext); err == nil {
+		t.Error("Unprotect with another key succeeded")
+	}
+	if plain, err := store.Unprotect(ciphertext); err != nil || string(plain) != "s3cret" {
+		t.Errorf("Unprotect = %q, %v", plain, err)
+	}
+
+	// A missing key file is not created when decrypting.
+	missing := NewFileKeyStore(filepath.Join(dir, "c", secretKeyFileName))
+	if _, err := missing.Unprotect(ciphertext); err == nil {
+		t.Error("Unprotect without a key file succeeded")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "c", secretKeyFileName)); !os.IsNotExist(err) {
+		t.Errorf("key file created by Unprotect: %v", err)
+	}
+}
+
+func TestFileKeyStoreKeyFileMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not enforced on Windows")
+	}
+
+	keyPath := filepath.Join(t.TempDir(), secretKeyFileName)
+	if _, err := NewFileKeyStore(keyPath).Protect([]byte("s3cret")); err != nil {
+		t.Fatalf("Protect: %v", err)
+	}
+
+	info, err := os.Stat(keyPath)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("key file mode = %o, want 600", mode)
+	}
+}
+
+func TestLoadConfigMigratesPlainSecrets(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	plain := `{"DB": {"DB_Host": "sage01", "DB_Username": "sync", "DB_Password": "p@ss;word"},
+		"SyncSettings": {"control_token": "tok3n"}}`
+	// An existing world-readable file is tightened when rewritten.
+	if err := os.WriteFile(configPath, []byte(plain), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loader := NewConfigLoader(configPath, "")
+	config, err := loader.LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	if config.Database.Password != "p@ss;word" {
+		t.Errorf("Password = %q, want the plain value", config.Database.Password)
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "p@ss;word") {
+		t.Errorf("config file still holds the plain password: %s", data)
+	}
+	var saved AgentConfig
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncryptedSecret(saved.Database.Password) || saved.Database.Host != "sage01" {
+		t.Errorf("saved DB = %+v, want the password encrypted and the rest kept", saved.Database)
+	}
+	if !IsEncryptedSecret(saved.SyncSettings.ControlToken) {
+		t.Errorf("saved control token = %q, want it encrypted", saved.SyncSettings.ControlToken)
+	}
+
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(configPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mode := info.Mode().Perm(); mode != 0600 {
+			t.Errorf("config file mode = %o, want 600", mode)
+		}
+	}
+
+	// The migrated file loads back to the same secret.
+	reloaded, err := NewConfigLoader(configPath, "").LoadConfig()
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if reloaded.Database.Password != "p@ss;word" {
+		t.Errorf("reloaded Password = %q", reloaded.Database.Password)
+	}
+}
@@ -0,0 +1,57 @@
+//go:build windows
+
+package shared
+
+import (
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// dpapiStore protects secrets with the Windows Data Protection API, scoped
+// to the current user.
+type dpapiStore struct{}
+
+func platformSecretStore() SecretStore {
+	return dpapiStore{}
+}
+
+// Scheme returns the identifier used in encrypted values.
+func (dpapiStore) Scheme() string {
+	return "dpapi"
+}
+
+// Protect encrypts plaintext with CryptProtectData.
+func (dpapiStore) Protect(plaintext []byte) ([]byte, error) {
+	var out windows.DataBlob
+	if err := windows.CryptProtectData(newDataBlob(plaintext), nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out); err != nil {
+		return nil, fmt.Errorf("CryptProtectData failed: %w", err)
+	}
+	return takeDataBlob(&out), nil
+}
+
+// Unprotect decrypts ciphertext with CryptUnprotectData.
+func (dpapiStore) Unprotect(ciphertext []byte) ([]byte, error) {
+	var out windows.DataBlob
+	if err := windows.CryptUnprotectData(newDataBlob(ciphertext), nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out); err != nil {
+		return nil, fmt.Errorf("CryptUnprotectData failed: %w", err)
+	}
+	return takeDataBlob(&out), nil
+}
+
+func newDataBlob(data []byte) *windows.DataBlob {
+	if len(data) == 0 {
+		return &windows.DataBlob{}
+	}
+	return &windows.DataBlob{Size: uint32(len(data)), Data: &data[0]}
+}
+
+// takeDataBlob copies a blob allocated by the system and frees it.
+func takeDataBlob(blob *windows.DataBlob) []byte {
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(blob.Data)))
+
+	data := make([]byte, blob.Size)
+	copy(data, unsafe.Slice(blob.Data, blob.Size))
+	return data
+}